@@ -0,0 +1,143 @@
+// Approvals
+//
+// The Approvals Package implements the four-eyes principle for changes to production:
+// patch campaigns and lock changes are only applied once another user, member of one
+// of the approver groups ('approvals.groups'), approved them. Requests expire after
+// 'approvals.expiry' and every decision is recorded on the request.
+package approvals
+
+import (
+	"errors"
+	"packagelock/structs"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Request kinds.
+const (
+	KindCampaign   = "campaign"
+	KindLockCreate = "lock-create"
+	KindLockUpdate = "lock-update"
+	KindLockDelete = "lock-delete"
+)
+
+// Request states.
+const (
+	StatePending  = "pending"
+	StateApproved = "approved"
+	StateRejected = "rejected"
+	StateExpired  = "expired"
+)
+
+// Decisions.
+const (
+	DecisionApprove = "approve"
+	DecisionReject  = "reject"
+	DecisionExpire  = "expire" // recorded by the server when a request expires
+)
+
+var (
+	// ErrNotPending is returned when deciding on a request which was already decided or expired.
+	ErrNotPending = errors.New("approval request is not pending")
+	// ErrOwnRequest is returned when a user decides on their own request.
+	ErrOwnRequest = errors.New("requesters can't decide on their own request")
+	// ErrNotApprover is returned when a user is in none of the required groups.
+	ErrNotApprover = errors.New("user is not member of an approver group")
+	// ErrAlreadyDecided is returned when a user decides twice on the same request.
+	ErrAlreadyDecided = errors.New("user already decided on this request")
+	// ErrUnknownDecision is returned for decisions other than approve and reject.
+	ErrUnknownDecision = errors.New("decision must be approve or reject")
+)
+
+// IsRequester reports whether a user created the request.
+func IsRequester(request structs.Approval_Request, user structs.User) bool {
+	if request.RequesterID != uuid.Nil && user.UserID != uuid.Nil {
+		return request.RequesterID == user.UserID
+	}
+	return request.Requester == user.Username
+}
+
+// CanDecide checks whether a user may approve or reject a request at the given time.
+func CanDecide(request structs.Approval_Request, user structs.User, now time.Time) error {
+	if request.State != StatePending || !now.Before(request.ExpiresAt) {
+		return ErrNotPending
+	}
+	if IsRequester(request, user) {
+		return ErrOwnRequest
+	}
+
+	member := false
+	for _, required := range request.RequiredGroups {
+		for _, group := range user.Groups {
+			if group == required {
+				member = true
+			}
+		}
+	}
+	if !member {
+		return ErrNotApprover
+	}
+
+	for _, decision := range request.Decisions {
+		if decision.Username == user.Username {
+			return ErrAlreadyDecided
+		}
+	}
+	return nil
+}
+
+// Decide records the decision of a user and updates the state of the request.
+// A single rejection rejects the request, it is approved once it has enough approvals.
+func Decide(request *structs.Approval_Request, user structs.User, decision, comment string, now time.Time) error {
+	if decision != DecisionApprove && decision != DecisionReject {
+		return ErrUnknownDecision
+	}
+	if err := CanDecide(*request, user, now); err != nil {
+		return err
+	}
+
+	request.Decisions = append(request.Decisions, structs.Approval_Decision{
+		UserID:   user.UserID,
+		Username: user.Username,
+		Decision: decision,
+		Comment:  comment,
+		Time:     now,
+	})
+	request.UpdateTime = now
+
+	if decision == DecisionReject {
+		request.State = StateRejected
+		return nil
+	}
+	if approvals(*request) >= request.RequiredApprovals {
+		request.State = StateApproved
+	}
+	return nil
+}
+
+// Expire marks a pending request as expired if it is past its expiry.
+// It reports whether the request changed.
+func Expire(request *structs.Approval_Request, now time.Time) bool {
+	if request.State != StatePending || now.Before(request.ExpiresAt) {
+		return false
+	}
+
+	request.State = StateExpired
+	request.Decisions = append(request.Decisions, structs.Approval_Decision{
+		Decision: DecisionExpire,
+		Time:     now,
+	})
+	request.UpdateTime = now
+	return true
+}
+
+func approvals(request structs.Approval_Request) int {
+	count := 0
+	for _, decision := range request.Decisions {
+		if decision.Decision == DecisionApprove {
+			count++
+		}
+	}
+	return count
+}
@@ -0,0 +1,185 @@
+package approvals
+
+import (
+	"testing"
+	"time"
+
+	"packagelock/structs"
+
+	"github.com/google/uuid"
+)
+
+var (
+	now     = time.Date(2024, 8, 23, 10, 0, 0, 0, time.UTC)
+	alice   = structs.User{UserID: uuid.New(), Username: "alice", Groups: []string{"ops"}}
+	bob     = structs.User{UserID: uuid.New(), Username: "bob", Groups: []string{"admins", "security"}}
+	carol   = structs.User{UserID: uuid.New(), Username: "carol", Groups: []string{"security"}}
+	dave    = structs.User{UserID: uuid.New(), Username: "dave", Groups: []string{"admins"}}
+	mallory = structs.User{UserID: uuid.New(), Username: "mallory", Groups: []string{"dev"}}
+)
+
+// pending is a request by alice which needs the given number of approvals.
+func pending(required int) structs.Approval_Request {
+	return structs.Approval_Request{
+		RequestID:         uuid.New(),
+		Kind:              KindCampaign,
+		RequesterID:       alice.UserID,
+		Requester:         alice.Username,
+		RequiredGroups:    []string{"admins", "security"},
+		RequiredApprovals: required,
+		State:             StatePending,
+		ExpiresAt:         now.Add(time.Hour),
+		CreationTime:      now.Add(-time.Hour),
+	}
+}
+
+func TestCanDecide(t *testing.T) {
+	legacy := pending(1)
+	legacy.RequesterID = uuid.Nil // requests of users created before user IDs existed
+
+	decided := pending(2)
+	decided.Decisions = []structs.Approval_Decision{{UserID: bob.UserID, Username: bob.Username, Decision: DecisionApprove, Time: now}}
+
+	approved := pending(1)
+	approved.State = StateApproved
+
+	cases := []struct {
+		name    string
+		request structs.Approval_Request
+		user    structs.User
+		at      time.Time
+		want    error
+	}{
+		{"approver", pending(1), bob, now, nil},
+		{"member of the second group", pending(1), carol, now, nil},
+		{"own request", pending(1), structs.User{UserID: alice.UserID, Username: "alice-renamed", Groups: []string{"admins"}}, now, ErrOwnRequest},
+		{"own request by username", legacy, structs.User{UserID: uuid.New(), Username: "alice", Groups: []string{"admins"}}, now, ErrOwnRequest},
+		{"user without ID", pending(1), structs.User{Username: "alice", Groups: []string{"admins"}}, now, ErrOwnRequest},
+		{"non-member", pending(1), mallory, now, ErrNotApprover},
+		{"requester is no approver either", pending(1), alice, now, ErrOwnRequest},
+		{"double decision", decided, bob, now, ErrAlreadyDecided},
+		{"second approver", decided, carol, now, nil},
+		{"already approved", approved, carol, now, ErrNotPending},
+		{"just before expiry", pending(1), bob, now.Add(time.Hour - time.Nanosecond), nil},
+		{"at expiry", pending(1), bob, now.Add(time.Hour), ErrNotPending},
+	}
+	for _, tc := range cases {
+		if got := CanDecide(tc.request, tc.user, tc.at); got != tc.want {
+			t.Errorf("CanDecide(%s) = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestDecide(t *testing.T) {
+	type step struct {
+		user     structs.User
+		decision string
+		err      error
+		state    string
+	}
+	cases := []struct {
+		name     string
+		required int
+		steps    []step
+	}{
+		{"single approval", 1, []step{
+			{bob, DecisionApprove, nil, StateApproved},
+			{carol, DecisionApprove, ErrNotPending, StateApproved},
+		}},
+		{"two of three", 2, []step{
+			{bob, DecisionApprove, nil, StatePending},
+			{bob, DecisionApprove, ErrAlreadyDecided, StatePending},
+			{carol, DecisionApprove, nil, StateApproved},
+			{dave, DecisionReject, ErrNotPending, StateApproved},
+		}},
+		{"reject wins", 3, []step{
+			{bob, DecisionApprove, nil, StatePending},
+			{carol, DecisionApprove, nil, StatePending},
+			{dave, DecisionReject, nil, StateRejected},
+		}},
+		{"reject first", 1, []step{
+			{carol, DecisionReject, nil, StateRejected},
+			{bob, DecisionApprove, ErrNotPending, StateRejected},
+		}},
+		{"unknown decision", 1, []step{
+			{bob, "maybe", ErrUnknownDecision, StatePending},
+			{bob, DecisionExpire, ErrUnknownDecision, StatePending},
+		}},
+		{"refused deciders", 1, []step{
+			{alice, DecisionApprove, ErrOwnRequest, StatePending},
+			{mallory, DecisionApprove, ErrNotApprover, StatePending},
+			{bob, DecisionApprove, nil, StateApproved},
+		}},
+	}
+	for _, tc := range cases {
+		request := pending(tc.required)
+		recorded := 0
+		for idx, step := range tc.steps {
+			err := Decide(&request, step.user, step.decision, "", now)
+			if err != step.err {
+				t.Errorf("%s: step %d: Decide(%s, %s) = %v, want %v", tc.name, idx, step.user.Username, step.decision, err, step.err)
+			}
+			if request.State != step.state {
+				t.Errorf("%s: step %d: state %q, want %q", tc.name, idx, request.State, step.state)
+			}
+			if err == nil {
+				recorded++
+			}
+			if len(request.Decisions) != recorded {
+				t.Errorf("%s: step %d: %d decisions recorded, want %d", tc.name, idx, len(request.Decisions), recorded)
+			}
+		}
+	}
+
+	request := pending(1)
+	if err := Decide(&request, bob, DecisionApprove, "looks good", now); err != nil {
+		t.Fatal(err)
+	}
+	decision := request.Decisions[0]
+	if decision.UserID != bob.UserID || decision.Username != "bob" || decision.Comment != "looks good" || !decision.Time.Equal(now) {
+		t.Errorf("recorded decision = %+v", decision)
+	}
+	if !request.UpdateTime.Equal(now) {
+		t.Errorf("UpdateTime = %v, want %v", request.UpdateTime, now)
+	}
+}
+
+func TestExpire(t *testing.T) {
+	approved := pending(1)
+	approved.State = StateApproved
+
+	cases := []struct {
+		name    string
+		request structs.Approval_Request
+		at      time.Time
+		changed bool
+		state   string
+	}{
+		{"before expiry", pending(1), now.Add(time.Hour - time.Nanosecond), false, StatePending},
+		{"at expiry", pending(1), now.Add(time.Hour), true, StateExpired},
+		{"after expiry", pending(1), now.Add(2 * time.Hour), true, StateExpired},
+		{"already decided", approved, now.Add(2 * time.Hour), false, StateApproved},
+	}
+	for _, tc := range cases {
+		request := tc.request
+		if got := Expire(&request, tc.at); got != tc.changed {
+			t.Errorf("Expire(%s) = %t, want %t", tc.name, got, tc.changed)
+		}
+		if request.State != tc.state {
+			t.Errorf("Expire(%s): state %q, want %q", tc.name, request.State, tc.state)
+		}
+		if tc.changed {
+			last := request.Decisions[len(request.Decisions)-1]
+			if last.Decision != DecisionExpire || !last.Time.Equal(tc.at) {
+				t.Errorf("Expire(%s): recorded %+v, want an expire decision", tc.name, last)
+			}
+		}
+	}
+
+	// An expired request can't be decided on anymore
+	request := pending(1)
+	Expire(&request, now.Add(time.Hour))
+	if err := Decide(&request, bob, DecisionApprove, "", now); err != ErrNotPending {
+		t.Errorf("Decide on an expired request = %v, want ErrNotPending", err)
+	}
+}
@@ -0,0 +1,337 @@
+package approvals
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"packagelock/campaign"
+	"packagelock/db"
+	"packagelock/locks"
+	"packagelock/structs"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/spf13/viper"
+	"github.com/surrealdb/surrealdb.go"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+// ServiceParams holds the dependencies of the Service.
+type ServiceParams struct {
+	fx.In
+
+	Lifecycle fx.Lifecycle
+	Logger    *zap.Logger
+	Config    *viper.Viper
+	DB        *db.Database
+	Campaigns *campaign.Dispatcher
+}
+
+// Service stores approval requests and applies the requested change once approved.
+// Pending requests are expired periodically ('approvals.sweep-interval').
+type Service struct {
+	logger    *zap.Logger
+	db        *db.Database
+	campaigns *campaign.Dispatcher
+	enabled   bool
+	groups    []string
+	required  int
+	expiry    time.Duration
+
+	// mu serializes decisions, so a request is never applied twice
+	mu sync.Mutex
+}
+
+// NewService creates the approval Service and schedules the expiry sweep.
+func NewService(params ServiceParams) *Service {
+	service := &Service{
+		logger:    params.Logger,
+		db:        params.DB,
+		campaigns: params.Campaigns,
+		enabled:   params.Config.GetBool("approvals.enabled"),
+		groups:    params.Config.GetStringSlice("approvals.groups"),
+		required:  params.Config.GetInt("approvals.required"),
+		expiry:    params.Config.GetDuration("approvals.expiry"),
+	}
+	if service.required < 1 {
+		service.required = 1
+	}
+
+	interval := params.Config.GetDuration("approvals.sweep-interval")
+	if !service.enabled || interval <= 0 {
+		return service
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	params.Lifecycle.Append(fx.Hook{
+		OnStart: func(context.Context) error {
+			go service.sweep(ctx, interval)
+			return nil
+		},
+		OnStop: func(context.Context) error {
+			cancel()
+			return nil
+		},
+	})
+
+	return service
+}
+
+// Enabled reports whether campaigns and lock changes need approval.
+func (s *Service) Enabled() bool {
+	return s.enabled
+}
+
+// Request stores a new pending approval request.
+func (s *Service) Request(kind string, subjectID uuid.UUID, summary string, lock *structs.Lock, requester structs.User) (structs.Approval_Request, error) {
+	now := time.Now()
+	request := structs.Approval_Request{
+		RequestID:         uuid.New(),
+		Kind:              kind,
+		SubjectID:         subjectID,
+		Summary:           summary,
+		Lock:              lock,
+		RequesterID:       requester.UserID,
+		Requester:         requester.Username,
+		RequiredGroups:    s.groups,
+		RequiredApprovals: s.required,
+		State:             StatePending,
+		Decisions:         []structs.Approval_Decision{},
+		ExpiresAt:         now.Add(s.expiry),
+		CreationTime:      now,
+		UpdateTime:        now,
+	}
+
+	created, err := surrealdb.SmartUnmarshal[[]structs.Approval_Request](s.db.DB.Create("approval_requests", request))
+	if err != nil {
+		return request, err
+	}
+	if len(created) == 0 {
+		return request, errors.New("approval request was not created")
+	}
+
+	s.logger.Info("Requested approval",
+		zap.String("RequestID", request.RequestID.String()),
+		zap.String("kind", kind),
+		zap.String("requester", requester.Username),
+	)
+	return created[0], nil
+}
+
+// Find returns the approval request with the given RequestID or nil if there is none.
+// Requests past their expiry are expired first.
+func (s *Service) Find(requestID uuid.UUID) (*structs.Approval_Request, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	request, err := s.find(requestID)
+	if err != nil || request == nil {
+		return request, err
+	}
+	if Expire(request, time.Now()) {
+		s.finish(request)
+	}
+	return request, nil
+}
+
+// List returns all approval requests, or those in the given state, newest first.
+func (s *Service) List(state string) ([]structs.Approval_Request, error) {
+	s.ExpireAll(time.Now())
+
+	query := "SELECT * FROM approval_requests ORDER BY CreationTime DESC"
+	if state != "" {
+		query = "SELECT * FROM approval_requests WHERE State = $state ORDER BY CreationTime DESC"
+	}
+	requests, err := surrealdb.SmartUnmarshal[[]structs.Approval_Request](s.db.DB.Query(query, map[string]interface{}{
+		"state": state,
+	}))
+	if err != nil {
+		return nil, err
+	}
+	if requests == nil {
+		requests = []structs.Approval_Request{}
+	}
+	return requests, nil
+}
+
+// Decide records the decision of a user. If it approves or rejects the request,
+// the requested change is applied or dropped right away.
+func (s *Service) Decide(requestID uuid.UUID, user structs.User, decision, comment string) (*structs.Approval_Request, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	request, err := s.find(requestID)
+	if err != nil || request == nil {
+		return request, err
+	}
+
+	now := time.Now()
+	if Expire(request, now) {
+		s.finish(request)
+		return request, ErrNotPending
+	}
+
+	if err := Decide(request, user, decision, comment, now); err != nil {
+		return request, err
+	}
+	s.logger.Info("Recorded approval decision",
+		zap.String("RequestID", request.RequestID.String()),
+		zap.String("user", user.Username),
+		zap.String("decision", decision),
+	)
+
+	if request.State == StatePending {
+		return request, s.save(request)
+	}
+	s.finish(request)
+	return request, nil
+}
+
+// ExpireAll expires all pending requests past their expiry.
+func (s *Service) ExpireAll(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	expired, err := surrealdb.SmartUnmarshal[[]structs.Approval_Request](s.db.DB.Query(
+		"SELECT * FROM approval_requests WHERE State = $state AND ExpiresAt <= $now",
+		map[string]interface{}{"state": StatePending, "now": now},
+	))
+	if err != nil {
+		s.logger.Warn("Failed to fetch expired approval requests", zap.Error(err))
+		return
+	}
+
+	for i := range expired {
+		if Expire(&expired[i], now) {
+			s.finish(&expired[i])
+		}
+	}
+}
+
+func (s *Service) sweep(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			s.ExpireAll(now)
+		}
+	}
+}
+
+func (s *Service) find(requestID uuid.UUID) (*structs.Approval_Request, error) {
+	found, err := surrealdb.SmartUnmarshal[[]structs.Approval_Request](s.db.DB.Query(
+		"SELECT * FROM approval_requests WHERE RequestID = $requestID LIMIT 1",
+		map[string]interface{}{"requestID": requestID.String()},
+	))
+	if err != nil || len(found) == 0 {
+		return nil, err
+	}
+	return &found[0], nil
+}
+
+func (s *Service) save(request *structs.Approval_Request) error {
+	_, err := s.db.DB.Update(request.ID, request)
+	return err
+}
+
+// finish applies or drops the change of a decided request and stores the request.
+func (s *Service) finish(request *structs.Approval_Request) {
+	if err := s.apply(request); err != nil {
+		request.ApplyError = err.Error()
+		s.logger.Warn("Failed to apply approval request",
+			zap.String("RequestID", request.RequestID.String()),
+			zap.String("kind", request.Kind),
+			zap.Error(err),
+		)
+	}
+
+	if err := s.save(request); err != nil {
+		s.logger.Warn("Cannot update approval request in DB", zap.String("RequestID", request.RequestID.String()), zap.Error(err))
+	}
+	s.logger.Info("Approval request decided",
+		zap.String("RequestID", request.RequestID.String()),
+		zap.String("state", request.State),
+	)
+}
+
+func (s *Service) apply(request *structs.Approval_Request) error {
+	now := time.Now()
+
+	if request.Kind == KindCampaign {
+		pending := structs.Campaign{CampaignID: request.SubjectID}
+		if request.State == StateApproved {
+			_, err := s.campaigns.Approve(pending, now)
+			return err
+		}
+		_, err := s.campaigns.Reject(pending, "approval "+request.State, now)
+		return err
+	}
+
+	// Lock changes are simply never applied unless approved
+	if request.State != StateApproved {
+		return nil
+	}
+	if request.Lock == nil {
+		return fmt.Errorf("request has no lock")
+	}
+
+	switch request.Kind {
+	case KindLockCreate:
+		if err := locks.Validate(*request.Lock); err != nil {
+			return err
+		}
+		created, err := locks.Create(s.db, *request.Lock)
+		if err != nil {
+			return err
+		}
+		request.SubjectID = created.LockID
+		return s.reevaluate(created)
+
+	case KindLockUpdate, KindLockDelete:
+		existing, err := locks.FindByLockID(s.db, request.SubjectID)
+		if err != nil {
+			return err
+		}
+		if existing == nil {
+			return fmt.Errorf("lock %s does not exist anymore", request.SubjectID)
+		}
+
+		if request.Kind == KindLockDelete {
+			if err := locks.Delete(s.db, *existing); err != nil {
+				return err
+			}
+			return s.reevaluate(*existing)
+		}
+
+		if err := locks.Validate(*request.Lock); err != nil {
+			return err
+		}
+		updated, err := locks.Update(s.db, *existing, *request.Lock)
+		if err != nil {
+			return err
+		}
+		return s.reevaluate(*existing, updated)
+	}
+
+	return fmt.Errorf("unknown request kind %q", request.Kind)
+}
+
+// reevaluate enforces the locks on all hosts the given lock versions apply to.
+func (s *Service) reevaluate(changed ...structs.Lock) error {
+	hostIDs, err := locks.Hosts(s.db, changed...)
+	if err != nil {
+		return err
+	}
+	return locks.Reevaluate(s.db, hostIDs)
+}
+
+// Module exports the approvals module.
+var Module = fx.Options(
+	fx.Provide(NewService),
+)
@@ -0,0 +1,228 @@
+// Campaign
+//
+// The Campaign Package rolls out jobs to many hosts, but only while the
+// maintenance window of the campaign is open. A job is only dispatched if the
+// window stays open for the expected duration of the job.
+//
+// Hosts are patched in waves, e.g. canaries, then 10%, then the rest. The next wave
+// only starts once all jobs of the previous one finished and their agents checked in
+// again. If too many hosts of a wave failed, the campaign is paused or aborted.
+package campaign
+
+import (
+	"fmt"
+	"math"
+	"packagelock/jobs"
+	"packagelock/structs"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Campaign states.
+const (
+	StatePendingApproval = "pending-approval"
+	StateRejected        = "rejected"
+	StateScheduled       = "scheduled"
+	StateRunning         = "running"
+	StatePaused          = "paused"
+	StateCompleted       = "completed"
+	StateAborted         = "aborted"
+	StateCancelled       = "cancelled"
+)
+
+// Wave states.
+const (
+	WavePending    = "pending"
+	WaveRunning    = "running"
+	WaveVerifying  = "verifying" // all jobs finished, waiting for the agents to check in
+	WavePassed     = "passed"
+	WaveFailed     = "failed"
+	WaveOverridden = "overridden" // failed, but resumed by a user
+)
+
+// Halt actions.
+const (
+	HaltPause = "pause"
+	HaltAbort = "abort"
+)
+
+// Target states besides the job states.
+const (
+	TargetPending = "pending" // not dispatched yet
+	TargetSkipped = "skipped" // the host has no agent, counts as failed
+)
+
+// Validate checks a new campaign against the maintenance window it is bound to.
+func Validate(campaign structs.Campaign, window structs.Maintenance_Window) error {
+	if campaign.Name == "" {
+		return fmt.Errorf("campaign needs a name")
+	}
+	if len(campaign.HostIDs) == 0 {
+		return fmt.Errorf("campaign needs at least one host")
+	}
+	if campaign.ExpectedDurationMinutes <= 0 {
+		return fmt.Errorf("campaign needs a positive expected duration")
+	}
+	if campaign.ExpectedDurationMinutes > window.DurationMinutes {
+		return fmt.Errorf("expected duration of %d minutes never fits into window %q of %d minutes",
+			campaign.ExpectedDurationMinutes, window.Name, window.DurationMinutes)
+	}
+	if campaign.FailureThreshold < 0 || campaign.FailureThreshold > 100 {
+		return fmt.Errorf("failure threshold must be a percentage between 0 and 100")
+	}
+	if campaign.HaltAction != "" && campaign.HaltAction != HaltPause && campaign.HaltAction != HaltAbort {
+		return fmt.Errorf("unknown halt action %q, expected %q or %q", campaign.HaltAction, HaltPause, HaltAbort)
+	}
+	if campaign.HealthGraceMinutes < 0 {
+		return fmt.Errorf("health grace period can't be negative")
+	}
+
+	if err := jobs.Validate(structs.Job{Type: campaign.JobType, Spec: campaign.Spec}); err != nil {
+		return err
+	}
+
+	// Hosts may only be patched in windows approved for them
+	allowed := map[uuid.UUID]bool{}
+	for _, hostID := range window.HostIDs {
+		allowed[hostID] = true
+	}
+	for _, hostID := range campaign.HostIDs {
+		if !allowed[hostID] {
+			return fmt.Errorf("host %s is not part of window %q", hostID, window.Name)
+		}
+	}
+	return nil
+}
+
+// PlanWaves assigns every host of the campaign to a wave and creates its pending target.
+// Waves listing their hosts are filled first, then percentage waves in order from the
+// remaining hosts, then the wave without either takes the rest. Hosts left over end up in
+// the last wave, waves which got no hosts are dropped. Without waves, all hosts form one wave.
+func PlanWaves(hostIDs []uuid.UUID, waves []structs.Campaign_Wave) ([]structs.Campaign_Wave, []structs.Campaign_Target, error) {
+	var hosts []uuid.UUID
+	inCampaign := map[uuid.UUID]bool{}
+	for _, hostID := range hostIDs {
+		if !inCampaign[hostID] {
+			inCampaign[hostID] = true
+			hosts = append(hosts, hostID)
+		}
+	}
+
+	if len(waves) == 0 {
+		waves = []structs.Campaign_Wave{{Name: "all"}}
+	}
+
+	assigned := map[uuid.UUID]int{}
+	planned := make([]structs.Campaign_Wave, len(waves))
+	rest := -1
+	for i, wave := range waves {
+		if wave.Name == "" {
+			wave.Name = fmt.Sprintf("wave %d", i+1)
+		}
+		switch {
+		case len(wave.HostIDs) > 0 && wave.Percent != 0:
+			return nil, nil, fmt.Errorf("wave %q can't have both hosts and a percentage", wave.Name)
+		case wave.Percent < 0 || wave.Percent > 100:
+			return nil, nil, fmt.Errorf("wave %q needs a percentage between 1 and 100", wave.Name)
+		case len(wave.HostIDs) == 0 && wave.Percent == 0:
+			if rest >= 0 {
+				return nil, nil, fmt.Errorf("only one wave can take the remaining hosts")
+			}
+			rest = i
+		}
+
+		for _, hostID := range wave.HostIDs {
+			if !inCampaign[hostID] {
+				return nil, nil, fmt.Errorf("host %s of wave %q is not part of the campaign", hostID, wave.Name)
+			}
+			if previous, ok := assigned[hostID]; ok {
+				return nil, nil, fmt.Errorf("host %s is part of waves %q and %q", hostID, planned[previous].Name, wave.Name)
+			}
+			assigned[hostID] = i
+		}
+
+		planned[i] = structs.Campaign_Wave{Name: wave.Name, Percent: wave.Percent, HostIDs: wave.HostIDs}
+	}
+
+	remaining := func() []uuid.UUID {
+		var unassigned []uuid.UUID
+		for _, hostID := range hosts {
+			if _, ok := assigned[hostID]; !ok {
+				unassigned = append(unassigned, hostID)
+			}
+		}
+		return unassigned
+	}
+
+	for i := range planned {
+		if planned[i].Percent == 0 {
+			continue
+		}
+		count := int(math.Ceil(float64(planned[i].Percent) * float64(len(hosts)) / 100))
+		unassigned := remaining()
+		if count > len(unassigned) {
+			count = len(unassigned)
+		}
+		for _, hostID := range unassigned[:count] {
+			assigned[hostID] = i
+			planned[i].HostIDs = append(planned[i].HostIDs, hostID)
+		}
+	}
+
+	last := len(planned) - 1
+	if rest >= 0 {
+		last = rest
+	}
+	for _, hostID := range remaining() {
+		assigned[hostID] = last
+		planned[last].HostIDs = append(planned[last].HostIDs, hostID)
+	}
+
+	// Drop empty waves and number the targets by the remaining ones
+	var result []structs.Campaign_Wave
+	var targets []structs.Campaign_Target
+	for _, wave := range planned {
+		if len(wave.HostIDs) == 0 {
+			continue
+		}
+		wave.State = WavePending
+		for _, hostID := range wave.HostIDs {
+			targets = append(targets, structs.Campaign_Target{HostID: hostID, Wave: len(result), State: TargetPending})
+		}
+		result = append(result, wave)
+	}
+	return result, targets, nil
+}
+
+// IsFinished reports whether a campaign won't dispatch any more jobs.
+func IsFinished(state string) bool {
+	return state == StateCompleted || state == StateAborted || state == StateCancelled || state == StateRejected
+}
+
+// TargetFinished reports whether a target won't change its state anymore.
+func TargetFinished(state string) bool {
+	return state == TargetSkipped || jobs.IsFinished(state)
+}
+
+// TargetFailed reports whether a target counts as failed in the health check of its wave.
+func TargetFailed(target structs.Campaign_Target) bool {
+	if target.State != jobs.StateSucceeded {
+		return TargetFinished(target.State)
+	}
+	return target.Healthy != nil && !*target.Healthy
+}
+
+// FailureRate returns the percentage of failed hosts of a wave.
+func FailureRate(wave structs.Campaign_Wave) float64 {
+	total := wave.Succeeded + wave.Failed
+	if total == 0 {
+		return 0
+	}
+	return float64(wave.Failed) * 100 / float64(total)
+}
+
+// ExpectedDuration returns how long a job of the campaign is expected to run.
+func ExpectedDuration(campaign structs.Campaign) time.Duration {
+	return time.Duration(campaign.ExpectedDurationMinutes) * time.Minute
+}
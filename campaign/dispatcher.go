@@ -0,0 +1,507 @@
+package campaign
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"packagelock/db"
+	"packagelock/jobs"
+	"packagelock/schedule"
+	"packagelock/structs"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+// ErrInvalidState is returned when a campaign can't be paused, resumed or cancelled in its state.
+var ErrInvalidState = errors.New("invalid campaign state")
+
+// DispatcherParams holds the dependencies of the Dispatcher.
+type DispatcherParams struct {
+	fx.In
+
+	Lifecycle fx.Lifecycle
+	Logger    *zap.Logger
+	Config    *viper.Viper
+	DB        *db.Database
+	Jobs      *jobs.Queue
+}
+
+// Dispatcher periodically ('campaigns.interval') queues the jobs of the current wave of all
+// campaigns whose window is open, checks the health of finished waves and moves on to the next one.
+type Dispatcher struct {
+	logger      *zap.Logger
+	db          *db.Database
+	jobs        *jobs.Queue
+	healthGrace time.Duration
+
+	// mu makes sure a target is never dispatched twice by overlapping runs
+	mu sync.Mutex
+}
+
+// NewDispatcher creates a Dispatcher and schedules the periodic dispatch.
+func NewDispatcher(params DispatcherParams) *Dispatcher {
+	dispatcher := &Dispatcher{
+		logger:      params.Logger,
+		db:          params.DB,
+		jobs:        params.Jobs,
+		healthGrace: params.Config.GetDuration("campaigns.health-grace"),
+	}
+
+	interval := params.Config.GetDuration("campaigns.interval")
+	if interval <= 0 {
+		params.Logger.Info("Campaign dispatch disabled")
+		return dispatcher
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	params.Lifecycle.Append(fx.Hook{
+		OnStart: func(context.Context) error {
+			go dispatcher.run(ctx, interval)
+			return nil
+		},
+		OnStop: func(context.Context) error {
+			cancel()
+			return nil
+		},
+	})
+
+	return dispatcher
+}
+
+func (d *Dispatcher) run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			d.DispatchAll(now)
+		}
+	}
+}
+
+// DefaultHealthGrace returns how long agents have to check in after their job,
+// for campaigns which don't set it.
+func (d *Dispatcher) DefaultHealthGrace() time.Duration {
+	return d.healthGrace
+}
+
+// DispatchAll advances all scheduled, running and paused campaigns.
+func (d *Dispatcher) DispatchAll(now time.Time) {
+	campaigns, err := findActive(d.db)
+	if err != nil {
+		d.logger.Warn("Failed to fetch campaigns", zap.Error(err))
+		return
+	}
+
+	for _, campaign := range campaigns {
+		if _, err := d.Dispatch(campaign, now); err != nil {
+			d.logger.Warn("Failed to dispatch campaign", zap.String("CampaignID", campaign.CampaignID.String()), zap.Error(err))
+		}
+	}
+}
+
+// Dispatch refreshes the targets of a campaign from their jobs and advances its waves:
+// if the window is open long enough, the pending targets of the current wave are queued,
+// a finished wave is checked and either starts the next one or halts the campaign.
+// Paused campaigns only have their targets refreshed, campaigns waiting for approval
+// are left alone. It returns the stored campaign.
+func (d *Dispatcher) Dispatch(campaign structs.Campaign, now time.Time) (structs.Campaign, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	campaign, err := d.reload(campaign)
+	if err != nil || IsFinished(campaign.State) || campaign.State == StatePendingApproval {
+		return campaign, err
+	}
+	return d.advance(campaign, now)
+}
+
+// Pause stops a campaign from dispatching further jobs until it is resumed.
+func (d *Dispatcher) Pause(campaign structs.Campaign, reason string, now time.Time) (structs.Campaign, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	campaign, err := d.reload(campaign)
+	if err != nil {
+		return campaign, err
+	}
+	if campaign.State != StateScheduled && campaign.State != StateRunning {
+		return campaign, fmt.Errorf("%w: campaign is %s", ErrInvalidState, campaign.State)
+	}
+	campaign.State = StatePaused
+	campaign.HaltReason = reason
+	return d.save(campaign, now)
+}
+
+// Resume continues a paused campaign. If it was halted by a failed wave,
+// the failure is accepted and the next wave starts.
+func (d *Dispatcher) Resume(campaign structs.Campaign, now time.Time) (structs.Campaign, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	campaign, err := d.reload(campaign)
+	if err != nil {
+		return campaign, err
+	}
+	if campaign.State != StatePaused {
+		return campaign, fmt.Errorf("%w: campaign is %s", ErrInvalidState, campaign.State)
+	}
+	if campaign.CurrentWave < len(campaign.Waves) && campaign.Waves[campaign.CurrentWave].State == WaveFailed {
+		campaign.Waves[campaign.CurrentWave].State = WaveOverridden
+		campaign.CurrentWave++
+	}
+	campaign.State = StateRunning
+	campaign.HaltReason = ""
+	return d.advance(campaign, now)
+}
+
+// Approve releases a campaign waiting for approval, which is dispatched right away.
+func (d *Dispatcher) Approve(campaign structs.Campaign, now time.Time) (structs.Campaign, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	campaign, err := d.reload(campaign)
+	if err != nil {
+		return campaign, err
+	}
+	if campaign.State != StatePendingApproval {
+		return campaign, fmt.Errorf("%w: campaign is %s", ErrInvalidState, campaign.State)
+	}
+	campaign.State = StateScheduled
+	return d.advance(campaign, now)
+}
+
+// Reject stops a campaign waiting for approval for good.
+func (d *Dispatcher) Reject(campaign structs.Campaign, reason string, now time.Time) (structs.Campaign, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	campaign, err := d.reload(campaign)
+	if err != nil {
+		return campaign, err
+	}
+	if campaign.State != StatePendingApproval {
+		return campaign, fmt.Errorf("%w: campaign is %s", ErrInvalidState, campaign.State)
+	}
+	campaign.State = StateRejected
+	campaign.HaltReason = reason
+	return d.save(campaign, now)
+}
+
+// Cancel stops a campaign for good. Jobs already dispatched are not aborted.
+func (d *Dispatcher) Cancel(campaign structs.Campaign, now time.Time) (structs.Campaign, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	campaign, err := d.reload(campaign)
+	if err != nil {
+		return campaign, err
+	}
+	if IsFinished(campaign.State) {
+		return campaign, fmt.Errorf("%w: campaign is already %s", ErrInvalidState, campaign.State)
+	}
+	campaign.State = StateCancelled
+	return d.save(campaign, now)
+}
+
+// reload fetches the current version of a campaign, which may have changed
+// since the caller read it.
+func (d *Dispatcher) reload(campaign structs.Campaign) (structs.Campaign, error) {
+	current, err := FindCampaign(d.db, campaign.CampaignID)
+	if err != nil {
+		return campaign, err
+	}
+	if current == nil {
+		return campaign, fmt.Errorf("campaign %s not found", campaign.CampaignID)
+	}
+	return *current, nil
+}
+
+func (d *Dispatcher) save(campaign structs.Campaign, now time.Time) (structs.Campaign, error) {
+	campaign.UpdateTime = now
+	if _, err := d.db.DB.Update(campaign.ID, campaign); err != nil {
+		return campaign, err
+	}
+	return campaign, nil
+}
+
+func (d *Dispatcher) advance(campaign structs.Campaign, now time.Time) (structs.Campaign, error) {
+	if len(campaign.Waves) == 0 {
+		// Campaigns created before waves existed roll out to all hosts at once
+		campaign.Waves = []structs.Campaign_Wave{{Name: "all", State: WavePending}}
+		for i := range campaign.Targets {
+			campaign.Targets[i].Wave = 0
+			campaign.Waves[0].HostIDs = append(campaign.Waves[0].HostIDs, campaign.Targets[i].HostID)
+		}
+	}
+
+	if err := d.refreshTargets(&campaign); err != nil {
+		return campaign, err
+	}
+
+	for !IsFinished(campaign.State) && campaign.State != StatePaused && campaign.CurrentWave < len(campaign.Waves) {
+		wave := &campaign.Waves[campaign.CurrentWave]
+
+		if wave.State == WavePending || wave.State == WaveRunning {
+			open, ok, err := d.openWindow(campaign, now)
+			if err != nil {
+				return campaign, err
+			}
+			if ok {
+				d.dispatchWave(&campaign, open, now)
+			}
+		}
+
+		if err := d.checkHealth(&campaign, now); err != nil {
+			return campaign, err
+		}
+		if !d.finishWave(&campaign, now) {
+			break
+		}
+	}
+
+	campaign.State = campaignState(campaign)
+	return d.save(campaign, now)
+}
+
+// openWindow returns the occurrence of the campaign window jobs may be started in now.
+func (d *Dispatcher) openWindow(campaign structs.Campaign, now time.Time) (schedule.Occurrence, bool, error) {
+	window, err := schedule.FindWindow(d.db, campaign.WindowID)
+	if err != nil {
+		return schedule.Occurrence{}, false, err
+	}
+	if window == nil || !window.Enabled {
+		return schedule.Occurrence{}, false, nil
+	}
+
+	compiled, err := schedule.Compile(*window)
+	if err != nil {
+		return schedule.Occurrence{}, false, err
+	}
+
+	open, ok := compiled.Active(now)
+	if !ok {
+		return open, false, nil
+	}
+	// No job may still be running when the window closes
+	if open.End.Sub(now) < ExpectedDuration(campaign) {
+		d.logger.Debug("Window closes before campaign jobs would finish",
+			zap.String("CampaignID", campaign.CampaignID.String()),
+			zap.Time("closes", open.End),
+		)
+		return open, false, nil
+	}
+	return open, true, nil
+}
+
+// dispatchWave queues the jobs of all pending targets of the current wave.
+func (d *Dispatcher) dispatchWave(campaign *structs.Campaign, open schedule.Occurrence, now time.Time) {
+	wave := &campaign.Waves[campaign.CurrentWave]
+	if wave.State == WavePending {
+		started := now
+		wave.State = WaveRunning
+		wave.StartTime = &started
+		d.logger.Info("Starting campaign wave",
+			zap.String("CampaignID", campaign.CampaignID.String()),
+			zap.String("wave", wave.Name),
+			zap.Int("hosts", len(wave.HostIDs)),
+		)
+	}
+
+	// Agents pick up jobs late if they poll rarely, the job must still finish in time
+	notAfter := open.End.Add(-ExpectedDuration(*campaign))
+
+	for i := range campaign.Targets {
+		target := &campaign.Targets[i]
+		if target.Wave != campaign.CurrentWave || target.State != TargetPending {
+			continue
+		}
+
+		agent, err := findHostAgent(d.db, target.HostID)
+		if err != nil {
+			d.logger.Warn("Failed to fetch agent of campaign host", zap.String("HostID", target.HostID.String()), zap.Error(err))
+			continue
+		}
+		if agent == nil {
+			// A wave can't wait for hosts which may never get an agent
+			target.State = TargetSkipped
+			d.logger.Warn("Skipping campaign host without agent", zap.String("HostID", target.HostID.String()))
+			continue
+		}
+
+		job, err := d.jobs.Enqueue(*agent, structs.Job{
+			Type:           campaign.JobType,
+			Spec:           campaign.Spec,
+			TimeoutSeconds: int(open.End.Sub(now).Seconds()),
+			NotAfter:       &notAfter,
+		})
+		if err != nil {
+			d.logger.Warn("Failed to queue campaign job", zap.String("HostID", target.HostID.String()), zap.Error(err))
+			continue
+		}
+
+		dispatched := now
+		target.AgentID = agent.AgentID
+		target.JobID = &job.JobID
+		target.State = job.State
+		target.DispatchTime = &dispatched
+
+		d.logger.Info("Dispatched campaign job",
+			zap.String("CampaignID", campaign.CampaignID.String()),
+			zap.String("HostID", target.HostID.String()),
+			zap.String("JobID", job.JobID.String()),
+		)
+	}
+}
+
+// refreshTargets copies the state of the dispatched jobs to their targets.
+func (d *Dispatcher) refreshTargets(campaign *structs.Campaign) error {
+	for i := range campaign.Targets {
+		target := &campaign.Targets[i]
+		if target.JobID == nil || TargetFinished(target.State) {
+			continue
+		}
+
+		job, err := d.jobs.Find(*target.JobID)
+		if err != nil {
+			return err
+		}
+		if job != nil {
+			target.State = job.State
+			target.FinishTime = job.FinishTime
+		}
+	}
+	return nil
+}
+
+// checkHealth marks succeeded targets of the current wave healthy once their agent checked in
+// after the job finished, or unhealthy if it didn't within the grace period.
+func (d *Dispatcher) checkHealth(campaign *structs.Campaign, now time.Time) error {
+	grace := time.Duration(campaign.HealthGraceMinutes) * time.Minute
+	if campaign.HealthGraceMinutes == 0 {
+		grace = d.healthGrace
+	}
+
+	for i := range campaign.Targets {
+		target := &campaign.Targets[i]
+		if target.Wave != campaign.CurrentWave || target.State != jobs.StateSucceeded || target.Healthy != nil {
+			continue
+		}
+
+		finished := now
+		if target.FinishTime != nil {
+			finished = *target.FinishTime
+		}
+
+		agent, err := findAgent(d.db, target.AgentID)
+		if err != nil {
+			return err
+		}
+
+		var healthy bool
+		switch {
+		case agent != nil && agent.LastSeen.After(finished):
+			healthy = true
+		case now.Sub(finished) > grace:
+			healthy = false
+			d.logger.Warn("Agent did not check in after campaign job",
+				zap.String("CampaignID", campaign.CampaignID.String()),
+				zap.String("HostID", target.HostID.String()),
+			)
+		default:
+			continue
+		}
+		target.Healthy = &healthy
+	}
+	return nil
+}
+
+// finishWave evaluates the current wave once all its targets are decided. It reports whether
+// the campaign moved on to the next wave, so it can be dispatched right away.
+func (d *Dispatcher) finishWave(campaign *structs.Campaign, now time.Time) bool {
+	wave := &campaign.Waves[campaign.CurrentWave]
+	if wave.State == WavePending {
+		return false
+	}
+
+	succeeded, failed, jobsFinished := 0, 0, true
+	for _, target := range campaign.Targets {
+		if target.Wave != campaign.CurrentWave {
+			continue
+		}
+		switch {
+		case !TargetFinished(target.State):
+			jobsFinished = false
+		case TargetFailed(target):
+			failed++
+		case target.Healthy != nil:
+			succeeded++
+		}
+	}
+	wave.Succeeded, wave.Failed = succeeded, failed
+
+	if !jobsFinished {
+		return false
+	}
+	if succeeded+failed < len(wave.HostIDs) {
+		wave.State = WaveVerifying
+		return false
+	}
+
+	finished := now
+	wave.FinishTime = &finished
+
+	if rate := FailureRate(*wave); failed > 0 && rate > campaign.FailureThreshold {
+		wave.State = WaveFailed
+		campaign.HaltReason = fmt.Sprintf("%d of %d hosts in wave %q failed (%.0f%%, threshold %.0f%%)",
+			failed, succeeded+failed, wave.Name, rate, campaign.FailureThreshold)
+		campaign.State = StatePaused
+		if campaign.HaltAction == HaltAbort {
+			campaign.State = StateAborted
+		}
+		d.logger.Warn("Halted campaign",
+			zap.String("CampaignID", campaign.CampaignID.String()),
+			zap.String("state", campaign.State),
+			zap.String("reason", campaign.HaltReason),
+		)
+		return false
+	}
+
+	wave.State = WavePassed
+	campaign.CurrentWave++
+	d.logger.Info("Campaign wave passed",
+		zap.String("CampaignID", campaign.CampaignID.String()),
+		zap.String("wave", wave.Name),
+		zap.Int("succeeded", succeeded),
+		zap.Int("failed", failed),
+	)
+	return true
+}
+
+// campaignState derives the state of a campaign from its waves.
+func campaignState(campaign structs.Campaign) string {
+	if IsFinished(campaign.State) || campaign.State == StatePaused {
+		return campaign.State
+	}
+	if campaign.CurrentWave >= len(campaign.Waves) {
+		return StateCompleted
+	}
+	for _, wave := range campaign.Waves {
+		if wave.State != WavePending {
+			return StateRunning
+		}
+	}
+	return StateScheduled
+}
+
+// Module exports the campaign module.
+var Module = fx.Options(
+	fx.Provide(NewDispatcher),
+)
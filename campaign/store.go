@@ -0,0 +1,54 @@
+package campaign
+
+import (
+	"packagelock/db"
+	"packagelock/decommission"
+	"packagelock/structs"
+
+	"github.com/google/uuid"
+	"github.com/surrealdb/surrealdb.go"
+)
+
+// FindCampaign returns the campaign with the given CampaignID or nil if there is none.
+func FindCampaign(database *db.Database, campaignID uuid.UUID) (*structs.Campaign, error) {
+	found, err := surrealdb.SmartUnmarshal[[]structs.Campaign](database.DB.Query(
+		"SELECT * FROM campaigns WHERE CampaignID = $campaignID LIMIT 1",
+		map[string]interface{}{"campaignID": campaignID.String()},
+	))
+	if err != nil || len(found) == 0 {
+		return nil, err
+	}
+	return &found[0], nil
+}
+
+// findActive returns all campaigns which may still dispatch jobs or wait for them.
+func findActive(database *db.Database) ([]structs.Campaign, error) {
+	return surrealdb.SmartUnmarshal[[]structs.Campaign](database.DB.Query(
+		"SELECT * FROM campaigns WHERE State IN [$scheduled, $running, $paused] ORDER BY CreationTime",
+		map[string]interface{}{"scheduled": StateScheduled, "running": StateRunning, "paused": StatePaused},
+	))
+}
+
+// findHostAgent returns the agent of a host or nil if the host has none.
+func findHostAgent(database *db.Database, hostID uuid.UUID) (*structs.Agent, error) {
+	agents, err := surrealdb.SmartUnmarshal[[]structs.Agent](database.DB.Query(
+		"SELECT * FROM agents WHERE HostID = $hostID AND "+decommission.Active+" LIMIT 1",
+		map[string]interface{}{"hostID": hostID.String()},
+	))
+	if err != nil || len(agents) == 0 {
+		return nil, err
+	}
+	return &agents[0], nil
+}
+
+// findAgent returns the agent with the given AgentID or nil if there is none.
+func findAgent(database *db.Database, agentID uuid.UUID) (*structs.Agent, error) {
+	agents, err := surrealdb.SmartUnmarshal[[]structs.Agent](database.DB.Query(
+		"SELECT * FROM agents WHERE AgentID = $agentID LIMIT 1",
+		map[string]interface{}{"agentID": agentID.String()},
+	))
+	if err != nil || len(agents) == 0 {
+		return nil, err
+	}
+	return &agents[0], nil
+}
@@ -0,0 +1,460 @@
+package certs
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/acme"
+)
+
+// Challenge types of 'acme.challenge'.
+const (
+	ChallengeHTTP01    = "http-01"
+	ChallengeTLSALPN01 = "tls-alpn-01"
+)
+
+// acmeRetryDelay is the wait after a failed renewal, shorter than the check interval
+// so a temporary outage of the CA doesn't eat up the renewal window.
+const acmeRetryDelay = time.Hour
+
+// acmeOrderTimeout bounds an order, CAs usually validate challenges within seconds.
+const acmeOrderTimeout = 10 * time.Minute
+
+type ACMEParams struct {
+	fx.In
+
+	Lifecycle fx.Lifecycle
+	Logger    *zap.Logger
+	Config    *viper.Viper
+	Store     *Store
+	HTTP      *HTTPChallenges
+	ALPN      *TLSALPNChallenges
+}
+
+// ACME obtains the server certificate from an ACME v2 CA like Let's Encrypt and
+// renews it before it expires. Certificates are written to 'network.ssl-config'
+// and swapped into the running server by the Store.
+type ACME struct {
+	logger *zap.Logger
+	config *viper.Viper
+	store  *Store
+	http   *HTTPChallenges
+	alpn   *TLSALPNChallenges
+
+	mu sync.Mutex // one order at a time
+}
+
+// NewACME creates the ACME client. With 'acme.enabled' the server checks the
+// certificate on start and every 'acme.check-interval'.
+func NewACME(params ACMEParams) *ACME {
+	a := &ACME{
+		logger: params.Logger,
+		config: params.Config,
+		store:  params.Store,
+		http:   params.HTTP,
+		alpn:   params.ALPN,
+	}
+
+	if !params.Config.GetBool("acme.enabled") || !params.Config.GetBool("network.ssl") {
+		return a
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	params.Lifecycle.Append(fx.Hook{
+		OnStart: func(context.Context) error {
+			if _, err := a.domains(); err != nil {
+				cancel()
+				return err
+			}
+			if _, err := a.challenge(); err != nil {
+				cancel()
+				return err
+			}
+			if a.config.GetString("acme.challenge") == ChallengeHTTP01 && !a.config.GetBool("network.ssl-config.redirecthttp") {
+				a.logger.Warn("ACME HTTP-01 challenges are served by the HTTP redirect server, which 'network.ssl-config.redirecthttp' disables")
+			}
+			go a.run(ctx)
+			return nil
+		},
+		OnStop: func(context.Context) error {
+			cancel()
+			return nil
+		},
+	})
+
+	return a
+}
+
+// domains returns 'acme.domains', defaulting to 'network.fqdn' if it is a name.
+func (a *ACME) domains() ([]string, error) {
+	domains := a.config.GetStringSlice("acme.domains")
+	if len(domains) == 0 {
+		if fqdn := a.config.GetString("network.fqdn"); fqdn != "" && net.ParseIP(fqdn) == nil {
+			domains = []string{fqdn}
+		}
+	}
+	if len(domains) == 0 {
+		return nil, fmt.Errorf("acme.domains: no domain names configured and network.fqdn is an IP address")
+	}
+	return domains, nil
+}
+
+func (a *ACME) challenge() (string, error) {
+	challenge := a.config.GetString("acme.challenge")
+	if challenge != ChallengeHTTP01 && challenge != ChallengeTLSALPN01 {
+		return "", fmt.Errorf("acme.challenge must be %s or %s", ChallengeHTTP01, ChallengeTLSALPN01)
+	}
+	return challenge, nil
+}
+
+func (a *ACME) run(ctx context.Context) {
+	delay := time.Duration(0)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+
+		delay = a.config.GetDuration("acme.check-interval")
+		if _, err := a.Renew(ctx, false); err != nil {
+			a.logger.Error("Failed to renew certificate via ACME", zap.Error(err))
+			delay = min(delay, acmeRetryDelay)
+		}
+	}
+}
+
+// NeedsRenewal returns why the certificate at 'network.ssl-config.certificatepath'
+// has to be replaced, or "" while it is valid for longer than 'acme.renew-before'.
+func (a *ACME) NeedsRenewal() (string, error) {
+	domains, err := a.domains()
+	if err != nil {
+		return "", err
+	}
+
+	cert, err := readCertificate(a.config.GetString("network.ssl-config.certificatepath"))
+	if errors.Is(err, os.ErrNotExist) {
+		return "no certificate", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if bytes.Equal(cert.RawIssuer, cert.RawSubject) {
+		return "self-signed certificate", nil
+	}
+	for _, domain := range domains {
+		if err := cert.VerifyHostname(domain); err != nil {
+			return "certificate not valid for " + domain, nil
+		}
+	}
+	if time.Until(cert.NotAfter) < a.config.GetDuration("acme.renew-before") {
+		return "certificate expires " + cert.NotAfter.Format(time.RFC3339), nil
+	}
+	return "", nil
+}
+
+// Renew obtains a new certificate if the current one needs renewal, or always with force.
+// It reports whether a certificate was obtained.
+func (a *ACME) Renew(ctx context.Context, force bool) (bool, error) {
+	reason, err := a.NeedsRenewal()
+	if err != nil {
+		return false, err
+	}
+	if reason == "" && !force {
+		a.logger.Debug("ACME certificate needs no renewal")
+		return false, nil
+	}
+	if reason == "" {
+		reason = "forced"
+	}
+
+	a.logger.Info("Obtaining certificate via ACME", zap.String("reason", reason))
+	return true, a.Obtain(ctx)
+}
+
+// Obtain orders a certificate for 'acme.domains', answers the challenges and
+// writes certificate and key to 'network.ssl-config'.
+func (a *ACME) Obtain(ctx context.Context) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(ctx, acmeOrderTimeout)
+	defer cancel()
+
+	domains, err := a.domains()
+	if err != nil {
+		return err
+	}
+	challenge, err := a.challenge()
+	if err != nil {
+		return err
+	}
+
+	client, err := a.client(ctx)
+	if err != nil {
+		return err
+	}
+
+	order, err := client.AuthorizeOrder(ctx, acme.DomainIDs(domains...))
+	if err != nil {
+		return fmt.Errorf("create order: %w", err)
+	}
+	orderURL := order.URI
+	for _, authzURL := range order.AuthzURLs {
+		if err := a.authorize(ctx, client, authzURL, challenge); err != nil {
+			return err
+		}
+	}
+	order, err = client.WaitOrder(ctx, orderURL)
+	if err != nil {
+		return fmt.Errorf("wait for order: %w", err)
+	}
+
+	key, err := GenerateKey(a.config.GetString("acme.key-type"))
+	if err != nil {
+		return err
+	}
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: domains[0]},
+		DNSNames: domains,
+	}, key)
+	if err != nil {
+		return fmt.Errorf("create certificate request: %w", err)
+	}
+	chain, err := finalize(ctx, client, order.FinalizeURL, orderURL, csr)
+	if err != nil {
+		return err
+	}
+
+	certFile := a.config.GetString("network.ssl-config.certificatepath")
+	keyFile := a.config.GetString("network.ssl-config.privatekeypath")
+	if err := WritePrivateKey(keyFile, key); err != nil {
+		return err
+	}
+	if err := WriteCertificate(certFile, chain...); err != nil {
+		return err
+	}
+	// The watcher would pick the files up too, this swaps them in right away
+	if err := a.store.Reload(); err != nil {
+		a.logger.Warn("Failed to reload certificates after ACME renewal", zap.Error(err))
+	}
+
+	leaf, err := x509.ParseCertificate(chain[0])
+	if err != nil {
+		return err
+	}
+	a.logger.Info("Obtained certificate via ACME",
+		zap.Strings("dnsNames", leaf.DNSNames),
+		zap.String("issuer", leaf.Issuer.String()),
+		zap.Time("notAfter", leaf.NotAfter),
+	)
+	return nil
+}
+
+// finalize submits the certificate request of an order and downloads the issued chain.
+func finalize(ctx context.Context, client *acme.Client, finalizeURL, orderURL string, csr []byte) ([][]byte, error) {
+	chain, _, err := client.CreateOrderCert(ctx, finalizeURL, csr, true)
+	if err == nil {
+		return chain, nil
+	}
+	// CreateOrderCert waits for the certificate at the Location of the finalize response,
+	// which CAs like Pebble leave out. The order is polled by its own URL then.
+	order, waitErr := client.WaitOrder(ctx, orderURL)
+	if waitErr != nil || order.Status != acme.StatusValid || order.CertURL == "" {
+		return nil, fmt.Errorf("finalize order: %w", err)
+	}
+	chain, err = client.FetchCert(ctx, order.CertURL, true)
+	if err != nil {
+		return nil, fmt.Errorf("fetch certificate: %w", err)
+	}
+	return chain, nil
+}
+
+// authorize answers the challenge of an authorization and waits until the CA validated it.
+func (a *ACME) authorize(ctx context.Context, client *acme.Client, authzURL, challengeType string) error {
+	authz, err := client.GetAuthorization(ctx, authzURL)
+	if err != nil {
+		return fmt.Errorf("get authorization: %w", err)
+	}
+	if authz.Status == acme.StatusValid {
+		return nil
+	}
+
+	domain := authz.Identifier.Value
+	var challenge *acme.Challenge
+	for _, c := range authz.Challenges {
+		if c.Type == challengeType {
+			challenge = c
+			break
+		}
+	}
+	if challenge == nil {
+		return fmt.Errorf("%s: the CA offers no %s challenge", domain, challengeType)
+	}
+
+	switch challengeType {
+	case ChallengeHTTP01:
+		keyAuth, err := client.HTTP01ChallengeResponse(challenge.Token)
+		if err != nil {
+			return err
+		}
+		a.http.Set(challenge.Token, keyAuth)
+		defer a.http.Delete(challenge.Token)
+	case ChallengeTLSALPN01:
+		cert, err := client.TLSALPN01ChallengeCert(challenge.Token, domain)
+		if err != nil {
+			return err
+		}
+		a.alpn.Set(domain, &cert)
+		defer a.alpn.Delete(domain)
+	}
+
+	if _, err := client.Accept(ctx, challenge); err != nil {
+		return fmt.Errorf("%s: accept %s challenge: %w", domain, challengeType, err)
+	}
+	if _, err := client.WaitAuthorization(ctx, authz.URI); err != nil {
+		return fmt.Errorf("%s: %s validation failed: %w", domain, challengeType, err)
+	}
+	a.logger.Debug("Validated ACME challenge", zap.String("domain", domain), zap.String("challenge", challengeType))
+	return nil
+}
+
+// client creates the ACME client and registers its account, whose key is kept in 'acme.account-key'.
+func (a *ACME) client(ctx context.Context) (*acme.Client, error) {
+	key, err := a.accountKey()
+	if err != nil {
+		return nil, err
+	}
+
+	client := &acme.Client{
+		Key:          key,
+		DirectoryURL: a.config.GetString("acme.directory-url"),
+		UserAgent:    "packagelock",
+	}
+	// Test CAs like Pebble serve their API with a certificate of their own root
+	if roots := a.config.GetString("acme.ca-roots"); roots != "" {
+		data, err := os.ReadFile(roots)
+		if err != nil {
+			return nil, fmt.Errorf("acme.ca-roots: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("acme.ca-roots: no PEM certificates in %s", roots)
+		}
+		client.HTTPClient = &http.Client{
+			Timeout:   time.Minute,
+			Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}},
+		}
+	}
+
+	account := &acme.Account{}
+	if email := a.config.GetString("acme.email"); email != "" {
+		account.Contact = []string{"mailto:" + email}
+	}
+	if _, err := client.Register(ctx, account, acme.AcceptTOS); err != nil && !errors.Is(err, acme.ErrAccountAlreadyExists) {
+		return nil, fmt.Errorf("register ACME account: %w", err)
+	}
+	return client, nil
+}
+
+// accountKey loads the ACME account key, creating it on first use.
+func (a *ACME) accountKey() (crypto.Signer, error) {
+	path := a.config.GetString("acme.account-key")
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		key, err := GenerateKey(KeyECDSAP256)
+		if err != nil {
+			return nil, err
+		}
+		if err := WritePrivateKey(path, key); err != nil {
+			return nil, fmt.Errorf("write ACME account key: %w", err)
+		}
+		a.logger.Info("Created ACME account key", zap.String("file", path))
+		return key, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := ParsePrivateKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("parse ACME account key: %w", err)
+	}
+	return key, nil
+}
+
+// ServeChallenges answers challenges while the server is not running, for
+// 'generate certs letsencrypt'. HTTP-01 is served on 'network.ssl-config.redirectport',
+// TLS-ALPN-01 on 'network.port'. The returned function stops the listener.
+func (a *ACME) ServeChallenges() (func(), error) {
+	challenge, err := a.challenge()
+	if err != nil {
+		return nil, err
+	}
+	host := a.config.GetString("network.fqdn")
+
+	if challenge == ChallengeHTTP01 {
+		listener, err := net.Listen("tcp", net.JoinHostPort(host, a.config.GetString("network.ssl-config.redirectport")))
+		if err != nil {
+			return nil, err
+		}
+		server := &http.Server{
+			ReadHeaderTimeout: 10 * time.Second,
+			Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				keyAuth, ok := a.http.Get(strings.TrimPrefix(r.URL.Path, HTTPChallengePath))
+				if !ok || !strings.HasPrefix(r.URL.Path, HTTPChallengePath) {
+					http.NotFound(w, r)
+					return
+				}
+				w.Write([]byte(keyAuth))
+			}),
+		}
+		go server.Serve(listener)
+		return func() { server.Close() }, nil
+	}
+
+	listener, err := tls.Listen("tcp", net.JoinHostPort(host, a.config.GetString("network.port")), &tls.Config{
+		NextProtos: []string{acme.ALPNProto},
+		GetCertificate: func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+			if cert, ok := a.alpn.GetCertificate(hello); ok {
+				return cert, nil
+			}
+			return nil, fmt.Errorf("no ACME challenge for %q", hello.ServerName)
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			// The validation is done once the handshake completes
+			go func() {
+				conn.SetDeadline(time.Now().Add(10 * time.Second))
+				conn.(*tls.Conn).Handshake()
+				conn.Close()
+			}()
+		}
+	}()
+	return func() { listener.Close() }, nil
+}
@@ -0,0 +1,115 @@
+package certs
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/viper"
+	"go.uber.org/fx/fxtest"
+	"go.uber.org/zap/zaptest"
+)
+
+// The ACME tests run against a local Pebble and are skipped unless PEBBLE_DIRECTORY is set,
+// see "Testing with Pebble" in wiki/developer docs/acme.md.
+
+func newPebbleACME(t *testing.T, challenge string) (*ACME, *viper.Viper) {
+	t.Helper()
+
+	directory := os.Getenv("PEBBLE_DIRECTORY")
+	if directory == "" {
+		t.Skip("PEBBLE_DIRECTORY is not set, see the comment of the ACME tests")
+	}
+	domain := os.Getenv("PEBBLE_DOMAIN")
+	if domain == "" {
+		domain = "localhost"
+	}
+
+	dir := t.TempDir()
+	config := viper.New()
+	config.Set("network.fqdn", "")
+	config.Set("network.port", "5001")
+	config.Set("network.ssl-config.redirectport", "5002")
+	config.Set("network.ssl-config.certificatepath", filepath.Join(dir, "cert.pem"))
+	config.Set("network.ssl-config.privatekeypath", filepath.Join(dir, "key.pem"))
+	config.Set("acme.directory-url", directory)
+	config.Set("acme.ca-roots", os.Getenv("PEBBLE_CA_ROOTS"))
+	config.Set("acme.domains", []string{domain})
+	config.Set("acme.challenge", challenge)
+	config.Set("acme.key-type", KeyECDSAP256)
+	config.Set("acme.account-key", filepath.Join(dir, "account.key"))
+	config.Set("acme.renew-before", "24h")
+
+	logger := zaptest.NewLogger(t)
+	lifecycle := fxtest.NewLifecycle(t)
+	alpn := NewTLSALPNChallenges()
+	store, err := NewStore(StoreParams{Lifecycle: lifecycle, Logger: logger, Config: config, ALPN: alpn})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewACME(ACMEParams{
+		Lifecycle: lifecycle,
+		Logger:    logger,
+		Config:    config,
+		Store:     store,
+		HTTP:      NewHTTPChallenges(),
+		ALPN:      alpn,
+	}), config
+}
+
+func TestACMEObtainAndRenew(t *testing.T) {
+	for _, challenge := range []string{ChallengeHTTP01, ChallengeTLSALPN01} {
+		t.Run(challenge, func(t *testing.T) {
+			client, config := newPebbleACME(t, challenge)
+			stop, err := client.ServeChallenges()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer stop()
+
+			ctx := context.Background()
+			certFile := config.GetString("network.ssl-config.certificatepath")
+
+			if reason, err := client.NeedsRenewal(); err != nil || reason != "no certificate" {
+				t.Fatalf("NeedsRenewal() before Obtain = %q, %v, want %q", reason, err, "no certificate")
+			}
+			if err := client.Obtain(ctx); err != nil {
+				t.Fatalf("Obtain: %v", err)
+			}
+
+			obtained, err := readCertificate(certFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, domain := range config.GetStringSlice("acme.domains") {
+				if err := obtained.VerifyHostname(domain); err != nil {
+					t.Errorf("obtained certificate: %v", err)
+				}
+			}
+			if obtained.Issuer.String() == obtained.Subject.String() {
+				t.Errorf("obtained certificate is self-signed")
+			}
+
+			// A fresh certificate is not renewed
+			renewed, err := client.Renew(ctx, false)
+			if err != nil || renewed {
+				t.Fatalf("Renew() of a fresh certificate = %t, %v, want false", renewed, err)
+			}
+
+			// Once it expires within 'acme.renew-before', a new one is ordered
+			config.Set("acme.renew-before", obtained.NotAfter.Sub(obtained.NotBefore).String())
+			renewed, err = client.Renew(ctx, false)
+			if err != nil || !renewed {
+				t.Fatalf("Renew() of an expiring certificate = %t, %v, want true", renewed, err)
+			}
+			renewedCert, err := readCertificate(certFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if renewedCert.SerialNumber.Cmp(obtained.SerialNumber) == 0 {
+				t.Errorf("renewal kept certificate %s", obtained.SerialNumber)
+			}
+		})
+	}
+}
@@ -0,0 +1,517 @@
+package certs
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+// Files of the CA directory 'ca.dir'.
+const (
+	caRootCert         = "root.crt"
+	caRootKey          = "root.key"
+	caIntermediateCert = "intermediate.crt"
+	caIntermediateKey  = "intermediate.key"
+	caIndex            = "index.json"
+	caCRL              = "crl.pem"
+)
+
+// Usages of certificates issued by the CA.
+const (
+	UsageServer = "server"
+	UsageClient = "client"
+)
+
+// ErrCANotInitialized is returned until 'packagelock ca init' created the CA.
+var ErrCANotInitialized = errors.New("certificate authority is not initialized, run 'packagelock ca init'")
+
+// RevocationReasons maps the names of CRL reason codes (RFC 5280, 5.3.1) to the codes.
+var RevocationReasons = map[string]int{
+	"unspecified":          0,
+	"keyCompromise":        1,
+	"affiliationChanged":   3,
+	"superseded":           4,
+	"cessationOfOperation": 5,
+}
+
+// IssuedCert is the index entry of a certificate issued by the CA.
+type IssuedCert struct {
+	Serial      string     `json:"serial"`
+	Subject     string     `json:"subject"`
+	Usage       string     `json:"usage"`
+	DNSNames    []string   `json:"dnsNames,omitempty"`
+	IPAddresses []string   `json:"ipAddresses,omitempty"`
+	NotBefore   time.Time  `json:"notBefore"`
+	NotAfter    time.Time  `json:"notAfter"`
+	RevokedAt   *time.Time `json:"revokedAt,omitempty"`
+	Reason      int        `json:"reason,omitempty"`
+}
+
+type CAParams struct {
+	fx.In
+
+	Logger *zap.Logger
+	Config *viper.Viper
+}
+
+// CA is the PackageLock certificate authority. A long-lived root signs an
+// intermediate, which issues server and client certificates and the CRL.
+// Everything lives in 'ca.dir'; the root key is only needed to create the intermediate.
+type CA struct {
+	logger *zap.Logger
+	config *viper.Viper
+	dir    string
+
+	mu sync.Mutex
+}
+
+func NewCA(params CAParams) *CA {
+	return &CA{
+		logger: params.Logger,
+		config: params.Config,
+		dir:    params.Config.GetString("ca.dir"),
+	}
+}
+
+func (ca *CA) path(name string) string {
+	return filepath.Join(ca.dir, name)
+}
+
+// Initialized reports whether the root and intermediate exist.
+func (ca *CA) Initialized() bool {
+	for _, name := range []string{caRootCert, caIntermediateCert, caIntermediateKey} {
+		if _, err := os.Stat(ca.path(name)); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// Init creates the root and intermediate CA. An existing CA is only replaced with force,
+// which invalidates every certificate it issued.
+func (ca *CA) Init(force bool) error {
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+
+	if ca.Initialized() && !force {
+		return fmt.Errorf("certificate authority already exists in %s", ca.dir)
+	}
+
+	keyType := ca.config.GetString("ca.key-type")
+	name := ca.config.GetString("ca.common-name")
+	organization := ca.config.GetStringSlice("ca.organization")
+
+	rootKey, err := GenerateKey(keyType)
+	if err != nil {
+		return err
+	}
+	root, err := caTemplate(pkix.Name{CommonName: name + " Root CA", Organization: organization},
+		ca.config.GetDuration("ca.root-validity"), 1)
+	if err != nil {
+		return err
+	}
+	rootDER, err := x509.CreateCertificate(rand.Reader, root, root, rootKey.Public(), rootKey)
+	if err != nil {
+		return fmt.Errorf("create root certificate: %w", err)
+	}
+	rootCert, err := x509.ParseCertificate(rootDER)
+	if err != nil {
+		return err
+	}
+
+	intermediateKey, err := GenerateKey(keyType)
+	if err != nil {
+		return err
+	}
+	intermediate, err := caTemplate(pkix.Name{CommonName: name + " Intermediate CA", Organization: organization},
+		ca.config.GetDuration("ca.intermediate-validity"), 0)
+	if err != nil {
+		return err
+	}
+	if intermediate.NotAfter.After(rootCert.NotAfter) {
+		intermediate.NotAfter = rootCert.NotAfter
+	}
+	intermediateDER, err := x509.CreateCertificate(rand.Reader, intermediate, rootCert, intermediateKey.Public(), rootKey)
+	if err != nil {
+		return fmt.Errorf("create intermediate certificate: %w", err)
+	}
+
+	if err := os.MkdirAll(ca.dir, 0700); err != nil {
+		return err
+	}
+	if err := WritePrivateKey(ca.path(caRootKey), rootKey); err != nil {
+		return err
+	}
+	if err := WriteCertificate(ca.path(caRootCert), rootDER); err != nil {
+		return err
+	}
+	if err := WritePrivateKey(ca.path(caIntermediateKey), intermediateKey); err != nil {
+		return err
+	}
+	if err := WriteCertificate(ca.path(caIntermediateCert), intermediateDER); err != nil {
+		return err
+	}
+	if err := ca.writeIndex(nil); err != nil {
+		return err
+	}
+	if _, err := ca.writeCRL(nil); err != nil {
+		return err
+	}
+
+	ca.logger.Info("Created certificate authority",
+		zap.String("dir", ca.dir),
+		zap.String("root", rootCert.Subject.CommonName),
+		zap.Time("notAfter", rootCert.NotAfter),
+	)
+	return nil
+}
+
+// caTemplate returns the template of a CA certificate. maxPathLen 0 allows no further CAs below it.
+func caTemplate(subject pkix.Name, validity time.Duration, maxPathLen int) (*x509.Certificate, error) {
+	if validity <= 0 {
+		return nil, fmt.Errorf("CA validity must be positive, got %s", validity)
+	}
+	template, err := CertOptions{Subject: subject, Validity: validity}.template()
+	if err != nil {
+		return nil, err
+	}
+	template.IsCA = true
+	template.MaxPathLen = maxPathLen
+	template.MaxPathLenZero = maxPathLen == 0
+	template.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageCRLSign
+	return template, nil
+}
+
+// signer loads the intermediate, which signs certificates and CRLs.
+func (ca *CA) signer() (*x509.Certificate, crypto.Signer, error) {
+	if !ca.Initialized() {
+		return nil, nil, ErrCANotInitialized
+	}
+
+	cert, err := readCertificate(ca.path(caIntermediateCert))
+	if err != nil {
+		return nil, nil, err
+	}
+	keyData, err := os.ReadFile(ca.path(caIntermediateKey))
+	if err != nil {
+		return nil, nil, err
+	}
+	key, err := ParsePrivateKey(keyData)
+	if err != nil {
+		return nil, nil, fmt.Errorf("parse %s: %w", caIntermediateKey, err)
+	}
+	return cert, key, nil
+}
+
+func readCertificate(path string) (*x509.Certificate, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, fmt.Errorf("%s: no PEM certificate found", path)
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
+
+// Issue creates a server or client certificate signed by the intermediate. It returns
+// the PEM chain of the certificate and the intermediate, together with the new key.
+func (ca *CA) Issue(opts CertOptions, usage string) ([]byte, crypto.Signer, *IssuedCert, error) {
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+
+	var extKeyUsage x509.ExtKeyUsage
+	switch usage {
+	case UsageServer:
+		extKeyUsage = x509.ExtKeyUsageServerAuth
+		if len(opts.DNSNames) == 0 && len(opts.IPAddresses) == 0 {
+			return nil, nil, nil, fmt.Errorf("server certificates need at least one DNS name or IP address")
+		}
+	case UsageClient:
+		extKeyUsage = x509.ExtKeyUsageClientAuth
+		if opts.Subject.CommonName == "" {
+			return nil, nil, nil, fmt.Errorf("client certificates need a common name")
+		}
+	default:
+		return nil, nil, nil, fmt.Errorf("unknown certificate usage %q", usage)
+	}
+	if opts.Validity <= 0 {
+		return nil, nil, nil, fmt.Errorf("certificate validity must be positive, got %s", opts.Validity)
+	}
+
+	issuer, issuerKey, err := ca.signer()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	index, err := ca.readIndex()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	key, err := GenerateKey(opts.KeyType)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	template, err := opts.template()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	template.KeyUsage = keyUsage(key)
+	template.ExtKeyUsage = []x509.ExtKeyUsage{extKeyUsage}
+	if crlURL := ca.config.GetString("ca.crl-url"); crlURL != "" {
+		template.CRLDistributionPoints = []string{crlURL}
+	}
+	// A certificate outliving its issuer would fail verification early
+	if template.NotAfter.After(issuer.NotAfter) {
+		template.NotAfter = issuer.NotAfter
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, issuer, key.Public(), issuerKey)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("create certificate: %w", err)
+	}
+
+	issued := IssuedCert{
+		Serial:    serialString(template.SerialNumber),
+		Subject:   template.Subject.String(),
+		Usage:     usage,
+		DNSNames:  template.DNSNames,
+		NotBefore: template.NotBefore.UTC(),
+		NotAfter:  template.NotAfter.UTC(),
+	}
+	for _, ip := range template.IPAddresses {
+		issued.IPAddresses = append(issued.IPAddresses, ip.String())
+	}
+	if err := ca.writeIndex(append(index, issued)); err != nil {
+		return nil, nil, nil, err
+	}
+
+	var chain bytes.Buffer
+	for _, block := range [][]byte{der, issuer.Raw} {
+		if err := pem.Encode(&chain, &pem.Block{Type: "CERTIFICATE", Bytes: block}); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+
+	ca.logger.Info("Issued certificate",
+		zap.String("serial", issued.Serial),
+		zap.String("subject", issued.Subject),
+		zap.String("usage", usage),
+		zap.Time("notAfter", issued.NotAfter),
+	)
+	return chain.Bytes(), key, &issued, nil
+}
+
+// Revoke marks an issued certificate as revoked and publishes a new CRL.
+func (ca *CA) Revoke(serial string, reason int) error {
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+
+	index, err := ca.readIndex()
+	if err != nil {
+		return err
+	}
+
+	serial = normalizeSerial(serial)
+	found := false
+	for idx := range index {
+		if index[idx].Serial != serial {
+			continue
+		}
+		if index[idx].RevokedAt != nil {
+			return fmt.Errorf("certificate %s is already revoked", serial)
+		}
+		now := time.Now().UTC()
+		index[idx].RevokedAt = &now
+		index[idx].Reason = reason
+		found = true
+	}
+	if !found {
+		return fmt.Errorf("no certificate with serial %s", serial)
+	}
+
+	if err := ca.writeIndex(index); err != nil {
+		return err
+	}
+	if _, err := ca.writeCRL(index); err != nil {
+		return err
+	}
+
+	ca.logger.Info("Revoked certificate", zap.String("serial", serial), zap.Int("reason", reason))
+	return nil
+}
+
+// List returns the issued certificates, the latest first.
+func (ca *CA) List() ([]IssuedCert, error) {
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+
+	if !ca.Initialized() {
+		return nil, ErrCANotInitialized
+	}
+	index, err := ca.readIndex()
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(index, func(i, j int) bool { return index[i].NotBefore.After(index[j].NotBefore) })
+	return index, nil
+}
+
+// Bundle returns the PEM certificates of the intermediate and the root,
+// which clients add to their trusted roots.
+func (ca *CA) Bundle() ([]byte, error) {
+	if !ca.Initialized() {
+		return nil, ErrCANotInitialized
+	}
+
+	var bundle []byte
+	for _, name := range []string{caIntermediateCert, caRootCert} {
+		data, err := os.ReadFile(ca.path(name))
+		if err != nil {
+			return nil, err
+		}
+		bundle = append(bundle, data...)
+	}
+	return bundle, nil
+}
+
+// RootPath returns the file of the root certificate.
+func (ca *CA) RootPath() string {
+	return CARootPath(ca.config)
+}
+
+// CARootPath returns the file of the root certificate in 'ca.dir'.
+func CARootPath(config *viper.Viper) string {
+	return filepath.Join(config.GetString("ca.dir"), caRootCert)
+}
+
+// CRL returns the PEM certificate revocation list of the intermediate. It is
+// signed again once half of its validity 'ca.crl-validity' has passed.
+func (ca *CA) CRL() ([]byte, error) {
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+
+	if !ca.Initialized() {
+		return nil, ErrCANotInitialized
+	}
+
+	data, err := os.ReadFile(ca.path(caCRL))
+	if err == nil {
+		if block, _ := pem.Decode(data); block != nil {
+			crl, err := x509.ParseRevocationList(block.Bytes)
+			if err == nil && time.Now().Before(crl.ThisUpdate.Add(crl.NextUpdate.Sub(crl.ThisUpdate)/2)) {
+				return data, nil
+			}
+		}
+	}
+
+	index, err := ca.readIndex()
+	if err != nil {
+		return nil, err
+	}
+	return ca.writeCRL(index)
+}
+
+// writeCRL signs a CRL of the revoked certificates in index. Expired certificates are left out.
+func (ca *CA) writeCRL(index []IssuedCert) ([]byte, error) {
+	issuer, issuerKey, err := ca.signer()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	var revoked []x509.RevocationListEntry
+	for _, cert := range index {
+		if cert.RevokedAt == nil || cert.NotAfter.Before(now) {
+			continue
+		}
+		serial, ok := new(big.Int).SetString(cert.Serial, 16)
+		if !ok {
+			return nil, fmt.Errorf("invalid serial %q in %s", cert.Serial, caIndex)
+		}
+		revoked = append(revoked, x509.RevocationListEntry{
+			SerialNumber:   serial,
+			RevocationTime: *cert.RevokedAt,
+			ReasonCode:     cert.Reason,
+		})
+	}
+
+	der, err := x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+		// CRL numbers must increase, the time does
+		Number:                    big.NewInt(now.UnixNano()),
+		ThisUpdate:                now,
+		NextUpdate:                now.Add(ca.config.GetDuration("ca.crl-validity")),
+		RevokedCertificateEntries: revoked,
+	}, issuer, issuerKey)
+	if err != nil {
+		return nil, fmt.Errorf("create CRL: %w", err)
+	}
+
+	data := pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: der})
+	if err := os.WriteFile(ca.path(caCRL), data, 0644); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func (ca *CA) readIndex() ([]IssuedCert, error) {
+	data, err := os.ReadFile(ca.path(caIndex))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var index []IssuedCert
+	if err := json.Unmarshal(data, &index); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", caIndex, err)
+	}
+	return index, nil
+}
+
+// writeIndex replaces the index through a temporary file, so it is never left half written.
+func (ca *CA) writeIndex(index []IssuedCert) error {
+	if index == nil {
+		index = []IssuedCert{}
+	}
+	data, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := ca.path(caIndex + ".tmp")
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, ca.path(caIndex))
+}
+
+// serialString formats serials like OpenSSL, as upper case hex.
+func serialString(serial *big.Int) string {
+	return strings.ToUpper(serial.Text(16))
+}
+
+// normalizeSerial accepts serials with colons or lower case, as printed by other tools.
+func normalizeSerial(serial string) string {
+	serial = strings.ToUpper(strings.ReplaceAll(serial, ":", ""))
+	return strings.TrimLeft(serial, "0")
+}
@@ -0,0 +1,82 @@
+package certs
+
+import (
+	"crypto/tls"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/acme"
+)
+
+// HTTPChallengePath is the path prefix ACME servers fetch HTTP-01 challenges from.
+const HTTPChallengePath = "/.well-known/acme-challenge/"
+
+// HTTPChallenges holds the key authorizations of pending ACME HTTP-01 challenges.
+// They are served by the plain-HTTP listener while an order is validated.
+type HTTPChallenges struct {
+	mu     sync.RWMutex
+	tokens map[string]string
+}
+
+func NewHTTPChallenges() *HTTPChallenges {
+	return &HTTPChallenges{tokens: map[string]string{}}
+}
+
+// Set publishes the key authorization of a challenge token.
+func (h *HTTPChallenges) Set(token, keyAuth string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.tokens[token] = keyAuth
+}
+
+// Delete removes a challenge once it is validated or failed.
+func (h *HTTPChallenges) Delete(token string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.tokens, token)
+}
+
+// Get returns the key authorization of a token.
+func (h *HTTPChallenges) Get(token string) (string, bool) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	keyAuth, ok := h.tokens[token]
+	return keyAuth, ok
+}
+
+// TLSALPNChallenges holds the certificates of pending ACME TLS-ALPN-01 challenges by domain.
+// The HTTPS server presents them to handshakes negotiating the "acme-tls/1" protocol.
+type TLSALPNChallenges struct {
+	mu    sync.RWMutex
+	certs map[string]*tls.Certificate
+}
+
+func NewTLSALPNChallenges() *TLSALPNChallenges {
+	return &TLSALPNChallenges{certs: map[string]*tls.Certificate{}}
+}
+
+// Set publishes the challenge certificate of a domain.
+func (t *TLSALPNChallenges) Set(domain string, cert *tls.Certificate) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.certs[strings.ToLower(domain)] = cert
+}
+
+// Delete removes a challenge once it is validated or failed.
+func (t *TLSALPNChallenges) Delete(domain string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.certs, strings.ToLower(domain))
+}
+
+// GetCertificate returns the challenge certificate for a handshake, if it is an ACME validation.
+func (t *TLSALPNChallenges) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, bool) {
+	if len(hello.SupportedProtos) != 1 || hello.SupportedProtos[0] != acme.ALPNProto {
+		return nil, false
+	}
+
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	cert, ok := t.certs[strings.ToLower(hello.ServerName)]
+	return cert, ok
+}
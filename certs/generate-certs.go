@@ -1,15 +1,20 @@
 package certs
 
 import (
+	"crypto"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"encoding/pem"
+	"fmt"
 	"math/big"
+	"net"
 	"os"
+	"path/filepath"
 	"time"
 
+	"github.com/spf13/viper"
 	"go.uber.org/fx"
 	"go.uber.org/zap"
 )
@@ -30,95 +35,170 @@ func NewCertGenerator(params CertGeneratorParams) *CertGenerator {
 	}
 }
 
-// CreateSelfSignedCert generates a self-signed RSA certificate and private key.
-func (cg *CertGenerator) CreateSelfSignedCert(certFile, keyFile string) error {
-	// Generate a private key using RSA (2048-bit key size)
-	priv, err := rsa.GenerateKey(rand.Reader, 2048)
-	if err != nil {
-		cg.logger.Warn("Failed to generate private key", zap.Error(err))
-		return err
+// CertOptions describe a generated certificate.
+type CertOptions struct {
+	DNSNames    []string
+	IPAddresses []net.IP
+	KeyType     string
+	Validity    time.Duration
+	Subject     pkix.Name
+}
+
+// OptionsFromConfig reads the certificate options of the 'certs' section.
+// Without configured SANs the certificate is issued for 'network.fqdn'; an
+// unspecified address like 0.0.0.0 stands for localhost and the hostname.
+func OptionsFromConfig(config *viper.Viper) (CertOptions, error) {
+	opts := CertOptions{
+		DNSNames: config.GetStringSlice("certs.dns-names"),
+		KeyType:  config.GetString("certs.key-type"),
+		Validity: config.GetDuration("certs.validity"),
+		Subject: pkix.Name{
+			CommonName:         config.GetString("certs.subject.common-name"),
+			Organization:       config.GetStringSlice("certs.subject.organization"),
+			OrganizationalUnit: config.GetStringSlice("certs.subject.organizational-unit"),
+			Country:            config.GetStringSlice("certs.subject.country"),
+			Province:           config.GetStringSlice("certs.subject.province"),
+			Locality:           config.GetStringSlice("certs.subject.locality"),
+		},
 	}
 
-	// Create a certificate template
-	notBefore := time.Now()
-	notAfter := notBefore.Add(365 * 24 * time.Hour) // 1 year
+	for _, addr := range config.GetStringSlice("certs.ip-addresses") {
+		ip := net.ParseIP(addr)
+		if ip == nil {
+			return opts, fmt.Errorf("certs.ip-addresses: invalid IP address %q", addr)
+		}
+		opts.IPAddresses = append(opts.IPAddresses, ip)
+	}
+
+	if len(opts.DNSNames) == 0 && len(opts.IPAddresses) == 0 {
+		opts.AddHost(config.GetString("network.fqdn"))
+	}
+	return opts, nil
+}
+
+// AddHost adds a host name or IP address to the SANs.
+func (o *CertOptions) AddHost(host string) {
+	ip := net.ParseIP(host)
+	switch {
+	case host == "":
+	case ip == nil:
+		o.DNSNames = append(o.DNSNames, host)
+	case ip.IsUnspecified():
+		o.DNSNames = append(o.DNSNames, "localhost")
+		if hostname, err := os.Hostname(); err == nil {
+			o.DNSNames = append(o.DNSNames, hostname)
+		}
+		o.IPAddresses = append(o.IPAddresses, net.IPv4(127, 0, 0, 1), net.IPv6loopback)
+	default:
+		o.IPAddresses = append(o.IPAddresses, ip)
+	}
+}
 
+// template returns the certificate template of the options, without key usages.
+func (o CertOptions) template() (*x509.Certificate, error) {
 	serialNumber, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
 	if err != nil {
-		cg.logger.Warn("Failed to generate serial number", zap.Error(err))
-		return err
+		return nil, fmt.Errorf("generate serial number: %w", err)
 	}
 
-	template := x509.Certificate{
-		SerialNumber: serialNumber,
-		Subject: pkix.Name{
-			Organization: []string{"Self-Signed Co"},
-		},
+	subject := o.Subject
+	if subject.CommonName == "" && len(o.DNSNames) > 0 {
+		subject.CommonName = o.DNSNames[0]
+	}
+
+	notBefore := time.Now()
+	return &x509.Certificate{
+		SerialNumber:          serialNumber,
+		Subject:               subject,
+		DNSNames:              o.DNSNames,
+		IPAddresses:           o.IPAddresses,
 		NotBefore:             notBefore,
-		NotAfter:              notAfter,
-		KeyUsage:              x509.KeyUsageKeyEncipherment | x509.KeyUsageDigitalSignature,
-		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		NotAfter:              notBefore.Add(o.Validity),
 		BasicConstraintsValid: true,
+	}, nil
+}
+
+// keyUsage returns the key usages of a leaf certificate. Only RSA keys encipher
+// the TLS key exchange, ECDSA and Ed25519 keys just sign.
+func keyUsage(key crypto.Signer) x509.KeyUsage {
+	if _, ok := key.Public().(*rsa.PublicKey); ok {
+		return x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment
 	}
+	return x509.KeyUsageDigitalSignature
+}
 
-	// Ensure the "certs" directory exists
-	err = os.MkdirAll("certs/", os.ModePerm)
-	if err != nil {
-		cg.logger.Fatal("Cannot create 'certs/' directory", zap.Error(err))
-		return err
+// CreateSelfSignedCert generates a self-signed server certificate and private key.
+func (cg *CertGenerator) CreateSelfSignedCert(certFile, keyFile string, opts CertOptions) error {
+	if opts.Validity <= 0 {
+		return fmt.Errorf("certificate validity must be positive, got %s", opts.Validity)
 	}
 
-	// Generate a self-signed certificate using the RSA private key
-	certDER, err := x509.CreateCertificate(rand.Reader, &template, &template, &priv.PublicKey, priv)
+	priv, err := GenerateKey(opts.KeyType)
 	if err != nil {
-		cg.logger.Warn("Failed to create certificate", zap.Error(err))
+		cg.logger.Warn("Failed to generate private key", zap.Error(err))
 		return err
 	}
 
-	// Save the certificate to certFile
-	certOut, err := os.Create(certFile)
+	template, err := opts.template()
 	if err != nil {
-		cg.logger.Warn("Failed to open cert.pem for writing", zap.Error(err))
+		cg.logger.Warn("Failed to create certificate template", zap.Error(err))
 		return err
 	}
-	defer func() {
-		if err := certOut.Close(); err != nil {
-			cg.logger.Warn("Cannot close certificate file", zap.Error(err))
-		}
-	}()
+	template.KeyUsage = keyUsage(priv)
+	template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
 
-	if err := pem.Encode(certOut, &pem.Block{Type: "CERTIFICATE", Bytes: certDER}); err != nil {
-		cg.logger.Warn("Failed to write certificate to file", zap.Error(err))
+	certDER, err := x509.CreateCertificate(rand.Reader, template, template, priv.Public(), priv)
+	if err != nil {
+		cg.logger.Warn("Failed to create certificate", zap.Error(err))
 		return err
 	}
 
-	// Save the RSA private key to keyFile
-	keyOut, err := os.Create(keyFile)
-	if err != nil {
-		cg.logger.Warn("Failed to open key.pem for writing", zap.Error(err))
+	if err := WriteCertificate(certFile, certDER); err != nil {
+		cg.logger.Warn("Failed to write certificate", zap.Error(err))
 		return err
 	}
-	defer func() {
-		if err := keyOut.Close(); err != nil {
-			cg.logger.Warn("Cannot close key file", zap.Error(err))
-		}
-	}()
-
-	// Marshal the RSA private key
-	privBytes := x509.MarshalPKCS1PrivateKey(priv)
-	if err := pem.Encode(keyOut, &pem.Block{Type: "RSA PRIVATE KEY", Bytes: privBytes}); err != nil {
-		cg.logger.Warn("Failed to write private key to file", zap.Error(err))
+	if err := WritePrivateKey(keyFile, priv); err != nil {
+		cg.logger.Warn("Failed to write private key", zap.Error(err))
 		return err
 	}
 
-	cg.logger.Info("Successfully created self-signed RSA certificate and private key",
+	cg.logger.Info("Successfully created self-signed certificate and private key",
 		zap.String("certFile", certFile),
 		zap.String("keyFile", keyFile),
+		zap.String("keyType", opts.KeyType),
+		zap.Strings("dnsNames", template.DNSNames),
+		zap.Time("notAfter", template.NotAfter),
 	)
 	return nil
 }
 
+// WriteCertificate stores DER certificates as PEM file, the leaf first.
+func WriteCertificate(path string, certs ...[]byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return err
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	for _, der := range certs {
+		if err := pem.Encode(file, &pem.Block{Type: "CERTIFICATE", Bytes: der}); err != nil {
+			return err
+		}
+	}
+	return file.Close()
+}
+
 // Module exports the certs module.
 var Module = fx.Options(
 	fx.Provide(NewCertGenerator),
+	fx.Provide(NewHTTPChallenges),
+	fx.Provide(NewTLSALPNChallenges),
+	fx.Provide(NewStore),
+	fx.Provide(NewCA),
+	fx.Provide(NewACME),
+	fx.Provide(NewExpiryMonitor),
 )
@@ -0,0 +1,89 @@
+package certs
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// CertInfo describes a certificate for 'packagelock certs inspect'.
+type CertInfo struct {
+	Subject     string    `json:"subject"`
+	Issuer      string    `json:"issuer"`
+	DNSNames    []string  `json:"dnsNames,omitempty"`
+	IPAddresses []string  `json:"ipAddresses,omitempty"`
+	NotBefore   time.Time `json:"notBefore"`
+	NotAfter    time.Time `json:"notAfter"`
+	KeyType     string    `json:"keyType"`
+	Serial      string    `json:"serial"`
+	Fingerprint string    `json:"fingerprint"` // SHA-256 of the DER certificate
+	SelfSigned  bool      `json:"selfSigned"`
+	IsCA        bool      `json:"isCA"`
+}
+
+// Describe returns the details of a certificate.
+func Describe(cert *x509.Certificate) CertInfo {
+	info := CertInfo{
+		Subject:     cert.Subject.String(),
+		Issuer:      cert.Issuer.String(),
+		DNSNames:    cert.DNSNames,
+		NotBefore:   cert.NotBefore.UTC(),
+		NotAfter:    cert.NotAfter.UTC(),
+		KeyType:     KeyType(cert.PublicKey),
+		Serial:      serialString(cert.SerialNumber),
+		Fingerprint: Fingerprint(cert),
+		SelfSigned:  bytes.Equal(cert.RawIssuer, cert.RawSubject),
+		IsCA:        cert.IsCA,
+	}
+	for _, ip := range cert.IPAddresses {
+		info.IPAddresses = append(info.IPAddresses, ip.String())
+	}
+	return info
+}
+
+// Fingerprint returns the SHA-256 fingerprint of a certificate like OpenSSL prints it, e.g. "AB:CD:...".
+func Fingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	hexSum := strings.ToUpper(hex.EncodeToString(sum[:]))
+
+	parts := make([]string, 0, len(sum))
+	for i := 0; i < len(hexSum); i += 2 {
+		parts = append(parts, hexSum[i:i+2])
+	}
+	return strings.Join(parts, ":")
+}
+
+// ReadCertificates reads all PEM certificates of a file, the leaf first.
+func ReadCertificates(path string) ([]*x509.Certificate, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("parse %s: %w", path, err)
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("%s: no PEM certificate found", path)
+	}
+	return certs, nil
+}
@@ -0,0 +1,211 @@
+package certs
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Key types of generated certificates.
+const (
+	KeyRSA2048   = "rsa-2048"
+	KeyRSA3072   = "rsa-3072"
+	KeyRSA4096   = "rsa-4096"
+	KeyECDSAP256 = "ecdsa-p256"
+	KeyECDSAP384 = "ecdsa-p384"
+	KeyEd25519   = "ed25519"
+)
+
+var keyGenerators = map[string]func() (crypto.Signer, error){
+	KeyRSA2048:   func() (crypto.Signer, error) { return rsa.GenerateKey(rand.Reader, 2048) },
+	KeyRSA3072:   func() (crypto.Signer, error) { return rsa.GenerateKey(rand.Reader, 3072) },
+	KeyRSA4096:   func() (crypto.Signer, error) { return rsa.GenerateKey(rand.Reader, 4096) },
+	KeyECDSAP256: func() (crypto.Signer, error) { return ecdsa.GenerateKey(elliptic.P256(), rand.Reader) },
+	KeyECDSAP384: func() (crypto.Signer, error) { return ecdsa.GenerateKey(elliptic.P384(), rand.Reader) },
+	KeyEd25519: func() (crypto.Signer, error) {
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		return key, err
+	},
+}
+
+// KeyTypes returns the supported key types in alphabetical order.
+func KeyTypes() []string {
+	types := make([]string, 0, len(keyGenerators))
+	for keyType := range keyGenerators {
+		types = append(types, keyType)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// GenerateKey creates a private key of the given type.
+func GenerateKey(keyType string) (crypto.Signer, error) {
+	generate, ok := keyGenerators[keyType]
+	if !ok {
+		return nil, fmt.Errorf("unknown key type %q, use one of %v", keyType, KeyTypes())
+	}
+	return generate()
+}
+
+// KeyType describes the type of a public key like the key type names, e.g. "ecdsa-p256".
+func KeyType(public crypto.PublicKey) string {
+	switch key := public.(type) {
+	case *rsa.PublicKey:
+		return fmt.Sprintf("rsa-%d", key.N.BitLen())
+	case *ecdsa.PublicKey:
+		return "ecdsa-" + map[string]string{"P-256": "p256", "P-384": "p384", "P-521": "p521"}[key.Curve.Params().Name]
+	case ed25519.PublicKey:
+		return KeyEd25519
+	}
+	return fmt.Sprintf("%T", public)
+}
+
+// WritePrivateKey stores a private key as PKCS #8 PEM file, readable only by its owner.
+func WritePrivateKey(path string, key crypto.Signer) error {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	// OpenFile keeps the mode of an existing file
+	if err := file.Chmod(0600); err != nil {
+		return err
+	}
+	if err := pem.Encode(file, &pem.Block{Type: "PRIVATE KEY", Bytes: der}); err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+// ParsePrivateKey reads a PEM encoded PKCS #8, PKCS #1 (RSA) or SEC 1 (EC) private key.
+func ParsePrivateKey(data []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data found")
+	}
+
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		return x509.ParseECPrivateKey(block.Bytes)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported private key %T", key)
+	}
+	return signer, nil
+}
+
+// JWTKey signs and verifies the JWTs of the API with the private key of the server certificate.
+type JWTKey struct {
+	Private crypto.Signer
+	Method  jwt.SigningMethod
+}
+
+// Public returns the key verifying the JWTs.
+func (k *JWTKey) Public() crypto.PublicKey {
+	return k.Private.Public()
+}
+
+// LoadJWTKey reads the private key at path and picks the matching signing method:
+// RS256 for RSA, ES256 or ES384 for ECDSA and EdDSA for Ed25519 keys.
+func LoadJWTKey(path string) (*JWTKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	key, err := ParsePrivateKey(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var method jwt.SigningMethod
+	switch private := key.(type) {
+	case *rsa.PrivateKey:
+		method = jwt.SigningMethodRS256
+	case *ecdsa.PrivateKey:
+		switch private.Curve {
+		case elliptic.P256():
+			method = jwt.SigningMethodES256
+		case elliptic.P384():
+			method = jwt.SigningMethodES384
+		}
+	case ed25519.PrivateKey:
+		method = jwt.SigningMethodEdDSA
+	}
+	if method == nil {
+		return nil, fmt.Errorf("no JWT signing method for %s keys", KeyType(key.Public()))
+	}
+	return &JWTKey{Private: key, Method: method}, nil
+}
+
+// JWTKeyFile keeps the JWT key of a file and reloads it when the file changes,
+// so tokens are verified with the current key after a certificate renewal.
+type JWTKeyFile struct {
+	path string
+
+	mu      sync.Mutex
+	key     *JWTKey
+	modTime time.Time
+}
+
+// NewJWTKeyFile creates the JWTKeyFile of path. The key is loaded on first use.
+func NewJWTKeyFile(path string) *JWTKeyFile {
+	return &JWTKeyFile{path: path}
+}
+
+// Key returns the current key. If the file can't be loaded, the previous key is kept.
+func (f *JWTKeyFile) Key() (*JWTKey, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	info, err := os.Stat(f.path)
+	if err == nil && (f.key == nil || !info.ModTime().Equal(f.modTime)) {
+		var key *JWTKey
+		if key, err = LoadJWTKey(f.path); err == nil {
+			f.key, f.modTime = key, info.ModTime()
+		}
+	}
+	if f.key == nil {
+		return nil, err
+	}
+	return f.key, nil
+}
+
+// Keyfunc verifies tokens with the current public key, see jwt.Keyfunc.
+func (f *JWTKeyFile) Keyfunc(token *jwt.Token) (interface{}, error) {
+	key, err := f.Key()
+	if err != nil {
+		return nil, err
+	}
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, fmt.Errorf("unexpected JWT signing method %s", token.Method.Alg())
+	}
+	return key.Public(), nil
+}
@@ -0,0 +1,158 @@
+package certs
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/spf13/viper"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+// certExpiry is exported at /metrics when monitoring is enabled.
+var certExpiry = prometheus.NewDesc(
+	"packagelock_certificate_expiry_seconds",
+	"Seconds until a served certificate expires, negative once it expired.",
+	[]string{"file", "subject"}, nil,
+)
+
+// expiryCollector computes the expiry on every scrape, so it never lags behind the reloads of the Store.
+type expiryCollector struct {
+	store *Store
+}
+
+func (c expiryCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- certExpiry
+}
+
+func (c expiryCollector) Collect(ch chan<- prometheus.Metric) {
+	for file, leaf := range c.store.Leaves() {
+		ch <- prometheus.MustNewConstMetric(certExpiry, prometheus.GaugeValue,
+			time.Until(leaf.NotAfter).Seconds(), file, leaf.Subject.String())
+	}
+}
+
+type ExpiryMonitorParams struct {
+	fx.In
+
+	Lifecycle fx.Lifecycle
+	Logger    *zap.Logger
+	Config    *viper.Viper
+	Store     *Store
+}
+
+// ExpiryMonitor warns about served certificates running out. Each threshold of
+// 'certs.expiry-warning-days' is logged once per certificate when it is crossed,
+// expired certificates are logged as errors on every check.
+type ExpiryMonitor struct {
+	logger     *zap.Logger
+	store      *Store
+	thresholds []int // days, descending
+
+	mu     sync.Mutex
+	warned map[string]int // fingerprint to the last threshold warned about
+}
+
+func NewExpiryMonitor(params ExpiryMonitorParams) *ExpiryMonitor {
+	thresholds := params.Config.GetIntSlice("certs.expiry-warning-days")
+	sort.Sort(sort.Reverse(sort.IntSlice(thresholds)))
+
+	monitor := &ExpiryMonitor{
+		logger:     params.Logger,
+		store:      params.Store,
+		thresholds: thresholds,
+		warned:     map[string]int{},
+	}
+
+	if !params.Config.GetBool("network.ssl") {
+		return monitor
+	}
+
+	if params.Config.GetString("general.monitoring") == "true" {
+		err := prometheus.Register(expiryCollector{store: params.Store})
+		var registered prometheus.AlreadyRegisteredError
+		if err != nil && !errors.As(err, &registered) {
+			params.Logger.Warn("Cannot export certificate expiry", zap.Error(err))
+		}
+	}
+
+	interval := params.Config.GetDuration("certs.expiry-check-interval")
+	if interval <= 0 {
+		return monitor
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	params.Lifecycle.Append(fx.Hook{
+		OnStart: func(context.Context) error {
+			// The Store loaded the certificates in its own start hook
+			monitor.Check()
+			go monitor.run(ctx, interval)
+			return nil
+		},
+		OnStop: func(context.Context) error {
+			cancel()
+			return nil
+		},
+	})
+
+	return monitor
+}
+
+func (m *ExpiryMonitor) run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m.Check()
+		}
+	}
+}
+
+// Check logs the served certificates which expired or crossed a warning threshold.
+func (m *ExpiryMonitor) Check() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for file, leaf := range m.store.Leaves() {
+		m.check(file, leaf)
+	}
+}
+
+func (m *ExpiryMonitor) check(file string, leaf *x509.Certificate) {
+	remaining := time.Until(leaf.NotAfter)
+	fields := []zap.Field{
+		zap.String("certFile", file),
+		zap.String("subject", leaf.Subject.String()),
+		zap.Time("notAfter", leaf.NotAfter),
+	}
+
+	if remaining <= 0 {
+		m.logger.Error("Certificate expired", fields...)
+		return
+	}
+
+	// The smallest threshold the certificate is within
+	threshold := 0
+	for _, days := range m.thresholds {
+		if remaining <= time.Duration(days)*24*time.Hour {
+			threshold = days
+		}
+	}
+
+	fingerprint := Fingerprint(leaf)
+	if threshold == 0 || m.warned[fingerprint] == threshold {
+		return
+	}
+	m.warned[fingerprint] = threshold
+	m.logger.Warn("Certificate expires soon",
+		append(fields, zap.Int("thresholdDays", threshold), zap.Int("daysLeft", int(remaining.Hours()/24)))...)
+}
@@ -0,0 +1,295 @@
+package certs
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/spf13/viper"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/acme"
+)
+
+// reloadDelay collects the file events of one renewal, which usually writes
+// the certificate and the key one after another, into a single reload.
+const reloadDelay = 500 * time.Millisecond
+
+// tlsVersions maps the values of 'network.ssl-config.minversion' to TLS versions.
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// KeyPair is a certificate and private key file served by the server.
+type KeyPair struct {
+	CertificatePath string `mapstructure:"certificatepath"`
+	PrivateKeyPath  string `mapstructure:"privatekeypath"`
+}
+
+type StoreParams struct {
+	fx.In
+
+	Lifecycle fx.Lifecycle
+	Logger    *zap.Logger
+	Config    *viper.Viper
+	ALPN      *TLSALPNChallenges
+}
+
+// Store serves the certificates of the HTTPS server. The certificate of
+// 'network.ssl-config' is the default, the ones of 'network.ssl-config.certificates'
+// are picked by SNI. Certificates are reloaded when their files change,
+// so renewed certificates are served without a restart.
+type Store struct {
+	logger *zap.Logger
+	config *viper.Viper
+	alpn   *TLSALPNChallenges
+	pairs  []KeyPair
+
+	mu    sync.RWMutex
+	certs []*tls.Certificate // same order as pairs, nil until loaded
+}
+
+func NewStore(params StoreParams) (*Store, error) {
+	store := &Store{
+		logger: params.Logger,
+		config: params.Config,
+		alpn:   params.ALPN,
+		pairs: []KeyPair{{
+			CertificatePath: params.Config.GetString("network.ssl-config.certificatepath"),
+			PrivateKeyPath:  params.Config.GetString("network.ssl-config.privatekeypath"),
+		}},
+	}
+
+	var sni []KeyPair
+	if err := params.Config.UnmarshalKey("network.ssl-config.certificates", &sni); err != nil {
+		return nil, fmt.Errorf("network.ssl-config.certificates: %w", err)
+	}
+	store.pairs = append(store.pairs, sni...)
+	store.certs = make([]*tls.Certificate, len(store.pairs))
+
+	if !params.Config.GetBool("network.ssl") {
+		return store, nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	params.Lifecycle.Append(fx.Hook{
+		OnStart: func(context.Context) error {
+			if _, err := store.TLSConfig(); err != nil {
+				cancel()
+				return err
+			}
+			if err := store.Reload(); err != nil {
+				cancel()
+				return err
+			}
+			watcher, err := store.watch()
+			if err != nil {
+				// Serving works without the watcher, renewals just need a restart
+				store.logger.Warn("Cannot watch certificate files, reload needs a restart", zap.Error(err))
+				return nil
+			}
+			go store.run(ctx, watcher)
+			return nil
+		},
+		OnStop: func(context.Context) error {
+			cancel()
+			return nil
+		},
+	})
+
+	return store, nil
+}
+
+// Reload reads all certificates from their files. A certificate that fails
+// to load keeps being served in its previous version.
+func (s *Store) Reload() error {
+	var errs []error
+	for idx, pair := range s.pairs {
+		cert, err := loadKeyPair(pair)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		s.mu.Lock()
+		s.certs[idx] = cert
+		s.mu.Unlock()
+
+		s.logger.Info("Loaded certificate",
+			zap.String("certFile", pair.CertificatePath),
+			zap.Strings("dnsNames", cert.Leaf.DNSNames),
+			zap.Time("notAfter", cert.Leaf.NotAfter),
+		)
+	}
+	return errors.Join(errs...)
+}
+
+func loadKeyPair(pair KeyPair) (*tls.Certificate, error) {
+	cert, err := tls.LoadX509KeyPair(pair.CertificatePath, pair.PrivateKeyPath)
+	if err != nil {
+		return nil, fmt.Errorf("load %s: %w", pair.CertificatePath, err)
+	}
+	// Needed to select certificates by SNI
+	cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return nil, fmt.Errorf("parse %s: %w", pair.CertificatePath, err)
+	}
+	return &cert, nil
+}
+
+// GetCertificate picks the certificate for a TLS handshake, see tls.Config.GetCertificate.
+// ACME TLS-ALPN-01 validations get their challenge certificate. Otherwise the first
+// SNI certificate valid for the requested name wins, else the default is served.
+func (s *Store) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	if cert, ok := s.alpn.GetCertificate(hello); ok {
+		return cert, nil
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if hello.ServerName != "" {
+		for _, cert := range s.certs[1:] {
+			if cert != nil && hello.SupportsCertificate(cert) == nil {
+				return cert, nil
+			}
+		}
+	}
+	if s.certs[0] == nil {
+		return nil, fmt.Errorf("no certificate loaded")
+	}
+	return s.certs[0], nil
+}
+
+// Leaves returns the loaded certificates by the file they were loaded from.
+func (s *Store) Leaves() map[string]*x509.Certificate {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	leaves := map[string]*x509.Certificate{}
+	for idx, cert := range s.certs {
+		if cert != nil {
+			leaves[s.pairs[idx].CertificatePath] = cert.Leaf
+		}
+	}
+	return leaves
+}
+
+// TLSConfig returns the TLS configuration of the HTTPS server, with the minimum version
+// of 'network.ssl-config.minversion' and the cipher suites of 'network.ssl-config.ciphersuites'.
+func (s *Store) TLSConfig() (*tls.Config, error) {
+	minVersion, ok := tlsVersions[s.config.GetString("network.ssl-config.minversion")]
+	if !ok {
+		return nil, fmt.Errorf("network.ssl-config.minversion must be 1.0, 1.1, 1.2 or 1.3")
+	}
+
+	suites, err := cipherSuites(s.config.GetStringSlice("network.ssl-config.ciphersuites"))
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion:     minVersion,
+		CipherSuites:   suites,
+		GetCertificate: s.GetCertificate,
+	}
+	// TLS-ALPN-01 validations only succeed if the server negotiates "acme-tls/1"
+	if s.config.GetBool("acme.enabled") && s.config.GetString("acme.challenge") == ChallengeTLSALPN01 {
+		tlsConfig.NextProtos = []string{"http/1.1", acme.ALPNProto}
+	}
+	return tlsConfig, nil
+}
+
+// cipherSuites looks up cipher suites by their names, e.g. TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256.
+// Insecure suites are refused. No names keep Go's defaults. TLS 1.3 suites are not configurable.
+func cipherSuites(names []string) ([]uint16, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	known := map[string]uint16{}
+	for _, suite := range tls.CipherSuites() {
+		known[suite.Name] = suite.ID
+	}
+
+	suites := make([]uint16, 0, len(names))
+	for _, name := range names {
+		id, ok := known[strings.ToUpper(name)]
+		if !ok {
+			return nil, fmt.Errorf("unknown or insecure cipher suite %q", name)
+		}
+		suites = append(suites, id)
+	}
+	return suites, nil
+}
+
+// watch watches the directories of the certificate files. Tools renewing certificates
+// often replace the files instead of writing them, which a watch on the file itself misses.
+func (s *Store) watch() (*fsnotify.Watcher, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+
+	dirs := map[string]bool{}
+	for _, pair := range s.pairs {
+		dirs[filepath.Dir(pair.CertificatePath)] = true
+		dirs[filepath.Dir(pair.PrivateKeyPath)] = true
+	}
+	for dir := range dirs {
+		if err := watcher.Add(dir); err != nil {
+			watcher.Close()
+			return nil, err
+		}
+	}
+	return watcher, nil
+}
+
+func (s *Store) watches(name string) bool {
+	for _, pair := range s.pairs {
+		if filepath.Clean(name) == filepath.Clean(pair.CertificatePath) || filepath.Clean(name) == filepath.Clean(pair.PrivateKeyPath) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Store) run(ctx context.Context, watcher *fsnotify.Watcher) {
+	defer watcher.Close()
+
+	reload := time.NewTimer(reloadDelay)
+	reload.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			if s.watches(event.Name) && !event.Has(fsnotify.Chmod) {
+				reload.Reset(reloadDelay)
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			s.logger.Warn("Certificate watcher failed", zap.Error(err))
+		case <-reload.C:
+			if err := s.Reload(); err != nil {
+				s.logger.Warn("Failed to reload certificates, serving the previous ones", zap.Error(err))
+			}
+		}
+	}
+}
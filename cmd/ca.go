@@ -0,0 +1,226 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"packagelock/certs"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+func NewCACmd() *cobra.Command {
+	caCmd := &cobra.Command{
+		Use:   "ca",
+		Short: "Manage the internal certificate authority",
+		Long: "Manage the PackageLock certificate authority in 'ca.dir': a root CA and an intermediate, " +
+			"which issues server and client certificates and publishes a revocation list.\n\n" +
+			"The running server serves the CA certificates at /v1/ca/bundle and the revocation list at /v1/ca/crl, " +
+			"so agents can trust the server without allowing self-signed certificates.",
+	}
+
+	caCmd.AddCommand(newCAInitCmd())
+	caCmd.AddCommand(newCAIssueCmd())
+	caCmd.AddCommand(newCARevokeCmd())
+	caCmd.AddCommand(newCAListCmd())
+	return caCmd
+}
+
+// runWithCA runs fn with the CA of the configuration.
+func runWithCA(action string, fn func(ca *certs.CA, config *viper.Viper, logger *zap.Logger)) {
+	runWithConfig(action, func(config *viper.Viper, logger *zap.Logger) {
+		fn(certs.NewCA(certs.CAParams{Logger: logger, Config: config}), config, logger)
+	})
+}
+
+func newCAInitCmd() *cobra.Command {
+	var force bool
+
+	initCmd := &cobra.Command{
+		Use:   "init",
+		Short: "Create the root and intermediate CA",
+		Long: "Create the root and intermediate CA in 'ca.dir'. Names, key type and validities " +
+			"are taken from the 'ca' settings.",
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			runWithCA("initialize CA", func(ca *certs.CA, config *viper.Viper, logger *zap.Logger) {
+				if err := ca.Init(force); err != nil {
+					fmt.Println("Failed to initialize CA:", err)
+					os.Exit(1)
+				}
+				fmt.Printf("Created certificate authority in %s.\n", config.GetString("ca.dir"))
+				fmt.Printf("Distribute %s to the clients which should trust it.\n", ca.RootPath())
+			})
+		},
+	}
+
+	initCmd.Flags().BoolVar(&force, "force", false, "replace an existing CA, invalidating all certificates it issued")
+	return initCmd
+}
+
+func newCAIssueCmd() *cobra.Command {
+	var client bool
+	var certOut, keyOut string
+
+	issueCmd := &cobra.Command{
+		Use:   "issue",
+		Short: "Issue a server or client certificate",
+		Long: "Issue a certificate signed by the intermediate CA. The certificate file contains the chain " +
+			"of the certificate and the intermediate.\n\n" +
+			"Server certificates are written to 'network.ssl-config.certificatepath' and 'privatekeypath' " +
+			"unless --cert and --key are given; the running server picks them up without a restart. " +
+			"Client certificates need --cn and are written to <cn>.crt and <cn>.key.",
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			runWithCA("issue certificate", func(ca *certs.CA, config *viper.Viper, logger *zap.Logger) {
+				applyCertFlags(cmd.Flags(), config)
+				opts, err := certs.OptionsFromConfig(config)
+				if err != nil {
+					fmt.Println("Invalid certificate options:", err)
+					os.Exit(1)
+				}
+
+				usage := certs.UsageServer
+				if client {
+					usage = certs.UsageClient
+					// The SANs default to the server, which a client certificate must not claim
+					if !cmd.Flags().Changed("dns") {
+						opts.DNSNames = nil
+					}
+					if !cmd.Flags().Changed("ip") {
+						opts.IPAddresses = nil
+					}
+				}
+
+				if certOut == "" && keyOut == "" {
+					if client {
+						certOut, keyOut = opts.Subject.CommonName+".crt", opts.Subject.CommonName+".key"
+					} else {
+						certOut = config.GetString("network.ssl-config.certificatepath")
+						keyOut = config.GetString("network.ssl-config.privatekeypath")
+					}
+				}
+				if certOut == "" || keyOut == "" {
+					fmt.Println("Please specify both --cert and --key.")
+					os.Exit(1)
+				}
+
+				chain, key, issued, err := ca.Issue(opts, usage)
+				if err != nil {
+					fmt.Println("Failed to issue certificate:", err)
+					os.Exit(1)
+				}
+				if err := certs.WritePrivateKey(keyOut, key); err != nil {
+					fmt.Println("Failed to write private key:", err)
+					os.Exit(1)
+				}
+				if err := os.WriteFile(certOut, chain, 0644); err != nil {
+					fmt.Println("Failed to write certificate:", err)
+					os.Exit(1)
+				}
+
+				fmt.Printf("Issued %s certificate %s for %s, valid until %s.\n",
+					issued.Usage, issued.Serial, issued.Subject, issued.NotAfter.Format(time.RFC3339))
+				fmt.Printf("Wrote %s and %s.\n", certOut, keyOut)
+			})
+		},
+	}
+
+	addCertFlags(issueCmd.Flags(), "")
+	issueCmd.Flags().BoolVar(&client, "client", false, "issue a client instead of a server certificate")
+	issueCmd.Flags().StringVar(&certOut, "cert", "", "file to write the certificate chain to")
+	issueCmd.Flags().StringVar(&keyOut, "key", "", "file to write the private key to")
+	return issueCmd
+}
+
+func newCARevokeCmd() *cobra.Command {
+	var reason string
+
+	reasons := make([]string, 0, len(certs.RevocationReasons))
+	for name := range certs.RevocationReasons {
+		reasons = append(reasons, name)
+	}
+	sort.Strings(reasons)
+
+	revokeCmd := &cobra.Command{
+		Use:   "revoke <serial>",
+		Short: "Revoke an issued certificate",
+		Long:  "Revoke a certificate issued by the CA and publish a new revocation list. Serials are listed by 'ca list'.",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			code, ok := certs.RevocationReasons[reason]
+			if !ok {
+				fmt.Printf("Invalid reason %q, use one of %s.\n", reason, strings.Join(reasons, ", "))
+				os.Exit(1)
+			}
+
+			runWithCA("revoke certificate", func(ca *certs.CA, config *viper.Viper, logger *zap.Logger) {
+				if err := ca.Revoke(args[0], code); err != nil {
+					fmt.Println("Failed to revoke certificate:", err)
+					os.Exit(1)
+				}
+				fmt.Printf("Revoked certificate %s.\n", args[0])
+			})
+		},
+	}
+
+	revokeCmd.Flags().StringVar(&reason, "reason", "unspecified", "reason of the revocation: "+strings.Join(reasons, ", "))
+	return revokeCmd
+}
+
+func newCAListCmd() *cobra.Command {
+	var asJSON bool
+
+	listCmd := &cobra.Command{
+		Use:   "list",
+		Short: "List the certificates issued by the CA",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			runWithCA("list certificates", func(ca *certs.CA, config *viper.Viper, logger *zap.Logger) {
+				issued, err := ca.List()
+				if err != nil {
+					fmt.Println("Failed to list certificates:", err)
+					os.Exit(1)
+				}
+
+				if asJSON {
+					data, err := json.MarshalIndent(issued, "", "  ")
+					if err != nil {
+						fmt.Println("Failed to encode certificates:", err)
+						os.Exit(1)
+					}
+					fmt.Println(string(data))
+					return
+				}
+
+				w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+				fmt.Fprintln(w, "SERIAL\tUSAGE\tSUBJECT\tNOT AFTER\tSTATUS")
+				for _, cert := range issued {
+					fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", cert.Serial, cert.Usage, cert.Subject,
+						cert.NotAfter.Format(time.DateOnly), certStatus(cert))
+				}
+				w.Flush()
+			})
+		},
+	}
+
+	listCmd.Flags().BoolVar(&asJSON, "json", false, "print the certificates as JSON")
+	return listCmd
+}
+
+// certStatus renders whether an issued certificate is valid, expired or revoked.
+func certStatus(cert certs.IssuedCert) string {
+	switch {
+	case cert.RevokedAt != nil:
+		return "revoked " + cert.RevokedAt.Format(time.DateOnly)
+	case cert.NotAfter.Before(time.Now()):
+		return "expired"
+	}
+	return "valid"
+}
@@ -0,0 +1,344 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"packagelock/campaign"
+	"packagelock/structs"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+// campaignClientFlags are shared by all campaign subcommands, which talk to the running server.
+type campaignClientFlags struct {
+	server   string
+	insecure bool
+}
+
+func (f *campaignClientFlags) register(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&f.server, "server", "", "server URL, e.g. https://packagelock.example.com:8080")
+	cmd.Flags().BoolVar(&f.insecure, "insecure", false, "don't verify the server certificate")
+}
+
+// run creates an API client and passes it to action.
+func (f *campaignClientFlags) run(name string, action func(client *apiClient)) {
+	runWithConfig(name, func(config *viper.Viper, logger *zap.Logger) {
+		client, err := newAPIClient(config, f.server, f.insecure)
+		if err != nil {
+			fmt.Println("Failed to create API client:", err)
+			os.Exit(1)
+		}
+		action(client)
+	})
+}
+
+func NewCampaignCmd() *cobra.Command {
+	campaignCmd := &cobra.Command{
+		Use:   "campaign",
+		Short: "Manage patch campaigns",
+		Long: "Create and follow patch campaigns, which roll out a job to hosts in waves inside a maintenance window.\n\n" +
+			"All subcommands talk to the running server, configured by the 'network' section or --server.",
+	}
+
+	campaignCmd.AddCommand(newCampaignListCmd())
+	campaignCmd.AddCommand(newCampaignShowCmd())
+	campaignCmd.AddCommand(newCampaignCreateCmd())
+	campaignCmd.AddCommand(newCampaignActionCmd("pause", "Stop dispatching jobs until the campaign is resumed"))
+	campaignCmd.AddCommand(newCampaignActionCmd("resume", "Continue a paused campaign, accepting a failed wave"))
+	campaignCmd.AddCommand(newCampaignActionCmd("cancel", "Stop a campaign for good"))
+	return campaignCmd
+}
+
+func newCampaignListCmd() *cobra.Command {
+	var flags campaignClientFlags
+
+	listCmd := &cobra.Command{
+		Use:   "list",
+		Short: "List all campaigns",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			flags.run("campaign list", func(client *apiClient) {
+				var campaigns []structs.Campaign
+				if err := client.do("GET", "/v1/campaigns", nil, &campaigns); err != nil {
+					fmt.Println("Failed to fetch campaigns:", err)
+					os.Exit(1)
+				}
+				if len(campaigns) == 0 {
+					fmt.Println("No campaigns.")
+					return
+				}
+
+				writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+				fmt.Fprintln(writer, "CAMPAIGN\tNAME\tSTATE\tWAVE\tHOSTS\tCREATED")
+				for _, c := range campaigns {
+					fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%d\t%s\n",
+						c.CampaignID, c.Name, c.State, waveProgress(c), len(c.Targets),
+						c.CreationTime.Local().Format("2006-01-02 15:04"))
+				}
+				_ = writer.Flush()
+			})
+		},
+	}
+
+	flags.register(listCmd)
+	return listCmd
+}
+
+func newCampaignShowCmd() *cobra.Command {
+	var flags campaignClientFlags
+	var watch bool
+
+	showCmd := &cobra.Command{
+		Use:   "show <CampaignID>",
+		Short: "Show the waves and hosts of a campaign",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			campaignID := parseCampaignID(args[0])
+
+			flags.run("campaign show", func(client *apiClient) {
+				interactive := isTerminal(os.Stdout)
+				printed := 0
+				lastView := ""
+				for {
+					var c structs.Campaign
+					if err := client.do("GET", "/v1/campaigns/"+campaignID.String(), nil, &c); err != nil {
+						fmt.Println("Failed to fetch campaign:", err)
+						os.Exit(1)
+					}
+
+					view := renderCampaign(c)
+					switch {
+					case !watch:
+						fmt.Print(view)
+						return
+					case interactive:
+						// Redraw in place
+						if printed > 0 {
+							fmt.Printf("\033[%dA\033[J", printed)
+						}
+						fmt.Print(view)
+						printed = strings.Count(view, "\n")
+					case view != lastView:
+						fmt.Print(view)
+						lastView = view
+					}
+
+					if campaign.IsFinished(c.State) || c.State == campaign.StatePaused {
+						return
+					}
+					time.Sleep(5 * time.Second)
+				}
+			})
+		},
+	}
+
+	flags.register(showCmd)
+	showCmd.Flags().BoolVarP(&watch, "watch", "w", false, "refresh until the campaign finishes or halts")
+	return showCmd
+}
+
+func newCampaignCreateCmd() *cobra.Command {
+	var flags campaignClientFlags
+	var name, windowID, jobType, haltAction string
+	var hostIDs, packages, waves []string
+	var duration, healthGrace time.Duration
+	var threshold float64
+
+	createCmd := &cobra.Command{
+		Use:   "create",
+		Short: "Create a campaign",
+		Long: "Create a campaign rolling out a job to hosts in waves inside a maintenance window.\n\n" +
+			"Every --wave is 'NAME=SPEC' or just 'SPEC', where SPEC is a percentage of all hosts ('10%'), " +
+			"a comma separated list of HostIDs or 'rest'. Without --wave, all hosts are patched at once.\n\n" +
+			"  packagelock campaign create --name openssl --window <WindowID> --host <HostID>... \\\n" +
+			"    --type update --package openssl --duration 30m \\\n" +
+			"    --wave canary=<HostID> --wave 10% --wave rest --threshold 20",
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			newCampaign := structs.Campaign{
+				Name:                    name,
+				JobType:                 jobType,
+				ExpectedDurationMinutes: int(duration.Minutes()),
+				FailureThreshold:        threshold,
+				HaltAction:              haltAction,
+				HealthGraceMinutes:      int(healthGrace.Minutes()),
+			}
+
+			var err error
+			if newCampaign.WindowID, err = uuid.Parse(windowID); err != nil {
+				fmt.Println("Invalid WindowID:", windowID)
+				os.Exit(1)
+			}
+			for _, raw := range hostIDs {
+				newCampaign.HostIDs = append(newCampaign.HostIDs, parseHostID(raw))
+			}
+			for _, raw := range packages {
+				pkg := structs.Job_Package{PackageName: raw}
+				if pkgName, version, ok := strings.Cut(raw, "="); ok {
+					pkg = structs.Job_Package{PackageName: pkgName, Version: version}
+				}
+				newCampaign.Spec.Packages = append(newCampaign.Spec.Packages, pkg)
+			}
+			for _, raw := range waves {
+				wave, err := parseWave(raw)
+				if err != nil {
+					fmt.Println(err)
+					os.Exit(1)
+				}
+				newCampaign.Waves = append(newCampaign.Waves, wave)
+			}
+
+			flags.run("campaign create", func(client *apiClient) {
+				var created structs.Campaign
+				if err := client.do("POST", "/v1/campaigns", newCampaign, &created); err != nil {
+					fmt.Println("Failed to create campaign:", err)
+					os.Exit(1)
+				}
+				fmt.Printf("Created campaign %s.\n\n", created.CampaignID)
+				fmt.Print(renderCampaign(created))
+			})
+		},
+	}
+
+	flags.register(createCmd)
+	createCmd.Flags().StringVar(&name, "name", "", "name of the campaign")
+	createCmd.Flags().StringVar(&windowID, "window", "", "WindowID of the maintenance window")
+	createCmd.Flags().StringSliceVar(&hostIDs, "host", nil, "hosts to patch")
+	createCmd.Flags().StringVar(&jobType, "type", "upgrade-all", "job type: install, update, remove or upgrade-all")
+	createCmd.Flags().StringSliceVar(&packages, "package", nil, "package of the job, 'name' or 'name=version'")
+	createCmd.Flags().DurationVar(&duration, "duration", 30*time.Minute, "expected duration of a job")
+	createCmd.Flags().StringArrayVar(&waves, "wave", nil, "wave of the rollout, see above")
+	createCmd.Flags().Float64Var(&threshold, "threshold", 0, "percentage of failed hosts in a wave which halts the campaign")
+	createCmd.Flags().StringVar(&haltAction, "halt", campaign.HaltPause, "what to do when a wave fails: pause or abort")
+	createCmd.Flags().DurationVar(&healthGrace, "health-grace", 0, "how long agents have to check in after their job (default from the server config)")
+	_ = createCmd.MarkFlagRequired("name")
+	_ = createCmd.MarkFlagRequired("window")
+	_ = createCmd.MarkFlagRequired("host")
+	return createCmd
+}
+
+// newCampaignActionCmd creates the subcommands which only POST to /v1/campaigns/{CampaignID}/{action}.
+func newCampaignActionCmd(action, short string) *cobra.Command {
+	var flags campaignClientFlags
+
+	actionCmd := &cobra.Command{
+		Use:   action + " <CampaignID>",
+		Short: short,
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			campaignID := parseCampaignID(args[0])
+
+			flags.run("campaign "+action, func(client *apiClient) {
+				var c structs.Campaign
+				if err := client.do("POST", "/v1/campaigns/"+campaignID.String()+"/"+action, nil, &c); err != nil {
+					fmt.Printf("Failed to %s campaign: %v\n", action, err)
+					os.Exit(1)
+				}
+				fmt.Print(renderCampaign(c))
+			})
+		},
+	}
+
+	flags.register(actionCmd)
+	return actionCmd
+}
+
+// parseWave parses a --wave flag, see 'campaign create --help'.
+func parseWave(raw string) (structs.Campaign_Wave, error) {
+	var wave structs.Campaign_Wave
+	spec := raw
+	if name, rest, ok := strings.Cut(raw, "="); ok {
+		wave.Name, spec = name, rest
+	}
+
+	switch {
+	case spec == "rest":
+	case strings.HasSuffix(spec, "%"):
+		percent, err := strconv.Atoi(strings.TrimSuffix(spec, "%"))
+		if err != nil || percent < 1 || percent > 100 {
+			return wave, fmt.Errorf("invalid wave %q: percentage must be between 1%% and 100%%", raw)
+		}
+		wave.Percent = percent
+	default:
+		for _, hostID := range strings.Split(spec, ",") {
+			parsed, err := uuid.Parse(strings.TrimSpace(hostID))
+			if err != nil {
+				return wave, fmt.Errorf("invalid wave %q: expected a percentage, 'rest' or HostIDs", raw)
+			}
+			wave.HostIDs = append(wave.HostIDs, parsed)
+		}
+	}
+	return wave, nil
+}
+
+func parseCampaignID(raw string) uuid.UUID {
+	campaignID, err := uuid.Parse(raw)
+	if err != nil {
+		fmt.Println("Invalid CampaignID:", raw)
+		os.Exit(1)
+	}
+	return campaignID
+}
+
+func parseHostID(raw string) uuid.UUID {
+	hostID, err := uuid.Parse(raw)
+	if err != nil {
+		fmt.Println("Invalid HostID:", raw)
+		os.Exit(1)
+	}
+	return hostID
+}
+
+// waveProgress renders the current wave of a campaign, e.g. "2/3 canary".
+func waveProgress(c structs.Campaign) string {
+	if len(c.Waves) == 0 {
+		return "-"
+	}
+	if c.CurrentWave >= len(c.Waves) {
+		return fmt.Sprintf("%d/%d", len(c.Waves), len(c.Waves))
+	}
+	return fmt.Sprintf("%d/%d %s", c.CurrentWave+1, len(c.Waves), c.Waves[c.CurrentWave].Name)
+}
+
+func renderCampaign(c structs.Campaign) string {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "Campaign %s (%s): %s, wave %s\n", c.Name, c.CampaignID, c.State, waveProgress(c))
+	fmt.Fprintf(&buf, "Job: %s", c.JobType)
+	for _, pkg := range c.Spec.Packages {
+		fmt.Fprintf(&buf, " %s", pkg.PackageName)
+		if pkg.Version != "" {
+			fmt.Fprintf(&buf, "=%s", pkg.Version)
+		}
+	}
+	fmt.Fprintf(&buf, ", halts (%s) above %.0f%% failed hosts per wave\n", c.HaltAction, c.FailureThreshold)
+	if c.HaltReason != "" {
+		fmt.Fprintf(&buf, "Halted: %s\n", c.HaltReason)
+	}
+
+	writer := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "\nWAVE\tHOST\tAGENT\tSTATE\tHEALTHY")
+	for _, target := range c.Targets {
+		waveName := strconv.Itoa(target.Wave + 1)
+		if target.Wave < len(c.Waves) {
+			waveName += " " + c.Waves[target.Wave].Name + " (" + c.Waves[target.Wave].State + ")"
+		}
+		agent, healthy := "-", "-"
+		if target.AgentID != uuid.Nil {
+			agent = target.AgentID.String()
+		}
+		if target.Healthy != nil {
+			healthy = strconv.FormatBool(*target.Healthy)
+		}
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%s\n", waveName, target.HostID, agent, target.State, healthy)
+	}
+	_ = writer.Flush()
+	return buf.String()
+}
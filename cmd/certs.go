@@ -0,0 +1,113 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"packagelock/certs"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+func NewCertsCmd() *cobra.Command {
+	certsCmd := &cobra.Command{
+		Use:   "certs",
+		Short: "Inspect the server certificates",
+	}
+
+	certsCmd.AddCommand(newCertsInspectCmd())
+	return certsCmd
+}
+
+func newCertsInspectCmd() *cobra.Command {
+	var file string
+	var asJSON bool
+
+	inspectCmd := &cobra.Command{
+		Use:   "inspect",
+		Short: "Print subject, SANs, issuer, validity, key type and fingerprint of a certificate",
+		Long: "Print the details of the certificate in 'network.ssl-config.certificatepath' or --file. " +
+			"Certificates after the first one, e.g. intermediates of a chain, are listed below it.",
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			runWithConfig("inspect certificate", func(config *viper.Viper, logger *zap.Logger) {
+				path := file
+				if path == "" {
+					path = config.GetString("network.ssl-config.certificatepath")
+				}
+
+				chain, err := certs.ReadCertificates(path)
+				if err != nil {
+					fmt.Println("Failed to read certificate:", err)
+					os.Exit(1)
+				}
+
+				infos := make([]certs.CertInfo, 0, len(chain))
+				for _, cert := range chain {
+					infos = append(infos, certs.Describe(cert))
+				}
+
+				if asJSON {
+					data, err := json.MarshalIndent(infos, "", "  ")
+					if err != nil {
+						fmt.Println("Failed to encode certificate:", err)
+						os.Exit(1)
+					}
+					fmt.Println(string(data))
+					return
+				}
+
+				fmt.Printf("File:         %s\n", path)
+				fmt.Print(renderCertInfo(infos[0]))
+				for _, info := range infos[1:] {
+					fmt.Printf("Chain:        %s (expires %s)\n", info.Subject, info.NotAfter.Format(time.RFC3339))
+				}
+			})
+		},
+	}
+
+	inspectCmd.Flags().StringVarP(&file, "file", "f", "", "PEM certificate to inspect instead of the configured one")
+	inspectCmd.Flags().BoolVar(&asJSON, "json", false, "print the certificates as JSON")
+	return inspectCmd
+}
+
+// renderCertInfo renders the details of a certificate as aligned lines.
+func renderCertInfo(info certs.CertInfo) string {
+	var out strings.Builder
+	w := tabwriter.NewWriter(&out, 0, 0, 1, ' ', 0)
+
+	fmt.Fprintf(w, "Subject:\t%s\n", info.Subject)
+	fmt.Fprintf(w, "Issuer:\t%s\n", info.Issuer)
+	fmt.Fprintf(w, "DNS names:\t%s\n", joinOrNone(info.DNSNames))
+	fmt.Fprintf(w, "IP addresses:\t%s\n", joinOrNone(info.IPAddresses))
+	fmt.Fprintf(w, "Not before:\t%s\n", info.NotBefore.Format(time.RFC3339))
+	fmt.Fprintf(w, "Not after:\t%s (%s)\n", info.NotAfter.Format(time.RFC3339), expiresIn(info.NotAfter))
+	fmt.Fprintf(w, "Key type:\t%s\n", info.KeyType)
+	fmt.Fprintf(w, "Serial:\t%s\n", info.Serial)
+	fmt.Fprintf(w, "SHA-256:\t%s\n", info.Fingerprint)
+	fmt.Fprintf(w, "Self-signed:\t%t\n", info.SelfSigned)
+	w.Flush()
+
+	return out.String()
+}
+
+func joinOrNone(values []string) string {
+	if len(values) == 0 {
+		return "-"
+	}
+	return strings.Join(values, ", ")
+}
+
+// expiresIn renders the time left until notAfter, e.g. "expires in 29 days".
+func expiresIn(notAfter time.Time) string {
+	remaining := time.Until(notAfter)
+	if remaining <= 0 {
+		return fmt.Sprintf("expired %d days ago", int(-remaining.Hours()/24))
+	}
+	return fmt.Sprintf("expires in %d days", int(remaining.Hours()/24))
+}
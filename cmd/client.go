@@ -0,0 +1,127 @@
+package cmd
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"packagelock/certs"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/spf13/viper"
+)
+
+// apiClient talks to the running server for commands which need it to act, e.g. to push jobs.
+type apiClient struct {
+	baseURL string
+	token   string
+	http    *http.Client
+}
+
+// newAPIClient creates a client for the server described by the config.
+// server overrides the address, insecure skips certificate verification.
+// In production, the client signs its own token with the server's private key.
+func newAPIClient(config *viper.Viper, server string, insecure bool) (*apiClient, error) {
+	if server == "" {
+		scheme := "http"
+		if config.GetBool("network.ssl") {
+			scheme = "https"
+		}
+		host := config.GetString("network.fqdn")
+		if host == "" || host == "0.0.0.0" || host == "::" {
+			host = "localhost"
+		}
+		server = fmt.Sprintf("%s://%s:%s", scheme, host, config.GetString("network.port"))
+	}
+
+	tlsConfig := &tls.Config{InsecureSkipVerify: insecure}
+	if !insecure {
+		// The server certificate is usually self-signed or issued by the internal CA, so trust both explicitly
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		for _, path := range []string{config.GetString("network.ssl-config.certificatepath"), certs.CARootPath(config)} {
+			if certData, err := os.ReadFile(path); err == nil {
+				pool.AppendCertsFromPEM(certData)
+			}
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	client := &apiClient{
+		baseURL: strings.TrimSuffix(server, "/"),
+		http: &http.Client{
+			Timeout:   30 * time.Second,
+			Transport: &http.Transport{TLSClientConfig: tlsConfig},
+		},
+	}
+
+	if config.GetBool("general.production") {
+		key, err := certs.LoadJWTKey(config.GetString("network.ssl-config.privatekeypath"))
+		if err != nil {
+			return nil, fmt.Errorf("cannot load private key for JWT: %w", err)
+		}
+
+		token := jwt.NewWithClaims(key.Method, jwt.MapClaims{
+			"username": "packagelock-cli",
+			"exp":      time.Now().Add(time.Hour).Unix(),
+		})
+		client.token, err = token.SignedString(key.Private)
+		if err != nil {
+			return nil, fmt.Errorf("cannot generate JWT: %w", err)
+		}
+	}
+
+	return client, nil
+}
+
+// do sends a JSON request and decodes the JSON response into out, if given.
+func (c *apiClient) do(method, path string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(encoded)
+	}
+
+	req, err := http.NewRequest(method, c.baseURL+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode >= 300 {
+		var apiErr struct{ Error string }
+		if json.Unmarshal(data, &apiErr) == nil && apiErr.Error != "" {
+			return fmt.Errorf("%s %s: %s (%d)", method, path, apiErr.Error, resp.StatusCode)
+		}
+		return fmt.Errorf("%s %s: %s", method, path, resp.Status)
+	}
+
+	if out == nil || len(data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(data, out)
+}
@@ -10,6 +10,7 @@ import (
 	"packagelock/logger"
 	"packagelock/structs"
 	"packagelock/tracing"
+	"strings"
 	"time"
 
 	configPkg "packagelock/config"
@@ -18,6 +19,7 @@ import (
 	"github.com/k0kubun/pp"
 	"github.com/sethvargo/go-password/password"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 	"github.com/surrealdb/surrealdb.go"
 	"go.uber.org/fx"
@@ -27,10 +29,22 @@ import (
 
 func NewGenerateCmd() *cobra.Command {
 	generateCmd := &cobra.Command{
-		Use:       "generate [certs|config|admin]",
-		Short:     "Generate certificates, configuration files, or an admin",
-		Long:      "Generate certificates, configuration files, or an admin user required by the application.",
-		Args:      cobra.ExactValidArgs(1),
+		Use:   "generate [certs [letsencrypt [renew]]|config|admin]",
+		Short: "Generate certificates, configuration files, or an admin",
+		Long: "Generate certificates, configuration files, or an admin user required by the application.\n\n" +
+			"'generate certs letsencrypt' obtains the server certificate from the ACME CA of 'acme.directory-url' " +
+			"instead of creating a self-signed one, 'generate certs letsencrypt renew' only if it is due. " +
+			"The challenges are answered on the ports of the server, so it must not be running; " +
+			"a running server renews by itself with 'acme.enabled'.",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) > 1 && args[0] == "certs" {
+				if args[1] != "letsencrypt" || len(args) > 3 || (len(args) == 3 && args[2] != "renew") {
+					return fmt.Errorf("invalid arguments %q, use 'certs letsencrypt [renew]'", args[1:])
+				}
+				return nil
+			}
+			return cobra.ExactValidArgs(1)(cmd, args)
+		},
 		ValidArgs: []string{"certs", "config", "admin"},
 		Run: func(cmd *cobra.Command, args []string) {
 			if len(args) == 0 {
@@ -39,12 +53,18 @@ func NewGenerateCmd() *cobra.Command {
 			}
 			switch args[0] {
 			case "certs":
+				if len(args) > 1 {
+					runGenerateLetsEncrypt(len(args) == 3)
+					os.Exit(0)
+				}
+
 				app := fx.New(
 					fx.Provide(func() string { return "Command Runner" }),
 					logger.Module,
 					configPkg.Module,
 					certs.Module,
 					tracing.Module,
+					fx.Invoke(func(config *viper.Viper) { applyCertFlags(cmd.Flags(), config) }),
 					fx.Invoke(runGenerateCerts),
 				)
 
@@ -105,14 +125,61 @@ func NewGenerateCmd() *cobra.Command {
 		},
 	}
 
+	addCertFlags(generateCmd.Flags(), "certs: ")
+
 	return generateCmd
 }
 
+// addCertFlags registers the flags overriding the 'certs' settings, see certFlags.
+func addCertFlags(flags *pflag.FlagSet, prefix string) {
+	flags.StringSlice("dns", nil, prefix+"DNS names of the certificate (default from certs.dns-names or network.fqdn)")
+	flags.StringSlice("ip", nil, prefix+"IP addresses of the certificate (default from certs.ip-addresses)")
+	flags.String("key-type", "", fmt.Sprintf("%skey type, one of %s (default from certs.key-type)", prefix, strings.Join(certs.KeyTypes(), ", ")))
+	flags.Duration("validity", 0, prefix+"how long the certificate is valid, e.g. 8760h (default from certs.validity)")
+	flags.String("cn", "", prefix+"subject common name (default the first DNS name)")
+	flags.StringSlice("org", nil, prefix+"subject organization")
+	flags.StringSlice("ou", nil, prefix+"subject organizational unit")
+	flags.StringSlice("country", nil, prefix+"subject country")
+	flags.StringSlice("province", nil, prefix+"subject province")
+	flags.StringSlice("locality", nil, prefix+"subject locality")
+}
+
+// certFlags maps the flags of 'generate certs' to the config keys they override.
+var certFlags = map[string]string{
+	"dns":      "certs.dns-names",
+	"ip":       "certs.ip-addresses",
+	"key-type": "certs.key-type",
+	"validity": "certs.validity",
+	"cn":       "certs.subject.common-name",
+	"org":      "certs.subject.organization",
+	"ou":       "certs.subject.organizational-unit",
+	"country":  "certs.subject.country",
+	"province": "certs.subject.province",
+	"locality": "certs.subject.locality",
+}
+
+// applyCertFlags overrides the certificate config with the flags given on the command line.
+func applyCertFlags(flags *pflag.FlagSet, config *viper.Viper) {
+	for name, key := range certFlags {
+		if flag := flags.Lookup(name); flag != nil && flag.Changed {
+			if slice, ok := flag.Value.(pflag.SliceValue); ok {
+				config.Set(key, slice.GetSlice())
+			} else {
+				config.Set(key, flag.Value.String())
+			}
+		}
+	}
+}
+
 func runGenerateCerts(certGen *certs.CertGenerator, logger *zap.Logger, config *viper.Viper) {
-	err := certGen.CreateSelfSignedCert(
-		config.GetString("network.ssl-config.certificatepath"),
-		config.GetString("network.ssl-config.privatekeypath"),
-	)
+	opts, err := certs.OptionsFromConfig(config)
+	if err == nil {
+		err = certGen.CreateSelfSignedCert(
+			config.GetString("network.ssl-config.certificatepath"),
+			config.GetString("network.ssl-config.privatekeypath"),
+			opts,
+		)
+	}
 	if err != nil {
 		fmt.Printf("Error generating self-signed certs: %v\n", err)
 		logger.Warn("Error generating self-signed certs", zap.Error(err))
@@ -122,6 +189,50 @@ func runGenerateCerts(certGen *certs.CertGenerator, logger *zap.Logger, config *
 	}
 }
 
+// runGenerateLetsEncrypt obtains the server certificate via ACME, with renew only if it is due.
+func runGenerateLetsEncrypt(renew bool) {
+	var acmeClient *certs.ACME
+	// Not started, which would run the renewals of 'acme.enabled' next to this one
+	app := fx.New(
+		fx.Provide(func() string { return "Command Runner" }),
+		logger.Module,
+		configPkg.Module,
+		certs.Module,
+		tracing.Module,
+		fx.Populate(&acmeClient),
+	)
+	if err := app.Err(); err != nil {
+		fmt.Println("Failed to set up ACME client:", err)
+		os.Exit(1)
+	}
+
+	if renew {
+		reason, err := acmeClient.NeedsRenewal()
+		if err != nil {
+			fmt.Println("Failed to check certificate:", err)
+			os.Exit(1)
+		}
+		if reason == "" {
+			fmt.Println("Certificate is not due for renewal.")
+			return
+		}
+		fmt.Printf("Renewing certificate: %s.\n", reason)
+	}
+
+	stop, err := acmeClient.ServeChallenges()
+	if err != nil {
+		fmt.Println("Failed to listen for ACME challenges, is the server running?", err)
+		os.Exit(1)
+	}
+	err = acmeClient.Obtain(context.Background())
+	stop()
+	if err != nil {
+		fmt.Println("Failed to obtain certificate:", err)
+		os.Exit(1)
+	}
+	fmt.Println("Certificate obtained successfully.")
+}
+
 func runGenerateConfig(config *viper.Viper, logger *zap.Logger) {
 	configPkg.CreateDefaultConfig(config, logger)
 	logger.Info("Default configuration file created.")
@@ -0,0 +1,80 @@
+package cmd
+
+import (
+	"fmt"
+	"packagelock/db"
+	"packagelock/osv"
+	"packagelock/structs"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+// osvImportBatchSize is the number of vulnerabilities written to the DB at once.
+const osvImportBatchSize = 500
+
+func NewOSVCmd() *cobra.Command {
+	osvCmd := &cobra.Command{
+		Use:   "osv",
+		Short: "Manage the offline vulnerability database",
+	}
+
+	importCmd := &cobra.Command{
+		Use:   "import <dir|archive>",
+		Short: "Import an OSV dump from a directory, .zip or .tar.gz archive",
+		Long: "Import OSV vulnerability records into the database. Only the ecosystems listed in " +
+			"'osv.ecosystems' (Debian, Ubuntu, Alpine and Rocky Linux by default) are imported. " +
+			"Records already in the database are replaced.",
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			runWithDB("import OSV dump", func(db *db.Database, config *viper.Viper, logger *zap.Logger) {
+				runOSVImport(args[0], db, logger, config)
+			})
+		},
+	}
+
+	osvCmd.AddCommand(importCmd)
+	return osvCmd
+}
+
+func runOSVImport(path string, db *db.Database, logger *zap.Logger, config *viper.Viper) {
+	ecosystems := config.GetStringSlice("osv.ecosystems")
+	importTime := time.Now()
+
+	var batch []structs.Vulnerability
+	imported := 0
+	flush := func() error {
+		if err := osv.Save(db, batch); err != nil {
+			return err
+		}
+		imported += len(batch)
+		batch = batch[:0]
+		fmt.Printf("\rImported %d vulnerabilities", imported)
+		return nil
+	}
+
+	err := osv.ReadDump(path, ecosystems, func(vuln structs.Vulnerability) error {
+		vuln.ImportTime = importTime
+		batch = append(batch, vuln)
+		if len(batch) >= osvImportBatchSize {
+			return flush()
+		}
+		return nil
+	})
+	if flushErr := flush(); flushErr != nil && err == nil {
+		err = flushErr
+	}
+	fmt.Println()
+
+	if err != nil {
+		fmt.Println("OSV import finished with errors:")
+		fmt.Println(err)
+		logger.Warn("OSV import finished with errors", zap.Int("imported", imported), zap.Error(err))
+		return
+	}
+
+	fmt.Printf("Imported %d vulnerabilities from %s.\n", imported, path)
+	logger.Info("Imported OSV dump", zap.String("path", path), zap.Int("imported", imported))
+}
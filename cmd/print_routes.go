@@ -1,61 +1,156 @@
 package cmd
 
 import (
-	"context"
+	"encoding/json"
 	"fmt"
+	"io"
 	"os"
+	"packagelock/approvals"
+	"packagelock/campaign"
 	"packagelock/certs"
 	"packagelock/config"
 	"packagelock/db"
+	"packagelock/decommission"
+	"packagelock/drift"
 	"packagelock/handler"
-	"packagelock/logger"
+	"packagelock/jobs"
+	"packagelock/repos"
 	"packagelock/server"
+	"packagelock/stream"
+	"strings"
+	"text/tabwriter"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/fx"
 	"go.uber.org/zap"
 )
 
 func NewPrintRoutesCmd() *cobra.Command {
+	var format, output string
+
 	printRoutesCmd := &cobra.Command{
 		Use:   "print-routes",
 		Short: "Prints out all registered routes",
+		Long: `Prints out all registered routes with their handler and the middleware running before it.
+The routes are built like the server builds them, but without connecting to the database.
+
+Formats:
+  table     aligned columns (default)
+  json      array of routes
+  markdown  table for the wiki
+  openapi   OpenAPI document of the API`,
 		Run: func(cmd *cobra.Command, args []string) {
+			print, ok := routePrinters[format]
+			if !ok {
+				fmt.Println("Unknown format:", format, "(use table, json, markdown or openapi)")
+				os.Exit(1)
+			}
+
+			var routes *fiber.App
+			var conf *viper.Viper
+			// Constructors only store the database, it is used once requests come in.
+			// The lifecycle is never started, so no server listens and no worker runs.
 			app := fx.New(
 				fx.Provide(func() string { return "Command Runner" }),
-				logger.Module,
-				server.Module,
-				handler.Module,
+				fx.Provide(newCommandLogger),
+				fx.Provide(func() *db.Database { return &db.Database{} }),
+				fx.Provide(func() trace.Tracer { return otel.GetTracerProvider().Tracer("noop-tracer") }),
 				config.Module,
 				certs.Module,
-				db.Module,
-				fx.Invoke(runPrintRoutes),
+				repos.Module,
+				drift.Module,
+				jobs.Module,
+				stream.Module,
+				campaign.Module,
+				approvals.Module,
+				decommission.Module,
+				handler.Module,
+				server.Module,
+				fx.Populate(&routes, &conf),
+				fx.NopLogger,
 			)
-
-			if err := app.Start(context.Background()); err != nil {
-				fmt.Println("Failed to start application for printing routes:", err)
+			if err := app.Err(); err != nil {
+				fmt.Println("Failed to build routes:", err)
 				os.Exit(1)
 			}
 
-			// Since runPrintRoutes runs synchronously, we can stop the app immediately
-			if err := app.Stop(context.Background()); err != nil {
-				fmt.Println("Failed to stop application after printing routes:", err)
+			// The application logs to stdout as well, a file keeps the output clean
+			if output == "-" {
+				if err := print(os.Stdout, routes, conf); err != nil {
+					fmt.Println("Failed to print routes:", err)
+					os.Exit(1)
+				}
+				return
+			}
+			file, err := os.Create(output)
+			if err != nil {
+				fmt.Println("Failed to create output file:", err)
+				os.Exit(1)
+			}
+			defer file.Close()
+			if err := print(file, routes, conf); err != nil {
+				fmt.Println("Failed to write routes:", err)
 				os.Exit(1)
 			}
+			fmt.Printf("Wrote routes to %s.\n", output)
 		},
 	}
 
+	printRoutesCmd.Flags().StringVar(&format, "format", "table", "Output format: table, json, markdown or openapi")
+	printRoutesCmd.Flags().StringVarP(&output, "output", "o", "-", "file to write, '-' for stdout")
+
 	return printRoutesCmd
 }
 
-func runPrintRoutes(app *fiber.App, logger *zap.Logger) {
-	routes := app.Stack() // Get all registered routes
-	for _, route := range routes {
-		for _, r := range route {
-			fmt.Printf("%s %s\n", r.Method, r.Path)
+// newCommandLogger only logs warnings, to stderr, so the output can be piped.
+func newCommandLogger() (*zap.Logger, error) {
+	conf := zap.NewDevelopmentConfig()
+	conf.Level = zap.NewAtomicLevelAt(zap.WarnLevel)
+	return conf.Build()
+}
+
+var routePrinters = map[string]func(w io.Writer, app *fiber.App, conf *viper.Viper) error{
+	"table":    printRoutesTable,
+	"json":     printRoutesJSON,
+	"markdown": printRoutesMarkdown,
+	"openapi":  printRoutesOpenAPI,
+}
+
+func printRoutesTable(w io.Writer, app *fiber.App, conf *viper.Viper) error {
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "METHOD\tPATH\tHANDLER\tAUTH\tMIDDLEWARE")
+	for _, route := range server.Routes(app) {
+		fmt.Fprintf(table, "%s\t%s\t%s\t%s\t%s\n",
+			route.Method, route.Path, route.Handler, route.Auth, strings.Join(route.Middleware, ", "))
+	}
+	return table.Flush()
+}
+
+func printRoutesJSON(w io.Writer, app *fiber.App, conf *viper.Viper) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(server.Routes(app))
+}
+
+func printRoutesMarkdown(w io.Writer, app *fiber.App, conf *viper.Viper) error {
+	fmt.Fprintln(w, "|Method|Path|Handler|Auth|Middleware|")
+	fmt.Fprintln(w, "|------|----|-------|----|----------|")
+	for _, route := range server.Routes(app) {
+		_, err := fmt.Fprintf(w, "|%s|`%s`|%s|%s|%s|\n",
+			route.Method, route.Path, route.Handler, route.Auth, strings.Join(route.Middleware, ", "))
+		if err != nil {
+			return err
 		}
 	}
-	logger.Info("Printed all routes.")
-	os.Exit(0)
+	return nil
+}
+
+func printRoutesOpenAPI(w io.Writer, app *fiber.App, conf *viper.Viper) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(server.NewOpenAPIDocument(app, conf))
 }
@@ -0,0 +1,102 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"packagelock/db"
+	"packagelock/repos"
+	"packagelock/structs"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/surrealdb/surrealdb.go"
+	"go.uber.org/zap"
+)
+
+func NewRepoCmd() *cobra.Command {
+	repoCmd := &cobra.Command{
+		Use:   "repo",
+		Short: "Manage mirrored repository indexes",
+	}
+
+	syncCmd := &cobra.Command{
+		Use:   "sync",
+		Short: "Download the indexes of all repositories used by known hosts",
+		Long: "Download the package indexes of all repositories reported by hosts into the mirror directory " +
+			"('repos.mirror-dir') and recompute which packages are updatable. " +
+			"The server only ever reads the mirror directory, so it works offline.",
+		Run: func(cmd *cobra.Command, args []string) {
+			runWithDB("sync repositories", func(db *db.Database, config *viper.Viper, logger *zap.Logger) {
+				indexes := repos.NewIndexStore(repos.IndexStoreParams{Logger: logger, Config: config})
+				runRepoSync(db, indexes, logger, config)
+			})
+		},
+	}
+
+	repoCmd.AddCommand(syncCmd)
+	return repoCmd
+}
+
+func runRepoSync(db *db.Database, indexes *repos.IndexStore, logger *zap.Logger, config *viper.Viper) {
+	hosts, err := surrealdb.SmartUnmarshal[[]structs.Host](db.DB.Select("hosts"))
+	if err != nil {
+		logger.Fatal("Failed to fetch hosts", zap.Error(err))
+	}
+
+	// Hosts share most of their repositories, every index is only fetched once
+	seen := map[string]bool{}
+	var mirrors []repos.Mirror
+	for _, host := range hosts {
+		for _, repo := range host.PackageManager.PackageRepos {
+			for _, mirror := range repos.Mirrors(repo, host.Arch) {
+				if !seen[mirror.Key] {
+					seen[mirror.Key] = true
+					mirrors = append(mirrors, mirror)
+				}
+			}
+		}
+	}
+
+	fmt.Printf("Syncing %d repository indexes...\n", len(mirrors))
+	syncer := repos.NewSyncer(
+		config.GetString("repos.mirror-dir"),
+		config.GetDuration("repos.sync-timeout"),
+		logger,
+	)
+	if err := syncer.Sync(context.Background(), mirrors); err != nil {
+		fmt.Println("Some repositories failed to sync:")
+		fmt.Println(err)
+	}
+
+	// Recompute Updatable for all known packages against the new indexes
+	index := indexes.Index()
+	updated := 0
+	for _, host := range hosts {
+		packages, err := surrealdb.SmartUnmarshal[[]structs.Package](db.DB.Query(
+			"SELECT * FROM packages WHERE HostID = $hostID",
+			map[string]interface{}{"hostID": host.HostID.String()},
+		))
+		if err != nil {
+			logger.Warn("Failed to fetch host packages", zap.String("HostID", host.HostID.String()), zap.Error(err))
+			continue
+		}
+
+		before := make([]structs.Package, len(packages))
+		copy(before, packages)
+		index.UpdatePackages(host, packages)
+
+		for idx, pkg := range packages {
+			if pkg.Updatable == before[idx].Updatable && pkg.CandidateVersion == before[idx].CandidateVersion {
+				continue
+			}
+			if _, err := db.DB.Update(pkg.ID, pkg); err != nil {
+				logger.Warn("Failed to update package", zap.String("package", pkg.PackageName), zap.Error(err))
+				continue
+			}
+			updated++
+		}
+	}
+
+	fmt.Printf("Synced %d repository indexes, updated %d packages.\n", index.Len(), updated)
+	logger.Info("Repository sync finished", zap.Int("repos", index.Len()), zap.Int("updatedPackages", updated))
+}
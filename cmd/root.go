@@ -33,6 +33,14 @@ func NewRootCmd() *cobra.Command {
 	rootCmd.AddCommand(NewSetupCmd())
 	rootCmd.AddCommand(NewGenerateCmd())
 	rootCmd.AddCommand(NewPrintRoutesCmd())
+	rootCmd.AddCommand(NewRepoCmd())
+	rootCmd.AddCommand(NewOSVCmd())
+	rootCmd.AddCommand(NewExportHostCmd())
+	rootCmd.AddCommand(NewPlanCmd())
+	rootCmd.AddCommand(NewSyncCmd())
+	rootCmd.AddCommand(NewCampaignCmd())
+	rootCmd.AddCommand(NewCACmd())
+	rootCmd.AddCommand(NewCertsCmd())
 
 	return rootCmd
 }
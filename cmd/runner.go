@@ -0,0 +1,61 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"packagelock/certs"
+	"packagelock/config"
+	"packagelock/db"
+	"packagelock/logger"
+	"packagelock/tracing"
+
+	"github.com/spf13/viper"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+// runWithDB runs fn inside a minimal application with a database connection.
+func runWithDB(action string, fn func(db *db.Database, config *viper.Viper, logger *zap.Logger)) {
+	app := fx.New(
+		fx.Provide(func() string { return "Command Runner" }),
+		certs.Module,
+		config.Module,
+		logger.Module,
+		db.Module,
+		tracing.Module,
+		fx.Invoke(fn),
+	)
+
+	if err := app.Start(context.Background()); err != nil {
+		fmt.Printf("Failed to start application to %s: %v\n", action, err)
+		os.Exit(1)
+	}
+
+	if err := app.Stop(context.Background()); err != nil {
+		fmt.Printf("Failed to stop application after %s: %v\n", action, err)
+		os.Exit(1)
+	}
+}
+
+// runWithConfig runs fn inside a minimal application without a database connection.
+func runWithConfig(action string, fn func(config *viper.Viper, logger *zap.Logger)) {
+	app := fx.New(
+		fx.Provide(func() string { return "Command Runner" }),
+		certs.Module,
+		config.Module,
+		logger.Module,
+		tracing.Module,
+		fx.Invoke(fn),
+	)
+
+	if err := app.Start(context.Background()); err != nil {
+		fmt.Printf("Failed to start application to %s: %v\n", action, err)
+		os.Exit(1)
+	}
+
+	if err := app.Stop(context.Background()); err != nil {
+		fmt.Printf("Failed to stop application after %s: %v\n", action, err)
+		os.Exit(1)
+	}
+}
@@ -5,12 +5,19 @@ import (
 	"fmt"
 	"os"
 	"os/signal"
+	"packagelock/approvals"
+	"packagelock/campaign"
 	"packagelock/certs"
 	"packagelock/config"
 	"packagelock/db"
+	"packagelock/decommission"
+	"packagelock/drift"
 	"packagelock/handler"
+	"packagelock/jobs"
 	"packagelock/logger"
+	"packagelock/repos"
 	"packagelock/server"
+	"packagelock/stream"
 	"packagelock/tracing"
 	"syscall"
 
@@ -33,9 +40,17 @@ func NewStartCmd() *cobra.Command {
 				},
 				logger.NewLogger,
 				config.NewConfig,
+				config.NewWatcher,
 			),
 			certs.Module,
 			db.Module,
+			repos.Module,
+			drift.Module,
+			jobs.Module,
+			stream.Module,
+			campaign.Module,
+			approvals.Module,
+			decommission.Module,
 			handler.Module,
 			server.Module,
 			tracing.Module,
@@ -0,0 +1,205 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"packagelock/resync"
+	"packagelock/structs"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+// syncTimestampLayouts are accepted for 'sync <timestamp>', besides durations like "6h".
+var syncTimestampLayouts = []string{time.RFC3339, "2006-01-02-15-04-05", "2006-01-02T15:04:05", "2006-01-02"}
+
+func NewSyncCmd() *cobra.Command {
+	var agentIDs, hostIDs []string
+	var distro, server string
+	var timeout time.Duration
+	var insecure, noWait bool
+
+	syncCmd := &cobra.Command{
+		Use:   "sync now|<timestamp>",
+		Short: "Force agents to refresh and report their inventory",
+		Long: "Ask agents to refresh and report their inventory right away and show the progress until all " +
+			"of them reported or the timeout passed.\n\n" +
+			"'sync now' syncs all selected agents. 'sync <timestamp>' only syncs hosts whose inventory is older " +
+			"than the timestamp, given as RFC 3339, 2006-01-02-15-04-05, a date or a duration like '6h'.\n\n" +
+			"The command talks to the running server, configured by the 'network' section or --server.",
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			filter := structs.Sync_Filter{Distro: distro}
+
+			if args[0] != "now" {
+				staleBefore, err := parseSyncTimestamp(args[0], time.Now())
+				if err != nil {
+					fmt.Println(err)
+					os.Exit(1)
+				}
+				filter.StaleBefore = &staleBefore
+			}
+
+			for _, raw := range agentIDs {
+				id, err := uuid.Parse(raw)
+				if err != nil {
+					fmt.Println("Invalid AgentID:", raw)
+					os.Exit(1)
+				}
+				filter.AgentIDs = append(filter.AgentIDs, id)
+			}
+			for _, raw := range hostIDs {
+				id, err := uuid.Parse(raw)
+				if err != nil {
+					fmt.Println("Invalid HostID:", raw)
+					os.Exit(1)
+				}
+				filter.HostIDs = append(filter.HostIDs, id)
+			}
+
+			runWithConfig("sync", func(config *viper.Viper, logger *zap.Logger) {
+				client, err := newAPIClient(config, server, insecure)
+				if err != nil {
+					fmt.Println("Failed to create API client:", err)
+					os.Exit(1)
+				}
+				if !runSync(client, filter, timeout, noWait) {
+					os.Exit(1)
+				}
+			})
+		},
+	}
+
+	syncCmd.Flags().StringSliceVar(&agentIDs, "agent", nil, "only sync these agents")
+	syncCmd.Flags().StringSliceVar(&hostIDs, "host", nil, "only sync the agents of these hosts")
+	syncCmd.Flags().StringVar(&distro, "distro", "", "only sync hosts running this distro")
+	syncCmd.Flags().DurationVar(&timeout, "timeout", 0, "how long agents have to report, defaults to the server's 'sync.timeout'")
+	syncCmd.Flags().StringVar(&server, "server", "", "server URL, e.g. https://packagelock.example.com:8080")
+	syncCmd.Flags().BoolVar(&insecure, "insecure", false, "don't verify the server certificate")
+	syncCmd.Flags().BoolVar(&noWait, "no-wait", false, "start the sync and return without waiting for the agents")
+	return syncCmd
+}
+
+// parseSyncTimestamp parses an absolute timestamp or a duration counted back from now.
+func parseSyncTimestamp(raw string, now time.Time) (time.Time, error) {
+	if duration, err := time.ParseDuration(raw); err == nil {
+		return now.Add(-duration), nil
+	}
+	for _, layout := range syncTimestampLayouts {
+		if parsed, err := time.ParseInLocation(layout, raw, time.Local); err == nil {
+			return parsed, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid timestamp %q, expected 'now', RFC 3339, 2006-01-02-15-04-05 or a duration", raw)
+}
+
+// runSync starts a sync and prints its progress. It reports whether all agents reported.
+func runSync(client *apiClient, filter structs.Sync_Filter, timeout time.Duration, noWait bool) bool {
+	body := map[string]interface{}{
+		"AgentIDs":    filter.AgentIDs,
+		"HostIDs":     filter.HostIDs,
+		"Distro":      filter.Distro,
+		"StaleBefore": filter.StaleBefore,
+	}
+	// Without --timeout the server uses 'sync.timeout'
+	if timeout > 0 {
+		body["Timeout"] = timeout.String()
+	}
+
+	var status resync.Status
+	if err := client.do("POST", "/v1/general/sync", body, &status); err != nil {
+		fmt.Println("Failed to start sync:", err)
+		return false
+	}
+
+	if status.Summary.Total == 0 {
+		fmt.Println("No agents match, nothing to sync.")
+		return true
+	}
+	fmt.Printf("Started sync %s for %d agents.\n", status.SyncID, status.Summary.Total)
+	if noWait {
+		return true
+	}
+
+	interactive := isTerminal(os.Stdout)
+	printed := 0
+	lastTable := ""
+	for {
+		table := renderSyncTable(status)
+		if interactive {
+			// Redraw the table in place
+			if printed > 0 {
+				fmt.Printf("\033[%dA\033[J", printed)
+			}
+			fmt.Print(table)
+			printed = strings.Count(table, "\n")
+		} else if rows := table[:strings.LastIndex(strings.TrimSuffix(table, "\n"), "\n")]; rows != lastTable {
+			// Without a terminal, only print when an agent changed
+			fmt.Print(table)
+			lastTable = rows
+		}
+
+		if status.Done {
+			break
+		}
+		time.Sleep(time.Second)
+
+		if err := client.do("GET", "/v1/general/sync/"+status.SyncID.String(), nil, &status); err != nil {
+			fmt.Println("Failed to fetch sync progress:", err)
+			return false
+		}
+	}
+
+	summary := status.Summary
+	fmt.Printf("\n%d of %d hosts reported (%d succeeded, %d failed, %d timed out, %d pending).\n",
+		summary.Reported, summary.Total, summary.Succeeded, summary.Failed, summary.TimedOut, summary.Pending)
+
+	missing := status.Missing()
+	if len(missing) == 0 {
+		return true
+	}
+	fmt.Println("Hosts that failed to report:")
+	for _, agent := range missing {
+		fmt.Printf("  %s (HostID %s, AgentID %s): %s\n", displayHostname(agent), agent.HostID, agent.AgentID, agent.State)
+	}
+	return false
+}
+
+func renderSyncTable(status resync.Status) string {
+	var buf bytes.Buffer
+	writer := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "HOST\tAGENT\tJOB STATE\tREPORTED")
+	for _, agent := range status.Agents {
+		reported := "-"
+		if agent.ReportTime != nil {
+			reported = agent.ReportTime.Local().Format("15:04:05")
+		}
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%s\n", displayHostname(agent), agent.AgentID, agent.State, reported)
+	}
+	_ = writer.Flush()
+
+	remaining := time.Until(status.Deadline).Round(time.Second)
+	if remaining < 0 {
+		remaining = 0
+	}
+	fmt.Fprintf(&buf, "%d/%d reported, %s left\n", status.Summary.Reported, status.Summary.Total, remaining)
+	return buf.String()
+}
+
+func displayHostname(agent structs.Sync_Agent) string {
+	if agent.Hostname != "" {
+		return agent.Hostname
+	}
+	return agent.HostID.String()
+}
+
+func isTerminal(file *os.File) bool {
+	info, err := file.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,138 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"packagelock/db"
+	"packagelock/structs"
+	"packagelock/sysdef"
+
+	"github.com/google/uuid"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/surrealdb/surrealdb.go"
+	"go.uber.org/zap"
+)
+
+func NewExportHostCmd() *cobra.Command {
+	var output string
+
+	exportHostCmd := &cobra.Command{
+		Use:   "export-host <HostID>",
+		Short: "Write the system definition of a host to " + sysdef.FileName,
+		Long: "Export the live inventory of a host (package manager, repositories, installed package versions " +
+			"and enabled services) as a system definition file, which can be used to rebuild or clone the host.",
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			runWithDB("export host", func(db *db.Database, config *viper.Viper, logger *zap.Logger) {
+				host, packages := loadHostInventory(db, args[0])
+
+				data, err := sysdef.Marshal(sysdef.FromHost(*host, packages))
+				if err != nil {
+					fmt.Println("Failed to encode system definition:", err)
+					os.Exit(1)
+				}
+
+				if output == "-" {
+					fmt.Print(string(data))
+					return
+				}
+				if err := os.WriteFile(output, data, 0644); err != nil {
+					fmt.Println("Failed to write system definition:", err)
+					os.Exit(1)
+				}
+				fmt.Printf("Wrote system definition of %s to %s.\n", host.Hostname, output)
+				logger.Info("Exported host", zap.String("HostID", host.HostID.String()), zap.String("file", output))
+			})
+		},
+	}
+
+	exportHostCmd.Flags().StringVarP(&output, "output", "o", sysdef.FileName, "file to write, '-' for stdout")
+	return exportHostCmd
+}
+
+func NewPlanCmd() *cobra.Command {
+	var hostID string
+	var asJSON bool
+
+	planCmd := &cobra.Command{
+		Use:   "plan <file>",
+		Short: "Show the changes needed to converge a host to a system definition",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			def, err := sysdef.Load(args[0])
+			if err != nil {
+				fmt.Println("Failed to read system definition:", err)
+				os.Exit(1)
+			}
+
+			runWithDB("plan", func(db *db.Database, config *viper.Viper, logger *zap.Logger) {
+				host, packages := loadHostInventory(db, hostID)
+
+				changes, err := sysdef.Plan(*def, *host, packages)
+				if err != nil {
+					fmt.Println("Failed to plan:", err)
+					os.Exit(1)
+				}
+
+				if asJSON {
+					if changes == nil {
+						changes = []sysdef.Change{}
+					}
+					encoded, _ := json.MarshalIndent(changes, "", "  ")
+					fmt.Println(string(encoded))
+					return
+				}
+
+				if len(changes) == 0 {
+					fmt.Printf("%s matches %s, no changes needed.\n", host.Hostname, args[0])
+					return
+				}
+				for _, change := range changes {
+					fmt.Println(change)
+				}
+				add, change, remove := sysdef.Summary(changes)
+				fmt.Printf("\nPlan: %d to add, %d to change, %d to remove.\n", add, change, remove)
+			})
+		},
+	}
+
+	planCmd.Flags().StringVar(&hostID, "host", "", "HostID of the host to compare against")
+	planCmd.Flags().BoolVar(&asJSON, "json", false, "print the changes as JSON")
+	_ = planCmd.MarkFlagRequired("host")
+	return planCmd
+}
+
+// loadHostInventory fetches a host and its packages or exits if it doesn't exist.
+func loadHostInventory(db *db.Database, rawHostID string) (*structs.Host, []structs.Package) {
+	hostID, err := uuid.Parse(rawHostID)
+	if err != nil {
+		fmt.Println("Invalid HostID:", err)
+		os.Exit(1)
+	}
+
+	hosts, err := surrealdb.SmartUnmarshal[[]structs.Host](db.DB.Query(
+		"SELECT * FROM hosts WHERE HostID = $hostID LIMIT 1",
+		map[string]interface{}{"hostID": hostID.String()},
+	))
+	if err != nil {
+		fmt.Println("Failed to fetch host:", err)
+		os.Exit(1)
+	}
+	if len(hosts) == 0 {
+		fmt.Println("Host not found:", hostID)
+		os.Exit(1)
+	}
+
+	packages, err := surrealdb.SmartUnmarshal[[]structs.Package](db.DB.Query(
+		"SELECT * FROM packages WHERE HostID = $hostID ORDER BY PackageName",
+		map[string]interface{}{"hostID": hostID.String()},
+	))
+	if err != nil {
+		fmt.Println("Failed to fetch host packages:", err)
+		os.Exit(1)
+	}
+
+	return &hosts[0], packages
+}
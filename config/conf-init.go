@@ -22,6 +22,7 @@ type ConfigParams struct {
 	AppVersion    string
 	CertGenerator *certs.CertGenerator
 	Tracer        trace.Tracer // Injected Tracer from OpenTelemetry
+	Watcher       *Watcher
 }
 
 func NewConfig(params ConfigParams) (*viper.Viper, error) {
@@ -31,6 +32,7 @@ func NewConfig(params ConfigParams) (*viper.Viper, error) {
 
 	config := viper.New()
 	config.SetDefault("general.app-version", params.AppVersion)
+	SetDefaults(config)
 	config.SetConfigName("config") // Name of config file (without extension)
 	config.SetConfigType("yaml")   // REQUIRED if the config file does not have the extension in the name
 	config.AddConfigPath("/app/data")
@@ -76,7 +78,10 @@ func NewConfig(params ConfigParams) (*viper.Viper, error) {
 		params.Logger.Info("Certificate files missing. Creating new self-signed certificates.")
 		span.AddEvent("Certificate files missing. Creating new self-signed certificates.")
 
-		err := params.CertGenerator.CreateSelfSignedCert(certPath, keyPath)
+		opts, err := certs.OptionsFromConfig(config)
+		if err == nil {
+			err = params.CertGenerator.CreateSelfSignedCert(certPath, keyPath, opts)
+		}
 		if err != nil {
 			params.Logger.Panic("Error creating self-signed certificate", zap.Error(err))
 			span.RecordError(err)
@@ -99,7 +104,7 @@ func NewConfig(params ConfigParams) (*viper.Viper, error) {
 			config.OnConfigChange(func(e fsnotify.Event) {
 				params.Logger.Info("Config file changed", zap.String("file", e.Name))
 				watchSpan.AddEvent("Configuration file changed")
-				// Handle configuration change if necessary
+				params.Watcher.notify()
 			})
 			config.WatchConfig()
 			params.Logger.Info("Started watching configuration changes.")
@@ -128,7 +133,7 @@ func CreateDefaultConfig(config *viper.Viper, logger *zap.Logger) {
 general:
   debug: true
   production: false
-	monitoring: true
+  monitoring: true
 database:
   address: 127.0.0.1
   port: 8000
@@ -143,6 +148,12 @@ network:
     certificatepath: ./certs/testing.crt
     privatekeypath: ./certs/testing.key
     redirecthttp: true
+    redirectport: 80
+certs:
+  key-type: rsa-3072
+  validity: 8760h
+repos:
+  mirror-dir: ./data/repos
 `)
 
 	// Read the default configuration from the YAML example
@@ -161,4 +172,5 @@ network:
 // Module exports the config module.
 var Module = fx.Options(
 	fx.Provide(NewConfig),
+	fx.Provide(NewWatcher),
 )
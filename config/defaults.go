@@ -1,3 +1,99 @@
 package config
 
 // This file is for declaration of viper defaults
+
+import (
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// SetDefaults declares defaults for settings which are optional in the config file.
+func SetDefaults(config *viper.Viper) {
+	// Repository indexes
+	config.SetDefault("repos.mirror-dir", "./data/repos")
+	config.SetDefault("repos.sync-timeout", 5*time.Minute)
+
+	// Vulnerability database
+	config.SetDefault("osv.ecosystems", []string{"Debian", "Ubuntu", "Alpine", "Rocky Linux"})
+
+	// Drift detection, 0 disables the periodic evaluation
+	config.SetDefault("drift.interval", 15*time.Minute)
+
+	// Agent job queue
+	config.SetDefault("jobs.default-timeout", 30*time.Minute)
+	config.SetDefault("jobs.max-wait", 60*time.Second)
+	config.SetDefault("jobs.max-output", 1<<20)
+	config.SetDefault("jobs.sweep-interval", 30*time.Second)
+
+	// Agent streams
+	config.SetDefault("stream.send-buffer", 64)
+	config.SetDefault("stream.write-timeout", 10*time.Second)
+	config.SetDefault("stream.ping-interval", 30*time.Second)
+	config.SetDefault("stream.read-timeout", 75*time.Second)
+	config.SetDefault("stream.max-message", 2<<20)
+
+	// Agents not seen for this long are listed as offline
+	config.SetDefault("agents.offline-after", 5*time.Minute)
+	// Values pushed to agents over their stream, on connect and when the config file changes
+	config.SetDefault("agents.config", map[string]interface{}{})
+
+	// Forced inventory syncs
+	config.SetDefault("sync.timeout", 5*time.Minute)
+
+	// Patch campaigns, dispatched inside maintenance windows
+	config.SetDefault("campaigns.interval", time.Minute)
+	config.SetDefault("campaigns.health-grace", 10*time.Minute)
+
+	// Four-eyes approval of campaigns and lock changes
+	config.SetDefault("approvals.enabled", false)
+	config.SetDefault("approvals.groups", []string{"approvers"})
+	config.SetDefault("approvals.required", 1)
+	config.SetDefault("approvals.expiry", 72*time.Hour)
+	config.SetDefault("approvals.sweep-interval", time.Minute)
+
+	// Decommissioned hosts, purged after the retention. 0 keeps them forever
+	config.SetDefault("hosts.retention", 30*24*time.Hour)
+	config.SetDefault("hosts.purge-interval", time.Hour)
+
+	// Plain-HTTP listener redirecting to HTTPS, only started with 'network.ssl'
+	config.SetDefault("network.ssl-config.redirecthttp", false)
+	config.SetDefault("network.ssl-config.redirectport", 80)
+
+	// TLS of the HTTPS server, no cipher suites keep Go's defaults
+	config.SetDefault("network.ssl-config.minversion", "1.2")
+	config.SetDefault("network.ssl-config.ciphersuites", []string{})
+
+	// Generated self-signed certificates, without SANs they are issued for 'network.fqdn'
+	config.SetDefault("certs.dns-names", []string{})
+	config.SetDefault("certs.ip-addresses", []string{})
+	config.SetDefault("certs.key-type", "rsa-3072")
+	config.SetDefault("certs.validity", 365*24*time.Hour)
+	config.SetDefault("certs.subject.organization", []string{"PackageLock"})
+
+	// Warnings about served certificates running out, 0 disables the check
+	config.SetDefault("certs.expiry-warning-days", []int{30, 14, 7})
+	config.SetDefault("certs.expiry-check-interval", time.Hour)
+
+	// Internal certificate authority of 'packagelock ca'
+	config.SetDefault("ca.dir", "./certs/ca")
+	config.SetDefault("ca.common-name", "PackageLock")
+	config.SetDefault("ca.organization", []string{"PackageLock"})
+	config.SetDefault("ca.key-type", "ecdsa-p384")
+	config.SetDefault("ca.root-validity", 10*365*24*time.Hour)
+	config.SetDefault("ca.intermediate-validity", 5*365*24*time.Hour)
+	config.SetDefault("ca.crl-validity", 7*24*time.Hour)
+	config.SetDefault("ca.crl-url", "")
+
+	// ACME certificates, e.g. from Let's Encrypt, renewed by the server with 'acme.enabled'
+	config.SetDefault("acme.enabled", false)
+	config.SetDefault("acme.directory-url", "https://acme-v02.api.letsencrypt.org/directory")
+	config.SetDefault("acme.email", "")
+	config.SetDefault("acme.domains", []string{})
+	config.SetDefault("acme.challenge", "http-01")
+	config.SetDefault("acme.account-key", "./certs/acme/account.key")
+	config.SetDefault("acme.key-type", "ecdsa-p256")
+	config.SetDefault("acme.ca-roots", "")
+	config.SetDefault("acme.renew-before", 30*24*time.Hour)
+	config.SetDefault("acme.check-interval", 12*time.Hour)
+}
@@ -0,0 +1,32 @@
+package config
+
+import "sync"
+
+// Watcher tells other modules about changes of the config file.
+// viper only keeps a single OnConfigChange callback, which the config module owns.
+type Watcher struct {
+	mu        sync.Mutex
+	callbacks []func()
+}
+
+// NewWatcher creates a Watcher without callbacks.
+func NewWatcher() *Watcher {
+	return &Watcher{}
+}
+
+// OnChange registers fn to run after the config file changed and was read again.
+func (w *Watcher) OnChange(fn func()) {
+	w.mu.Lock()
+	w.callbacks = append(w.callbacks, fn)
+	w.mu.Unlock()
+}
+
+func (w *Watcher) notify() {
+	w.mu.Lock()
+	callbacks := append([]func(){}, w.callbacks...)
+	w.mu.Unlock()
+
+	for _, fn := range callbacks {
+		fn()
+	}
+}
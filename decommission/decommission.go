@@ -0,0 +1,260 @@
+// Decommission
+//
+// The Decommission Package retires hosts. Deleting a host archives it first: the host and its
+// agents are hidden from the lists, its unfinished jobs fail and it leaves all groups.
+// Archived hosts can be restored until they are purged after 'hosts.retention', which
+// removes the host together with its agents, packages, jobs and all other data about it.
+package decommission
+
+import (
+	"context"
+	"errors"
+	"packagelock/db"
+	"packagelock/hostgroups"
+	"packagelock/jobs"
+	"packagelock/structs"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/surrealdb/surrealdb.go"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+// Conditions selecting active or archived hosts and agents in SurrealQL.
+// Records stored before archiving existed don't have the field at all.
+const (
+	Active   = "!ArchiveTime"
+	Archived = "!!ArchiveTime"
+)
+
+// hostTables lists the tables holding data about a host, removed when it is purged.
+var hostTables = []string{"agents", "packages", "jobs", "lock_violations", "baselines", "drift_events"}
+
+// ServiceParams holds the dependencies of the Service.
+type ServiceParams struct {
+	fx.In
+
+	Lifecycle fx.Lifecycle
+	Logger    *zap.Logger
+	Config    *viper.Viper
+	DB        *db.Database
+	Jobs      *jobs.Queue
+}
+
+// Service archives, restores and purges hosts.
+// Hosts archived longer than 'hosts.retention' are purged every 'hosts.purge-interval'.
+type Service struct {
+	logger    *zap.Logger
+	db        *db.Database
+	jobs      *jobs.Queue
+	retention time.Duration
+	retired   []func(host structs.Host)
+}
+
+// NewService creates the Service and schedules the purge of expired hosts.
+func NewService(params ServiceParams) *Service {
+	service := &Service{
+		logger:    params.Logger,
+		db:        params.DB,
+		jobs:      params.Jobs,
+		retention: params.Config.GetDuration("hosts.retention"),
+	}
+
+	interval := params.Config.GetDuration("hosts.purge-interval")
+	if service.retention <= 0 || interval <= 0 {
+		return service
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	params.Lifecycle.Append(fx.Hook{
+		OnStart: func(context.Context) error {
+			go service.sweep(ctx, interval)
+			return nil
+		},
+		OnStop: func(context.Context) error {
+			cancel()
+			return nil
+		},
+	})
+
+	return service
+}
+
+// OnRetire registers fn to run after a host was archived or purged, so state kept
+// outside the database, like metrics, can be dropped. Register during construction.
+func (s *Service) OnRetire(fn func(host structs.Host)) {
+	s.retired = append(s.retired, fn)
+}
+
+func (s *Service) notifyRetired(host structs.Host) {
+	for _, fn := range s.retired {
+		fn(host)
+	}
+}
+
+// Archive soft-deletes a host and its agents. Archiving an archived host does nothing.
+func (s *Service) Archive(host *structs.Host, now time.Time) error {
+	if host.ArchiveTime != nil {
+		return nil
+	}
+
+	host.ArchiveTime = &now
+	host.UpdateTime = now
+	if _, err := s.db.DB.Update(host.ID, host); err != nil {
+		return err
+	}
+
+	var errs []error
+	if _, err := s.db.DB.Query(
+		"UPDATE agents SET ArchiveTime = $now, UpdateTime = $now WHERE HostID = $hostID AND "+Active,
+		map[string]interface{}{"hostID": host.HostID.String(), "now": now},
+	); err != nil {
+		errs = append(errs, err)
+	}
+
+	failed, err := s.jobs.FailHost(host.HostID, "host was decommissioned", now)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	// Violations of a host which is gone would only be noise
+	if _, err := s.db.DB.Query(
+		"DELETE lock_violations WHERE HostID = $hostID",
+		map[string]interface{}{"hostID": host.HostID.String()},
+	); err != nil {
+		errs = append(errs, err)
+	}
+
+	if _, err := hostgroups.RefreshHost(s.db, *host); err != nil {
+		errs = append(errs, err)
+	}
+	s.notifyRetired(*host)
+
+	s.logger.Info("Archived host",
+		zap.String("HostID", host.HostID.String()),
+		zap.Int("failedJobs", failed),
+	)
+	return errors.Join(errs...)
+}
+
+// Restore brings back an archived host and its agents. The caller has to enforce its locks again.
+func (s *Service) Restore(host *structs.Host, now time.Time) error {
+	if host.ArchiveTime == nil {
+		return nil
+	}
+	archived := *host.ArchiveTime
+
+	host.ArchiveTime = nil
+	host.UpdateTime = now
+	if _, err := s.db.DB.Update(host.ID, host); err != nil {
+		return err
+	}
+
+	// Agents archived separately, before the host, stay archived
+	var errs []error
+	if _, err := s.db.DB.Query(
+		"UPDATE agents SET ArchiveTime = NULL, UpdateTime = $now WHERE HostID = $hostID AND ArchiveTime = $archived",
+		map[string]interface{}{"hostID": host.HostID.String(), "now": now, "archived": archived},
+	); err != nil {
+		errs = append(errs, err)
+	}
+
+	if _, err := hostgroups.RefreshHost(s.db, *host); err != nil {
+		errs = append(errs, err)
+	}
+
+	s.logger.Info("Restored host", zap.String("HostID", host.HostID.String()))
+	return errors.Join(errs...)
+}
+
+// Purge removes a host and everything stored about it. Policies stop listing it.
+// Campaigns and syncs keep it in their history.
+func (s *Service) Purge(host structs.Host) error {
+	vars := map[string]interface{}{"hostID": host.HostID.String()}
+
+	var errs []error
+	for _, table := range hostTables {
+		if _, err := s.db.DB.Query("DELETE type::table($table) WHERE HostID = $hostID", map[string]interface{}{
+			"table":  table,
+			"hostID": host.HostID.String(),
+		}); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	for _, table := range []string{"locks", "maintenance_windows"} {
+		if _, err := s.db.DB.Query(
+			"UPDATE type::table($table) SET HostIDs -= $hostID WHERE HostIDs CONTAINS $hostID",
+			map[string]interface{}{"table": table, "hostID": host.HostID.String()},
+		); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := hostgroups.ForgetHost(s.db, host.HostID); err != nil {
+		errs = append(errs, err)
+	}
+
+	// The host goes last, so a failed cleanup can be retried by purging again
+	if len(errs) == 0 {
+		if _, err := s.db.DB.Query("DELETE hosts WHERE HostID = $hostID", vars); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return err
+	}
+	s.notifyRetired(host)
+	s.logger.Info("Purged host", zap.String("HostID", host.HostID.String()), zap.String("hostname", host.Hostname))
+	return nil
+}
+
+// PurgeExpired purges all hosts archived longer than the retention.
+func (s *Service) PurgeExpired(now time.Time) (int, error) {
+	if s.retention <= 0 {
+		return 0, nil
+	}
+
+	expired, err := surrealdb.SmartUnmarshal[[]structs.Host](s.db.DB.Query(
+		"SELECT * FROM hosts WHERE "+Archived+" AND ArchiveTime <= $before",
+		map[string]interface{}{"before": now.Add(-s.retention)},
+	))
+	if err != nil {
+		return 0, err
+	}
+
+	purged := 0
+	var errs []error
+	for _, host := range expired {
+		if err := s.Purge(host); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		purged++
+	}
+	return purged, errors.Join(errs...)
+}
+
+func (s *Service) sweep(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if purged, err := s.PurgeExpired(now); err != nil {
+				s.logger.Warn("Failed to purge archived hosts", zap.Error(err))
+			} else if purged > 0 {
+				s.logger.Info("Purged archived hosts", zap.Int("hosts", purged))
+			}
+		}
+	}
+}
+
+// Module exports the decommission module.
+var Module = fx.Options(
+	fx.Provide(NewService),
+)
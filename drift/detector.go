@@ -0,0 +1,177 @@
+package drift
+
+import (
+	"context"
+	"packagelock/db"
+	"packagelock/decommission"
+	"packagelock/locks"
+	"packagelock/structs"
+	"packagelock/sysdef"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/spf13/viper"
+	"github.com/surrealdb/surrealdb.go"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+// hostDrift is exported at /metrics when monitoring is enabled.
+var hostDrift = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Namespace: "packagelock",
+	Name:      "host_drift_events",
+	Help:      "Number of open drift events of a host.",
+}, []string{"host_id", "hostname"})
+
+func init() {
+	prometheus.MustRegister(hostDrift)
+}
+
+// DetectorParams holds the dependencies of the Detector.
+type DetectorParams struct {
+	fx.In
+
+	Lifecycle    fx.Lifecycle
+	Logger       *zap.Logger
+	Config       *viper.Viper
+	DB           *db.Database
+	Decommission *decommission.Service
+}
+
+// Detector evaluates hosts for drift on every inventory upload and
+// periodically ('drift.interval'), so changed baselines and locks are picked up as well.
+type Detector struct {
+	logger *zap.Logger
+	db     *db.Database
+}
+
+// NewDetector creates a Detector and schedules the periodic evaluation.
+func NewDetector(params DetectorParams) *Detector {
+	detector := &Detector{
+		logger: params.Logger,
+		db:     params.DB,
+	}
+	params.Decommission.OnRetire(func(host structs.Host) {
+		ForgetHost(host.HostID)
+	})
+
+	interval := params.Config.GetDuration("drift.interval")
+	if interval <= 0 {
+		params.Logger.Info("Periodic drift detection disabled")
+		return detector
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	params.Lifecycle.Append(fx.Hook{
+		OnStart: func(context.Context) error {
+			go detector.run(ctx, interval)
+			return nil
+		},
+		OnStop: func(context.Context) error {
+			cancel()
+			return nil
+		},
+	})
+
+	return detector
+}
+
+func (d *Detector) run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			d.EvaluateAll()
+		}
+	}
+}
+
+// Evaluate detects and stores the drift of a host with the given packages installed.
+// Lock violations have to be up to date, see locks.Enforce.
+func (d *Detector) Evaluate(host structs.Host, packages []structs.Package) ([]structs.Drift_Event, error) {
+	var definition *sysdef.Definition
+	baseline, err := FindBaseline(d.db, host.HostID)
+	if err != nil {
+		return nil, err
+	}
+	if baseline != nil {
+		definition, err = sysdef.Parse([]byte(baseline.Definition))
+		if err != nil {
+			// Baselines are validated on upload, so this only happens for broken DB entries
+			d.logger.Warn("Ignoring invalid baseline", zap.String("HostID", host.HostID.String()), zap.Error(err))
+			definition = nil
+		}
+	}
+
+	violations, err := locks.FindViolations(d.db, "HostID", host.HostID)
+	if err != nil {
+		return nil, err
+	}
+
+	detected, err := Detect(host, packages, definition, violations)
+	if err != nil {
+		return nil, err
+	}
+
+	open, err := Reconcile(d.db, host.HostID, detected, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	// Drop the series of a previous hostname
+	hostDrift.DeletePartialMatch(prometheus.Labels{"host_id": host.HostID.String()})
+	hostDrift.WithLabelValues(host.HostID.String(), host.Hostname).Set(float64(len(open)))
+	return open, nil
+}
+
+// ForgetHost removes the drift gauge of an archived or purged host.
+func ForgetHost(hostID uuid.UUID) {
+	hostDrift.DeletePartialMatch(prometheus.Labels{"host_id": hostID.String()})
+}
+
+// EvaluateAll re-evaluates the locks and drift of all hosts.
+func (d *Detector) EvaluateAll() {
+	hosts, err := surrealdb.SmartUnmarshal[[]structs.Host](d.db.DB.Query("SELECT * FROM hosts WHERE "+decommission.Active, nil))
+	if err != nil {
+		d.logger.Warn("Failed to fetch hosts for drift detection", zap.Error(err))
+		return
+	}
+
+	drifting := 0
+	for _, host := range hosts {
+		packages, err := surrealdb.SmartUnmarshal[[]structs.Package](d.db.DB.Query(
+			"SELECT * FROM packages WHERE HostID = $hostID",
+			map[string]interface{}{"hostID": host.HostID.String()},
+		))
+		if err != nil {
+			d.logger.Warn("Failed to fetch host packages", zap.String("HostID", host.HostID.String()), zap.Error(err))
+			continue
+		}
+
+		if _, err := locks.Enforce(d.db, host, packages); err != nil {
+			d.logger.Warn("Failed to evaluate locks for host", zap.String("HostID", host.HostID.String()), zap.Error(err))
+			continue
+		}
+
+		open, err := d.Evaluate(host, packages)
+		if err != nil {
+			d.logger.Warn("Failed to detect drift of host", zap.String("HostID", host.HostID.String()), zap.Error(err))
+			continue
+		}
+		if len(open) > 0 {
+			drifting++
+		}
+	}
+
+	d.logger.Debug("Drift detection finished", zap.Int("hosts", len(hosts)), zap.Int("drifting", drifting))
+}
+
+// Module exports the drift module.
+var Module = fx.Options(
+	fx.Provide(NewDetector),
+)
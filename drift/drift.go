@@ -0,0 +1,88 @@
+// Drift
+//
+// The Drift Package compares the observed state of a host, its latest inventory,
+// with the declared state: the host's baseline system definition and its locks.
+// Differences are tracked as events which stay open until they disappear.
+package drift
+
+import (
+	"packagelock/locks"
+	"packagelock/structs"
+	"packagelock/sysdef"
+
+	"github.com/google/uuid"
+)
+
+// SourceBaseline marks drift against the host's baseline. Drift against locks uses LockSource.
+const SourceBaseline = "baseline"
+
+// Drift types.
+const (
+	TypeMissing    = "missing"    // declared, but not present on the host
+	TypeUnexpected = "unexpected" // present on the host, but not declared
+	TypeChanged    = "changed"    // present, but different from the declaration
+)
+
+// LockSource returns the source of drift detected by a lock.
+func LockSource(lockID uuid.UUID) string {
+	return "lock:" + lockID.String()
+}
+
+// Detect returns the drift of a host. The baseline may be nil if none is assigned.
+// A baseline is a full declaration, so packages and repos it doesn't list count as unexpected.
+func Detect(host structs.Host, packages []structs.Package, baseline *sysdef.Definition, violations []structs.Lock_Violation) ([]structs.Drift_Event, error) {
+	var events []structs.Drift_Event
+
+	if baseline != nil {
+		def := *baseline
+		def.Prune = true
+		changes, err := sysdef.Plan(def, host, packages)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, change := range changes {
+			event := structs.Drift_Event{
+				HostID:   host.HostID,
+				Source:   SourceBaseline,
+				Kind:     change.Kind,
+				Name:     change.Name,
+				Expected: change.Desired,
+				Observed: change.Current,
+			}
+			switch change.Action {
+			case sysdef.ActionAdd:
+				event.Type = TypeMissing
+			case sysdef.ActionRemove:
+				event.Type = TypeUnexpected
+			default:
+				event.Type = TypeChanged
+			}
+			events = append(events, event)
+		}
+	}
+
+	for _, violation := range violations {
+		event := structs.Drift_Event{
+			HostID:   host.HostID,
+			Source:   LockSource(violation.LockID),
+			Kind:     sysdef.KindPackage,
+			Type:     TypeChanged,
+			Name:     violation.PackageName,
+			Expected: violation.Expected,
+			Observed: violation.InstalledVersion,
+		}
+		if violation.Reason == locks.ReasonMissing {
+			event.Type = TypeMissing
+		}
+		events = append(events, event)
+	}
+
+	return events, nil
+}
+
+// Key identifies the same drift across evaluations.
+// The observed value is not part of it, so a package drifting to yet another version stays one event.
+func Key(event structs.Drift_Event) string {
+	return event.Source + "\x00" + event.Kind + "\x00" + event.Type + "\x00" + event.Name
+}
@@ -0,0 +1,122 @@
+package drift
+
+import (
+	"packagelock/db"
+	"packagelock/structs"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/surrealdb/surrealdb.go"
+)
+
+// Reconcile stores the currently detected drift of a host. Open events which were
+// not detected again get resolved, new ones are opened. It returns the open events.
+func Reconcile(database *db.Database, hostID uuid.UUID, detected []structs.Drift_Event, now time.Time) ([]structs.Drift_Event, error) {
+	open, err := FindEvents(database, hostID, false)
+	if err != nil {
+		return nil, err
+	}
+
+	current := make(map[string]structs.Drift_Event, len(detected))
+	for _, event := range detected {
+		current[Key(event)] = event
+	}
+
+	var result []structs.Drift_Event
+	for _, event := range open {
+		key := Key(event)
+		if found, ok := current[key]; ok {
+			delete(current, key)
+			event.Expected = found.Expected
+			event.Observed = found.Observed
+			event.LastSeen = now
+			result = append(result, event)
+		} else {
+			resolved := now
+			event.ResolvedAt = &resolved
+		}
+
+		if _, err := database.DB.Update(event.ID, event); err != nil {
+			return nil, err
+		}
+	}
+
+	var opened []structs.Drift_Event
+	for _, event := range detected {
+		if _, ok := current[Key(event)]; !ok {
+			continue
+		}
+		// Detected events may contain the same key twice, only the first one is opened
+		delete(current, Key(event))
+
+		event.DriftID = uuid.New()
+		event.FirstSeen = now
+		event.LastSeen = now
+		opened = append(opened, event)
+	}
+
+	if len(opened) > 0 {
+		if _, err := database.DB.Query("INSERT INTO drift_events $events", map[string]interface{}{
+			"events": opened,
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	return append(result, opened...), nil
+}
+
+// FindEvents returns the drift events of a host, newest first.
+// Resolved events are only included if all is set.
+func FindEvents(database *db.Database, hostID uuid.UUID, all bool) ([]structs.Drift_Event, error) {
+	query := "SELECT * FROM drift_events WHERE HostID = $hostID AND !ResolvedAt ORDER BY FirstSeen DESC"
+	if all {
+		query = "SELECT * FROM drift_events WHERE HostID = $hostID ORDER BY FirstSeen DESC"
+	}
+
+	events, err := surrealdb.SmartUnmarshal[[]structs.Drift_Event](database.DB.Query(query, map[string]interface{}{
+		"hostID": hostID.String(),
+	}))
+	if err != nil {
+		return nil, err
+	}
+	if events == nil {
+		events = []structs.Drift_Event{}
+	}
+	return events, nil
+}
+
+// FindBaseline returns the baseline of a host or nil if none is assigned.
+func FindBaseline(database *db.Database, hostID uuid.UUID) (*structs.Baseline, error) {
+	baselines, err := surrealdb.SmartUnmarshal[[]structs.Baseline](database.DB.Query(
+		"SELECT * FROM baselines WHERE HostID = $hostID LIMIT 1",
+		map[string]interface{}{"hostID": hostID.String()},
+	))
+	if err != nil {
+		return nil, err
+	}
+	if len(baselines) == 0 {
+		return nil, nil
+	}
+	return &baselines[0], nil
+}
+
+// SaveBaseline assigns a baseline to a host, replacing the previous one.
+func SaveBaseline(database *db.Database, baseline structs.Baseline) error {
+	_, err := database.DB.Query(
+		"DELETE baselines WHERE HostID = $hostID; INSERT INTO baselines $baseline;",
+		map[string]interface{}{
+			"hostID":   baseline.HostID.String(),
+			"baseline": baseline,
+		},
+	)
+	return err
+}
+
+// DeleteBaseline removes the baseline of a host.
+func DeleteBaseline(database *db.Database, hostID uuid.UUID) error {
+	_, err := database.DB.Query("DELETE baselines WHERE HostID = $hostID", map[string]interface{}{
+		"hostID": hostID.String(),
+	})
+	return err
+}
@@ -0,0 +1,42 @@
+package handler
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"go.uber.org/zap"
+)
+
+// NewGetAgentHandler returns the agent with the AgentID of the path.
+func NewGetAgentHandler(params HandlerParams) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		agent, err := agentFromPath(c, params)
+		if agent == nil {
+			return err
+		}
+		return c.Status(fiber.StatusOK).JSON(agent)
+	}
+}
+
+// NewGetAgentHostHandler returns the host an agent runs on.
+func NewGetAgentHostHandler(params HandlerParams) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		agent, err := agentFromPath(c, params)
+		if agent == nil {
+			return err
+		}
+
+		host, err := findHost(params, agent.HostID)
+		if err != nil {
+			params.Logger.Warn("Failed to fetch host from DB", zap.Error(err))
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to fetch host",
+			})
+		}
+		if host == nil {
+			params.Logger.Warn("No host associated with agent", zap.String("AgentID", agent.AgentID.String()))
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Host not found for the agent",
+			})
+		}
+		return c.Status(fiber.StatusOK).JSON(host)
+	}
+}
@@ -0,0 +1,126 @@
+package handler
+
+import (
+	"errors"
+	"packagelock/approvals"
+	"packagelock/structs"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// requester returns the user asking for a change which needs approval.
+// If it returns nil, the error response has already been written.
+func requester(c *fiber.Ctx, params HandlerParams) (*structs.User, error) {
+	user, err := currentUser(c, params)
+	if err != nil {
+		params.Logger.Warn("Failed to fetch user from DB", zap.Error(err))
+		return nil, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch user",
+		})
+	}
+	if user == nil || user.Username == "" {
+		return nil, c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Changes which need approval need an authenticated user",
+		})
+	}
+	return user, nil
+}
+
+// approvalFromPath resolves the ':id' path parameter to an approval request.
+// If it returns nil, the error response has already been written.
+func approvalFromPath(c *fiber.Ctx, params HandlerParams) (*structs.Approval_Request, error) {
+	requestID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		params.Logger.Debug("Cannot parse RequestID from path", zap.Error(err))
+		return nil, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Failed to parse RequestID",
+		})
+	}
+
+	request, err := params.Approvals.Find(requestID)
+	if err != nil {
+		params.Logger.Warn("Failed to fetch approval request from DB", zap.Error(err))
+		return nil, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch approval request",
+		})
+	}
+
+	if request == nil {
+		return nil, c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Approval request not found",
+		})
+	}
+
+	return request, nil
+}
+
+// NewGetApprovalsHandler lists approval requests, optionally filtered by '?state='.
+func NewGetApprovalsHandler(params HandlerParams) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		requests, err := params.Approvals.List(c.Query("state"))
+		if err != nil {
+			params.Logger.Warn("Failed to fetch 'approval_requests' from DB", zap.Error(err))
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to fetch approval requests",
+			})
+		}
+		return c.Status(fiber.StatusOK).JSON(requests)
+	}
+}
+
+func NewGetApprovalHandler(params HandlerParams) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		request, err := approvalFromPath(c, params)
+		if request == nil {
+			return err
+		}
+		return c.Status(fiber.StatusOK).JSON(request)
+	}
+}
+
+// NewDecideApprovalHandler records an approve or reject decision of the current user.
+func NewDecideApprovalHandler(params HandlerParams, decision string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var body struct {
+			Comment string
+		}
+		if len(c.Body()) > 0 {
+			if err := c.BodyParser(&body); err != nil {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"error": "Cannot parse JSON",
+				})
+			}
+		}
+
+		user, err := requester(c, params)
+		if user == nil {
+			return err
+		}
+
+		request, err := approvalFromPath(c, params)
+		if request == nil {
+			return err
+		}
+
+		decided, err := params.Approvals.Decide(request.RequestID, *user, decision, body.Comment)
+		switch {
+		case errors.Is(err, approvals.ErrOwnRequest), errors.Is(err, approvals.ErrNotApprover):
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		case errors.Is(err, approvals.ErrNotPending), errors.Is(err, approvals.ErrAlreadyDecided):
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		case err != nil:
+			params.Logger.Warn("Failed to record approval decision", zap.Error(err))
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to record decision",
+			})
+		}
+
+		return c.Status(fiber.StatusOK).JSON(decided)
+	}
+}
@@ -0,0 +1,49 @@
+package handler
+
+import (
+	"errors"
+	"packagelock/certs"
+
+	"github.com/gofiber/fiber/v2"
+	"go.uber.org/zap"
+)
+
+// pemContentType is served for PEM certificates and CRLs.
+const pemContentType = "application/x-pem-file"
+
+// NewGetCABundleHandler serves the intermediate and root certificate of the internal CA,
+// which agents add to their trusted roots.
+func NewGetCABundleHandler(params HandlerParams) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		bundle, err := params.CA.Bundle()
+		if err != nil {
+			return caError(c, params, err)
+		}
+		c.Set(fiber.HeaderContentType, pemContentType)
+		return c.Send(bundle)
+	}
+}
+
+// NewGetCACRLHandler serves the certificate revocation list of the internal CA.
+func NewGetCACRLHandler(params HandlerParams) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		crl, err := params.CA.CRL()
+		if err != nil {
+			return caError(c, params, err)
+		}
+		c.Set(fiber.HeaderContentType, pemContentType)
+		return c.Send(crl)
+	}
+}
+
+func caError(c *fiber.Ctx, params HandlerParams, err error) error {
+	if errors.Is(err, certs.ErrCANotInitialized) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Certificate authority is not initialized",
+		})
+	}
+	params.Logger.Warn("Failed to read certificate authority", zap.Error(err))
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		"error": "Failed to read certificate authority",
+	})
+}
@@ -0,0 +1,269 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"packagelock/approvals"
+	"packagelock/campaign"
+	"packagelock/hostgroups"
+	"packagelock/schedule"
+	"packagelock/structs"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/surrealdb/surrealdb.go"
+	"go.uber.org/zap"
+)
+
+// campaignFromPath resolves the ':id' path parameter to a campaign.
+// If it returns nil, the error response has already been written.
+func campaignFromPath(c *fiber.Ctx, params HandlerParams) (*structs.Campaign, error) {
+	campaignID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		params.Logger.Debug("Cannot parse CampaignID from path", zap.Error(err))
+		return nil, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Failed to parse CampaignID",
+		})
+	}
+
+	found, err := campaign.FindCampaign(params.DB, campaignID)
+	if err != nil {
+		params.Logger.Warn("Failed to fetch campaign from DB", zap.Error(err))
+		return nil, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch campaign",
+		})
+	}
+
+	if found == nil {
+		return nil, c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Campaign not found",
+		})
+	}
+
+	return found, nil
+}
+
+func NewGetCampaignsHandler(params HandlerParams) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		campaigns, err := surrealdb.SmartUnmarshal[[]structs.Campaign](params.DB.DB.Query(
+			"SELECT * FROM campaigns ORDER BY CreationTime DESC", nil,
+		))
+		if err != nil {
+			params.Logger.Warn("Failed to fetch 'campaigns' from DB", zap.Error(err))
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to fetch campaigns",
+			})
+		}
+
+		if campaigns == nil {
+			campaigns = []structs.Campaign{}
+		}
+		return c.Status(fiber.StatusOK).JSON(campaigns)
+	}
+}
+
+func NewGetCampaignHandler(params HandlerParams) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		found, err := campaignFromPath(c, params)
+		if found == nil {
+			return err
+		}
+		return c.Status(fiber.StatusOK).JSON(found)
+	}
+}
+
+func NewCreateCampaignHandler(params HandlerParams) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var newCampaign structs.Campaign
+		if err := c.BodyParser(&newCampaign); err != nil {
+			params.Logger.Warn("Cannot parse JSON into new Campaign", zap.Error(err))
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Cannot parse JSON",
+			})
+		}
+
+		window, err := schedule.FindWindow(params.DB, newCampaign.WindowID)
+		if err != nil {
+			params.Logger.Warn("Failed to fetch maintenance window from DB", zap.Error(err))
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to fetch window",
+			})
+		}
+		if window == nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Window not found",
+			})
+		}
+
+		// Groups are resolved once, later changes to them don't move hosts in or out of the campaign
+		newCampaign.HostIDs, err = hostgroups.Resolve(params.DB, newCampaign.HostIDs, newCampaign.HostGroups)
+		if err != nil {
+			return hostGroupError(c, params, err)
+		}
+		windowHosts, err := hostgroups.Resolve(params.DB, window.HostIDs, window.HostGroups)
+		if err != nil {
+			return hostGroupError(c, params, err)
+		}
+		resolvedWindow := *window
+		resolvedWindow.HostIDs = windowHosts
+
+		if err := campaign.Validate(newCampaign, resolvedWindow); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+
+		waves, targets, err := campaign.PlanWaves(newCampaign.HostIDs, newCampaign.Waves)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+
+		now := time.Now()
+		newCampaign.ID = ""
+		newCampaign.CampaignID = uuid.New()
+		newCampaign.State = campaign.StateScheduled
+		newCampaign.ApprovalID = nil
+		newCampaign.Waves = waves
+		newCampaign.CurrentWave = 0
+		newCampaign.Targets = targets
+		newCampaign.HaltReason = ""
+		if newCampaign.HaltAction == "" {
+			newCampaign.HaltAction = campaign.HaltPause
+		}
+		if newCampaign.HealthGraceMinutes == 0 {
+			newCampaign.HealthGraceMinutes = int(params.Campaigns.DefaultHealthGrace().Minutes())
+		}
+		newCampaign.CreationTime = now
+		newCampaign.UpdateTime = now
+
+		var user *structs.User
+		if params.Approvals.Enabled() {
+			user, err = requester(c, params)
+			if user == nil {
+				return err
+			}
+			newCampaign.State = campaign.StatePendingApproval
+		}
+
+		created, err := surrealdb.SmartUnmarshal[[]structs.Campaign](params.DB.DB.Create("campaigns", newCampaign))
+		if err != nil || len(created) == 0 {
+			params.Logger.Warn("Cannot insert new Campaign into DB", zap.Error(err))
+			return c.Status(fiber.StatusInternalServerError).JSON(nil)
+		}
+
+		// The campaign exists before its approval request, so approving it always finds the campaign
+		if user != nil {
+			summary := fmt.Sprintf("Campaign %q: %s on %d hosts in window %q", newCampaign.Name, newCampaign.JobType, len(newCampaign.Targets), window.Name)
+			request, err := params.Approvals.Request(approvals.KindCampaign, newCampaign.CampaignID, summary, nil, *user)
+			if err == nil {
+				created[0].ApprovalID = &request.RequestID
+				_, err = params.DB.DB.Query("UPDATE campaigns SET ApprovalID = $approvalID WHERE CampaignID = $campaignID", map[string]interface{}{
+					"approvalID": request.RequestID,
+					"campaignID": newCampaign.CampaignID,
+				})
+			}
+			if err != nil {
+				params.Logger.Warn("Cannot request approval for new Campaign", zap.Error(err))
+				if _, err := params.Campaigns.Reject(created[0], "approval could not be requested", now); err != nil {
+					params.Logger.Warn("Cannot reject Campaign without approval request", zap.Error(err))
+				}
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+					"error": "Failed to request approval",
+				})
+			}
+		}
+
+		// Don't wait for the next tick if the window is open already
+		dispatched, err := params.Campaigns.Dispatch(created[0], now)
+		if err != nil {
+			params.Logger.Warn("Failed to dispatch new Campaign", zap.Error(err))
+			dispatched = created[0]
+		}
+
+		params.Logger.Info("Created new Campaign", zap.String("CampaignID", newCampaign.CampaignID.String()))
+		return c.Status(fiber.StatusCreated).JSON(dispatched)
+	}
+}
+
+// NewPauseCampaignHandler stops a campaign from dispatching further jobs until it is resumed.
+func NewPauseCampaignHandler(params HandlerParams) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		found, err := campaignFromPath(c, params)
+		if found == nil {
+			return err
+		}
+
+		paused, err := params.Campaigns.Pause(*found, "paused by user", time.Now())
+		if errors.Is(err, campaign.ErrInvalidState) {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		if err != nil {
+			params.Logger.Warn("Cannot pause Campaign", zap.Error(err))
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to pause campaign",
+			})
+		}
+
+		params.Logger.Info("Paused Campaign", zap.String("CampaignID", found.CampaignID.String()))
+		return c.Status(fiber.StatusOK).JSON(paused)
+	}
+}
+
+// NewResumeCampaignHandler continues a paused campaign. A wave which halted the campaign
+// is accepted as it is and the next wave starts.
+func NewResumeCampaignHandler(params HandlerParams) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		found, err := campaignFromPath(c, params)
+		if found == nil {
+			return err
+		}
+
+		resumed, err := params.Campaigns.Resume(*found, time.Now())
+		if errors.Is(err, campaign.ErrInvalidState) {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		if err != nil {
+			params.Logger.Warn("Cannot resume Campaign", zap.Error(err))
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to resume campaign",
+			})
+		}
+
+		params.Logger.Info("Resumed Campaign", zap.String("CampaignID", found.CampaignID.String()))
+		return c.Status(fiber.StatusOK).JSON(resumed)
+	}
+}
+
+// NewCancelCampaignHandler stops a campaign from dispatching further jobs.
+// Jobs already dispatched are not aborted.
+func NewCancelCampaignHandler(params HandlerParams) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		found, err := campaignFromPath(c, params)
+		if found == nil {
+			return err
+		}
+
+		cancelled, err := params.Campaigns.Cancel(*found, time.Now())
+		if errors.Is(err, campaign.ErrInvalidState) {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		if err != nil {
+			params.Logger.Warn("Cannot cancel Campaign", zap.Error(err))
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to cancel campaign",
+			})
+		}
+
+		params.Logger.Info("Cancelled Campaign", zap.String("CampaignID", found.CampaignID.String()))
+		return c.Status(fiber.StatusOK).JSON(cancelled)
+	}
+}
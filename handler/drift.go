@@ -0,0 +1,135 @@
+package handler
+
+import (
+	"packagelock/drift"
+	"packagelock/structs"
+	"packagelock/sysdef"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.uber.org/zap"
+)
+
+// NewGetHostDriftHandler returns the open drift events of a host.
+// With '?all=true' resolved events are included as well.
+func NewGetHostDriftHandler(params HandlerParams) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		host, err := hostFromPath(c, params)
+		if host == nil {
+			return err
+		}
+
+		events, err := drift.FindEvents(params.DB, host.HostID, c.QueryBool("all"))
+		if err != nil {
+			params.Logger.Warn("Failed to fetch drift events from DB", zap.Error(err))
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to fetch drift",
+			})
+		}
+		return c.Status(fiber.StatusOK).JSON(events)
+	}
+}
+
+// NewGetHostBaselineHandler returns the baseline system definition of a host as YAML.
+func NewGetHostBaselineHandler(params HandlerParams) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		host, err := hostFromPath(c, params)
+		if host == nil {
+			return err
+		}
+
+		baseline, err := drift.FindBaseline(params.DB, host.HostID)
+		if err != nil {
+			params.Logger.Warn("Failed to fetch baseline from DB", zap.Error(err))
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to fetch baseline",
+			})
+		}
+		if baseline == nil {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Host has no baseline",
+			})
+		}
+
+		c.Set(fiber.HeaderContentType, "application/yaml")
+		return c.Status(fiber.StatusOK).SendString(baseline.Definition)
+	}
+}
+
+// NewPutHostBaselineHandler assigns a system definition (packagelock.sys.yaml, sent as
+// the raw request body) as baseline to a host and evaluates the host's drift against it.
+func NewPutHostBaselineHandler(params HandlerParams) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		host, err := hostFromPath(c, params)
+		if host == nil {
+			return err
+		}
+
+		if _, err := sysdef.Parse(c.Body()); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+
+		now := time.Now()
+		baseline := structs.Baseline{
+			HostID:       host.HostID,
+			Definition:   string(c.Body()),
+			CreationTime: now,
+			UpdateTime:   now,
+		}
+		if previous, err := drift.FindBaseline(params.DB, host.HostID); err == nil && previous != nil {
+			baseline.CreationTime = previous.CreationTime
+		}
+
+		if err := drift.SaveBaseline(params.DB, baseline); err != nil {
+			params.Logger.Warn("Cannot store baseline in DB", zap.Error(err))
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to store baseline",
+			})
+		}
+
+		events, err := evaluateHostDrift(params, *host)
+		if err != nil {
+			params.Logger.Warn("Failed to detect drift of host", zap.String("HostID", host.HostID.String()), zap.Error(err))
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to detect drift",
+			})
+		}
+
+		params.Logger.Info("Assigned baseline to host", zap.String("HostID", host.HostID.String()))
+		return c.Status(fiber.StatusOK).JSON(events)
+	}
+}
+
+// NewDeleteHostBaselineHandler removes the baseline of a host, resolving its baseline drift.
+func NewDeleteHostBaselineHandler(params HandlerParams) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		host, err := hostFromPath(c, params)
+		if host == nil {
+			return err
+		}
+
+		if err := drift.DeleteBaseline(params.DB, host.HostID); err != nil {
+			params.Logger.Warn("Cannot delete baseline from DB", zap.Error(err))
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to delete baseline",
+			})
+		}
+
+		if _, err := evaluateHostDrift(params, *host); err != nil {
+			params.Logger.Warn("Failed to detect drift of host", zap.String("HostID", host.HostID.String()), zap.Error(err))
+		}
+
+		return c.SendStatus(fiber.StatusNoContent)
+	}
+}
+
+// evaluateHostDrift detects the drift of a host against its stored inventory.
+func evaluateHostDrift(params HandlerParams, host structs.Host) ([]structs.Drift_Event, error) {
+	packages, err := findHostPackages(params, host.HostID)
+	if err != nil {
+		return nil, err
+	}
+	return params.Drift.Evaluate(host, packages)
+}
@@ -0,0 +1,347 @@
+package handler
+
+import (
+	"errors"
+	"packagelock/hostgroups"
+	"packagelock/locks"
+	"packagelock/structs"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/surrealdb/surrealdb.go"
+	"go.uber.org/zap"
+)
+
+// groupFromPath resolves the ':id' path parameter to a host group.
+// If it returns nil, the error response has already been written.
+func groupFromPath(c *fiber.Ctx, params HandlerParams) (*structs.Host_Group, error) {
+	groupID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		params.Logger.Debug("Cannot parse GroupID from path", zap.Error(err))
+		return nil, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Failed to parse GroupID",
+		})
+	}
+
+	group, err := hostgroups.FindGroup(params.DB, groupID)
+	if err != nil {
+		params.Logger.Warn("Failed to fetch host group from DB", zap.Error(err))
+		return nil, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch group",
+		})
+	}
+	if group == nil {
+		return nil, c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Group not found",
+		})
+	}
+	return group, nil
+}
+
+// hostGroupError writes the response for a failed group resolution of a policy.
+func hostGroupError(c *fiber.Ctx, params HandlerParams, err error) error {
+	if errors.Is(err, hostgroups.ErrUnknownGroup) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	params.Logger.Warn("Failed to resolve host groups", zap.Error(err))
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		"error": "Failed to resolve host groups",
+	})
+}
+
+// refreshHostGroups re-evaluates the dynamic groups after the data of a host changed.
+// It reports whether the host joined or left a group, so its locks need to be enforced again.
+func refreshHostGroups(params HandlerParams, host structs.Host) bool {
+	changed, err := hostgroups.RefreshHost(params.DB, host)
+	if err != nil {
+		params.Logger.Warn("Failed to evaluate host groups", zap.String("HostID", host.HostID.String()), zap.Error(err))
+	}
+	return changed
+}
+
+// reevaluateGroupHosts enforces the locks of hosts which joined or left a group.
+func reevaluateGroupHosts(params HandlerParams, group structs.Host_Group, hostIDs []uuid.UUID) {
+	if len(hostIDs) == 0 {
+		return
+	}
+	if err := locks.Reevaluate(params.DB, hostIDs); err != nil {
+		params.Logger.Warn("Failed to evaluate locks for group members",
+			zap.String("GroupID", group.GroupID.String()),
+			zap.Error(err),
+		)
+	}
+}
+
+func NewGetGroupsHandler(params HandlerParams) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		groups, err := surrealdb.SmartUnmarshal[[]structs.Host_Group](params.DB.DB.Query(
+			"SELECT * FROM host_groups ORDER BY Name", nil,
+		))
+		if err != nil {
+			params.Logger.Warn("Failed to fetch 'host_groups' from DB", zap.Error(err))
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to fetch groups",
+			})
+		}
+		if groups == nil {
+			groups = []structs.Host_Group{}
+		}
+		return c.Status(fiber.StatusOK).JSON(groups)
+	}
+}
+
+func NewGetGroupHandler(params HandlerParams) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		group, err := groupFromPath(c, params)
+		if group == nil {
+			return err
+		}
+		return c.Status(fiber.StatusOK).JSON(group)
+	}
+}
+
+func NewCreateGroupHandler(params HandlerParams) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var newGroup structs.Host_Group
+		if err := c.BodyParser(&newGroup); err != nil {
+			params.Logger.Warn("Cannot parse JSON into new Host_Group", zap.Error(err))
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Cannot parse JSON",
+			})
+		}
+
+		if err := hostgroups.Validate(newGroup); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+
+		newGroup.ID = ""
+		newGroup.GroupID = uuid.New()
+		newGroup.Members = nil
+		newGroup.CreationTime = time.Now()
+		newGroup.UpdateTime = time.Now()
+
+		// No policy targets a new group yet, so no locks have to be enforced for its members
+		if _, err := hostgroups.Refresh(params.DB, &newGroup); err != nil {
+			params.Logger.Warn("Failed to evaluate new Host_Group", zap.Error(err))
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to evaluate group",
+			})
+		}
+
+		created, err := surrealdb.SmartUnmarshal[[]structs.Host_Group](params.DB.DB.Create("host_groups", newGroup))
+		if err != nil || len(created) == 0 {
+			params.Logger.Warn("Cannot insert new Host_Group into DB", zap.Error(err))
+			return c.Status(fiber.StatusInternalServerError).JSON(nil)
+		}
+
+		params.Logger.Info("Created new host group",
+			zap.String("GroupID", newGroup.GroupID.String()),
+			zap.Int("members", len(newGroup.Members)),
+		)
+		return c.Status(fiber.StatusCreated).JSON(created[0])
+	}
+}
+
+func NewUpdateGroupHandler(params HandlerParams) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		group, err := groupFromPath(c, params)
+		if group == nil {
+			return err
+		}
+
+		var update structs.Host_Group
+		if err := c.BodyParser(&update); err != nil {
+			params.Logger.Warn("Cannot parse JSON into Host_Group", zap.Error(err))
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Cannot parse JSON",
+			})
+		}
+
+		if err := hostgroups.Validate(update); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+
+		update.ID = group.ID
+		update.GroupID = group.GroupID
+		update.Members = group.Members
+		update.CreationTime = group.CreationTime
+		update.UpdateTime = time.Now()
+
+		changed, err := hostgroups.Refresh(params.DB, &update)
+		if err != nil {
+			params.Logger.Warn("Failed to evaluate Host_Group", zap.Error(err))
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to evaluate group",
+			})
+		}
+
+		// Refresh only stores the group if its members changed
+		if _, err := params.DB.DB.Update(group.ID, update); err != nil {
+			params.Logger.Warn("Cannot update Host_Group in DB", zap.Error(err))
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to update group",
+			})
+		}
+
+		reevaluateGroupHosts(params, update, changed)
+
+		params.Logger.Info("Updated host group",
+			zap.String("GroupID", update.GroupID.String()),
+			zap.Int("changed", len(changed)),
+		)
+		return c.Status(fiber.StatusOK).JSON(update)
+	}
+}
+
+func NewDeleteGroupHandler(params HandlerParams) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		group, err := groupFromPath(c, params)
+		if group == nil {
+			return err
+		}
+
+		// Policies would silently lose hosts otherwise
+		references, err := hostgroups.References(params.DB, group.GroupID)
+		if err != nil {
+			params.Logger.Warn("Failed to fetch policies of host group", zap.Error(err))
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to delete group",
+			})
+		}
+		if references > 0 {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error": "Group is still used by locks or maintenance windows",
+			})
+		}
+
+		if _, err := params.DB.DB.Delete(group.ID); err != nil {
+			params.Logger.Warn("Cannot delete Host_Group from DB", zap.Error(err))
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to delete group",
+			})
+		}
+
+		params.Logger.Info("Deleted host group", zap.String("GroupID", group.GroupID.String()))
+		return c.SendStatus(fiber.StatusNoContent)
+	}
+}
+
+// NewGetGroupHostsHandler returns the hosts which are currently members of a group.
+func NewGetGroupHostsHandler(params HandlerParams) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		group, err := groupFromPath(c, params)
+		if group == nil {
+			return err
+		}
+
+		members := make([]string, 0, len(group.Members))
+		for _, hostID := range group.Members {
+			members = append(members, hostID.String())
+		}
+
+		hosts, err := surrealdb.SmartUnmarshal[[]structs.Host](params.DB.DB.Query(
+			"SELECT * FROM hosts WHERE HostID IN $members ORDER BY Hostname",
+			map[string]interface{}{"members": members},
+		))
+		if err != nil {
+			params.Logger.Warn("Failed to fetch group members from DB", zap.Error(err))
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to fetch hosts",
+			})
+		}
+		if hosts == nil {
+			hosts = []structs.Host{}
+		}
+		return c.Status(fiber.StatusOK).JSON(hosts)
+	}
+}
+
+// NewPreviewGroupHandler returns the hosts a rule would match, without storing a group.
+func NewPreviewGroupHandler(params HandlerParams) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var preview struct {
+			Rule string
+		}
+		if err := c.BodyParser(&preview); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Cannot parse JSON",
+			})
+		}
+
+		rule, err := hostgroups.Compile(preview.Rule)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+
+		hosts, err := surrealdb.SmartUnmarshal[[]structs.Host](params.DB.DB.Select("hosts"))
+		if err != nil {
+			params.Logger.Warn("Failed to fetch 'hosts' from DB", zap.Error(err))
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to fetch hosts",
+			})
+		}
+
+		matching := []structs.Host{}
+		for _, host := range hosts {
+			if rule.Match(host) {
+				matching = append(matching, host)
+			}
+		}
+		return c.Status(fiber.StatusOK).JSON(matching)
+	}
+}
+
+// NewPutHostTagsHandler replaces the tags of a host and re-evaluates its groups.
+func NewPutHostTagsHandler(params HandlerParams) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		host, err := hostFromPath(c, params)
+		if host == nil {
+			return err
+		}
+
+		var tags map[string]string
+		if err := c.BodyParser(&tags); err != nil {
+			params.Logger.Warn("Cannot parse JSON into host tags", zap.Error(err))
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Cannot parse JSON",
+			})
+		}
+		for key := range tags {
+			if key == "" {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"error": "Tag names must not be empty",
+				})
+			}
+		}
+		if tags == nil {
+			tags = map[string]string{}
+		}
+
+		host.Tags = tags
+		host.UpdateTime = time.Now()
+		if _, err := params.DB.DB.Update(host.ID, host); err != nil {
+			params.Logger.Warn("Cannot update host tags in DB", zap.Error(err))
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to update host",
+			})
+		}
+
+		if refreshHostGroups(params, *host) {
+			if err := locks.Reevaluate(params.DB, []uuid.UUID{host.HostID}); err != nil {
+				params.Logger.Warn("Failed to evaluate locks for host", zap.String("HostID", host.HostID.String()), zap.Error(err))
+			}
+		}
+
+		params.Logger.Info("Updated host tags", zap.String("HostID", host.HostID.String()), zap.Int("tags", len(tags)))
+		return c.Status(fiber.StatusOK).JSON(tags)
+	}
+}
@@ -2,13 +2,22 @@ package handler
 
 import (
 	"encoding/base64"
-	"os"
+	"packagelock/approvals"
+	"packagelock/campaign"
+	"packagelock/certs"
 	"packagelock/db"
+	"packagelock/decommission"
+	"packagelock/drift"
+	"packagelock/jobs"
+	"packagelock/locks"
+	"packagelock/repos"
+	"packagelock/stream"
 	"packagelock/structs"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 	"github.com/spf13/viper"
 	"github.com/surrealdb/surrealdb.go"
 	"go.uber.org/fx"
@@ -20,46 +29,184 @@ type Handlers struct {
 	LoginHandler fiber.Handler
 
 	// AgentGroup handlers
-	GetAgentByID     fiber.Handler
+	GetAgentByID     fiber.Handler // deprecated, base64 AgentID in the query
+	GetAgent         fiber.Handler
+	GetAgentHost     fiber.Handler
 	RegisterAgent    fiber.Handler
-	GetHostByAgentID fiber.Handler
+	GetHostByAgentID fiber.Handler // deprecated, base64 AgentID in the query
+	CreateAgentJob   fiber.Handler
+	GetAgentJobs     fiber.Handler
+	GetNextAgentJob  fiber.Handler
+	GetAgentJob      fiber.Handler
+	ReportAgentJob   fiber.Handler
+	AgentStream      fiber.Handler
 
 	// GeneralGroup handlers
-	GetHosts  fiber.Handler
-	GetAgents fiber.Handler
+	GetHosts           fiber.Handler
+	GetAgents          fiber.Handler
+	GetConnections     fiber.Handler
+	StartSync          fiber.Handler
+	GetSync            fiber.Handler
+	GetVulnerabilities fiber.Handler
 
 	// HostGroup handlers
-	RegisterHost fiber.Handler
+	GetHost            fiber.Handler
+	GetHostAgents      fiber.Handler
+	RegisterHost       fiber.Handler
+	ReportHostRepos    fiber.Handler
+	GetHostRepos       fiber.Handler
+	ReportHostPackages fiber.Handler
+	GetHostPackages    fiber.Handler
+	GetHostVulns       fiber.Handler
+	GetHostViolations  fiber.Handler
+	GetHostDrift       fiber.Handler
+	GetHostBaseline    fiber.Handler
+	PutHostBaseline    fiber.Handler
+	DeleteHostBaseline fiber.Handler
+	PutHostTags        fiber.Handler
+	UpdateHost         fiber.Handler
+	DeleteHost         fiber.Handler
+
+	// LockGroup handlers
+	GetLocks          fiber.Handler
+	GetLock           fiber.Handler
+	CreateLock        fiber.Handler
+	UpdateLock        fiber.Handler
+	DeleteLock        fiber.Handler
+	GetLockViolations fiber.Handler
+
+	// GroupGroup handlers
+	GetGroups     fiber.Handler
+	GetGroup      fiber.Handler
+	CreateGroup   fiber.Handler
+	UpdateGroup   fiber.Handler
+	DeleteGroup   fiber.Handler
+	GetGroupHosts fiber.Handler
+	PreviewGroup  fiber.Handler
+
+	// WindowGroup handlers
+	GetWindows       fiber.Handler
+	GetWindow        fiber.Handler
+	CreateWindow     fiber.Handler
+	UpdateWindow     fiber.Handler
+	DeleteWindow     fiber.Handler
+	GetWindowPreview fiber.Handler
+
+	// CampaignGroup handlers
+	GetCampaigns   fiber.Handler
+	GetCampaign    fiber.Handler
+	CreateCampaign fiber.Handler
+	PauseCampaign  fiber.Handler
+	ResumeCampaign fiber.Handler
+	CancelCampaign fiber.Handler
+
+	// ApprovalGroup handlers
+	GetApprovals    fiber.Handler
+	GetApproval     fiber.Handler
+	ApproveApproval fiber.Handler
+	RejectApproval  fiber.Handler
+
+	// CAGroup handlers
+	GetCABundle fiber.Handler
+	GetCACRL    fiber.Handler
 }
 
 type HandlerParams struct {
 	fx.In
 
-	Logger *zap.Logger
-	Config *viper.Viper
-	DB     *db.Database
+	Logger  *zap.Logger
+	Config  *viper.Viper
+	DB      *db.Database
+	Indexes *repos.IndexStore
+	Drift   *drift.Detector
+	Jobs    *jobs.Queue
+	Stream  *stream.Hub
+
+	Campaigns    *campaign.Dispatcher
+	Approvals    *approvals.Service
+	Decommission *decommission.Service
+	CA           *certs.CA
 }
 
 // NewHandlers constructs all handler functions with injected dependencies.
 func NewHandlers(params HandlerParams) *Handlers {
 	return &Handlers{
-		LoginHandler:     NewLoginHandler(params),
-		GetAgentByID:     NewGetAgentByIDHandler(params),
-		RegisterAgent:    NewRegisterAgentHandler(params),
-		GetHostByAgentID: NewGetHostByAgentIDHandler(params),
-		GetHosts:         NewGetHostsHandler(params),
-		GetAgents:        NewGetAgentsHandler(params),
-		RegisterHost:     NewRegisterHostHandler(params),
+		LoginHandler:       NewLoginHandler(params),
+		GetAgentByID:       NewGetAgentByIDHandler(params),
+		GetAgent:           NewGetAgentHandler(params),
+		GetAgentHost:       NewGetAgentHostHandler(params),
+		RegisterAgent:      NewRegisterAgentHandler(params),
+		GetHostByAgentID:   NewGetHostByAgentIDHandler(params),
+		CreateAgentJob:     NewCreateAgentJobHandler(params),
+		GetAgentJobs:       NewGetAgentJobsHandler(params),
+		GetNextAgentJob:    NewGetNextAgentJobHandler(params),
+		GetAgentJob:        NewGetAgentJobHandler(params),
+		ReportAgentJob:     NewReportAgentJobHandler(params),
+		AgentStream:        NewAgentStreamHandler(params),
+		GetConnections:     NewGetAgentConnectionsHandler(params),
+		StartSync:          NewStartSyncHandler(params),
+		GetSync:            NewGetSyncHandler(params),
+		GetHosts:           NewGetHostsHandler(params),
+		GetAgents:          NewGetAgentsHandler(params),
+		GetHost:            NewGetHostHandler(params),
+		GetHostAgents:      NewGetHostAgentsHandler(params),
+		RegisterHost:       NewRegisterHostHandler(params),
+		ReportHostRepos:    NewReportHostReposHandler(params),
+		GetHostRepos:       NewGetHostReposHandler(params),
+		ReportHostPackages: NewReportHostPackagesHandler(params),
+		GetHostPackages:    NewGetHostPackagesHandler(params),
+		GetHostVulns:       NewGetHostVulnerabilitiesHandler(params),
+		GetVulnerabilities: NewGetVulnerabilitiesHandler(params),
+		GetHostViolations:  NewGetHostViolationsHandler(params),
+		GetHostDrift:       NewGetHostDriftHandler(params),
+		GetHostBaseline:    NewGetHostBaselineHandler(params),
+		PutHostBaseline:    NewPutHostBaselineHandler(params),
+		DeleteHostBaseline: NewDeleteHostBaselineHandler(params),
+		PutHostTags:        NewPutHostTagsHandler(params),
+		UpdateHost:         NewUpdateHostHandler(params),
+		DeleteHost:         NewDeleteHostHandler(params),
+		GetLocks:           NewGetLocksHandler(params),
+		GetLock:            NewGetLockHandler(params),
+		CreateLock:         NewCreateLockHandler(params),
+		UpdateLock:         NewUpdateLockHandler(params),
+		DeleteLock:         NewDeleteLockHandler(params),
+		GetLockViolations:  NewGetLockViolationsHandler(params),
+		GetGroups:          NewGetGroupsHandler(params),
+		GetGroup:           NewGetGroupHandler(params),
+		CreateGroup:        NewCreateGroupHandler(params),
+		UpdateGroup:        NewUpdateGroupHandler(params),
+		DeleteGroup:        NewDeleteGroupHandler(params),
+		GetGroupHosts:      NewGetGroupHostsHandler(params),
+		PreviewGroup:       NewPreviewGroupHandler(params),
+		GetWindows:         NewGetWindowsHandler(params),
+		GetWindow:          NewGetWindowHandler(params),
+		CreateWindow:       NewCreateWindowHandler(params),
+		UpdateWindow:       NewUpdateWindowHandler(params),
+		DeleteWindow:       NewDeleteWindowHandler(params),
+		GetWindowPreview:   NewGetWindowPreviewHandler(params),
+		GetCampaigns:       NewGetCampaignsHandler(params),
+		GetCampaign:        NewGetCampaignHandler(params),
+		CreateCampaign:     NewCreateCampaignHandler(params),
+		PauseCampaign:      NewPauseCampaignHandler(params),
+		ResumeCampaign:     NewResumeCampaignHandler(params),
+		CancelCampaign:     NewCancelCampaignHandler(params),
+		GetApprovals:       NewGetApprovalsHandler(params),
+		GetApproval:        NewGetApprovalHandler(params),
+		ApproveApproval:    NewDecideApprovalHandler(params, approvals.DecisionApprove),
+		RejectApproval:     NewDecideApprovalHandler(params, approvals.DecisionReject),
+		GetCABundle:        NewGetCABundleHandler(params),
+		GetCACRL:           NewGetCACRLHandler(params),
 	}
 }
 
+// LoginRequest is the body of a login.
+type LoginRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
 func NewLoginHandler(params HandlerParams) fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		type LoginRequest struct {
-			Username string `json:"username"`
-			Password string `json:"password"`
-		}
-
 		var loginReq LoginRequest
 		if err := c.BodyParser(&loginReq); err != nil {
 			params.Logger.Debug("Invalid login request", zap.Error(err))
@@ -97,31 +244,24 @@ func NewLoginHandler(params HandlerParams) fiber.Handler {
 			})
 		}
 
-		// Create JWT
-		token := jwt.New(jwt.SigningMethodRS256)
-		claims := token.Claims.(jwt.MapClaims)
-		claims["username"] = authenticatedUser.Username
-		claims["userID"] = authenticatedUser.UserID
-		claims["exp"] = time.Now().Add(72 * time.Hour).Unix() // 3 days expiry
-
-		// Sign and get the encoded token
-		keyData, err := os.ReadFile(params.Config.GetString("network.ssl-config.privatekeypath"))
+		// The signing method follows the type of the server key
+		key, err := certs.LoadJWTKey(params.Config.GetString("network.ssl-config.privatekeypath"))
 		if err != nil {
-			params.Logger.Warn("Cannot read private key file", zap.Error(err))
+			params.Logger.Warn("Cannot load private key", zap.Error(err))
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 				"error": "Failed to generate token",
 			})
 		}
 
-		privateKey, err := jwt.ParseRSAPrivateKeyFromPEM(keyData)
-		if err != nil {
-			params.Logger.Warn("Cannot parse private key", zap.Error(err))
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-				"error": "Failed to generate token",
-			})
-		}
+		// Create JWT
+		token := jwt.New(key.Method)
+		claims := token.Claims.(jwt.MapClaims)
+		claims["username"] = authenticatedUser.Username
+		claims["userID"] = authenticatedUser.UserID
+		claims["exp"] = time.Now().Add(72 * time.Hour).Unix() // 3 days expiry
 
-		tokenString, err := token.SignedString(privateKey)
+		// Sign and get the encoded token
+		tokenString, err := token.SignedString(key.Private)
 		if err != nil {
 			params.Logger.Warn("Cannot generate JWT", zap.Error(err))
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
@@ -306,49 +446,19 @@ func NewGetHostByAgentIDHandler(params HandlerParams) fiber.Handler {
 	}
 }
 
+// NewGetHostsHandler lists hosts page by page, see listPage and hostListSpec.
 func NewGetHostsHandler(params HandlerParams) fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		hosts, err := params.DB.DB.Select("hosts")
-		if err != nil {
-			params.Logger.Warn("Failed to fetch 'hosts' from DB", zap.Error(err))
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-				"error": "Failed to fetch hosts",
-			})
-		}
-
-		var hostsSlice []structs.Host
-		err = surrealdb.Unmarshal(hosts, &hostsSlice)
-		if err != nil {
-			params.Logger.Warn("Failed to unmarshal hosts", zap.Error(err))
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-				"error": "Failed to unmarshal hosts",
-			})
-		}
-
-		return c.Status(fiber.StatusOK).JSON(hostsSlice)
+		since := time.Now().Add(-params.Config.GetDuration("agents.offline-after"))
+		return listPage[structs.Host](c, params, hostListSpec(since))
 	}
 }
 
+// NewGetAgentsHandler lists agents page by page, see listPage and agentListSpec.
 func NewGetAgentsHandler(params HandlerParams) fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		agents, err := params.DB.DB.Select("agents")
-		if err != nil {
-			params.Logger.Warn("Failed to fetch 'agents' from DB", zap.Error(err))
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-				"error": "Failed to fetch agents",
-			})
-		}
-
-		var agentsSlice []structs.Agent
-		err = surrealdb.Unmarshal(agents, &agentsSlice)
-		if err != nil {
-			params.Logger.Warn("Failed to unmarshal agents", zap.Error(err))
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-				"error": "Failed to unmarshal agents",
-			})
-		}
-
-		return c.Status(fiber.StatusOK).JSON(agentsSlice)
+		since := time.Now().Add(-params.Config.GetDuration("agents.offline-after"))
+		return listPage[structs.Agent](c, params, agentListSpec(since))
 	}
 }
 
@@ -369,6 +479,12 @@ func NewRegisterHostHandler(params HandlerParams) fiber.Handler {
 			return c.Status(fiber.StatusInternalServerError).JSON(nil)
 		}
 
+		if refreshHostGroups(params, newHost) {
+			if err := locks.Reevaluate(params.DB, []uuid.UUID{newHost.HostID}); err != nil {
+				params.Logger.Warn("Failed to evaluate locks for host", zap.String("HostID", newHost.HostID.String()), zap.Error(err))
+			}
+		}
+
 		params.Logger.Info("Created new Host", zap.String("HostID", newHost.HostID.String()))
 		return c.Status(fiber.StatusCreated).JSON(transaction)
 	}
@@ -0,0 +1,192 @@
+package handler
+
+import (
+	"packagelock/decommission"
+	"packagelock/locks"
+	"packagelock/structs"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/surrealdb/surrealdb.go"
+	"go.uber.org/zap"
+)
+
+// archivedCondition translates the '?archived=' query parameter of the list endpoints
+// into a SurrealQL condition. Without the parameter only active records are listed.
+// If it returns an empty condition, the error response has already been written.
+func archivedCondition(c *fiber.Ctx) (string, error) {
+	switch c.Query("archived", "false") {
+	case "false":
+		return decommission.Active, nil
+	case "true":
+		return decommission.Archived, nil
+	case "all":
+		return "true", nil
+	}
+	return "", c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+		"error": "archived must be true, false or all",
+	})
+}
+
+// NewGetHostHandler returns the host with the HostID of the path.
+func NewGetHostHandler(params HandlerParams) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		host, err := hostFromPath(c, params)
+		if host == nil {
+			return err
+		}
+		return c.Status(fiber.StatusOK).JSON(host)
+	}
+}
+
+// NewGetHostAgentsHandler returns the agents running on a host, filtered like the agent list by '?archived='.
+func NewGetHostAgentsHandler(params HandlerParams) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		host, err := hostFromPath(c, params)
+		if host == nil {
+			return err
+		}
+
+		condition, err := archivedCondition(c)
+		if condition == "" {
+			return err
+		}
+
+		agents, err := surrealdb.SmartUnmarshal[[]structs.Agent](params.DB.DB.Query(
+			"SELECT * FROM agents WHERE HostID = $hostID AND "+condition+" ORDER BY AgentName",
+			map[string]interface{}{"hostID": host.HostID.String()},
+		))
+		if err != nil {
+			params.Logger.Warn("Failed to fetch agents of host from DB", zap.Error(err))
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to fetch agents",
+			})
+		}
+		if agents == nil {
+			agents = []structs.Agent{}
+		}
+		return c.Status(fiber.StatusOK).JSON(agents)
+	}
+}
+
+// HostPatch is the body of a host update, omitted fields keep their value.
+type HostPatch struct {
+	Hostname    *string
+	FQDN        *string
+	NetworkInfo map[string]string
+	Distro      *string
+	Arch        *string
+	Tags        map[string]string
+	Archived    *bool
+}
+
+// NewUpdateHostHandler changes the given fields of a host. Archived hosts are restored
+// with '"Archived": false'.
+func NewUpdateHostHandler(params HandlerParams) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var patch HostPatch
+		if err := c.BodyParser(&patch); err != nil {
+			params.Logger.Warn("Cannot parse JSON into host patch", zap.Error(err))
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Cannot parse JSON",
+			})
+		}
+
+		host, err := hostFromPath(c, params)
+		if host == nil {
+			return err
+		}
+
+		if patch.Hostname != nil {
+			if *patch.Hostname == "" {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"error": "Hostname must not be empty",
+				})
+			}
+			host.Hostname = *patch.Hostname
+		}
+		if patch.FQDN != nil {
+			host.FQDN = *patch.FQDN
+		}
+		if patch.NetworkInfo != nil {
+			host.NetworkInfo = patch.NetworkInfo
+		}
+		if patch.Distro != nil {
+			host.Distro = *patch.Distro
+		}
+		if patch.Arch != nil {
+			host.Arch = *patch.Arch
+		}
+		if patch.Tags != nil {
+			host.Tags = patch.Tags
+		}
+
+		now := time.Now()
+		if patch.Archived != nil && *patch.Archived {
+			if err := params.Decommission.Archive(host, now); err != nil {
+				params.Logger.Warn("Failed to archive host", zap.String("HostID", host.HostID.String()), zap.Error(err))
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+					"error": "Failed to archive host",
+				})
+			}
+			return c.Status(fiber.StatusOK).JSON(host)
+		}
+
+		restored := patch.Archived != nil && host.ArchiveTime != nil
+		if restored {
+			if err := params.Decommission.Restore(host, now); err != nil {
+				params.Logger.Warn("Failed to restore host", zap.String("HostID", host.HostID.String()), zap.Error(err))
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+					"error": "Failed to restore host",
+				})
+			}
+		}
+
+		host.UpdateTime = now
+		if _, err := params.DB.DB.Update(host.ID, host); err != nil {
+			params.Logger.Warn("Cannot update host in DB", zap.Error(err))
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to update host",
+			})
+		}
+
+		if refreshHostGroups(params, *host) || restored {
+			if err := locks.Reevaluate(params.DB, []uuid.UUID{host.HostID}); err != nil {
+				params.Logger.Warn("Failed to evaluate locks for host", zap.String("HostID", host.HostID.String()), zap.Error(err))
+			}
+		}
+
+		params.Logger.Info("Updated host", zap.String("HostID", host.HostID.String()))
+		return c.Status(fiber.StatusOK).JSON(host)
+	}
+}
+
+// NewDeleteHostHandler archives a host, it is purged after 'hosts.retention'.
+// With '?purge=true' the host and all its data are removed right away.
+func NewDeleteHostHandler(params HandlerParams) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		host, err := hostFromPath(c, params)
+		if host == nil {
+			return err
+		}
+
+		if c.QueryBool("purge") {
+			if err := params.Decommission.Purge(*host); err != nil {
+				params.Logger.Warn("Failed to purge host", zap.String("HostID", host.HostID.String()), zap.Error(err))
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+					"error": "Failed to purge host",
+				})
+			}
+			return c.SendStatus(fiber.StatusNoContent)
+		}
+
+		if err := params.Decommission.Archive(host, time.Now()); err != nil {
+			params.Logger.Warn("Failed to archive host", zap.String("HostID", host.HostID.String()), zap.Error(err))
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to archive host",
+			})
+		}
+		return c.SendStatus(fiber.StatusNoContent)
+	}
+}
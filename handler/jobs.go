@@ -0,0 +1,199 @@
+package handler
+
+import (
+	"errors"
+	"packagelock/jobs"
+	"packagelock/stream"
+	"packagelock/structs"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// NewCreateAgentJobHandler queues a job for an agent.
+func NewCreateAgentJobHandler(params HandlerParams) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var newJob structs.Job
+		if err := c.BodyParser(&newJob); err != nil {
+			params.Logger.Warn("Cannot parse JSON into new Job", zap.Error(err))
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Cannot parse JSON",
+			})
+		}
+
+		if err := jobs.Validate(newJob); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+
+		agent, err := agentFromPath(c, params)
+		if agent == nil {
+			return err
+		}
+
+		job, err := params.Jobs.Enqueue(*agent, newJob)
+		if err != nil {
+			params.Logger.Warn("Cannot insert new Job into DB", zap.Error(err))
+			return c.Status(fiber.StatusInternalServerError).JSON(nil)
+		}
+
+		params.Logger.Info("Queued new Job",
+			zap.String("JobID", job.JobID.String()),
+			zap.String("AgentID", agent.AgentID.String()),
+			zap.String("type", job.Type),
+		)
+		return c.Status(fiber.StatusCreated).JSON(job)
+	}
+}
+
+// NewGetAgentJobsHandler returns the job history of an agent, optionally filtered by '?state='.
+func NewGetAgentJobsHandler(params HandlerParams) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		agent, err := agentFromPath(c, params)
+		if agent == nil {
+			return err
+		}
+
+		history, err := params.Jobs.List(agent.AgentID, c.Query("state"))
+		if err != nil {
+			params.Logger.Warn("Failed to fetch jobs from DB", zap.Error(err))
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to fetch jobs",
+			})
+		}
+		return c.Status(fiber.StatusOK).JSON(history)
+	}
+}
+
+// NewGetNextAgentJobHandler claims the next queued job of an agent.
+// With '?wait=30s' the request is held open until a job arrives or the wait ends
+// ('jobs.max-wait' at most), in which case 204 is returned.
+func NewGetNextAgentJobHandler(params HandlerParams) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		agent, err := agentFromPath(c, params)
+		if agent == nil {
+			return err
+		}
+
+		// Polling counts as a sign of life, just like a heartbeat on the stream
+		if err := stream.TouchAgent(params.DB, agent.AgentID); err != nil {
+			params.Logger.Warn("Failed to update agent LastSeen", zap.Error(err))
+		}
+
+		var wait time.Duration
+		if raw := c.Query("wait"); raw != "" {
+			wait, err = time.ParseDuration(raw)
+			if err != nil || wait < 0 {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"error": "Failed to parse wait duration",
+				})
+			}
+		}
+		if maxWait := params.Config.GetDuration("jobs.max-wait"); wait > maxWait {
+			wait = maxWait
+		}
+
+		job, err := params.Jobs.Next(c.Context(), agent.AgentID, wait)
+		if err != nil {
+			params.Logger.Warn("Failed to claim job", zap.String("AgentID", agent.AgentID.String()), zap.Error(err))
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to claim job",
+			})
+		}
+		if job == nil {
+			return c.SendStatus(fiber.StatusNoContent)
+		}
+
+		params.Logger.Info("Agent claimed Job",
+			zap.String("JobID", job.JobID.String()),
+			zap.String("AgentID", agent.AgentID.String()),
+		)
+		return c.Status(fiber.StatusOK).JSON(job)
+	}
+}
+
+// jobFromPath resolves the ':jobId' path parameter to a job of the agent.
+// If it returns nil, the error response has already been written.
+func jobFromPath(c *fiber.Ctx, params HandlerParams, agent *structs.Agent) (*structs.Job, error) {
+	jobID, err := uuid.Parse(c.Params("jobId"))
+	if err != nil {
+		return nil, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Failed to parse JobID",
+		})
+	}
+
+	job, err := params.Jobs.Find(jobID)
+	if err != nil {
+		params.Logger.Warn("Failed to fetch job from DB", zap.Error(err))
+		return nil, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch job",
+		})
+	}
+	if job == nil || job.AgentID != agent.AgentID {
+		return nil, c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Job not found",
+		})
+	}
+	return job, nil
+}
+
+// NewGetAgentJobHandler returns a single job of an agent.
+func NewGetAgentJobHandler(params HandlerParams) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		agent, err := agentFromPath(c, params)
+		if agent == nil {
+			return err
+		}
+
+		job, err := jobFromPath(c, params, agent)
+		if job == nil {
+			return err
+		}
+		return c.Status(fiber.StatusOK).JSON(job)
+	}
+}
+
+// NewReportAgentJobHandler lets an agent report the state and output of a claimed job.
+func NewReportAgentJobHandler(params HandlerParams) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var report jobs.Report
+		if err := c.BodyParser(&report); err != nil {
+			params.Logger.Warn("Cannot parse JSON into job report", zap.Error(err))
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Cannot parse JSON",
+			})
+		}
+
+		agent, err := agentFromPath(c, params)
+		if agent == nil {
+			return err
+		}
+
+		job, err := jobFromPath(c, params, agent)
+		if job == nil {
+			return err
+		}
+
+		updated, err := params.Jobs.Update(job.JobID, report)
+		if errors.Is(err, jobs.ErrInvalidTransition) {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error": "Job is " + updated.State + " and can't become " + report.State,
+			})
+		}
+		if err != nil || updated == nil {
+			params.Logger.Warn("Cannot update Job in DB", zap.Error(err))
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to update job",
+			})
+		}
+
+		params.Logger.Info("Agent reported Job state",
+			zap.String("JobID", updated.JobID.String()),
+			zap.String("state", updated.State),
+		)
+		return c.Status(fiber.StatusOK).JSON(updated)
+	}
+}
@@ -0,0 +1,146 @@
+package handler
+
+import (
+	"fmt"
+	"net/url"
+	"packagelock/decommission"
+	"packagelock/listing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/surrealdb/surrealdb.go"
+	"go.uber.org/zap"
+)
+
+// equalFilter matches a column exactly.
+func equalFilter(condition, name string) listing.Filter {
+	return func(value string, vars map[string]interface{}) (string, error) {
+		vars[name] = value
+		return condition, nil
+	}
+}
+
+// seenSince compares LastSeen as a datetime, the stored strings don't order by time.
+const seenSince = "type::datetime(LastSeen) >= type::datetime($since)"
+
+// statusFilter selects records by whether their agents were seen since the given time.
+func statusFilter(online, offline string, since time.Time) listing.Filter {
+	return func(value string, vars map[string]interface{}) (string, error) {
+		vars["since"] = since
+		switch value {
+		case "online":
+			return online, nil
+		case "offline":
+			return offline, nil
+		}
+		return "", fmt.Errorf("status must be online or offline")
+	}
+}
+
+// hostListSpec describes the filters and sort keys of the host list.
+// Hosts are online if one of their agents was seen since the given time.
+func hostListSpec(since time.Time) listing.Spec {
+	onlineAgents := "(SELECT VALUE HostID FROM agents WHERE " + decommission.Active + " AND " + seenSince + ")"
+	return listing.Spec{
+		Table: "hosts",
+		Key:   "HostID",
+		Sorts: map[string]string{
+			"hostname": "Hostname",
+			"distro":   "Distro",
+			"arch":     "Arch",
+			"created":  "CreationTime",
+			"updated":  "UpdateTime",
+		},
+		DefaultSort: "hostname",
+		Times:       map[string]bool{"created": true, "updated": true},
+		Filters: map[string]listing.Filter{
+			"distro": equalFilter("string::lowercase(Distro) = string::lowercase($distro)", "distro"),
+			"arch":   equalFilter("Arch = $arch", "arch"),
+			"status": statusFilter("HostID INSIDE "+onlineAgents, "HostID NOTINSIDE "+onlineAgents, since),
+		},
+	}
+}
+
+// agentListSpec describes the filters and sort keys of the agent list.
+// The distro and arch filters match the host of an agent.
+func agentListSpec(since time.Time) listing.Spec {
+	return listing.Spec{
+		Table: "agents",
+		Key:   "AgentID",
+		Sorts: map[string]string{
+			"name":     "AgentName",
+			"lastseen": "LastSeen",
+			"created":  "CreationTime",
+			"updated":  "UpdateTime",
+		},
+		DefaultSort: "name",
+		Times:       map[string]bool{"lastseen": true, "created": true, "updated": true},
+		Filters: map[string]listing.Filter{
+			"distro": equalFilter("HostID INSIDE (SELECT VALUE HostID FROM hosts WHERE string::lowercase(Distro) = string::lowercase($distro))", "distro"),
+			"arch":   equalFilter("HostID INSIDE (SELECT VALUE HostID FROM hosts WHERE Arch = $arch)", "arch"),
+			"status": statusFilter(seenSince, "type::datetime(LastSeen) < type::datetime($since)", since),
+		},
+	}
+}
+
+// listPage answers a list request with one page of records. The total number of matching
+// records is sent in 'X-Total-Count', the cursor of the next page in 'X-Next-Cursor' and 'Link'.
+func listPage[T any](c *fiber.Ctx, params HandlerParams, spec listing.Spec) error {
+	query, err := listing.Parse(spec, func(key string) string { return c.Query(key) })
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	condition, err := archivedCondition(c)
+	if condition == "" {
+		return err
+	}
+	query.Where(condition)
+
+	records, err := surrealdb.SmartUnmarshal[[]T](params.DB.DB.Query(query.SelectSQL(), query.Vars()))
+	if err != nil {
+		params.Logger.Warn("Failed to fetch '"+spec.Table+"' from DB", zap.Error(err))
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch " + spec.Table,
+		})
+	}
+
+	counted, err := surrealdb.SmartUnmarshal[[]struct {
+		Count int `json:"count"`
+	}](params.DB.DB.Query(query.CountSQL(), query.Vars()))
+	if err != nil {
+		params.Logger.Warn("Failed to count '"+spec.Table+"' in DB", zap.Error(err))
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to count " + spec.Table,
+		})
+	}
+	total := 0
+	if len(counted) > 0 {
+		total = counted[0].Count
+	}
+
+	page, next, err := listing.Page(query, records)
+	if err != nil {
+		params.Logger.Warn("Failed to create cursor", zap.Error(err))
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to create cursor",
+		})
+	}
+	if page == nil {
+		page = []T{}
+	}
+
+	c.Set("X-Total-Count", fmt.Sprint(total))
+	if next != "" {
+		c.Set("X-Next-Cursor", next)
+		if link, err := url.Parse(c.OriginalURL()); err == nil {
+			values := link.Query()
+			values.Set("cursor", next)
+			link.RawQuery = values.Encode()
+			c.Set("Link", fmt.Sprintf("<%s>; rel=\"next\"", link.String()))
+		}
+	}
+	return c.Status(fiber.StatusOK).JSON(page)
+}
@@ -0,0 +1,245 @@
+package handler
+
+import (
+	"fmt"
+	"packagelock/approvals"
+	"packagelock/hostgroups"
+	"packagelock/locks"
+	"packagelock/structs"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/surrealdb/surrealdb.go"
+	"go.uber.org/zap"
+)
+
+// lockFromPath resolves the ':id' path parameter to a lock.
+// If it returns nil, the error response has already been written.
+func lockFromPath(c *fiber.Ctx, params HandlerParams) (*structs.Lock, error) {
+	lockID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		params.Logger.Debug("Cannot parse LockID from path", zap.Error(err))
+		return nil, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Failed to parse LockID",
+		})
+	}
+
+	lock, err := locks.FindByLockID(params.DB, lockID)
+	if err != nil {
+		params.Logger.Warn("Failed to fetch lock from DB", zap.Error(err))
+		return nil, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch lock",
+		})
+	}
+
+	if lock == nil {
+		return nil, c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Lock not found",
+		})
+	}
+
+	return lock, nil
+}
+
+// requestLockApproval stores a lock change for approval instead of applying it
+// and answers with the approval request.
+func requestLockApproval(c *fiber.Ctx, params HandlerParams, kind string, lockID uuid.UUID, lock structs.Lock) error {
+	user, err := requester(c, params)
+	if user == nil {
+		return err
+	}
+
+	summary := map[string]string{
+		approvals.KindLockCreate: "Create lock %q",
+		approvals.KindLockUpdate: "Update lock %q",
+		approvals.KindLockDelete: "Delete lock %q",
+	}[kind]
+	request, err := params.Approvals.Request(kind, lockID, fmt.Sprintf(summary, lock.Name), &lock, *user)
+	if err != nil {
+		params.Logger.Warn("Cannot request approval for Lock change", zap.Error(err))
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to request approval",
+		})
+	}
+
+	return c.Status(fiber.StatusAccepted).JSON(request)
+}
+
+func NewGetLocksHandler(params HandlerParams) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		allLocks, err := surrealdb.SmartUnmarshal[[]structs.Lock](params.DB.DB.Select("locks"))
+		if err != nil {
+			params.Logger.Warn("Failed to fetch 'locks' from DB", zap.Error(err))
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to fetch locks",
+			})
+		}
+
+		if allLocks == nil {
+			allLocks = []structs.Lock{}
+		}
+		return c.Status(fiber.StatusOK).JSON(allLocks)
+	}
+}
+
+func NewGetLockHandler(params HandlerParams) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		lock, err := lockFromPath(c, params)
+		if lock == nil {
+			return err
+		}
+		return c.Status(fiber.StatusOK).JSON(lock)
+	}
+}
+
+func NewCreateLockHandler(params HandlerParams) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var newLock structs.Lock
+		if err := c.BodyParser(&newLock); err != nil {
+			params.Logger.Warn("Cannot parse JSON into new Lock", zap.Error(err))
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Cannot parse JSON",
+			})
+		}
+
+		if err := locks.Validate(newLock); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		if _, err := hostgroups.Resolve(params.DB, nil, newLock.HostGroups); err != nil {
+			return hostGroupError(c, params, err)
+		}
+
+		if params.Approvals.Enabled() {
+			return requestLockApproval(c, params, approvals.KindLockCreate, uuid.Nil, newLock)
+		}
+
+		created, err := locks.Create(params.DB, newLock)
+		if err != nil {
+			params.Logger.Warn("Cannot insert new Lock into DB", zap.Error(err))
+			return c.Status(fiber.StatusInternalServerError).JSON(nil)
+		}
+
+		reevaluateLocks(params, created)
+
+		params.Logger.Info("Created new Lock", zap.String("LockID", created.LockID.String()))
+		return c.Status(fiber.StatusCreated).JSON(created)
+	}
+}
+
+func NewUpdateLockHandler(params HandlerParams) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		lock, err := lockFromPath(c, params)
+		if lock == nil {
+			return err
+		}
+
+		var update structs.Lock
+		if err := c.BodyParser(&update); err != nil {
+			params.Logger.Warn("Cannot parse JSON into Lock", zap.Error(err))
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Cannot parse JSON",
+			})
+		}
+
+		if err := locks.Validate(update); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		if _, err := hostgroups.Resolve(params.DB, nil, update.HostGroups); err != nil {
+			return hostGroupError(c, params, err)
+		}
+
+		if params.Approvals.Enabled() {
+			return requestLockApproval(c, params, approvals.KindLockUpdate, lock.LockID, update)
+		}
+
+		update, err = locks.Update(params.DB, *lock, update)
+		if err != nil {
+			params.Logger.Warn("Cannot update Lock in DB", zap.Error(err))
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to update lock",
+			})
+		}
+
+		// Hosts which were removed from the lock lose their violations as well
+		reevaluateLocks(params, *lock, update)
+
+		params.Logger.Info("Updated Lock", zap.String("LockID", update.LockID.String()))
+		return c.Status(fiber.StatusOK).JSON(update)
+	}
+}
+
+func NewDeleteLockHandler(params HandlerParams) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		lock, err := lockFromPath(c, params)
+		if lock == nil {
+			return err
+		}
+
+		if params.Approvals.Enabled() {
+			return requestLockApproval(c, params, approvals.KindLockDelete, lock.LockID, *lock)
+		}
+
+		if err := locks.Delete(params.DB, *lock); err != nil {
+			params.Logger.Warn("Cannot delete Lock from DB", zap.Error(err))
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to delete lock",
+			})
+		}
+
+		reevaluateLocks(params, *lock)
+
+		params.Logger.Info("Deleted Lock", zap.String("LockID", lock.LockID.String()))
+		return c.SendStatus(fiber.StatusNoContent)
+	}
+}
+
+// reevaluateLocks enforces the locks on all hosts the given lock versions apply to.
+func reevaluateLocks(params HandlerParams, changed ...structs.Lock) {
+	hostIDs, err := locks.Hosts(params.DB, changed...)
+	if err == nil {
+		err = locks.Reevaluate(params.DB, hostIDs)
+	}
+	if err != nil {
+		params.Logger.Warn("Failed to evaluate Lock", zap.Error(err))
+	}
+}
+
+func NewGetLockViolationsHandler(params HandlerParams) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		lock, err := lockFromPath(c, params)
+		if lock == nil {
+			return err
+		}
+
+		violations, err := locks.FindViolations(params.DB, "LockID", lock.LockID)
+		if err != nil {
+			params.Logger.Warn("Failed to fetch lock violations from DB", zap.Error(err))
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to fetch violations",
+			})
+		}
+		return c.Status(fiber.StatusOK).JSON(violations)
+	}
+}
+
+func NewGetHostViolationsHandler(params HandlerParams) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		host, err := hostFromPath(c, params)
+		if host == nil {
+			return err
+		}
+
+		violations, err := locks.FindViolations(params.DB, "HostID", host.HostID)
+		if err != nil {
+			params.Logger.Warn("Failed to fetch lock violations from DB", zap.Error(err))
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to fetch violations",
+			})
+		}
+		return c.Status(fiber.StatusOK).JSON(violations)
+	}
+}
@@ -0,0 +1,150 @@
+package handler
+
+import (
+	"packagelock/structs"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/surrealdb/surrealdb.go"
+	"go.uber.org/zap"
+)
+
+// findHost looks up a host by its HostID. It returns nil if no such host exists.
+func findHost(params HandlerParams, hostID uuid.UUID) (*structs.Host, error) {
+	hosts, err := surrealdb.SmartUnmarshal[[]structs.Host](params.DB.DB.Query(
+		"SELECT * FROM hosts WHERE HostID = $hostID LIMIT 1",
+		map[string]interface{}{"hostID": hostID.String()},
+	))
+	if err != nil {
+		return nil, err
+	}
+	if len(hosts) == 0 {
+		return nil, nil
+	}
+	return &hosts[0], nil
+}
+
+// hostFromPath resolves the ':id' path parameter to a host.
+// If it returns nil, the error response has already been written.
+func hostFromPath(c *fiber.Ctx, params HandlerParams) (*structs.Host, error) {
+	hostID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		params.Logger.Debug("Cannot parse HostID from path", zap.Error(err))
+		return nil, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Failed to parse HostID",
+		})
+	}
+
+	host, err := findHost(params, hostID)
+	if err != nil {
+		params.Logger.Warn("Failed to fetch host from DB", zap.Error(err))
+		return nil, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch host",
+		})
+	}
+
+	if host == nil {
+		params.Logger.Warn("Host not found", zap.String("HostID", hostID.String()))
+		return nil, c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Host not found",
+		})
+	}
+
+	return host, nil
+}
+
+// findHostPackages returns the package inventory of a host.
+func findHostPackages(params HandlerParams, hostID uuid.UUID) ([]structs.Package, error) {
+	packages, err := surrealdb.SmartUnmarshal[[]structs.Package](params.DB.DB.Query(
+		"SELECT * FROM packages WHERE HostID = $hostID ORDER BY PackageName",
+		map[string]interface{}{"hostID": hostID.String()},
+	))
+	if err != nil {
+		return nil, err
+	}
+	if packages == nil {
+		packages = []structs.Package{}
+	}
+	return packages, nil
+}
+
+// findAgent looks up an agent by its AgentID. It returns nil if no such agent exists.
+func findAgent(params HandlerParams, agentID uuid.UUID) (*structs.Agent, error) {
+	agents, err := surrealdb.SmartUnmarshal[[]structs.Agent](params.DB.DB.Query(
+		"SELECT * FROM agents WHERE AgentID = $agentID LIMIT 1",
+		map[string]interface{}{"agentID": agentID.String()},
+	))
+	if err != nil {
+		return nil, err
+	}
+	if len(agents) == 0 {
+		return nil, nil
+	}
+	return &agents[0], nil
+}
+
+// agentFromPath resolves the ':id' path parameter to an agent.
+// If it returns nil, the error response has already been written.
+func agentFromPath(c *fiber.Ctx, params HandlerParams) (*structs.Agent, error) {
+	agentID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		params.Logger.Debug("Cannot parse AgentID from path", zap.Error(err))
+		return nil, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Failed to parse AgentID",
+		})
+	}
+
+	agent, err := findAgent(params, agentID)
+	if err != nil {
+		params.Logger.Warn("Failed to fetch agent from DB", zap.Error(err))
+		return nil, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch agent",
+		})
+	}
+
+	if agent == nil {
+		params.Logger.Warn("Agent not found", zap.String("AgentID", agentID.String()))
+		return nil, c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Agent not found",
+		})
+	}
+
+	return agent, nil
+}
+
+// currentUser returns the user of the JWT the request was authenticated with, or nil
+// if the request has no token, e.g. outside of production. Tokens of unknown users,
+// like the one the CLI signs itself, yield a user without groups.
+func currentUser(c *fiber.Ctx, params HandlerParams) (*structs.User, error) {
+	token, ok := c.Locals("user").(*jwt.Token)
+	if !ok || token == nil {
+		return nil, nil
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, nil
+	}
+
+	username, _ := claims["username"].(string)
+	user := &structs.User{Username: username}
+	if rawID, ok := claims["userID"].(string); ok {
+		user.UserID, _ = uuid.Parse(rawID)
+	}
+
+	query := "SELECT * FROM user WHERE Username = $username LIMIT 1"
+	if user.UserID != uuid.Nil {
+		query = "SELECT * FROM user WHERE UserID = $userID LIMIT 1"
+	}
+	users, err := surrealdb.SmartUnmarshal[[]structs.User](params.DB.DB.Query(query, map[string]interface{}{
+		"username": username,
+		"userID":   user.UserID.String(),
+	}))
+	if err != nil {
+		return nil, err
+	}
+	if len(users) > 0 {
+		return &users[0], nil
+	}
+	return user, nil
+}
@@ -0,0 +1,168 @@
+package handler
+
+import (
+	"packagelock/locks"
+	"packagelock/structs"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// InventoryReport is the body of a package inventory report.
+type InventoryReport struct {
+	PackageManagerName string
+	Packages           []structs.Package
+	Services           []structs.Service // optional, nil keeps the known services
+}
+
+// NewReportHostPackagesHandler replaces the package inventory of a host.
+// Every package is checked against the mirrored repository indexes
+// to find out whether a newer version is available.
+func NewReportHostPackagesHandler(params HandlerParams) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var report InventoryReport
+		if err := c.BodyParser(&report); err != nil {
+			params.Logger.Warn("Cannot parse JSON into inventory report", zap.Error(err))
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Cannot parse JSON",
+			})
+		}
+
+		host, err := hostFromPath(c, params)
+		if host == nil {
+			return err
+		}
+		if host.ArchiveTime != nil {
+			return c.Status(fiber.StatusGone).JSON(fiber.Map{
+				"error": "Host was decommissioned",
+			})
+		}
+
+		previous, err := findHostPackages(params, host.HostID)
+		if err != nil {
+			params.Logger.Warn("Failed to fetch host packages from DB", zap.Error(err))
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to fetch packages",
+			})
+		}
+
+		// Keep IDs and creation times stable for packages which were already known
+		known := make(map[string]structs.Package, len(previous))
+		for _, pkg := range previous {
+			known[pkg.PackageName+"\x00"+pkg.Arch] = pkg
+		}
+
+		now := time.Now()
+		packages := report.Packages
+		for idx := range packages {
+			pkg := &packages[idx]
+			pkg.ID = ""
+			pkg.HostID = host.HostID
+			pkg.SourceName = sourceName(pkg.SourceName)
+			pkg.UpdateTime = now
+			if old, ok := known[pkg.PackageName+"\x00"+pkg.Arch]; ok {
+				pkg.PackageID = old.PackageID
+				pkg.CreationTime = old.CreationTime
+			} else {
+				pkg.PackageID = uuid.New()
+				pkg.CreationTime = now
+			}
+		}
+
+		if report.PackageManagerName != "" {
+			host.PackageManager.PackageManagerName = report.PackageManagerName
+		}
+		if report.Services != nil {
+			host.Services = report.Services
+		}
+		params.Indexes.Index().UpdatePackages(*host, packages)
+
+		if err := replaceHostPackages(params, host, packages); err != nil {
+			params.Logger.Warn("Cannot store host packages in DB", zap.Error(err))
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to store packages",
+			})
+		}
+
+		// The package manager is part of the group rules, locks below see the new groups
+		refreshHostGroups(params, *host)
+
+		// A failed lock evaluation must not reject the inventory itself
+		if violations, err := locks.Enforce(params.DB, *host, packages); err != nil {
+			params.Logger.Warn("Failed to evaluate locks for host", zap.String("HostID", host.HostID.String()), zap.Error(err))
+		} else if len(violations) > 0 {
+			params.Logger.Info("Host violates package locks",
+				zap.String("HostID", host.HostID.String()),
+				zap.Int("violations", len(violations)),
+			)
+		}
+
+		if _, err := params.Drift.Evaluate(*host, packages); err != nil {
+			params.Logger.Warn("Failed to detect drift of host", zap.String("HostID", host.HostID.String()), zap.Error(err))
+		}
+
+		params.Logger.Info("Updated host inventory",
+			zap.String("HostID", host.HostID.String()),
+			zap.Int("packages", len(packages)),
+		)
+		return c.Status(fiber.StatusOK).JSON(packages)
+	}
+}
+
+// sourceName strips the version dpkg appends to 'Source:' when it differs
+// from the binary's, e.g. "openssl (3.0.13-1)".
+func sourceName(source string) string {
+	name, _, _ := strings.Cut(strings.TrimSpace(source), " ")
+	return name
+}
+
+// NewGetHostPackagesHandler returns the package inventory of a host.
+func NewGetHostPackagesHandler(params HandlerParams) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		host, err := hostFromPath(c, params)
+		if host == nil {
+			return err
+		}
+
+		packages, err := findHostPackages(params, host.HostID)
+		if err != nil {
+			params.Logger.Warn("Failed to fetch host packages from DB", zap.Error(err))
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to fetch packages",
+			})
+		}
+
+		return c.Status(fiber.StatusOK).JSON(packages)
+	}
+}
+
+// replaceHostPackages swaps the stored inventory of a host for the given packages
+// and updates the host's package references.
+func replaceHostPackages(params HandlerParams, host *structs.Host, packages []structs.Package) error {
+	if _, err := params.DB.DB.Query("DELETE packages WHERE HostID = $hostID", map[string]interface{}{
+		"hostID": host.HostID.String(),
+	}); err != nil {
+		return err
+	}
+
+	if len(packages) > 0 {
+		if _, err := params.DB.DB.Query("INSERT INTO packages $packages", map[string]interface{}{
+			"packages": packages,
+		}); err != nil {
+			return err
+		}
+	}
+
+	host.Packages = make([]uuid.UUID, 0, len(packages))
+	for _, pkg := range packages {
+		host.Packages = append(host.Packages, pkg.PackageID)
+	}
+	host.PackageManager.UpdateTime = time.Now()
+	host.UpdateTime = time.Now()
+
+	_, err := params.DB.DB.Update(host.ID, host)
+	return err
+}
@@ -0,0 +1,108 @@
+package handler
+
+import (
+	"packagelock/repos"
+	"packagelock/structs"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.uber.org/zap"
+)
+
+// ReposReport is the body of a repository report.
+type ReposReport struct {
+	Repos []structs.Package_Repo
+	Files map[string]string // raw configuration files keyed by their path on the host
+}
+
+// NewReportHostReposHandler stores the repositories configured on a host.
+// Agents can either send already parsed records or the raw configuration files,
+// which are then parsed on the server.
+func NewReportHostReposHandler(params HandlerParams) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var report ReposReport
+		if err := c.BodyParser(&report); err != nil {
+			params.Logger.Warn("Cannot parse JSON into repos report", zap.Error(err))
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Cannot parse JSON",
+			})
+		}
+
+		host, err := hostFromPath(c, params)
+		if host == nil {
+			return err
+		}
+		if host.ArchiveTime != nil {
+			return c.Status(fiber.StatusGone).JSON(fiber.Map{
+				"error": "Host was decommissioned",
+			})
+		}
+
+		reported := report.Repos
+		if len(report.Files) > 0 {
+			files := make(map[string][]byte, len(report.Files))
+			for path, content := range report.Files {
+				files[path] = []byte(content)
+			}
+
+			parsed, err := repos.ParseFiles(files)
+			if err != nil {
+				params.Logger.Warn("Cannot parse reported repository files",
+					zap.String("HostID", host.HostID.String()),
+					zap.Error(err),
+				)
+				return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{
+					"error": err.Error(),
+				})
+			}
+			reported = append(reported, parsed...)
+		}
+
+		if reported == nil {
+			reported = []structs.Package_Repo{}
+		}
+
+		host.PackageManager.PackageRepos = reported
+		host.PackageManager.UpdateTime = time.Now()
+		host.UpdateTime = time.Now()
+
+		if _, err := params.DB.DB.Update(host.ID, host); err != nil {
+			params.Logger.Warn("Cannot update host repos in DB", zap.Error(err))
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to update host",
+			})
+		}
+
+		// Repos added outside of the baseline show up as drift right away
+		if _, err := evaluateHostDrift(params, *host); err != nil {
+			params.Logger.Warn("Failed to detect drift of host", zap.String("HostID", host.HostID.String()), zap.Error(err))
+		}
+
+		params.Logger.Info("Updated host repositories",
+			zap.String("HostID", host.HostID.String()),
+			zap.Int("repos", len(reported)),
+		)
+		return c.Status(fiber.StatusOK).JSON(reported)
+	}
+}
+
+// NewGetHostReposHandler returns the repositories last reported for a host.
+func NewGetHostReposHandler(params HandlerParams) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		host, err := hostFromPath(c, params)
+		if host == nil {
+			return err
+		}
+		if host.ArchiveTime != nil {
+			return c.Status(fiber.StatusGone).JSON(fiber.Map{
+				"error": "Host was decommissioned",
+			})
+		}
+
+		reported := host.PackageManager.PackageRepos
+		if reported == nil {
+			reported = []structs.Package_Repo{}
+		}
+		return c.Status(fiber.StatusOK).JSON(reported)
+	}
+}
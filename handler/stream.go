@@ -0,0 +1,69 @@
+package handler
+
+import (
+	"crypto/subtle"
+	"packagelock/structs"
+
+	"github.com/gofiber/contrib/websocket"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// NewAgentStreamHandler upgrades the request to the agent's WebSocket stream.
+// Agents identify themselves with the 'X-Agent-ID' and 'X-Agent-Secret' headers.
+// Agents without a secret and archived agents can't connect.
+func NewAgentStreamHandler(params HandlerParams) fiber.Handler {
+	serve := websocket.New(func(socket *websocket.Conn) {
+		agent := socket.Locals("agent").(*structs.Agent)
+		params.Stream.Serve(socket, *agent)
+	})
+
+	return func(c *fiber.Ctx) error {
+		if !websocket.IsWebSocketUpgrade(c) {
+			return c.Status(fiber.StatusUpgradeRequired).JSON(fiber.Map{
+				"error": "Expected a WebSocket upgrade",
+			})
+		}
+
+		agentID, err := uuid.Parse(c.Get("X-Agent-ID"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Failed to parse AgentID",
+			})
+		}
+
+		agent, err := findAgent(params, agentID)
+		if err != nil {
+			params.Logger.Warn("Failed to fetch agent from DB", zap.Error(err))
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to fetch agent",
+			})
+		}
+
+		// Unknown agents, missing and wrong secrets get the same answer
+		if agent == nil || agent.AgentSecret == "" ||
+			subtle.ConstantTimeCompare([]byte(agent.AgentSecret), []byte(c.Get("X-Agent-Secret"))) != 1 {
+			params.Logger.Warn("Rejected agent stream", zap.String("AgentID", agentID.String()))
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": "Invalid agent credentials",
+			})
+		}
+
+		if agent.ArchiveTime != nil {
+			return c.Status(fiber.StatusGone).JSON(fiber.Map{
+				"error": "Agent was decommissioned",
+			})
+		}
+
+		c.Locals("agent", agent)
+		return serve(c)
+	}
+}
+
+// NewGetAgentConnectionsHandler lists the agents with an open stream.
+func NewGetAgentConnectionsHandler(params HandlerParams) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		return c.Status(fiber.StatusOK).JSON(params.Stream.Connections())
+	}
+}
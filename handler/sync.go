@@ -0,0 +1,114 @@
+package handler
+
+import (
+	"packagelock/hostgroups"
+	"packagelock/resync"
+	"packagelock/structs"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// SyncRequest is the optional body of a sync, without a body all agents are synced.
+type SyncRequest struct {
+	structs.Sync_Filter
+	Timeout string // e.g. "5m", defaults to 'sync.timeout'
+}
+
+// NewStartSyncHandler queues a refresh-inventory job for all agents or a filtered set.
+func NewStartSyncHandler(params HandlerParams) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var request SyncRequest
+		if len(c.Body()) > 0 {
+			if err := c.BodyParser(&request); err != nil {
+				params.Logger.Warn("Cannot parse JSON into sync request", zap.Error(err))
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"error": "Cannot parse JSON",
+				})
+			}
+		}
+
+		timeout := params.Config.GetDuration("sync.timeout")
+		if request.Timeout != "" {
+			parsed, err := time.ParseDuration(request.Timeout)
+			if err != nil || parsed <= 0 {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"error": "Failed to parse timeout",
+				})
+			}
+			timeout = parsed
+		}
+
+		if len(request.HostGroups) > 0 {
+			hostIDs, err := hostgroups.Resolve(params.DB, request.HostIDs, request.HostGroups)
+			if err != nil {
+				return hostGroupError(c, params, err)
+			}
+			// Without hosts the filter would match every agent
+			if len(hostIDs) == 0 {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"error": "The given groups have no members",
+				})
+			}
+			request.HostIDs = hostIDs
+		}
+
+		started, err := resync.Start(params.DB, params.Jobs, request.Sync_Filter, timeout)
+		if err != nil {
+			params.Logger.Warn("Failed to start sync", zap.Error(err))
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to start sync",
+			})
+		}
+
+		status, err := resync.Progress(params.DB, params.Jobs, *started, time.Now())
+		if err != nil {
+			params.Logger.Warn("Failed to fetch sync progress", zap.Error(err))
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to fetch sync progress",
+			})
+		}
+
+		params.Logger.Info("Started sync",
+			zap.String("SyncID", started.SyncID.String()),
+			zap.Int("agents", len(started.Agents)),
+		)
+		return c.Status(fiber.StatusAccepted).JSON(status)
+	}
+}
+
+// NewGetSyncHandler returns the progress of a sync.
+func NewGetSyncHandler(params HandlerParams) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		syncID, err := uuid.Parse(c.Params("id"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Failed to parse SyncID",
+			})
+		}
+
+		request, err := resync.Find(params.DB, syncID)
+		if err != nil {
+			params.Logger.Warn("Failed to fetch sync from DB", zap.Error(err))
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to fetch sync",
+			})
+		}
+		if request == nil {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Sync not found",
+			})
+		}
+
+		status, err := resync.Progress(params.DB, params.Jobs, *request, time.Now())
+		if err != nil {
+			params.Logger.Warn("Failed to fetch sync progress", zap.Error(err))
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to fetch sync progress",
+			})
+		}
+		return c.Status(fiber.StatusOK).JSON(status)
+	}
+}
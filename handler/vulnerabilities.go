@@ -0,0 +1,95 @@
+package handler
+
+import (
+	"packagelock/decommission"
+	"packagelock/osv"
+	"packagelock/structs"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/surrealdb/surrealdb.go"
+	"go.uber.org/zap"
+)
+
+// NewGetHostVulnerabilitiesHandler matches the packages of a host against the imported OSV database.
+func NewGetHostVulnerabilitiesHandler(params HandlerParams) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		host, err := hostFromPath(c, params)
+		if host == nil {
+			return err
+		}
+
+		packages, err := findHostPackages(params, host.HostID)
+		if err != nil {
+			params.Logger.Warn("Failed to fetch host packages from DB", zap.Error(err))
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to fetch packages",
+			})
+		}
+
+		vulns, err := osv.FindByPackages(params.DB, packageNames(packages))
+		if err != nil {
+			params.Logger.Warn("Failed to fetch vulnerabilities from DB", zap.Error(err))
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to fetch vulnerabilities",
+			})
+		}
+
+		return c.Status(fiber.StatusOK).JSON(osv.Match(*host, packages, vulns))
+	}
+}
+
+// NewGetVulnerabilitiesHandler matches the packages of all hosts against the imported OSV database.
+func NewGetVulnerabilitiesHandler(params HandlerParams) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		hosts, err := surrealdb.SmartUnmarshal[[]structs.Host](params.DB.DB.Query("SELECT * FROM hosts WHERE "+decommission.Active, nil))
+		if err != nil {
+			params.Logger.Warn("Failed to fetch 'hosts' from DB", zap.Error(err))
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to fetch hosts",
+			})
+		}
+
+		allPackages, err := surrealdb.SmartUnmarshal[[]structs.Package](params.DB.DB.Select("packages"))
+		if err != nil {
+			params.Logger.Warn("Failed to fetch 'packages' from DB", zap.Error(err))
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to fetch packages",
+			})
+		}
+
+		vulns, err := osv.FindByPackages(params.DB, packageNames(allPackages))
+		if err != nil {
+			params.Logger.Warn("Failed to fetch vulnerabilities from DB", zap.Error(err))
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to fetch vulnerabilities",
+			})
+		}
+
+		packagesByHost := map[string][]structs.Package{}
+		for _, pkg := range allPackages {
+			packagesByHost[pkg.HostID.String()] = append(packagesByHost[pkg.HostID.String()], pkg)
+		}
+
+		findings := []structs.Vulnerability_Finding{}
+		for _, host := range hosts {
+			findings = append(findings, osv.Match(host, packagesByHost[host.HostID.String()], vulns)...)
+		}
+
+		return c.Status(fiber.StatusOK).JSON(findings)
+	}
+}
+
+// packageNames returns the distinct binary and source names of the given packages.
+func packageNames(packages []structs.Package) []string {
+	seen := map[string]bool{}
+	names := []string{}
+	for _, pkg := range packages {
+		for _, name := range []string{pkg.PackageName, pkg.SourceName} {
+			if name != "" && !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	return names
+}
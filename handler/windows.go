@@ -0,0 +1,232 @@
+package handler
+
+import (
+	"packagelock/hostgroups"
+	"packagelock/schedule"
+	"packagelock/structs"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/surrealdb/surrealdb.go"
+	"go.uber.org/zap"
+)
+
+// maxPreview caps the occurrences returned by the window preview.
+const maxPreview = 100
+
+// windowFromPath resolves the ':id' path parameter to a maintenance window.
+// If it returns nil, the error response has already been written.
+func windowFromPath(c *fiber.Ctx, params HandlerParams) (*structs.Maintenance_Window, error) {
+	windowID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		params.Logger.Debug("Cannot parse WindowID from path", zap.Error(err))
+		return nil, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Failed to parse WindowID",
+		})
+	}
+
+	window, err := schedule.FindWindow(params.DB, windowID)
+	if err != nil {
+		params.Logger.Warn("Failed to fetch maintenance window from DB", zap.Error(err))
+		return nil, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch window",
+		})
+	}
+
+	if window == nil {
+		return nil, c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Window not found",
+		})
+	}
+
+	return window, nil
+}
+
+func NewGetWindowsHandler(params HandlerParams) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		windows, err := surrealdb.SmartUnmarshal[[]structs.Maintenance_Window](params.DB.DB.Select("maintenance_windows"))
+		if err != nil {
+			params.Logger.Warn("Failed to fetch 'maintenance_windows' from DB", zap.Error(err))
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to fetch windows",
+			})
+		}
+
+		if windows == nil {
+			windows = []structs.Maintenance_Window{}
+		}
+		return c.Status(fiber.StatusOK).JSON(windows)
+	}
+}
+
+func NewGetWindowHandler(params HandlerParams) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		window, err := windowFromPath(c, params)
+		if window == nil {
+			return err
+		}
+		return c.Status(fiber.StatusOK).JSON(window)
+	}
+}
+
+func NewCreateWindowHandler(params HandlerParams) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var newWindow structs.Maintenance_Window
+		if err := c.BodyParser(&newWindow); err != nil {
+			params.Logger.Warn("Cannot parse JSON into new Maintenance_Window", zap.Error(err))
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Cannot parse JSON",
+			})
+		}
+
+		if err := schedule.Validate(newWindow); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		if _, err := hostgroups.Resolve(params.DB, nil, newWindow.HostGroups); err != nil {
+			return hostGroupError(c, params, err)
+		}
+
+		newWindow.ID = ""
+		newWindow.WindowID = uuid.New()
+		newWindow.CreationTime = time.Now()
+		newWindow.UpdateTime = time.Now()
+
+		created, err := surrealdb.SmartUnmarshal[[]structs.Maintenance_Window](params.DB.DB.Create("maintenance_windows", newWindow))
+		if err != nil || len(created) == 0 {
+			params.Logger.Warn("Cannot insert new Maintenance_Window into DB", zap.Error(err))
+			return c.Status(fiber.StatusInternalServerError).JSON(nil)
+		}
+
+		params.Logger.Info("Created new maintenance window", zap.String("WindowID", newWindow.WindowID.String()))
+		return c.Status(fiber.StatusCreated).JSON(created[0])
+	}
+}
+
+func NewUpdateWindowHandler(params HandlerParams) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		window, err := windowFromPath(c, params)
+		if window == nil {
+			return err
+		}
+
+		var update structs.Maintenance_Window
+		if err := c.BodyParser(&update); err != nil {
+			params.Logger.Warn("Cannot parse JSON into Maintenance_Window", zap.Error(err))
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Cannot parse JSON",
+			})
+		}
+
+		if err := schedule.Validate(update); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		if _, err := hostgroups.Resolve(params.DB, nil, update.HostGroups); err != nil {
+			return hostGroupError(c, params, err)
+		}
+
+		update.ID = window.ID
+		update.WindowID = window.WindowID
+		update.CreationTime = window.CreationTime
+		update.UpdateTime = time.Now()
+
+		if _, err := params.DB.DB.Update(window.ID, update); err != nil {
+			params.Logger.Warn("Cannot update Maintenance_Window in DB", zap.Error(err))
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to update window",
+			})
+		}
+
+		params.Logger.Info("Updated maintenance window", zap.String("WindowID", update.WindowID.String()))
+		return c.Status(fiber.StatusOK).JSON(update)
+	}
+}
+
+func NewDeleteWindowHandler(params HandlerParams) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		window, err := windowFromPath(c, params)
+		if window == nil {
+			return err
+		}
+
+		// Campaigns without their window would never run
+		campaigns, err := surrealdb.SmartUnmarshal[[]structs.Campaign](params.DB.DB.Query(
+			"SELECT * FROM campaigns WHERE WindowID = $windowID AND State IN ['scheduled', 'running']",
+			map[string]interface{}{"windowID": window.WindowID.String()},
+		))
+		if err != nil {
+			params.Logger.Warn("Failed to fetch campaigns of window", zap.Error(err))
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to delete window",
+			})
+		}
+		if len(campaigns) > 0 {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error": "Window is used by " + strconv.Itoa(len(campaigns)) + " active campaigns",
+			})
+		}
+
+		if _, err := params.DB.DB.Delete(window.ID); err != nil {
+			params.Logger.Warn("Cannot delete Maintenance_Window from DB", zap.Error(err))
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to delete window",
+			})
+		}
+
+		params.Logger.Info("Deleted maintenance window", zap.String("WindowID", window.WindowID.String()))
+		return c.SendStatus(fiber.StatusNoContent)
+	}
+}
+
+// NewGetWindowPreviewHandler lists the next occurrences of a window, '?n=' of them (default 5),
+// starting at '?from=' (RFC 3339, default now).
+func NewGetWindowPreviewHandler(params HandlerParams) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		window, err := windowFromPath(c, params)
+		if window == nil {
+			return err
+		}
+
+		n := c.QueryInt("n", 5)
+		if n < 1 || n > maxPreview {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "n must be between 1 and " + strconv.Itoa(maxPreview),
+			})
+		}
+
+		from := time.Now()
+		if raw := c.Query("from"); raw != "" {
+			from, err = time.Parse(time.RFC3339, raw)
+			if err != nil {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"error": "from must be an RFC 3339 timestamp",
+				})
+			}
+		}
+
+		compiled, err := schedule.Compile(*window)
+		if err != nil {
+			params.Logger.Warn("Stored maintenance window is invalid", zap.String("WindowID", window.WindowID.String()), zap.Error(err))
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+
+		occurrences := compiled.Next(from, n)
+		// An occurrence which is open right now comes first
+		if open, ok := compiled.Active(from); ok {
+			occurrences = append([]schedule.Occurrence{open}, occurrences[:len(occurrences)-1]...)
+		}
+
+		return c.Status(fiber.StatusOK).JSON(fiber.Map{
+			"WindowID":    window.WindowID,
+			"TimeZone":    window.TimeZone,
+			"Occurrences": occurrences,
+		})
+	}
+}
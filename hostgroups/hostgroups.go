@@ -0,0 +1,126 @@
+// Hostgroups
+//
+// The Hostgroups Package groups hosts, so policies like locks, maintenance windows and
+// campaigns can target a group instead of listing hosts one by one. Static groups list
+// their hosts, dynamic groups have a membership rule over host fields and tags.
+// The members of every group are stored with it and kept up to date whenever a host
+// or a group changes.
+package hostgroups
+
+import (
+	"errors"
+	"fmt"
+	"packagelock/structs"
+
+	"github.com/google/uuid"
+)
+
+// ErrUnknownGroup is returned when a policy refers to a group which doesn't exist.
+var ErrUnknownGroup = errors.New("unknown host group")
+
+// Validate checks the name and rule of a group.
+func Validate(group structs.Host_Group) error {
+	if group.Name == "" {
+		return fmt.Errorf("group needs a name")
+	}
+	if group.Rule != "" && len(group.HostIDs) > 0 {
+		return fmt.Errorf("group can either have a rule or list its hosts")
+	}
+	if group.Rule != "" {
+		if _, err := Compile(group.Rule); err != nil {
+			return fmt.Errorf("invalid rule: %w", err)
+		}
+	}
+	return nil
+}
+
+// IsDynamic reports whether the members of a group are defined by a rule.
+func IsDynamic(group structs.Host_Group) bool {
+	return group.Rule != ""
+}
+
+// Members returns the members of a group among the given hosts. Archived hosts are never members,
+// static groups keep hosts which are not registered yet.
+func Members(group structs.Host_Group, hosts []structs.Host) ([]uuid.UUID, error) {
+	if !IsDynamic(group) {
+		archived := map[uuid.UUID]bool{}
+		for _, host := range hosts {
+			if host.ArchiveTime != nil {
+				archived[host.HostID] = true
+			}
+		}
+
+		members := []uuid.UUID{}
+		for _, id := range dedupe(group.HostIDs) {
+			if !archived[id] {
+				members = append(members, id)
+			}
+		}
+		return members, nil
+	}
+
+	rule, err := Compile(group.Rule)
+	if err != nil {
+		return nil, err
+	}
+	members := []uuid.UUID{}
+	for _, host := range hosts {
+		if host.ArchiveTime == nil && rule.Match(host) {
+			members = append(members, host.HostID)
+		}
+	}
+	return members, nil
+}
+
+// IsMember reports whether a host belongs to a group.
+func IsMember(group structs.Host_Group, host structs.Host) (bool, error) {
+	if host.ArchiveTime != nil {
+		return false, nil
+	}
+	if !IsDynamic(group) {
+		for _, id := range group.HostIDs {
+			if id == host.HostID {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+
+	rule, err := Compile(group.Rule)
+	if err != nil {
+		return false, err
+	}
+	return rule.Match(host), nil
+}
+
+// Changed returns the hosts which are members of only one of the two lists.
+func Changed(before, after []uuid.UUID) []uuid.UUID {
+	in := map[uuid.UUID]int{}
+	for _, id := range dedupe(before) {
+		in[id]++
+	}
+	for _, id := range dedupe(after) {
+		in[id]--
+	}
+
+	var changed []uuid.UUID
+	for _, id := range append(dedupe(before), dedupe(after)...) {
+		if in[id] != 0 {
+			changed = append(changed, id)
+			in[id] = 0
+		}
+	}
+	return changed
+}
+
+func dedupe(ids []uuid.UUID) []uuid.UUID {
+	seen := map[uuid.UUID]bool{}
+	result := []uuid.UUID{}
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			result = append(result, id)
+		}
+	}
+	return result
+}
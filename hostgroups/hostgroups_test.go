@@ -0,0 +1,94 @@
+package hostgroups
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"packagelock/structs"
+
+	"github.com/google/uuid"
+)
+
+func TestMembers(t *testing.T) {
+	archived := time.Date(2024, 8, 23, 10, 0, 0, 0, time.UTC)
+	web, test, db, old := debianProd, debianTest, rockyProd, debianProd
+	web.HostID, test.HostID, db.HostID, old.HostID = uuid.New(), uuid.New(), uuid.New(), uuid.New()
+	old.ArchiveTime = &archived
+	unregistered := uuid.New()
+	hosts := []structs.Host{web, test, db, old}
+
+	cases := []struct {
+		name  string
+		group structs.Host_Group
+		want  []uuid.UUID
+	}{
+		{"rule", structs.Host_Group{Rule: `Distro == "debian"`}, []uuid.UUID{web.HostID, test.HostID}},
+		{"rule without members", structs.Host_Group{Rule: `Distro == "alpine"`}, []uuid.UUID{}},
+		{"static", structs.Host_Group{HostIDs: []uuid.UUID{db.HostID, web.HostID, db.HostID}}, []uuid.UUID{db.HostID, web.HostID}},
+		{"static with archived host", structs.Host_Group{HostIDs: []uuid.UUID{old.HostID, test.HostID}}, []uuid.UUID{test.HostID}},
+		{"static with unregistered host", structs.Host_Group{HostIDs: []uuid.UUID{unregistered}}, []uuid.UUID{unregistered}},
+	}
+	for _, tc := range cases {
+		got, err := Members(tc.group, hosts)
+		if err != nil {
+			t.Errorf("Members(%s) error = %v", tc.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("Members(%s) = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+
+	if _, err := Members(structs.Host_Group{Rule: `Color == "red"`}, hosts); err == nil {
+		t.Errorf("Members with an invalid rule succeeded, want error")
+	}
+
+	for _, host := range hosts {
+		member, err := IsMember(structs.Host_Group{Rule: `Tags.env == "prod"`}, host)
+		if want := host.HostID == web.HostID || host.HostID == db.HostID; err != nil || member != want {
+			t.Errorf("IsMember(%s) = %t, %v, want %t", host.Hostname, member, err, want)
+		}
+	}
+}
+
+func TestChanged(t *testing.T) {
+	a, b, c, d := uuid.New(), uuid.New(), uuid.New(), uuid.New()
+	cases := []struct {
+		name          string
+		before, after []uuid.UUID
+		want          []uuid.UUID
+	}{
+		{"unchanged", []uuid.UUID{a, b}, []uuid.UUID{b, a}, nil},
+		{"joined", []uuid.UUID{a}, []uuid.UUID{a, b}, []uuid.UUID{b}},
+		{"left", []uuid.UUID{a, b}, []uuid.UUID{b}, []uuid.UUID{a}},
+		{"left and joined", []uuid.UUID{a, b, c}, []uuid.UUID{c, d}, []uuid.UUID{a, b, d}},
+		{"duplicates", []uuid.UUID{a, a}, []uuid.UUID{a, b, b}, []uuid.UUID{b}},
+		{"new group", nil, []uuid.UUID{a}, []uuid.UUID{a}},
+		{"deleted group", []uuid.UUID{a}, nil, []uuid.UUID{a}},
+	}
+	for _, tc := range cases {
+		if got := Changed(tc.before, tc.after); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("Changed(%s) = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	cases := []struct {
+		group structs.Host_Group
+		ok    bool
+	}{
+		{structs.Host_Group{Name: "prod", Rule: `Tags.env == "prod"`}, true},
+		{structs.Host_Group{Name: "db", HostIDs: []uuid.UUID{uuid.New()}}, true},
+		{structs.Host_Group{Name: "empty"}, true},
+		{structs.Host_Group{Rule: `Tags.env == "prod"`}, false},
+		{structs.Host_Group{Name: "both", Rule: `Tags.env == "prod"`, HostIDs: []uuid.UUID{uuid.New()}}, false},
+		{structs.Host_Group{Name: "broken", Rule: `Tags.env ==`}, false},
+	}
+	for _, tc := range cases {
+		if err := Validate(tc.group); (err == nil) != tc.ok {
+			t.Errorf("Validate(%q, %q) = %v, want ok %t", tc.group.Name, tc.group.Rule, err, tc.ok)
+		}
+	}
+}
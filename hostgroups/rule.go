@@ -0,0 +1,317 @@
+package hostgroups
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"packagelock/structs"
+)
+
+// Rule is a compiled membership rule of a dynamic group, e.g.
+//
+//	Distro == "debian" && Arch == "amd64"
+//	Tags.env in ["prod", "staging"] && !(Hostname =~ "^test-")
+//
+// Fields are Hostname, FQDN, Distro, Arch, PackageManager and Tags.<key>, missing tags are "".
+// Operators are ==, !=, =~ and !~ (regular expressions), in [...], &&, || and !.
+type Rule struct {
+	source string
+	root   node
+}
+
+type node interface {
+	match(host structs.Host) bool
+}
+
+type andNode struct{ left, right node }
+type orNode struct{ left, right node }
+type notNode struct{ inner node }
+
+type compareNode struct {
+	field  string
+	op     string
+	values []string
+	regex  *regexp.Regexp
+}
+
+func (n andNode) match(host structs.Host) bool { return n.left.match(host) && n.right.match(host) }
+func (n orNode) match(host structs.Host) bool  { return n.left.match(host) || n.right.match(host) }
+func (n notNode) match(host structs.Host) bool { return !n.inner.match(host) }
+
+func (n compareNode) match(host structs.Host) bool {
+	value := fieldValue(host, n.field)
+	switch n.op {
+	case "==":
+		return value == n.values[0]
+	case "!=":
+		return value != n.values[0]
+	case "=~":
+		return n.regex.MatchString(value)
+	case "!~":
+		return !n.regex.MatchString(value)
+	case "in":
+		for _, candidate := range n.values {
+			if value == candidate {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// fields maps the rule field names to their value on a host.
+var fields = map[string]func(host structs.Host) string{
+	"Hostname":       func(host structs.Host) string { return host.Hostname },
+	"FQDN":           func(host structs.Host) string { return host.FQDN },
+	"Distro":         func(host structs.Host) string { return host.Distro },
+	"Arch":           func(host structs.Host) string { return host.Arch },
+	"PackageManager": func(host structs.Host) string { return host.PackageManager.PackageManagerName },
+}
+
+func fieldValue(host structs.Host, field string) string {
+	if key, ok := strings.CutPrefix(field, "Tags."); ok {
+		return host.Tags[key]
+	}
+	return fields[field](host)
+}
+
+// Compile parses a membership rule.
+func Compile(source string) (*Rule, error) {
+	tokens, err := tokenize(source)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("rule is empty")
+	}
+
+	p := &parser{tokens: tokens}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if !p.done() {
+		return nil, fmt.Errorf("unexpected %q at position %d", p.peek().text, p.peek().pos)
+	}
+	return &Rule{source: source, root: root}, nil
+}
+
+// Match reports whether a host matches the rule.
+func (r *Rule) Match(host structs.Host) bool {
+	return r.root.match(host)
+}
+
+// String returns the source of the rule.
+func (r *Rule) String() string {
+	return r.source
+}
+
+const (
+	tokenIdent = iota
+	tokenString
+	tokenOp
+)
+
+type token struct {
+	kind int
+	text string
+	pos  int
+}
+
+var operators = []string{"&&", "||", "==", "!=", "=~", "!~", "!", "(", ")", "[", "]", ","}
+
+func tokenize(source string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(source); {
+		r := rune(source[i])
+		switch {
+		case unicode.IsSpace(r):
+			i++
+
+		case r == '"':
+			// Go syntax, so escapes like \" and \\ work as expected
+			end := i + 1
+			for end < len(source) && source[end] != '"' {
+				if source[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(source) {
+				return nil, fmt.Errorf("unterminated string at position %d", i)
+			}
+			value, err := strconv.Unquote(source[i : end+1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid string at position %d: %w", i, err)
+			}
+			tokens = append(tokens, token{kind: tokenString, text: value, pos: i})
+			i = end + 1
+
+		case unicode.IsLetter(r) || r == '_':
+			end := i
+			for end < len(source) && (unicode.IsLetter(rune(source[end])) || unicode.IsDigit(rune(source[end])) ||
+				strings.ContainsRune("_.-", rune(source[end]))) {
+				end++
+			}
+			tokens = append(tokens, token{kind: tokenIdent, text: source[i:end], pos: i})
+			i = end
+
+		default:
+			matched := false
+			for _, op := range operators {
+				if strings.HasPrefix(source[i:], op) {
+					tokens = append(tokens, token{kind: tokenOp, text: op, pos: i})
+					i += len(op)
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return nil, fmt.Errorf("unexpected %q at position %d", source[i], i)
+			}
+		}
+	}
+	return tokens, nil
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) done() bool { return p.pos >= len(p.tokens) }
+
+func (p *parser) peek() token {
+	if p.done() {
+		return token{text: "end of rule", pos: -1}
+	}
+	return p.tokens[p.pos]
+}
+
+func (p *parser) accept(kind int, text string) bool {
+	if !p.done() && p.tokens[p.pos].kind == kind && p.tokens[p.pos].text == text {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) expect(kind int, text string) error {
+	if !p.accept(kind, text) {
+		return fmt.Errorf("expected %q, got %q", text, p.peek().text)
+	}
+	return nil
+}
+
+// parseOr parses 'and ( "||" and )*'.
+func (p *parser) parseOr() (node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept(tokenOp, "||") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = orNode{left, right}
+	}
+	return left, nil
+}
+
+// parseAnd parses 'unary ( "&&" unary )*'.
+func (p *parser) parseAnd() (node, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept(tokenOp, "&&") {
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = andNode{left, right}
+	}
+	return left, nil
+}
+
+// parseUnary parses '"!" unary | "(" or ")" | comparison'.
+func (p *parser) parseUnary() (node, error) {
+	if p.accept(tokenOp, "!") {
+		inner, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{inner}, nil
+	}
+	if p.accept(tokenOp, "(") {
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		return inner, p.expect(tokenOp, ")")
+	}
+	return p.parseComparison()
+}
+
+// parseComparison parses 'field op string | field "in" "[" string ( "," string )* "]"'.
+func (p *parser) parseComparison() (node, error) {
+	fieldToken := p.peek()
+	if fieldToken.kind != tokenIdent || p.done() {
+		return nil, fmt.Errorf("expected a field, got %q", fieldToken.text)
+	}
+	p.pos++
+
+	field := fieldToken.text
+	if key, ok := strings.CutPrefix(field, "Tags."); ok {
+		if key == "" {
+			return nil, fmt.Errorf("tag name missing at position %d", fieldToken.pos)
+		}
+	} else if _, ok := fields[field]; !ok {
+		return nil, fmt.Errorf("unknown field %q at position %d", field, fieldToken.pos)
+	}
+
+	if p.accept(tokenIdent, "in") {
+		if err := p.expect(tokenOp, "["); err != nil {
+			return nil, err
+		}
+		var values []string
+		for {
+			value := p.peek()
+			if value.kind != tokenString || p.done() {
+				return nil, fmt.Errorf("expected a string, got %q", value.text)
+			}
+			p.pos++
+			values = append(values, value.text)
+			if !p.accept(tokenOp, ",") {
+				break
+			}
+		}
+		return compareNode{field: field, op: "in", values: values}, p.expect(tokenOp, "]")
+	}
+
+	opToken := p.peek()
+	if opToken.kind != tokenOp || !strings.Contains("== != =~ !~", opToken.text) || len(opToken.text) != 2 {
+		return nil, fmt.Errorf("expected a comparison after %q, got %q", field, opToken.text)
+	}
+	p.pos++
+
+	value := p.peek()
+	if value.kind != tokenString || p.done() {
+		return nil, fmt.Errorf("expected a string after %q, got %q", opToken.text, value.text)
+	}
+	p.pos++
+
+	cmp := compareNode{field: field, op: opToken.text, values: []string{value.text}}
+	if cmp.op == "=~" || cmp.op == "!~" {
+		regex, err := regexp.Compile(value.text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regular expression %q: %w", value.text, err)
+		}
+		cmp.regex = regex
+	}
+	return cmp, nil
+}
@@ -0,0 +1,96 @@
+package hostgroups
+
+import (
+	"strings"
+	"testing"
+
+	"packagelock/structs"
+)
+
+var (
+	debianProd = structs.Host{
+		Hostname: "web-1", FQDN: "web-1.example.com", Distro: "debian", Arch: "amd64",
+		PackageManager: structs.Package_Manager{PackageManagerName: "apt"},
+		Tags:           map[string]string{"env": "prod", "team": "web"},
+	}
+	debianTest = structs.Host{
+		Hostname: "test-web-1", Distro: "debian", Arch: "arm64",
+		Tags: map[string]string{"env": "staging"},
+	}
+	rockyProd = structs.Host{
+		Hostname: "db-1", Distro: "rocky", Arch: "x86_64",
+		PackageManager: structs.Package_Manager{PackageManagerName: "dnf"},
+		Tags:           map[string]string{"env": "prod"},
+	}
+)
+
+func TestRuleMatch(t *testing.T) {
+	cases := []struct {
+		rule string
+		want [3]bool // debianProd, debianTest, rockyProd
+	}{
+		{`Distro == "debian"`, [3]bool{true, true, false}},
+		{`Distro != "debian"`, [3]bool{false, false, true}},
+		{`Hostname =~ "^test-"`, [3]bool{false, true, false}},
+		{`Hostname !~ "^test-"`, [3]bool{true, false, true}},
+		{`FQDN == "web-1.example.com"`, [3]bool{true, false, false}},
+		{`PackageManager in ["apt", "dnf"]`, [3]bool{true, false, true}},
+		{`Tags.env in ["prod", "staging"] && !(Hostname =~ "^test-")`, [3]bool{true, false, true}},
+		{`Tags.team == ""`, [3]bool{false, true, true}}, // missing tags are ""
+		{`Tags.env == "prod\"s"`, [3]bool{false, false, false}},
+
+		// && binds tighter than ||, ! tighter than both
+		{`Distro == "rocky" || Distro == "debian" && Arch == "arm64"`, [3]bool{false, true, true}},
+		{`Distro == "debian" && Arch == "arm64" || Distro == "rocky"`, [3]bool{false, true, true}},
+		{`(Distro == "rocky" || Distro == "debian") && Arch == "arm64"`, [3]bool{false, true, false}},
+		{`!Distro == "debian" && Tags.env == "prod"`, [3]bool{false, false, true}},
+		{`!(Distro == "debian" && Tags.env == "prod")`, [3]bool{false, true, true}},
+		{`!!Arch == "amd64"`, [3]bool{true, false, false}},
+	}
+	hosts := []structs.Host{debianProd, debianTest, rockyProd}
+	for _, tc := range cases {
+		rule, err := Compile(tc.rule)
+		if err != nil {
+			t.Errorf("Compile(%q) error = %v", tc.rule, err)
+			continue
+		}
+		for idx, host := range hosts {
+			if got := rule.Match(host); got != tc.want[idx] {
+				t.Errorf("Compile(%q).Match(%s) = %t, want %t", tc.rule, host.Hostname, got, tc.want[idx])
+			}
+		}
+		if rule.String() != tc.rule {
+			t.Errorf("Compile(%q).String() = %q", tc.rule, rule.String())
+		}
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	cases := []struct{ rule, want string }{
+		{``, `rule is empty`},
+		{`   `, `rule is empty`},
+		{`Distro == "debian`, `unterminated string at position 10`},
+		{`Distro == "deb\ian"`, `invalid string at position 10`},
+		{`Distro == "debian" & Arch == "amd64"`, `unexpected '&' at position 19`},
+		{`Distro = "debian"`, `unexpected '=' at position 7`},
+		{`Distro == "debian" Arch`, `unexpected "Arch" at position 19`},
+		{`Color == "red"`, `unknown field "Color" at position 0`},
+		{`Arch == "amd64" && tags.env == "prod"`, `unknown field "tags.env" at position 19`},
+		{`Arch == "amd64" && Tags. == "prod"`, `tag name missing at position 19`},
+		{`&& Distro == "debian"`, `expected a field, got "&&"`},
+		{`Distro "debian"`, `expected a comparison after "Distro", got "debian"`},
+		{`Distro && Arch`, `expected a comparison after "Distro", got "&&"`},
+		{`Distro ==`, `expected a string after "==", got "end of rule"`},
+		{`Distro in "debian"`, `expected "[", got "debian"`},
+		{`Distro in ["debian",]`, `expected a string, got "]"`},
+		{`Distro in ["debian"`, `expected "]", got "end of rule"`},
+		{`(Distro == "debian"`, `expected ")", got "end of rule"`},
+		{`Hostname =~ "(["`, `invalid regular expression "(["`},
+	}
+	for _, tc := range cases {
+		_, err := Compile(tc.rule)
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("Compile(%q) error = %v, want %q", tc.rule, err, tc.want)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package hostgroups
+
+import (
+	"fmt"
+	"packagelock/db"
+	"packagelock/structs"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/surrealdb/surrealdb.go"
+)
+
+// FindGroup returns the group with the given GroupID or nil if there is none.
+func FindGroup(database *db.Database, groupID uuid.UUID) (*structs.Host_Group, error) {
+	found, err := surrealdb.SmartUnmarshal[[]structs.Host_Group](database.DB.Query(
+		"SELECT * FROM host_groups WHERE GroupID = $groupID LIMIT 1",
+		map[string]interface{}{"groupID": groupID.String()},
+	))
+	if err != nil || len(found) == 0 {
+		return nil, err
+	}
+	return &found[0], nil
+}
+
+// GroupsOf returns the GroupIDs of all groups a host is a member of.
+func GroupsOf(database *db.Database, hostID uuid.UUID) ([]uuid.UUID, error) {
+	groups, err := surrealdb.SmartUnmarshal[[]structs.Host_Group](database.DB.Query(
+		"SELECT * FROM host_groups WHERE Members CONTAINS $hostID",
+		map[string]interface{}{"hostID": hostID.String()},
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	groupIDs := make([]uuid.UUID, 0, len(groups))
+	for _, group := range groups {
+		groupIDs = append(groupIDs, group.GroupID)
+	}
+	return groupIDs, nil
+}
+
+// Resolve returns the given hosts and the members of the given groups, without duplicates.
+// It fails with ErrUnknownGroup if a group doesn't exist.
+func Resolve(database *db.Database, hostIDs []uuid.UUID, groupIDs []uuid.UUID) ([]uuid.UUID, error) {
+	resolved := append([]uuid.UUID{}, hostIDs...)
+	for _, groupID := range dedupe(groupIDs) {
+		group, err := FindGroup(database, groupID)
+		if err != nil {
+			return nil, err
+		}
+		if group == nil {
+			return nil, fmt.Errorf("%w %s", ErrUnknownGroup, groupID)
+		}
+		resolved = append(resolved, group.Members...)
+	}
+	return dedupe(resolved), nil
+}
+
+// Refresh evaluates the members of a group against all hosts and stores them.
+// It returns the hosts which joined or left the group.
+func Refresh(database *db.Database, group *structs.Host_Group) ([]uuid.UUID, error) {
+	hosts, err := surrealdb.SmartUnmarshal[[]structs.Host](database.DB.Select("hosts"))
+	if err != nil {
+		return nil, err
+	}
+
+	members, err := Members(*group, hosts)
+	if err != nil {
+		return nil, err
+	}
+
+	changed := Changed(group.Members, members)
+	group.Members = members
+	if group.ID != "" && len(changed) > 0 {
+		group.UpdateTime = time.Now()
+		if _, err := database.DB.Update(group.ID, group); err != nil {
+			return nil, err
+		}
+	}
+	return changed, nil
+}
+
+// RefreshHost re-evaluates the groups of a host whose data changed, was archived or restored.
+// It reports whether the host joined or left any group.
+func RefreshHost(database *db.Database, host structs.Host) (bool, error) {
+	groups, err := surrealdb.SmartUnmarshal[[]structs.Host_Group](database.DB.Select("host_groups"))
+	if err != nil {
+		return false, err
+	}
+
+	changed := false
+	for _, group := range groups {
+		matches, err := IsMember(group, host)
+		if err != nil {
+			// Rules are validated on write, so this only happens for broken DB entries
+			continue
+		}
+
+		member := false
+		remaining := []uuid.UUID{}
+		for _, id := range group.Members {
+			if id == host.HostID {
+				member = true
+				continue
+			}
+			remaining = append(remaining, id)
+		}
+
+		if matches == member {
+			continue
+		}
+		if matches {
+			remaining = append(remaining, host.HostID)
+		}
+
+		group.Members = remaining
+		group.UpdateTime = time.Now()
+		if _, err := database.DB.Update(group.ID, group); err != nil {
+			return changed, err
+		}
+		changed = true
+	}
+	return changed, nil
+}
+
+// ForgetHost removes a purged host from the host lists of all groups.
+func ForgetHost(database *db.Database, hostID uuid.UUID) error {
+	_, err := database.DB.Query(
+		"UPDATE host_groups SET HostIDs -= $hostID, Members -= $hostID WHERE HostIDs CONTAINS $hostID OR Members CONTAINS $hostID",
+		map[string]interface{}{"hostID": hostID.String()},
+	)
+	return err
+}
+
+// References counts the locks and maintenance windows targeting a group.
+func References(database *db.Database, groupID uuid.UUID) (int, error) {
+	vars := map[string]interface{}{"groupID": groupID.String()}
+
+	lockRefs, err := surrealdb.SmartUnmarshal[[]structs.Lock](database.DB.Query(
+		"SELECT * FROM locks WHERE HostGroups CONTAINS $groupID", vars,
+	))
+	if err != nil {
+		return 0, err
+	}
+	windowRefs, err := surrealdb.SmartUnmarshal[[]structs.Maintenance_Window](database.DB.Query(
+		"SELECT * FROM maintenance_windows WHERE HostGroups CONTAINS $groupID", vars,
+	))
+	if err != nil {
+		return 0, err
+	}
+	return len(lockRefs) + len(windowRefs), nil
+}
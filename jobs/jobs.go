@@ -0,0 +1,82 @@
+// Jobs
+//
+// The Jobs Package queues operations for agents, like installing a pinned
+// package version or refreshing the inventory. Agents fetch their jobs by
+// (long-)polling and report the state and output back.
+package jobs
+
+import (
+	"fmt"
+
+	"packagelock/structs"
+)
+
+// Job types.
+const (
+	TypeInstall          = "install"
+	TypeUpdate           = "update"
+	TypeRemove           = "remove"
+	TypeUpgradeAll       = "upgrade-all"
+	TypeRefreshInventory = "refresh-inventory"
+)
+
+// Job states.
+const (
+	StateQueued    = "queued"
+	StateClaimed   = "claimed"
+	StateRunning   = "running"
+	StateSucceeded = "succeeded"
+	StateFailed    = "failed"
+	StateTimedOut  = "timed_out"
+)
+
+// transitions lists the states an agent may move a job to from each state.
+// Queued and timed out jobs are only ever changed by the server.
+var transitions = map[string][]string{
+	StateClaimed: {StateRunning, StateSucceeded, StateFailed},
+	StateRunning: {StateSucceeded, StateFailed},
+}
+
+// Validate checks the type and spec of a new job.
+func Validate(job structs.Job) error {
+	switch job.Type {
+	case TypeInstall, TypeUpdate, TypeRemove:
+		if len(job.Spec.Packages) == 0 {
+			return fmt.Errorf("job type %q needs at least one package", job.Type)
+		}
+		for _, pkg := range job.Spec.Packages {
+			if pkg.PackageName == "" {
+				return fmt.Errorf("job package needs a name")
+			}
+			if pkg.Version != "" && job.Type == TypeRemove {
+				return fmt.Errorf("packages to remove can't have a version")
+			}
+		}
+	case TypeUpgradeAll, TypeRefreshInventory:
+		if len(job.Spec.Packages) > 0 {
+			return fmt.Errorf("job type %q takes no packages", job.Type)
+		}
+	default:
+		return fmt.Errorf("unknown job type %q", job.Type)
+	}
+
+	if job.TimeoutSeconds < 0 {
+		return fmt.Errorf("job timeout can't be negative")
+	}
+	return nil
+}
+
+// CanTransition reports whether an agent may move a job from one state to another.
+func CanTransition(from, to string) bool {
+	for _, allowed := range transitions[from] {
+		if allowed == to {
+			return true
+		}
+	}
+	return false
+}
+
+// IsFinished reports whether a job reached a final state.
+func IsFinished(state string) bool {
+	return state == StateSucceeded || state == StateFailed || state == StateTimedOut
+}
@@ -0,0 +1,450 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"packagelock/db"
+	"packagelock/structs"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/spf13/viper"
+	"github.com/surrealdb/surrealdb.go"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+// ErrInvalidTransition is returned when an agent reports a state the job can't move to.
+var ErrInvalidTransition = errors.New("invalid job state transition")
+
+// truncatedMarker prefixes output which was cut to 'jobs.max-output' bytes.
+const truncatedMarker = "[output truncated]\n"
+
+// QueueParams holds the dependencies of the Queue.
+type QueueParams struct {
+	fx.In
+
+	Lifecycle fx.Lifecycle
+	Logger    *zap.Logger
+	Config    *viper.Viper
+	DB        *db.Database
+}
+
+// Queue persists jobs and hands them out to agents.
+// Agents waiting for work are woken up as soon as a job is queued for them.
+type Queue struct {
+	logger         *zap.Logger
+	db             *db.Database
+	defaultTimeout time.Duration
+	maxOutput      int
+
+	// stateMu serializes state changes, so a job can't be claimed twice
+	// or time out while its result is being reported.
+	stateMu sync.Mutex
+
+	mu      sync.Mutex
+	waiters map[uuid.UUID]map[chan struct{}]struct{}
+}
+
+// Report is the state and output of a job as sent by the agent.
+type Report struct {
+	State    string
+	Stdout   string
+	Stderr   string
+	ExitCode *int
+	Error    string
+}
+
+// NewQueue creates a Queue and schedules the timeout sweeper.
+func NewQueue(params QueueParams) *Queue {
+	queue := &Queue{
+		logger:         params.Logger,
+		db:             params.DB,
+		defaultTimeout: params.Config.GetDuration("jobs.default-timeout"),
+		maxOutput:      params.Config.GetInt("jobs.max-output"),
+		waiters:        map[uuid.UUID]map[chan struct{}]struct{}{},
+	}
+
+	interval := params.Config.GetDuration("jobs.sweep-interval")
+	if interval <= 0 {
+		return queue
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	params.Lifecycle.Append(fx.Hook{
+		OnStart: func(context.Context) error {
+			go queue.sweep(ctx, interval)
+			return nil
+		},
+		OnStop: func(context.Context) error {
+			cancel()
+			return nil
+		},
+	})
+
+	return queue
+}
+
+// Enqueue validates and stores a new job for an agent.
+func (q *Queue) Enqueue(agent structs.Agent, job structs.Job) (structs.Job, error) {
+	if err := Validate(job); err != nil {
+		return job, err
+	}
+
+	now := time.Now()
+	job.ID = ""
+	job.JobID = uuid.New()
+	job.AgentID = agent.AgentID
+	job.HostID = agent.HostID
+	job.State = StateQueued
+	job.Stdout, job.Stderr, job.Error = "", "", ""
+	job.ExitCode = nil
+	job.ClaimTime, job.StartTime, job.FinishTime = nil, nil, nil
+	job.CreationTime = now
+	job.UpdateTime = now
+	if job.TimeoutSeconds == 0 {
+		job.TimeoutSeconds = int(q.defaultTimeout.Seconds())
+	}
+
+	if _, err := q.db.DB.Query("INSERT INTO jobs $job", map[string]interface{}{"job": job}); err != nil {
+		return job, err
+	}
+
+	q.notify(agent.AgentID)
+	return job, nil
+}
+
+// Claim hands out the oldest queued job of an agent. It returns nil if there is none.
+func (q *Queue) Claim(agentID uuid.UUID) (*structs.Job, error) {
+	q.stateMu.Lock()
+	defer q.stateMu.Unlock()
+
+	for {
+		queued, err := surrealdb.SmartUnmarshal[[]structs.Job](q.db.DB.Query(
+			"SELECT * FROM jobs WHERE AgentID = $agentID AND State = $state ORDER BY CreationTime LIMIT 1",
+			map[string]interface{}{"agentID": agentID.String(), "state": StateQueued},
+		))
+		if err != nil || len(queued) == 0 {
+			return nil, err
+		}
+
+		job := queued[0]
+		now := time.Now()
+		job.UpdateTime = now
+
+		// A job which must not start anymore is never handed out
+		if job.NotAfter != nil && now.After(*job.NotAfter) {
+			job.State = StateTimedOut
+			job.FinishTime = &now
+			job.Error = "not claimed before " + job.NotAfter.Format(time.RFC3339)
+			if _, err := q.db.DB.Update(job.ID, job); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		job.State = StateClaimed
+		job.ClaimTime = &now
+		if _, err := q.db.DB.Update(job.ID, job); err != nil {
+			return nil, err
+		}
+		return &job, nil
+	}
+}
+
+// Next claims the next job of an agent, waiting up to wait for one to be queued.
+// It returns nil if no job arrived in time.
+func (q *Queue) Next(ctx context.Context, agentID uuid.UUID, wait time.Duration) (*structs.Job, error) {
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	for {
+		// Subscribe before claiming, so a job queued in between isn't missed
+		notified, unsubscribe := q.Subscribe(agentID)
+		job, err := q.Claim(agentID)
+		if err != nil || job != nil || wait <= 0 {
+			unsubscribe()
+			return job, err
+		}
+
+		select {
+		case <-notified:
+			unsubscribe()
+		case <-timer.C:
+			unsubscribe()
+			return nil, nil
+		case <-ctx.Done():
+			unsubscribe()
+			return nil, nil
+		}
+	}
+}
+
+// Subscribe returns a channel which receives a value whenever a job is queued for the agent.
+func (q *Queue) Subscribe(agentID uuid.UUID) (<-chan struct{}, func()) {
+	ch := make(chan struct{}, 1)
+
+	q.mu.Lock()
+	if q.waiters[agentID] == nil {
+		q.waiters[agentID] = map[chan struct{}]struct{}{}
+	}
+	q.waiters[agentID][ch] = struct{}{}
+	q.mu.Unlock()
+
+	return ch, func() {
+		q.mu.Lock()
+		defer q.mu.Unlock()
+		delete(q.waiters[agentID], ch)
+		if len(q.waiters[agentID]) == 0 {
+			delete(q.waiters, agentID)
+		}
+	}
+}
+
+func (q *Queue) notify(agentID uuid.UUID) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for ch := range q.waiters[agentID] {
+		select {
+		case ch <- struct{}{}:
+		default:
+			// A notification is already pending
+		}
+	}
+}
+
+// Update applies a report of the agent to a job. Empty output keeps the output
+// streamed so far, see AppendOutput.
+func (q *Queue) Update(jobID uuid.UUID, report Report) (*structs.Job, error) {
+	q.stateMu.Lock()
+	defer q.stateMu.Unlock()
+
+	job, err := q.Find(jobID)
+	if err != nil || job == nil {
+		return job, err
+	}
+
+	if report.State != job.State && !CanTransition(job.State, report.State) {
+		return job, ErrInvalidTransition
+	}
+	if report.State == job.State && IsFinished(job.State) {
+		return job, ErrInvalidTransition
+	}
+
+	now := time.Now()
+	if report.State == StateRunning && job.StartTime == nil {
+		job.StartTime = &now
+	}
+	if IsFinished(report.State) {
+		job.FinishTime = &now
+	}
+	job.State = report.State
+	if report.Stdout != "" {
+		job.Stdout = q.truncate(report.Stdout)
+	}
+	if report.Stderr != "" {
+		job.Stderr = q.truncate(report.Stderr)
+	}
+	job.ExitCode = report.ExitCode
+	job.Error = report.Error
+	job.UpdateTime = now
+
+	if _, err := q.db.DB.Update(job.ID, job); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// AppendOutput appends a chunk of streamed output to a job which is still in progress.
+func (q *Queue) AppendOutput(jobID uuid.UUID, stdout, stderr string) (*structs.Job, error) {
+	q.stateMu.Lock()
+	defer q.stateMu.Unlock()
+
+	job, err := q.Find(jobID)
+	if err != nil || job == nil {
+		return job, err
+	}
+	if job.State != StateClaimed && job.State != StateRunning {
+		return job, ErrInvalidTransition
+	}
+
+	job.Stdout = q.truncate(job.Stdout + stdout)
+	job.Stderr = q.truncate(job.Stderr + stderr)
+	job.UpdateTime = time.Now()
+
+	if _, err := q.db.DB.Update(job.ID, job); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// Release puts a claimed job back into the queue, e.g. when pushing it to the agent failed.
+func (q *Queue) Release(jobID uuid.UUID) error {
+	q.stateMu.Lock()
+	job, err := q.Find(jobID)
+	if err != nil || job == nil || job.State != StateClaimed {
+		q.stateMu.Unlock()
+		return err
+	}
+
+	job.State = StateQueued
+	job.ClaimTime = nil
+	job.UpdateTime = time.Now()
+	_, err = q.db.DB.Update(job.ID, job)
+	q.stateMu.Unlock()
+
+	if err == nil {
+		q.notify(job.AgentID)
+	}
+	return err
+}
+
+// Cancel fails a job which is not finished yet, e.g. when the operation which queued it failed.
+func (q *Queue) Cancel(jobID uuid.UUID, reason string, now time.Time) error {
+	q.stateMu.Lock()
+	defer q.stateMu.Unlock()
+
+	job, err := q.Find(jobID)
+	if err != nil || job == nil || IsFinished(job.State) {
+		return err
+	}
+
+	job.State = StateFailed
+	job.Error = reason
+	job.FinishTime = &now
+	job.UpdateTime = now
+	_, err = q.db.DB.Update(job.ID, job)
+	return err
+}
+
+// FailHost fails all unfinished jobs of a host, e.g. when it is decommissioned.
+func (q *Queue) FailHost(hostID uuid.UUID, reason string, now time.Time) (int, error) {
+	q.stateMu.Lock()
+	defer q.stateMu.Unlock()
+
+	active, err := surrealdb.SmartUnmarshal[[]structs.Job](q.db.DB.Query(
+		"SELECT * FROM jobs WHERE HostID = $hostID AND State IN $states",
+		map[string]interface{}{
+			"hostID": hostID.String(),
+			"states": []string{StateQueued, StateClaimed, StateRunning},
+		},
+	))
+	if err != nil {
+		return 0, err
+	}
+
+	for idx, job := range active {
+		job.State = StateFailed
+		job.Error = reason
+		job.FinishTime = &now
+		job.UpdateTime = now
+		if _, err := q.db.DB.Update(job.ID, job); err != nil {
+			return idx, err
+		}
+	}
+	return len(active), nil
+}
+
+// truncate keeps the end of the output, which usually holds the error.
+func (q *Queue) truncate(output string) string {
+	if q.maxOutput <= 0 || len(output) <= q.maxOutput {
+		return output
+	}
+	return truncatedMarker + output[len(output)-q.maxOutput:]
+}
+
+// Find returns a job by its JobID or nil if there is none.
+func (q *Queue) Find(jobID uuid.UUID) (*structs.Job, error) {
+	found, err := surrealdb.SmartUnmarshal[[]structs.Job](q.db.DB.Query(
+		"SELECT * FROM jobs WHERE JobID = $jobID LIMIT 1",
+		map[string]interface{}{"jobID": jobID.String()},
+	))
+	if err != nil || len(found) == 0 {
+		return nil, err
+	}
+	return &found[0], nil
+}
+
+// List returns the job history of an agent, newest first. An empty state matches all jobs.
+func (q *Queue) List(agentID uuid.UUID, state string) ([]structs.Job, error) {
+	query := "SELECT * FROM jobs WHERE AgentID = $agentID ORDER BY CreationTime DESC"
+	if state != "" {
+		query = "SELECT * FROM jobs WHERE AgentID = $agentID AND State = $state ORDER BY CreationTime DESC"
+	}
+
+	found, err := surrealdb.SmartUnmarshal[[]structs.Job](q.db.DB.Query(query, map[string]interface{}{
+		"agentID": agentID.String(),
+		"state":   state,
+	}))
+	if err != nil {
+		return nil, err
+	}
+	if found == nil {
+		found = []structs.Job{}
+	}
+	return found, nil
+}
+
+func (q *Queue) sweep(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if timedOut, err := q.SweepTimeouts(now); err != nil {
+				q.logger.Warn("Failed to sweep timed out jobs", zap.Error(err))
+			} else if timedOut > 0 {
+				q.logger.Info("Jobs timed out", zap.Int("jobs", timedOut))
+			}
+		}
+	}
+}
+
+// SweepTimeouts marks claimed and running jobs whose timeout passed
+// and queued jobs past their NotAfter time as timed out.
+func (q *Queue) SweepTimeouts(now time.Time) (int, error) {
+	q.stateMu.Lock()
+	defer q.stateMu.Unlock()
+
+	active, err := surrealdb.SmartUnmarshal[[]structs.Job](q.db.DB.Query(
+		"SELECT * FROM jobs WHERE State IN $states",
+		map[string]interface{}{"states": []string{StateQueued, StateClaimed, StateRunning}},
+	))
+	if err != nil {
+		return 0, err
+	}
+
+	timedOut := 0
+	for _, job := range active {
+		switch {
+		case job.State == StateQueued:
+			if job.NotAfter == nil || !now.After(*job.NotAfter) {
+				continue
+			}
+			job.Error = "not claimed before " + job.NotAfter.Format(time.RFC3339)
+		case job.ClaimTime == nil || job.TimeoutSeconds <= 0:
+			continue
+		case now.Before(job.ClaimTime.Add(time.Duration(job.TimeoutSeconds) * time.Second)):
+			continue
+		}
+
+		job.State = StateTimedOut
+		job.FinishTime = &now
+		job.UpdateTime = now
+		if _, err := q.db.DB.Update(job.ID, job); err != nil {
+			return timedOut, err
+		}
+		timedOut++
+	}
+	return timedOut, nil
+}
+
+// Module exports the jobs module.
+var Module = fx.Options(
+	fx.Provide(NewQueue),
+)
@@ -0,0 +1,254 @@
+// Listing
+//
+// The Listing Package translates the query parameters of list endpoints into SurrealQL,
+// so filtering, sorting and pagination happen in the database instead of in memory.
+// Pages are selected with keyset cursors: a cursor holds the sort value and the unique
+// key of the last record of a page, the next page starts right after it.
+package listing
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Page sizes.
+const (
+	DefaultLimit = 100
+	MaxLimit     = 1000
+)
+
+// Filter turns the value of a filter parameter into a condition.
+// Values referenced by the condition are added to vars.
+type Filter func(value string, vars map[string]interface{}) (string, error)
+
+// Spec describes the filters and sort keys of a list endpoint.
+type Spec struct {
+	Table       string
+	Key         string            // unique column, breaks ties of the sort order
+	Sorts       map[string]string // sort key as used in '?sort=' to column
+	DefaultSort string
+	Times       map[string]bool   // sort keys of timestamp columns, which are compared as datetime
+	Filters     map[string]Filter // query parameter to filter
+}
+
+// sortAlias is the field a timestamp column is selected as, cast to a datetime for ordering.
+const sortAlias = "listingSortValue"
+
+// Query is a parsed list request.
+type Query struct {
+	spec       Spec
+	conditions []string
+	position   string // condition selecting the records behind the cursor
+	vars       map[string]interface{}
+	sortKey    string
+	descending bool
+	limit      int
+}
+
+// cursor points behind the last record of a page.
+type cursor struct {
+	Sort  string
+	Value interface{}
+	Key   string
+}
+
+// Parse reads 'limit', 'cursor', 'sort' and the filters of a spec through get,
+// which returns the value of a query parameter or "".
+func Parse(spec Spec, get func(key string) string) (*Query, error) {
+	query := &Query{
+		spec:    spec,
+		vars:    map[string]interface{}{},
+		sortKey: spec.DefaultSort,
+		limit:   DefaultLimit,
+	}
+
+	if raw := get("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit < 1 || limit > MaxLimit {
+			return nil, fmt.Errorf("limit must be between 1 and %d", MaxLimit)
+		}
+		query.limit = limit
+	}
+
+	if raw := get("sort"); raw != "" {
+		key, descending := strings.CutPrefix(raw, "-")
+		if _, ok := spec.Sorts[key]; !ok {
+			return nil, fmt.Errorf("unknown sort key %q, use one of %s", key, strings.Join(SortKeys(spec), ", "))
+		}
+		query.sortKey = key
+		query.descending = descending
+	}
+
+	// Filters are applied in a stable order, so the same request builds the same query
+	params := make([]string, 0, len(spec.Filters))
+	for param := range spec.Filters {
+		params = append(params, param)
+	}
+	sort.Strings(params)
+	for _, param := range params {
+		value := get(param)
+		if value == "" {
+			continue
+		}
+		condition, err := spec.Filters[param](value, query.vars)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", param, err)
+		}
+		query.conditions = append(query.conditions, condition)
+	}
+
+	if raw := get("cursor"); raw != "" {
+		if err := query.after(raw); err != nil {
+			return nil, err
+		}
+	}
+	return query, nil
+}
+
+// SortKeys returns the sort keys of a spec in alphabetical order.
+func SortKeys(spec Spec) []string {
+	keys := make([]string, 0, len(spec.Sorts))
+	for key := range spec.Sorts {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// after restricts the query to the records behind a cursor.
+func (q *Query) after(raw string) error {
+	data, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil {
+		return fmt.Errorf("invalid cursor")
+	}
+	var position cursor
+	if err := json.Unmarshal(data, &position); err != nil || position.Key == "" {
+		return fmt.Errorf("invalid cursor")
+	}
+
+	sortParam := q.sortParam()
+	if position.Sort != sortParam {
+		return fmt.Errorf("cursor was created for sort %q, not %q", position.Sort, sortParam)
+	}
+
+	op := ">"
+	if q.descending {
+		op = "<"
+	}
+	column := q.spec.Sorts[q.sortKey]
+	value := "$cursorValue"
+	if q.isTime() {
+		// Timestamps are stored as strings, whose order depends on the offset and precision
+		raw, _ := position.Value.(string)
+		if _, err := time.Parse(time.RFC3339Nano, raw); err != nil {
+			return fmt.Errorf("invalid cursor")
+		}
+		column = "type::datetime(" + column + ")"
+		value = "type::datetime($cursorValue)"
+	}
+	q.vars["cursorValue"] = position.Value
+	q.vars["cursorKey"] = position.Key
+	q.position = fmt.Sprintf(
+		"(%[1]s %[2]s %[4]s OR (%[1]s = %[4]s AND %[3]s %[2]s $cursorKey))",
+		column, op, q.spec.Key, value,
+	)
+	return nil
+}
+
+func (q *Query) isTime() bool {
+	return q.spec.Times[q.sortKey]
+}
+
+// Where adds a condition every record has to match.
+func (q *Query) Where(condition string) {
+	q.conditions = append(q.conditions, condition)
+}
+
+// Vars returns the values referenced by the conditions.
+func (q *Query) Vars() map[string]interface{} {
+	return q.vars
+}
+
+// SelectSQL selects one page. It fetches one record more than the limit,
+// which tells whether there is a next page.
+func (q *Query) SelectSQL() string {
+	direction := "ASC"
+	if q.descending {
+		direction = "DESC"
+	}
+	conditions := q.conditions
+	if q.position != "" {
+		conditions = append(append([]string{}, conditions...), q.position)
+	}
+	fields, order := "*", q.spec.Sorts[q.sortKey]
+	if q.isTime() {
+		// ORDER BY only takes fields, so the cast is selected as one
+		fields = fmt.Sprintf("*, type::datetime(%s) AS %s", order, sortAlias)
+		order = sortAlias
+	}
+	return fmt.Sprintf("SELECT %s FROM %s%s ORDER BY %s %s, %s %s LIMIT %d",
+		fields, q.spec.Table, q.where(conditions), order, direction, q.spec.Key, direction, q.limit+1)
+}
+
+// CountSQL counts all records matching the filters, regardless of the cursor.
+func (q *Query) CountSQL() string {
+	return fmt.Sprintf("SELECT count() FROM %s%s GROUP ALL", q.spec.Table, q.where(q.conditions))
+}
+
+func (q *Query) where(conditions []string) string {
+	if len(conditions) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(conditions, " AND ")
+}
+
+func (q *Query) sortParam() string {
+	if q.descending {
+		return "-" + q.sortKey
+	}
+	return q.sortKey
+}
+
+// Page cuts the records fetched with SelectSQL to the limit and returns the cursor
+// of the next page, "" on the last page.
+func Page[T any](q *Query, records []T) ([]T, string, error) {
+	if len(records) <= q.limit {
+		return records, "", nil
+	}
+	records = records[:q.limit]
+
+	// The records are re-read as JSON, the columns are their field names in the DB
+	data, err := json.Marshal(records[len(records)-1])
+	if err != nil {
+		return nil, "", err
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, "", err
+	}
+
+	key, _ := fields[q.spec.Key].(string)
+	value := fields[q.spec.Sorts[q.sortKey]]
+	if q.isTime() {
+		raw, _ := value.(string)
+		parsed, err := time.Parse(time.RFC3339Nano, raw)
+		if err != nil {
+			return nil, "", fmt.Errorf("sort value %q is no timestamp: %w", raw, err)
+		}
+		value = parsed.UTC().Format(time.RFC3339Nano)
+	}
+	next, err := json.Marshal(cursor{
+		Sort:  q.sortParam(),
+		Value: value,
+		Key:   key,
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return records, base64.RawURLEncoding.EncodeToString(next), nil
+}
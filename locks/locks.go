@@ -0,0 +1,97 @@
+// Locks
+//
+// The Locks Package evaluates package lock documents, which declare
+// the package versions a host is allowed to run, against host inventories.
+package locks
+
+import (
+	"fmt"
+	"time"
+
+	"packagelock/structs"
+	"packagelock/versions"
+)
+
+// Violation reasons.
+const (
+	ReasonMissing = "missing"
+	ReasonVersion = "version"
+)
+
+// PackageConstraint returns the constraint of a locked package.
+func PackageConstraint(pkg structs.Lock_Package) (versions.Constraint, error) {
+	if pkg.Version != "" {
+		return versions.ParseConstraint("= " + pkg.Version)
+	}
+	return versions.ParseConstraint(pkg.Constraint)
+}
+
+// Validate checks a lock for missing names and unparsable constraints.
+func Validate(lock structs.Lock) error {
+	if lock.Name == "" {
+		return fmt.Errorf("lock needs a name")
+	}
+	seen := map[string]bool{}
+	for _, pkg := range lock.Packages {
+		if pkg.PackageName == "" {
+			return fmt.Errorf("locked package needs a name")
+		}
+		if seen[pkg.PackageName] {
+			return fmt.Errorf("package %q is locked twice", pkg.PackageName)
+		}
+		seen[pkg.PackageName] = true
+
+		if _, err := PackageConstraint(pkg); err != nil {
+			return fmt.Errorf("package %q: %w", pkg.PackageName, err)
+		}
+	}
+	return nil
+}
+
+// Evaluate returns all violations of a lock on a host with the given packages installed.
+func Evaluate(lock structs.Lock, host structs.Host, packages []structs.Package) []structs.Lock_Violation {
+	cmp := versions.ForHost(host)
+	now := time.Now()
+
+	installed := map[string][]structs.Package{}
+	for _, pkg := range packages {
+		installed[pkg.PackageName] = append(installed[pkg.PackageName], pkg)
+	}
+
+	violations := []structs.Lock_Violation{}
+	for _, locked := range lock.Packages {
+		constraint, err := PackageConstraint(locked)
+		if err != nil {
+			// Locks are validated on write, so this only happens for broken DB entries
+			continue
+		}
+
+		violation := structs.Lock_Violation{
+			LockID:        lock.LockID,
+			LockName:      lock.Name,
+			HostID:        host.HostID,
+			PackageName:   locked.PackageName,
+			Expected:      constraint.String(),
+			DetectionTime: now,
+		}
+
+		candidates := installed[locked.PackageName]
+		if len(candidates) == 0 {
+			violation.Reason = ReasonMissing
+			violations = append(violations, violation)
+			continue
+		}
+
+		// Multiarch installs have the package more than once, every copy has to satisfy the lock
+		for _, pkg := range candidates {
+			if constraint.Check(cmp, pkg.PackageVersion) {
+				continue
+			}
+			violation.Reason = ReasonVersion
+			violation.InstalledVersion = pkg.PackageVersion
+			violations = append(violations, violation)
+		}
+	}
+
+	return violations
+}
@@ -0,0 +1,160 @@
+package locks
+
+import (
+	"errors"
+	"packagelock/db"
+	"packagelock/hostgroups"
+	"packagelock/structs"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/surrealdb/surrealdb.go"
+)
+
+// FindByLockID returns the lock with the given LockID or nil if there is none.
+func FindByLockID(database *db.Database, lockID uuid.UUID) (*structs.Lock, error) {
+	found, err := surrealdb.SmartUnmarshal[[]structs.Lock](database.DB.Query(
+		"SELECT * FROM locks WHERE LockID = $lockID LIMIT 1",
+		map[string]interface{}{"lockID": lockID.String()},
+	))
+	if err != nil {
+		return nil, err
+	}
+	if len(found) == 0 {
+		return nil, nil
+	}
+	return &found[0], nil
+}
+
+// FindForHost returns all locks which apply to a host, directly or through one of its groups.
+func FindForHost(database *db.Database, host structs.Host) ([]structs.Lock, error) {
+	groupIDs, err := hostgroups.GroupsOf(database, host.HostID)
+	if err != nil {
+		return nil, err
+	}
+	groups := make([]string, 0, len(groupIDs))
+	for _, groupID := range groupIDs {
+		groups = append(groups, groupID.String())
+	}
+
+	return surrealdb.SmartUnmarshal[[]structs.Lock](database.DB.Query(
+		"SELECT * FROM locks WHERE HostIDs CONTAINS $hostID OR HostGroups CONTAINSANY $groups",
+		map[string]interface{}{"hostID": host.HostID.String(), "groups": groups},
+	))
+}
+
+// Hosts returns the hosts the given locks apply to, including the members of their groups.
+func Hosts(database *db.Database, locks ...structs.Lock) ([]uuid.UUID, error) {
+	var hostIDs, groupIDs []uuid.UUID
+	for _, lock := range locks {
+		hostIDs = append(hostIDs, lock.HostIDs...)
+		groupIDs = append(groupIDs, lock.HostGroups...)
+	}
+	return hostgroups.Resolve(database, hostIDs, groupIDs)
+}
+
+// Enforce evaluates all locks applying to a host and replaces its stored violations.
+func Enforce(database *db.Database, host structs.Host, packages []structs.Package) ([]structs.Lock_Violation, error) {
+	applicable, err := FindForHost(database, host)
+	if err != nil {
+		return nil, err
+	}
+
+	violations := []structs.Lock_Violation{}
+	for _, lock := range applicable {
+		violations = append(violations, Evaluate(lock, host, packages)...)
+	}
+
+	query := "DELETE lock_violations WHERE HostID = $hostID;"
+	if len(violations) > 0 {
+		query += " INSERT INTO lock_violations $violations;"
+	}
+	_, err = database.DB.Query(query, map[string]interface{}{
+		"hostID":     host.HostID.String(),
+		"violations": violations,
+	})
+	return violations, err
+}
+
+// Reevaluate enforces the locks of the given hosts again, e.g. after a lock changed.
+func Reevaluate(database *db.Database, hostIDs []uuid.UUID) error {
+	var errs []error
+	for _, hostID := range hostIDs {
+		hosts, err := surrealdb.SmartUnmarshal[[]structs.Host](database.DB.Query(
+			"SELECT * FROM hosts WHERE HostID = $hostID LIMIT 1",
+			map[string]interface{}{"hostID": hostID.String()},
+		))
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if len(hosts) == 0 {
+			continue
+		}
+
+		packages, err := surrealdb.SmartUnmarshal[[]structs.Package](database.DB.Query(
+			"SELECT * FROM packages WHERE HostID = $hostID",
+			map[string]interface{}{"hostID": hostID.String()},
+		))
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		if _, err := Enforce(database, hosts[0], packages); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// FindViolations returns the stored violations matching a field, e.g. "HostID" or "LockID".
+func FindViolations(database *db.Database, field string, id uuid.UUID) ([]structs.Lock_Violation, error) {
+	violations, err := surrealdb.SmartUnmarshal[[]structs.Lock_Violation](database.DB.Query(
+		"SELECT * FROM lock_violations WHERE type::field($field) = $id ORDER BY PackageName",
+		map[string]interface{}{"field": field, "id": id.String()},
+	))
+	if err != nil {
+		return nil, err
+	}
+	if violations == nil {
+		violations = []structs.Lock_Violation{}
+	}
+	return violations, nil
+}
+
+// Create stores a new lock with a fresh LockID. The caller has to validate it
+// and re-evaluate its hosts.
+func Create(database *db.Database, lock structs.Lock) (structs.Lock, error) {
+	lock.ID = ""
+	lock.LockID = uuid.New()
+	lock.CreationTime = time.Now()
+	lock.UpdateTime = time.Now()
+
+	created, err := surrealdb.SmartUnmarshal[[]structs.Lock](database.DB.Create("locks", lock))
+	if err != nil {
+		return lock, err
+	}
+	if len(created) == 0 {
+		return lock, errors.New("lock was not created")
+	}
+	return created[0], nil
+}
+
+// Update replaces an existing lock. The caller has to validate the update and
+// re-evaluate the hosts of both versions.
+func Update(database *db.Database, existing structs.Lock, update structs.Lock) (structs.Lock, error) {
+	update.ID = existing.ID
+	update.LockID = existing.LockID
+	update.CreationTime = existing.CreationTime
+	update.UpdateTime = time.Now()
+
+	_, err := database.DB.Update(existing.ID, update)
+	return update, err
+}
+
+// Delete removes a lock. The caller has to re-evaluate its hosts.
+func Delete(database *db.Database, lock structs.Lock) error {
+	_, err := database.DB.Delete(lock.ID)
+	return err
+}
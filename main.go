@@ -4,13 +4,20 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"packagelock/approvals"
+	"packagelock/campaign"
 	"packagelock/certs"
 	"packagelock/cmd"
 	"packagelock/config"
 	"packagelock/db"
+	"packagelock/decommission"
+	"packagelock/drift"
 	"packagelock/handler"
+	"packagelock/jobs"
 	"packagelock/logger"
+	"packagelock/repos"
 	"packagelock/server"
+	"packagelock/stream"
 	"packagelock/tracing"
 
 	"go.uber.org/fx"
@@ -34,13 +41,21 @@ func main() {
 			},
 			logger.NewLogger,
 			config.NewConfig,
+			config.NewWatcher,
 		),
 		certs.Module,
-		db.Module,      // Include the database module
-		handler.Module, // Include the handlers module
-		server.Module,  // Include the server module
-		cmd.Module,     // Include the commands module
-		tracing.Module, // Include the tracing module
+		db.Module,           // Include the database module
+		repos.Module,        // Include the repository index module
+		drift.Module,        // Include the drift detection module
+		jobs.Module,         // Include the agent job queue module
+		stream.Module,       // Include the agent stream module
+		campaign.Module,     // Include the patch campaign module
+		approvals.Module,    // Include the approval module
+		decommission.Module, // Include the host decommission module
+		handler.Module,      // Include the handlers module
+		server.Module,       // Include the server module
+		cmd.Module,          // Include the commands module
+		tracing.Module,      // Include the tracing module
 	)
 
 	if err := app.Start(context.Background()); err != nil {
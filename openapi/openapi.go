@@ -0,0 +1,314 @@
+// OpenAPI
+//
+// The OpenAPI Package describes the API as an OpenAPI 3.1 document. The paths are taken
+// from the routes registered on the fiber app, so the document can't miss a route.
+// Summaries and body types come from the operations documented next to the router,
+// their JSON schemas are generated from the Go types.
+package openapi
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// Version is the OpenAPI version of the generated documents.
+const Version = "3.1.0"
+
+// Operation documents a route. All fields are optional.
+type Operation struct {
+	Summary    string
+	Request    interface{}       // example value of the request body type
+	Response   interface{}       // example value of the response body type
+	Status     int               // success status, defaults to 200
+	Query      map[string]string // query parameter to description
+	Deprecated bool
+}
+
+// Info describes the API.
+type Info struct {
+	Title   string
+	Version string
+	Secured bool     // routes below SecuredPrefix need a bearer token
+	Servers []string // base URLs of the API
+}
+
+// SecuredPrefix is the path prefix of the routes protected by a JWT in production.
+const SecuredPrefix = "/v1"
+
+// Key returns the key of a route in the operations map, e.g. "GET /v1/hosts/:id".
+func Key(method, path string) string {
+	return method + " " + path
+}
+
+// Build creates the OpenAPI document for the given routes. Routes are documented
+// by the operations with their Key, HEAD routes and routes outside of the API are skipped.
+func Build(routes []fiber.Route, info Info, operations map[string]Operation) map[string]interface{} {
+	gen := &generator{schemas: map[string]interface{}{}, types: map[reflect.Type]string{}}
+
+	paths := map[string]interface{}{}
+	for _, route := range routes {
+		if route.Method == fiber.MethodHead || route.Method == fiber.MethodConnect || route.Method == fiber.MethodTrace {
+			continue
+		}
+		if !strings.HasPrefix(route.Path, SecuredPrefix+"/") && !strings.HasPrefix(route.Path, "/auth/") {
+			continue
+		}
+
+		path, params := convertPath(route.Path)
+		item, ok := paths[path].(map[string]interface{})
+		if !ok {
+			item = map[string]interface{}{}
+			paths[path] = item
+		}
+		item[strings.ToLower(route.Method)] = gen.operation(route, path, params, info, operations[Key(route.Method, route.Path)])
+	}
+
+	document := map[string]interface{}{
+		"openapi": Version,
+		"info": map[string]interface{}{
+			"title":   info.Title,
+			"version": info.Version,
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas": gen.schemas,
+		},
+	}
+	if len(info.Servers) > 0 {
+		servers := make([]interface{}, 0, len(info.Servers))
+		for _, server := range info.Servers {
+			servers = append(servers, map[string]interface{}{"url": server})
+		}
+		document["servers"] = servers
+	}
+	if info.Secured {
+		document["components"].(map[string]interface{})["securitySchemes"] = map[string]interface{}{
+			"bearerAuth": map[string]interface{}{
+				"type":         "http",
+				"scheme":       "bearer",
+				"bearerFormat": "JWT",
+			},
+		}
+	}
+	gen.schemas["Error"] = map[string]interface{}{
+		"type":       "object",
+		"properties": map[string]interface{}{"error": map[string]interface{}{"type": "string"}},
+	}
+	return document
+}
+
+// convertPath turns fiber parameters like ':id' into OpenAPI parameters like '{id}'.
+// Fiber doesn't route strictly, so a trailing slash is dropped.
+func convertPath(path string) (string, []string) {
+	var params []string
+	segments := strings.Split(path, "/")
+	for idx, segment := range segments {
+		if name, ok := strings.CutPrefix(segment, ":"); ok {
+			name = strings.TrimSuffix(name, "?")
+			params = append(params, name)
+			segments[idx] = "{" + name + "}"
+		}
+	}
+	converted := strings.Join(segments, "/")
+	if len(converted) > 1 {
+		converted = strings.TrimSuffix(converted, "/")
+	}
+	return converted, params
+}
+
+type generator struct {
+	schemas map[string]interface{}
+	types   map[reflect.Type]string
+}
+
+func (g *generator) operation(route fiber.Route, path string, params []string, info Info, doc Operation) map[string]interface{} {
+	op := map[string]interface{}{
+		"operationId": operationID(route.Method, path),
+		"tags":        []string{tag(path)},
+	}
+	if doc.Summary != "" {
+		op["summary"] = doc.Summary
+	}
+	if doc.Deprecated {
+		op["deprecated"] = true
+	}
+	if info.Secured && strings.HasPrefix(route.Path, SecuredPrefix+"/") {
+		op["security"] = []interface{}{map[string]interface{}{"bearerAuth": []string{}}}
+	}
+
+	var parameters []interface{}
+	for _, name := range params {
+		parameters = append(parameters, map[string]interface{}{
+			"name":     name,
+			"in":       "path",
+			"required": true,
+			"schema":   map[string]interface{}{"type": "string", "format": "uuid"},
+		})
+	}
+	queryNames := make([]string, 0, len(doc.Query))
+	for name := range doc.Query {
+		queryNames = append(queryNames, name)
+	}
+	sort.Strings(queryNames)
+	for _, name := range queryNames {
+		parameters = append(parameters, map[string]interface{}{
+			"name":        name,
+			"in":          "query",
+			"description": doc.Query[name],
+			"schema":      map[string]interface{}{"type": "string"},
+		})
+	}
+	if len(parameters) > 0 {
+		op["parameters"] = parameters
+	}
+
+	if doc.Request != nil {
+		op["requestBody"] = map[string]interface{}{
+			"required": true,
+			"content": map[string]interface{}{
+				fiber.MIMEApplicationJSON: map[string]interface{}{"schema": g.schema(reflect.TypeOf(doc.Request))},
+			},
+		}
+	}
+
+	status := doc.Status
+	if status == 0 {
+		status = fiber.StatusOK
+	}
+	success := map[string]interface{}{"description": http.StatusText(status)}
+	if doc.Response != nil && status != fiber.StatusNoContent {
+		success["content"] = map[string]interface{}{
+			fiber.MIMEApplicationJSON: map[string]interface{}{"schema": g.schema(reflect.TypeOf(doc.Response))},
+		}
+	}
+	op["responses"] = map[string]interface{}{
+		fmt.Sprint(status): success,
+		"default": map[string]interface{}{
+			"description": "Error",
+			"content": map[string]interface{}{
+				fiber.MIMEApplicationJSON: map[string]interface{}{"schema": map[string]interface{}{"$ref": "#/components/schemas/Error"}},
+			},
+		},
+	}
+	return op
+}
+
+// operationID derives a unique ID from method and path, e.g. "getV1HostsIdAgents".
+func operationID(method, path string) string {
+	var id strings.Builder
+	id.WriteString(strings.ToLower(method))
+	for _, segment := range strings.Split(path, "/") {
+		segment = strings.Trim(segment, "{}")
+		for _, part := range strings.FieldsFunc(segment, func(r rune) bool { return r == '-' || r == '_' }) {
+			id.WriteString(strings.ToUpper(part[:1]) + part[1:])
+		}
+	}
+	return id.String()
+}
+
+// tag groups routes by their first segment below the API version.
+func tag(path string) string {
+	segments := strings.Split(strings.TrimPrefix(path, SecuredPrefix), "/")
+	if len(segments) > 1 && segments[1] != "" {
+		return segments[1]
+	}
+	return "general"
+}
+
+var (
+	timeType = reflect.TypeOf(time.Time{})
+	uuidType = reflect.TypeOf(uuid.UUID{})
+)
+
+// schema returns the JSON schema of a type. Named structs become components.
+func (g *generator) schema(t reflect.Type) map[string]interface{} {
+	switch t {
+	case timeType:
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case uuidType:
+		return map[string]interface{}{"type": "string", "format": "uuid"}
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		return g.schema(t.Elem())
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]interface{}{"type": "string", "contentEncoding": "base64"}
+		}
+		return map[string]interface{}{"type": "array", "items": g.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": g.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.object(t)
+		}
+		name, ok := g.types[t]
+		if !ok {
+			name = g.componentName(t)
+			g.types[t] = name
+			// Registered before the fields are generated, so recursive types terminate
+			g.schemas[name] = map[string]interface{}{}
+			g.schemas[name] = g.object(t)
+		}
+		return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+	}
+	return map[string]interface{}{}
+}
+
+// componentName returns the type name, prefixed with its package if another type has the same name.
+func (g *generator) componentName(t reflect.Type) string {
+	name := t.Name()
+	if _, taken := g.schemas[name]; taken {
+		pkg := t.PkgPath()[strings.LastIndex(t.PkgPath(), "/")+1:]
+		name = pkg + "_" + name
+	}
+	return name
+}
+
+// object returns the schema of a struct with the field names encoding/json uses.
+func (g *generator) object(t reflect.Type) map[string]interface{} {
+	properties := map[string]interface{}{}
+	g.fields(t, properties)
+	return map[string]interface{}{"type": "object", "properties": properties}
+}
+
+func (g *generator) fields(t reflect.Type, properties map[string]interface{}) {
+	for idx := 0; idx < t.NumField(); idx++ {
+		field := t.Field(idx)
+		tagValue := field.Tag.Get("json")
+		if tagValue == "-" {
+			continue
+		}
+		name, _, _ := strings.Cut(tagValue, ",")
+
+		// Embedded structs without a name in the tag are flattened like encoding/json does
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			g.fields(field.Type, properties)
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		properties[name] = g.schema(field.Type)
+	}
+}
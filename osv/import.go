@@ -0,0 +1,150 @@
+package osv
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"packagelock/structs"
+)
+
+// ReadDump reads all OSV records from a directory, a single JSON file,
+// a zip archive (as published at https://osv-vulnerabilities.storage.googleapis.com/<ecosystem>/all.zip)
+// or a gzipped tarball. Every record of the selected ecosystems is passed to fn.
+// Records which cannot be parsed are skipped and reported in the returned error.
+func ReadDump(path string, ecosystems []string, fn func(structs.Vulnerability) error) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	reader := &dumpReader{ecosystems: ecosystems, fn: fn}
+	switch {
+	case info.IsDir():
+		err = reader.readDir(path)
+	case strings.HasSuffix(path, ".zip"):
+		err = reader.readZip(path)
+	case strings.HasSuffix(path, ".tar.gz"), strings.HasSuffix(path, ".tgz"):
+		err = reader.readTarball(path)
+	case strings.HasSuffix(path, ".json"):
+		err = reader.readFile(path)
+	default:
+		return fmt.Errorf("unsupported OSV dump: %s", path)
+	}
+
+	if err != nil {
+		return err
+	}
+	return errors.Join(reader.errs...)
+}
+
+type dumpReader struct {
+	ecosystems []string
+	fn         func(structs.Vulnerability) error
+	errs       []error
+}
+
+// handle parses a single record. Parse errors are collected, errors from fn abort the import.
+func (r *dumpReader) handle(name string, data []byte) error {
+	vuln, ok, err := Parse(data, r.ecosystems)
+	if err != nil {
+		r.errs = append(r.errs, fmt.Errorf("%s: %w", name, err))
+		return nil
+	}
+	if !ok {
+		return nil
+	}
+	return r.fn(vuln)
+}
+
+func (r *dumpReader) readDir(dir string) error {
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !strings.HasSuffix(path, ".json") {
+			return nil
+		}
+		return r.readFile(path)
+	})
+}
+
+func (r *dumpReader) readFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return r.handle(path, data)
+}
+
+func (r *dumpReader) readZip(path string) error {
+	archive, err := zip.OpenReader(path)
+	if err != nil {
+		return err
+	}
+	defer archive.Close()
+
+	for _, file := range archive.File {
+		if file.FileInfo().IsDir() || !strings.HasSuffix(file.Name, ".json") {
+			continue
+		}
+
+		content, err := file.Open()
+		if err != nil {
+			return err
+		}
+		data, err := io.ReadAll(content)
+		content.Close()
+		if err != nil {
+			return err
+		}
+
+		if err := r.handle(file.Name, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *dumpReader) readTarball(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+
+	archive := tar.NewReader(gz)
+	for {
+		header, err := archive.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if header.Typeflag != tar.TypeReg || !strings.HasSuffix(header.Name, ".json") {
+			continue
+		}
+
+		data, err := io.ReadAll(archive)
+		if err != nil {
+			return err
+		}
+		if err := r.handle(header.Name, data); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package osv
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+
+	"packagelock/structs"
+	"packagelock/versions"
+)
+
+var releasePattern = regexp.MustCompile(`\d+(\.\d+)*`)
+
+// HostEcosystem returns the OSV ecosystem and release of a host, e.g. "Debian" and "12".
+// The release is empty if the host's distro string doesn't contain one.
+func HostEcosystem(host structs.Host) (string, string) {
+	distro := strings.ToLower(host.Distro)
+
+	ecosystem := ""
+	switch {
+	case strings.Contains(distro, "debian"):
+		ecosystem = "Debian"
+	case strings.Contains(distro, "ubuntu"):
+		ecosystem = "Ubuntu"
+	case strings.Contains(distro, "alpine"):
+		ecosystem = "Alpine"
+	case strings.Contains(distro, "rocky"):
+		ecosystem = "Rocky Linux"
+	}
+
+	return ecosystem, releasePattern.FindString(distro)
+}
+
+// releaseMatches compares the release of an OSV ecosystem ("12", "v3.20", "22.04:LTS", "9")
+// with a host release. Unknown releases on either side always match.
+func releaseMatches(osvRelease, hostRelease string) bool {
+	osvRelease = releasePattern.FindString(osvRelease)
+	if osvRelease == "" || hostRelease == "" {
+		return true
+	}
+	// "9" covers "9.4", "3.20" covers "3.20.1"
+	return hostRelease == osvRelease || strings.HasPrefix(hostRelease, osvRelease+".")
+}
+
+// Affects reports whether version is affected according to the given affected entry.
+// It returns the version fixing the issue, if any.
+func Affects(cmp versions.Comparator, affected structs.Vulnerability_Affected, version string) (bool, string) {
+	for _, listed := range affected.Versions {
+		if cmp.Compare(listed, version) == 0 {
+			return true, ""
+		}
+	}
+
+	for _, r := range affected.Ranges {
+		if r.Type != "ECOSYSTEM" {
+			continue
+		}
+		if ok, fixed := inRange(cmp, r.Events, version); ok {
+			return true, fixed
+		}
+	}
+	return false, ""
+}
+
+// inRange evaluates the events of a single range as described in the OSV schema:
+// the events are sorted and the version is affected if the last event at or below it
+// introduced the vulnerability.
+func inRange(cmp versions.Comparator, events []structs.Vulnerability_Event, version string) (bool, string) {
+	eventVersion := func(e structs.Vulnerability_Event) string {
+		switch {
+		case e.Introduced != "":
+			return e.Introduced
+		case e.Fixed != "":
+			return e.Fixed
+		case e.LastAffected != "":
+			return e.LastAffected
+		}
+		return e.Limit
+	}
+	// "0" is the start of all versions, no matter how the ecosystem orders it
+	compare := func(a, b string) int {
+		switch {
+		case a == b:
+			return 0
+		case a == "0":
+			return -1
+		case b == "0":
+			return 1
+		}
+		return cmp.Compare(a, b)
+	}
+
+	sorted := make([]structs.Vulnerability_Event, len(events))
+	copy(sorted, events)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return compare(eventVersion(sorted[i]), eventVersion(sorted[j])) < 0
+	})
+
+	affected := false
+	fixed := ""
+	for _, event := range sorted {
+		switch {
+		case event.Introduced != "":
+			if compare(version, event.Introduced) >= 0 {
+				affected = true
+			}
+		case event.Fixed != "":
+			if compare(version, event.Fixed) >= 0 {
+				affected = false
+			} else if affected && fixed == "" {
+				fixed = event.Fixed
+			}
+		case event.LastAffected != "":
+			if compare(version, event.LastAffected) > 0 {
+				affected = false
+			}
+		case event.Limit != "":
+			if compare(version, event.Limit) >= 0 {
+				affected = false
+			}
+		}
+	}
+
+	if !affected {
+		return false, ""
+	}
+	return true, fixed
+}
+
+// sourceEcosystems publish their advisories (DSA, DLA, USN) for source packages.
+var sourceEcosystems = map[string]bool{"Debian": true, "Ubuntu": true}
+
+// matchNames returns the names a package is looked up by in an ecosystem:
+// the source package first where advisories are published for it, then the binary.
+func matchNames(ecosystem string, pkg structs.Package) []string {
+	if sourceEcosystems[ecosystem] && pkg.SourceName != "" && pkg.SourceName != pkg.PackageName {
+		return []string{pkg.SourceName, pkg.PackageName}
+	}
+	return []string{pkg.PackageName}
+}
+
+// Match returns all findings of the given vulnerabilities for the packages of a host.
+func Match(host structs.Host, packages []structs.Package, vulns []structs.Vulnerability) []structs.Vulnerability_Finding {
+	ecosystem, release := HostEcosystem(host)
+	cmp := versions.ForHost(host)
+
+	byName := map[string][]structs.Vulnerability{}
+	for _, vuln := range vulns {
+		for _, name := range vuln.AffectedPackages {
+			byName[name] = append(byName[name], vuln)
+		}
+	}
+
+	findings := []structs.Vulnerability_Finding{}
+	for _, pkg := range packages {
+		found := map[string]bool{}
+		for _, name := range matchNames(ecosystem, pkg) {
+			for _, vuln := range byName[name] {
+				if found[vuln.OSVID] {
+					continue
+				}
+				for _, affected := range vuln.Affected {
+					base, osvRelease := splitEcosystem(affected.Ecosystem)
+					if affected.Name != name || base != ecosystem || !releaseMatches(osvRelease, release) {
+						continue
+					}
+
+					ok, fixed := Affects(cmp, affected, pkg.PackageVersion)
+					if !ok {
+						continue
+					}
+
+					finding := structs.Vulnerability_Finding{
+						HostID:          host.HostID,
+						Hostname:        host.Hostname,
+						PackageName:     pkg.PackageName,
+						PackageVersion:  pkg.PackageVersion,
+						VulnerabilityID: vuln.OSVID,
+						Aliases:         vuln.Aliases,
+						Summary:         vuln.Summary,
+						Severity:        vuln.Severity,
+						Ecosystem:       affected.Ecosystem,
+						FixedVersion:    fixed,
+					}
+					if name != pkg.PackageName {
+						finding.SourceName = name
+					}
+					findings = append(findings, finding)
+					// One finding per package and vulnerability is enough
+					found[vuln.OSVID] = true
+					break
+				}
+			}
+		}
+	}
+
+	return findings
+}
@@ -0,0 +1,70 @@
+package osv
+
+import (
+	"testing"
+
+	"packagelock/structs"
+)
+
+// fixedIn is an affected entry of a package, fixed in the given version.
+func fixedIn(ecosystem, name, fixed string) structs.Vulnerability_Affected {
+	return structs.Vulnerability_Affected{
+		Ecosystem: ecosystem,
+		Name:      name,
+		Ranges: []structs.Vulnerability_Range{{
+			Type:   "ECOSYSTEM",
+			Events: []structs.Vulnerability_Event{{Introduced: "0"}, {Fixed: fixed}},
+		}},
+	}
+}
+
+func TestMatchSourcePackages(t *testing.T) {
+	vulns := []structs.Vulnerability{
+		{
+			OSVID:            "DSA-5764-1",
+			Affected:         []structs.Vulnerability_Affected{fixedIn("Debian:12", "openssl", "3.0.14-1~deb12u2")},
+			AffectedPackages: []string{"openssl"},
+		},
+		{
+			OSVID:            "DLA-0000-1",
+			Affected:         []structs.Vulnerability_Affected{fixedIn("Debian:12", "curl", "7.88.1-10+deb12u6")},
+			AffectedPackages: []string{"curl"},
+		},
+		{
+			OSVID:            "ALPINE-CVE-2024-5535",
+			Affected:         []structs.Vulnerability_Affected{fixedIn("Alpine:v3.20", "openssl", "3.3.2-r0")},
+			AffectedPackages: []string{"openssl"},
+		},
+	}
+
+	debian := structs.Host{Distro: "Debian GNU/Linux 12 (bookworm)"}
+	packages := []structs.Package{
+		{PackageName: "libssl3", SourceName: "openssl", PackageVersion: "3.0.13-1~deb12u1"},
+		{PackageName: "openssl", SourceName: "openssl", PackageVersion: "3.0.13-1~deb12u1"},
+		{PackageName: "curl", PackageVersion: "7.88.1-10+deb12u5"}, // no source reported, falls back to the binary
+		{PackageName: "libcurl4", PackageVersion: "7.88.1-10+deb12u5"},
+	}
+	findings := Match(debian, packages, vulns)
+
+	want := []struct{ pkg, source, id string }{
+		{"libssl3", "openssl", "DSA-5764-1"},
+		{"openssl", "", "DSA-5764-1"},
+		{"curl", "", "DLA-0000-1"},
+	}
+	if len(findings) != len(want) {
+		t.Fatalf("Match found %d findings, want %d: %+v", len(findings), len(want), findings)
+	}
+	for idx, finding := range findings {
+		if finding.PackageName != want[idx].pkg || finding.SourceName != want[idx].source || finding.VulnerabilityID != want[idx].id {
+			t.Errorf("finding %d = %s (source %q) %s, want %s (source %q) %s", idx,
+				finding.PackageName, finding.SourceName, finding.VulnerabilityID, want[idx].pkg, want[idx].source, want[idx].id)
+		}
+	}
+
+	// Only Debian and Ubuntu are matched by the source package
+	alpine := structs.Host{Distro: "Alpine Linux v3.20"}
+	findings = Match(alpine, []structs.Package{{PackageName: "libssl3", SourceName: "openssl", PackageVersion: "3.3.1-r0"}}, vulns)
+	if len(findings) != 0 {
+		t.Errorf("Match on Alpine = %+v, want no findings", findings)
+	}
+}
@@ -0,0 +1,131 @@
+// OSV
+//
+// The OSV Package imports vulnerability databases in the
+// Open Source Vulnerability format (https://ossf.github.io/osv-schema/)
+// and matches them against the packages installed on hosts.
+package osv
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"packagelock/structs"
+)
+
+// entry is the subset of an OSV record PackageLock cares about.
+type entry struct {
+	ID        string    `json:"id"`
+	Aliases   []string  `json:"aliases"`
+	Summary   string    `json:"summary"`
+	Details   string    `json:"details"`
+	Published time.Time `json:"published"`
+	Modified  time.Time `json:"modified"`
+	Withdrawn time.Time `json:"withdrawn"`
+	Severity  []struct {
+		Type  string `json:"type"`
+		Score string `json:"score"`
+	} `json:"severity"`
+	Affected []struct {
+		Package struct {
+			Ecosystem string `json:"ecosystem"`
+			Name      string `json:"name"`
+		} `json:"package"`
+		Ranges []struct {
+			Type   string     `json:"type"`
+			Events []osvEvent `json:"events"`
+		} `json:"ranges"`
+		Versions []string `json:"versions"`
+	} `json:"affected"`
+	References []struct {
+		URL string `json:"url"`
+	} `json:"references"`
+}
+
+type osvEvent struct {
+	Introduced   string `json:"introduced"`
+	Fixed        string `json:"fixed"`
+	LastAffected string `json:"last_affected"`
+	Limit        string `json:"limit"`
+}
+
+// Parse decodes a single OSV record. Only affected packages of the given
+// ecosystems are kept; ok is false if none are left or the record was withdrawn.
+func Parse(data []byte, ecosystems []string) (vuln structs.Vulnerability, ok bool, err error) {
+	var e entry
+	if err := json.Unmarshal(data, &e); err != nil {
+		return vuln, false, err
+	}
+	if !e.Withdrawn.IsZero() {
+		return vuln, false, nil
+	}
+
+	vuln = structs.Vulnerability{
+		OSVID:     e.ID,
+		Aliases:   e.Aliases,
+		Summary:   e.Summary,
+		Details:   e.Details,
+		Published: e.Published,
+		Modified:  e.Modified,
+	}
+	for _, severity := range e.Severity {
+		vuln.Severity = append(vuln.Severity, severity.Score)
+	}
+	for _, reference := range e.References {
+		vuln.References = append(vuln.References, reference.URL)
+	}
+
+	seen := map[string]bool{}
+	for _, affected := range e.Affected {
+		if !ecosystemSelected(affected.Package.Ecosystem, ecosystems) {
+			continue
+		}
+
+		converted := structs.Vulnerability_Affected{
+			Ecosystem: affected.Package.Ecosystem,
+			Name:      affected.Package.Name,
+			Versions:  affected.Versions,
+		}
+		for _, r := range affected.Ranges {
+			converted.Ranges = append(converted.Ranges, convertRange(r.Type, r.Events))
+		}
+		vuln.Affected = append(vuln.Affected, converted)
+
+		if !seen[converted.Name] {
+			seen[converted.Name] = true
+			vuln.AffectedPackages = append(vuln.AffectedPackages, converted.Name)
+		}
+	}
+
+	return vuln, len(vuln.Affected) > 0, nil
+}
+
+func convertRange(rangeType string, events []osvEvent) structs.Vulnerability_Range {
+	converted := structs.Vulnerability_Range{Type: rangeType}
+	for _, event := range events {
+		converted.Events = append(converted.Events, structs.Vulnerability_Event{
+			Introduced:   event.Introduced,
+			Fixed:        event.Fixed,
+			LastAffected: event.LastAffected,
+			Limit:        event.Limit,
+		})
+	}
+	return converted
+}
+
+// ecosystemSelected reports whether an ecosystem like "Debian:12" belongs to one of the selected base ecosystems.
+func ecosystemSelected(ecosystem string, selected []string) bool {
+	base, _ := splitEcosystem(ecosystem)
+	for _, s := range selected {
+		if strings.EqualFold(base, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// splitEcosystem splits "Ubuntu:22.04:LTS" into "Ubuntu" and "22.04:LTS".
+func splitEcosystem(ecosystem string) (string, string) {
+	base, release, _ := strings.Cut(ecosystem, ":")
+	return base, release
+}
@@ -0,0 +1,45 @@
+package osv
+
+import (
+	"packagelock/db"
+	"packagelock/structs"
+
+	"github.com/surrealdb/surrealdb.go"
+)
+
+// Save replaces the stored vulnerabilities with the same OSV IDs by the given ones.
+func Save(database *db.Database, vulns []structs.Vulnerability) error {
+	if len(vulns) == 0 {
+		return nil
+	}
+
+	ids := make([]string, 0, len(vulns))
+	for _, vuln := range vulns {
+		ids = append(ids, vuln.OSVID)
+	}
+
+	_, err := database.DB.Query(
+		"DELETE vulnerabilities WHERE OSVID IN $ids; INSERT INTO vulnerabilities $vulns;",
+		map[string]interface{}{
+			"ids":   ids,
+			"vulns": vulns,
+		},
+	)
+	return err
+}
+
+// FindByPackages returns all stored vulnerabilities affecting at least one of the given package names.
+func FindByPackages(database *db.Database, names []string) ([]structs.Vulnerability, error) {
+	if len(names) == 0 {
+		return []structs.Vulnerability{}, nil
+	}
+
+	vulns, err := surrealdb.SmartUnmarshal[[]structs.Vulnerability](database.DB.Query(
+		"SELECT * FROM vulnerabilities WHERE AffectedPackages CONTAINSANY $names",
+		map[string]interface{}{"names": names},
+	))
+	if err != nil {
+		return nil, err
+	}
+	return vulns, nil
+}
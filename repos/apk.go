@@ -0,0 +1,73 @@
+package repos
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strings"
+
+	"packagelock/structs"
+)
+
+// ParseApkRepositories parses /etc/apk/repositories.
+// A line like 'https://dl-cdn.alpinelinux.org/alpine/v3.20/main' is split into
+// the mirror URL, the branch as suite and the repository as component.
+// Tagged repositories ('@testing https://...') keep their tag as name.
+func ParseApkRepositories(content []byte, source string) ([]structs.Package_Repo, error) {
+	var result []structs.Package_Repo
+
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		enabled := true
+		if strings.HasPrefix(line, "#") {
+			line = strings.TrimSpace(strings.TrimLeft(line, "#"))
+			if !strings.Contains(line, "://") {
+				// A normal comment
+				continue
+			}
+			enabled = false
+		}
+
+		tag := ""
+		if strings.HasPrefix(line, "@") {
+			fields := strings.Fields(line)
+			if len(fields) < 2 {
+				if !enabled {
+					continue
+				}
+				return nil, fmt.Errorf("%s: tagged repository without url: %q", source, line)
+			}
+			tag, line = strings.TrimPrefix(fields[0], "@"), fields[1]
+		}
+
+		repo := structs.Package_Repo{
+			Type:     "apk",
+			URL:      strings.TrimSuffix(line, "/"),
+			Enabled:  enabled,
+			GPGCheck: true, // apk always verifies signatures unless run with --allow-untrusted
+			Source:   source,
+		}
+
+		// Split '<mirror>/<branch>/<repository>'
+		segments := strings.Split(repo.URL, "/")
+		if len(segments) >= 5 {
+			repo.Suite = segments[len(segments)-2]
+			repo.Components = []string{segments[len(segments)-1]}
+			repo.URL = strings.Join(segments[:len(segments)-2], "/")
+		}
+
+		repo.Name = tag
+		if repo.Name == "" {
+			repo.Name = strings.TrimSpace(repo.Suite + " " + strings.Join(repo.Components, " "))
+		}
+
+		result = append(result, repo)
+	}
+
+	return result, scanner.Err()
+}
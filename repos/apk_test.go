@@ -0,0 +1,49 @@
+package repos
+
+import (
+	"testing"
+
+	"packagelock/structs"
+)
+
+func TestParseApkRepositories(t *testing.T) {
+	const source = ApkRepositories
+	repos, err := ParseApkRepositories(fixture(t, "repositories"), source)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const mirror = "https://dl-cdn.alpinelinux.org/alpine"
+	checkRepos(t, repos, []structs.Package_Repo{
+		{
+			Type: "apk", Name: "v3.20 main", URL: mirror, Suite: "v3.20", Components: []string{"main"},
+			Enabled: true, GPGCheck: true, Source: source,
+		},
+		{
+			Type: "apk", Name: "v3.20 community", URL: mirror, Suite: "v3.20", Components: []string{"community"},
+			Enabled: true, GPGCheck: true, Source: source,
+		},
+		{
+			Type: "apk", Name: "edge testing", URL: mirror, Suite: "edge", Components: []string{"testing"},
+			Enabled: false, GPGCheck: true, Source: source,
+		},
+		{
+			Type: "apk", Name: "edge", URL: mirror, Suite: "edge", Components: []string{"main"},
+			Enabled: true, GPGCheck: true, Source: source,
+		},
+		{
+			// Local repositories aren't split into branch and repository
+			Type: "apk", URL: "/var/cache/packages", Enabled: true, GPGCheck: true, Source: source,
+		},
+	})
+}
+
+func TestParseApkRepositoriesTagWithoutURL(t *testing.T) {
+	if _, err := ParseApkRepositories([]byte("@edge\n"), ApkRepositories); err == nil {
+		t.Errorf("tag without url succeeded, want error")
+	}
+	repos, err := ParseApkRepositories([]byte("#@edge\n"), ApkRepositories)
+	if err != nil || len(repos) != 0 {
+		t.Errorf("commented tag = %v, %v, want no repos", repos, err)
+	}
+}
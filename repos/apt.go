@@ -0,0 +1,202 @@
+package repos
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strings"
+
+	"packagelock/structs"
+)
+
+// ParseAptSources parses the one-line-style format used by sources.list and sources.list.d/*.list.
+// Commented out entries are returned as disabled repositories.
+func ParseAptSources(content []byte, source string) ([]structs.Package_Repo, error) {
+	var result []structs.Package_Repo
+
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		enabled := true
+		if strings.HasPrefix(line, "#") {
+			// Only lines which look like an entry count as disabled repos,
+			// everything else is a normal comment.
+			line = strings.TrimSpace(strings.TrimLeft(line, "#"))
+			if !strings.HasPrefix(line, "deb ") && !strings.HasPrefix(line, "deb-src ") {
+				continue
+			}
+			enabled = false
+		}
+
+		// Strip trailing comments
+		if idx := strings.Index(line, "#"); idx >= 0 {
+			line = strings.TrimSpace(line[:idx])
+		}
+
+		repo, err := parseAptLine(line)
+		if err != nil {
+			if !enabled {
+				// A broken disabled entry is just a comment
+				continue
+			}
+			return nil, fmt.Errorf("%s:%d: %w", source, lineNumber, err)
+		}
+		repo.Enabled = enabled
+		repo.Source = source
+		result = append(result, repo)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", source, err)
+	}
+	return result, nil
+}
+
+// parseAptLine parses 'deb [option=value ...] uri suite [component ...]'.
+func parseAptLine(line string) (structs.Package_Repo, error) {
+	repo := structs.Package_Repo{GPGCheck: true}
+
+	repoType, rest, _ := strings.Cut(line, " ")
+	if repoType != "deb" && repoType != "deb-src" {
+		return repo, fmt.Errorf("unknown entry type %q", repoType)
+	}
+	repo.Type = repoType
+	rest = strings.TrimSpace(rest)
+
+	// Options are enclosed in brackets and may contain spaces
+	if strings.HasPrefix(rest, "[") {
+		end := strings.Index(rest, "]")
+		if end < 0 {
+			return repo, fmt.Errorf("unterminated option list")
+		}
+		for _, option := range strings.Fields(rest[1:end]) {
+			key, value, _ := strings.Cut(option, "=")
+			applyAptOption(&repo, key, value)
+		}
+		rest = rest[end+1:]
+	}
+
+	fields := strings.Fields(rest)
+	if len(fields) < 2 {
+		return repo, fmt.Errorf("missing uri or suite")
+	}
+	repo.URL = fields[0]
+	repo.Suite = fields[1]
+	repo.Components = fields[2:]
+	repo.Name = aptRepoName(repo.URL, repo.Suite)
+
+	return repo, nil
+}
+
+// ParseDeb822Sources parses the deb822-style format used by sources.list.d/*.sources.
+// Every combination of Types, URIs and Suites in a stanza becomes its own record.
+func ParseDeb822Sources(content []byte, source string) ([]structs.Package_Repo, error) {
+	var result []structs.Package_Repo
+
+	stanzas, err := parseDeb822(content)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", source, err)
+	}
+	for _, stanza := range stanzas {
+		types := strings.Fields(stanza["types"])
+		uris := strings.Fields(stanza["uris"])
+		suites := strings.Fields(stanza["suites"])
+		if len(types) == 0 || len(uris) == 0 || len(suites) == 0 {
+			return nil, fmt.Errorf("%s: stanza is missing Types, URIs or Suites", source)
+		}
+
+		enabled := !strings.EqualFold(stanza["enabled"], "no")
+		gpgCheck := !strings.EqualFold(stanza["trusted"], "yes") &&
+			!strings.EqualFold(stanza["allow-insecure"], "yes")
+		components := strings.Fields(stanza["components"])
+
+		for _, repoType := range types {
+			for _, uri := range uris {
+				for _, suite := range suites {
+					result = append(result, structs.Package_Repo{
+						Type:       repoType,
+						Name:       aptRepoName(uri, suite),
+						URL:        uri,
+						Suite:      suite,
+						Components: components,
+						Enabled:    enabled,
+						GPGCheck:   gpgCheck,
+						Source:     source,
+					})
+				}
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// parseDeb822 splits a deb822 document into stanzas with lower-cased field names.
+// Continuation lines are joined with a single space.
+func parseDeb822(content []byte) ([]map[string]string, error) {
+	var stanzas []map[string]string
+	current := map[string]string{}
+	lastKey := ""
+
+	flush := func() {
+		if len(current) > 0 {
+			stanzas = append(stanzas, current)
+		}
+		current = map[string]string{}
+		lastKey = ""
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	// Package indexes can have very long fields
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.TrimSpace(line) == "":
+			flush()
+		case strings.HasPrefix(line, "#"):
+			continue
+		case line[0] == ' ' || line[0] == '\t':
+			if lastKey != "" {
+				current[lastKey] += " " + strings.TrimSpace(line)
+			}
+		default:
+			key, value, found := strings.Cut(line, ":")
+			if !found {
+				continue
+			}
+			lastKey = strings.ToLower(strings.TrimSpace(key))
+			current[lastKey] = strings.TrimSpace(value)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	flush()
+
+	return stanzas, nil
+}
+
+func applyAptOption(repo *structs.Package_Repo, key, value string) {
+	switch key {
+	case "trusted", "allow-insecure":
+		if value == "yes" {
+			repo.GPGCheck = false
+		}
+	}
+}
+
+// aptRepoName builds a name for apt repos, which don't have one themselves.
+func aptRepoName(uri, suite string) string {
+	host := uri
+	if _, after, found := strings.Cut(host, "://"); found {
+		host = after
+	}
+	return strings.TrimSuffix(host, "/") + " " + suite
+}
@@ -0,0 +1,99 @@
+package repos
+
+import (
+	"strings"
+	"testing"
+
+	"packagelock/structs"
+)
+
+func TestParseAptSources(t *testing.T) {
+	const source = AptSourcesList
+	repos, err := ParseAptSources(fixture(t, "sources.list"), source)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkRepos(t, repos, []structs.Package_Repo{
+		{
+			Type: "deb", Name: "deb.debian.org/debian bookworm", URL: "http://deb.debian.org/debian", Suite: "bookworm",
+			Components: []string{"main", "contrib", "non-free-firmware"}, Enabled: true, GPGCheck: true, Source: source,
+		},
+		{
+			Type: "deb-src", Name: "deb.debian.org/debian bookworm", URL: "http://deb.debian.org/debian", Suite: "bookworm",
+			Components: []string{"main"}, Enabled: true, GPGCheck: true, Source: source,
+		},
+		{
+			Type: "deb", Name: "download.docker.com/linux/debian bookworm", URL: "https://download.docker.com/linux/debian",
+			Suite: "bookworm", Components: []string{"stable"}, Enabled: true, GPGCheck: true, Source: source,
+		},
+		{
+			Type: "deb", Name: "mirror.internal/debian ./", URL: "http://mirror.internal/debian", Suite: "./",
+			Components: []string{}, Enabled: true, GPGCheck: false, Source: source,
+		},
+		{
+			Type: "deb", Name: "deb.debian.org/debian bookworm-backports", URL: "http://deb.debian.org/debian",
+			Suite: "bookworm-backports", Components: []string{"main"}, Enabled: false, GPGCheck: true, Source: source,
+		},
+	})
+}
+
+func TestParseAptSourcesErrors(t *testing.T) {
+	cases := map[string]string{
+		"deb http://deb.debian.org/debian":            "line.list:1: missing uri or suite",
+		"\nrpm http://deb.debian.org/debian bookworm": `line.list:2: unknown entry type "rpm"`,
+		"deb [arch=amd64 http://x bookworm main":      "line.list:1: unterminated option list",
+	}
+	for content, want := range cases {
+		_, err := ParseAptSources([]byte(content), "line.list")
+		if err == nil || err.Error() != want {
+			t.Errorf("ParseAptSources(%q) error = %v, want %q", content, err, want)
+		}
+	}
+}
+
+func TestParseDeb822Sources(t *testing.T) {
+	const source = AptSourcesDir + "/ubuntu.sources"
+	repos, err := ParseDeb822Sources(fixture(t, "ubuntu.sources"), source)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	archive := []string{"main", "restricted", "universe"}
+	checkRepos(t, repos, []structs.Package_Repo{
+		{
+			Type: "deb", Name: "archive.ubuntu.com/ubuntu noble", URL: "http://archive.ubuntu.com/ubuntu/", Suite: "noble",
+			Components: archive, Enabled: true, GPGCheck: true, Source: source,
+		},
+		{
+			Type: "deb", Name: "archive.ubuntu.com/ubuntu noble-updates", URL: "http://archive.ubuntu.com/ubuntu/",
+			Suite: "noble-updates", Components: archive, Enabled: true, GPGCheck: true, Source: source,
+		},
+		{
+			Type: "deb", Name: "security.ubuntu.com/ubuntu noble-security", URL: "http://security.ubuntu.com/ubuntu/",
+			Suite: "noble-security", Components: []string{"main"}, Enabled: false, GPGCheck: true, Source: source,
+		},
+		{
+			Type: "deb-src", Name: "security.ubuntu.com/ubuntu noble-security", URL: "http://security.ubuntu.com/ubuntu/",
+			Suite: "noble-security", Components: []string{"main"}, Enabled: false, GPGCheck: true, Source: source,
+		},
+		{
+			Type: "deb", Name: "mirror.internal/ubuntu noble", URL: "https://mirror.internal/ubuntu/", Suite: "noble",
+			Components: []string{"main"}, Enabled: true, GPGCheck: false, Source: source,
+		},
+	})
+}
+
+func TestParseDeb822SourcesErrors(t *testing.T) {
+	_, err := ParseDeb822Sources([]byte("Types: deb\nSuites: noble\n"), "x.sources")
+	if err == nil || err.Error() != "x.sources: stanza is missing Types, URIs or Suites" {
+		t.Errorf("stanza without URIs: error = %v", err)
+	}
+
+	// Lines longer than the scanner buffer are reported instead of cutting the file short
+	long := "Types: deb\nURIs: http://x/\nSuites: noble\nDescription: " + strings.Repeat("x", 17*1024*1024) + "\n"
+	_, err = ParseDeb822Sources([]byte(long), "x.sources")
+	if err == nil || !strings.HasPrefix(err.Error(), "x.sources: ") {
+		t.Errorf("overlong line: error = %v, want scan error", err)
+	}
+}
@@ -0,0 +1,348 @@
+package repos
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"packagelock/structs"
+	"packagelock/versions"
+
+	"github.com/spf13/viper"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+// Names of the files inside a mirrored repository directory.
+const (
+	metaFileName  = "meta.json"
+	stampFileName = ".synced"
+)
+
+// IndexEntry is a single package version offered by a repository.
+type IndexEntry struct {
+	Name    string
+	Version string
+	Arch    string
+}
+
+// Mirror describes a mirrored repository index on disk.
+// Apt repositories are mirrored once per component, all others have a single index.
+type Mirror struct {
+	Key       string
+	Repo      structs.Package_Repo
+	Component string
+	Arch      string
+	SyncTime  time.Time
+}
+
+// RepoIndex holds the parsed metadata of a single mirrored repository.
+type RepoIndex struct {
+	Mirror
+	Packages map[string][]IndexEntry
+}
+
+// Index is the set of all mirrored repository indexes.
+type Index struct {
+	repos map[string]*RepoIndex
+}
+
+// MirrorKey returns the directory name used for a repository in the mirror directory.
+func MirrorKey(repo structs.Package_Repo, component, arch string) string {
+	sum := sha256.Sum256([]byte(strings.Join([]string{repo.Type, repo.URL, repo.Suite, component, arch}, "\x00")))
+	return hex.EncodeToString(sum[:12])
+}
+
+// Mirrors returns the mirrors a host repository consists of for the given host architecture.
+// Repositories which can't be mirrored (disabled, source or pacman repos) have none.
+func Mirrors(repo structs.Package_Repo, hostArch string) []Mirror {
+	if !repo.Enabled || repo.URL == "" {
+		return nil
+	}
+
+	arch := RepoArch(repo.Type, hostArch)
+	switch repo.Type {
+	case "deb":
+		var mirrors []Mirror
+		components := repo.Components
+		if len(components) == 0 {
+			// Flat repositories don't have components
+			components = []string{""}
+		}
+		for _, component := range components {
+			mirrors = append(mirrors, Mirror{
+				Key:       MirrorKey(repo, component, arch),
+				Repo:      repo,
+				Component: component,
+				Arch:      arch,
+			})
+		}
+		return mirrors
+	case "rpm":
+		return []Mirror{{Key: MirrorKey(repo, "", arch), Repo: repo, Arch: arch}}
+	case "apk":
+		component := ""
+		if len(repo.Components) > 0 {
+			component = repo.Components[0]
+		}
+		return []Mirror{{Key: MirrorKey(repo, component, arch), Repo: repo, Component: component, Arch: arch}}
+	default:
+		return nil
+	}
+}
+
+// RepoArch translates a host architecture into the naming of the given repository type.
+func RepoArch(repoType, hostArch string) string {
+	arch := strings.ToLower(hostArch)
+	switch repoType {
+	case "deb":
+		switch arch {
+		case "x86_64":
+			return "amd64"
+		case "aarch64":
+			return "arm64"
+		case "i686", "i386":
+			return "i386"
+		}
+	case "rpm", "apk":
+		switch arch {
+		case "amd64":
+			return "x86_64"
+		case "arm64":
+			return "aarch64"
+		}
+	}
+	return arch
+}
+
+// PackageManagerType returns the repository type of a package manager, e.g. "deb" for apt.
+func PackageManagerType(name string) string {
+	switch strings.ToLower(name) {
+	case "apt", "apt-get", "aptitude", "dpkg":
+		return "deb"
+	case "dnf", "yum", "rpm", "zypper", "tdnf", "microdnf":
+		return "rpm"
+	case "apk", "pacman":
+		return strings.ToLower(name)
+	}
+	return ""
+}
+
+// HostPackageArch returns the architecture of a host in the naming of its packages,
+// e.g. amd64 for an x86_64 Debian host. Hosts which didn't report a known package
+// manager fall back to the type of their repositories.
+func HostPackageArch(host structs.Host) string {
+	repoType := PackageManagerType(host.PackageManager.PackageManagerName)
+	if repoType == "" {
+		for _, repo := range host.PackageManager.PackageRepos {
+			if repo.Type != "" {
+				repoType = repo.Type
+				break
+			}
+		}
+	}
+	return RepoArch(repoType, host.Arch)
+}
+
+// Candidate returns the newest version of a package available from the given host repositories.
+func (i *Index) Candidate(cmp versions.Comparator, hostRepos []structs.Package_Repo, hostArch, name, arch string) (string, bool) {
+	best := ""
+	for _, repo := range hostRepos {
+		for _, mirror := range Mirrors(repo, hostArch) {
+			repoIndex, ok := i.repos[mirror.Key]
+			if !ok {
+				continue
+			}
+			for _, entry := range repoIndex.Packages[name] {
+				if !archMatches(entry.Arch, arch) {
+					continue
+				}
+				if best == "" || cmp.Compare(entry.Version, best) > 0 {
+					best = entry.Version
+				}
+			}
+		}
+	}
+	return best, best != ""
+}
+
+// UpdatePackages sets CandidateVersion and Updatable on all packages of a host.
+// Packages without any known candidate are left as not updatable.
+func (i *Index) UpdatePackages(host structs.Host, packages []structs.Package) {
+	cmp := HostComparator(host)
+	for idx := range packages {
+		pkg := &packages[idx]
+		candidate, ok := i.Candidate(cmp, host.PackageManager.PackageRepos, host.Arch, pkg.PackageName, pkg.Arch)
+		if !ok {
+			pkg.CandidateVersion = ""
+			pkg.Updatable = false
+			continue
+		}
+		pkg.CandidateVersion = candidate
+		pkg.Updatable = cmp.Compare(candidate, pkg.PackageVersion) > 0
+	}
+}
+
+// HostComparator returns the version comparator for a host. Hosts which didn't
+// report a known package manager or distro fall back to the type of their repositories.
+func HostComparator(host structs.Host) versions.Comparator {
+	cmp := versions.ForHost(host)
+	if cmp != versions.Generic {
+		return cmp
+	}
+	for _, repo := range host.PackageManager.PackageRepos {
+		if repoCmp := versions.ForRepoType(repo.Type); repoCmp != versions.Generic {
+			return repoCmp
+		}
+	}
+	return cmp
+}
+
+// Len returns the number of mirrored repositories in the index.
+func (i *Index) Len() int {
+	return len(i.repos)
+}
+
+func archMatches(entryArch, pkgArch string) bool {
+	if pkgArch == "" || entryArch == "" || entryArch == pkgArch {
+		return true
+	}
+	switch entryArch {
+	case "all", "noarch":
+		return true
+	}
+	return false
+}
+
+// LoadIndex parses all mirrored repositories below dir.
+// Mirrors which cannot be parsed are skipped and reported in the returned error.
+func LoadIndex(dir string) (*Index, error) {
+	index := &Index{repos: map[string]*RepoIndex{}}
+
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return index, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var errs []error
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		repoIndex, err := loadRepoIndex(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", entry.Name(), err))
+			continue
+		}
+		index.repos[repoIndex.Key] = repoIndex
+	}
+
+	return index, errors.Join(errs...)
+}
+
+func loadRepoIndex(dir string) (*RepoIndex, error) {
+	metaData, err := os.ReadFile(filepath.Join(dir, metaFileName))
+	if err != nil {
+		return nil, err
+	}
+
+	var mirror Mirror
+	if err := json.Unmarshal(metaData, &mirror); err != nil {
+		return nil, err
+	}
+
+	var entries []IndexEntry
+	switch mirror.Repo.Type {
+	case "deb":
+		entries, err = readIndexFile(dir, ParseDebianPackages, "Packages.gz", "Packages")
+	case "rpm":
+		entries, err = readIndexFile(dir, ParsePrimaryXML, "primary.xml.gz", "primary.xml")
+	case "apk":
+		entries, err = readIndexFile(dir, ParseAPKIndexArchive, "APKINDEX.tar.gz")
+	default:
+		err = fmt.Errorf("unsupported repository type %q", mirror.Repo.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	repoIndex := &RepoIndex{Mirror: mirror, Packages: map[string][]IndexEntry{}}
+	for _, entry := range entries {
+		repoIndex.Packages[entry.Name] = append(repoIndex.Packages[entry.Name], entry)
+	}
+	return repoIndex, nil
+}
+
+// IndexStoreParams holds the dependencies of the IndexStore.
+type IndexStoreParams struct {
+	fx.In
+
+	Logger *zap.Logger
+	Config *viper.Viper
+}
+
+// IndexStore provides the current Index and reloads it whenever
+// the mirror directory has been synced again.
+type IndexStore struct {
+	logger *zap.Logger
+	dir    string
+
+	mu       sync.Mutex
+	index    *Index
+	loadedAt time.Time
+}
+
+// NewIndexStore creates an IndexStore for the configured mirror directory.
+func NewIndexStore(params IndexStoreParams) *IndexStore {
+	return &IndexStore{
+		logger: params.Logger,
+		dir:    params.Config.GetString("repos.mirror-dir"),
+	}
+}
+
+// Index returns the current index, loading it from disk if it changed since the last call.
+func (s *IndexStore) Index() *Index {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stamp := time.Time{}
+	if info, err := os.Stat(filepath.Join(s.dir, stampFileName)); err == nil {
+		stamp = info.ModTime()
+	}
+
+	if s.index != nil && !stamp.After(s.loadedAt) {
+		return s.index
+	}
+
+	index, err := LoadIndex(s.dir)
+	if err != nil {
+		s.logger.Warn("Some repository indexes could not be loaded", zap.Error(err))
+	}
+	if index == nil {
+		index = &Index{repos: map[string]*RepoIndex{}}
+	}
+
+	s.index = index
+	s.loadedAt = stamp
+	s.logger.Info("Loaded repository indexes",
+		zap.String("dir", s.dir),
+		zap.Int("repos", index.Len()),
+	)
+	return s.index
+}
+
+// Module exports the repos module.
+var Module = fx.Options(
+	fx.Provide(NewIndexStore),
+)
@@ -0,0 +1,245 @@
+package repos
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"packagelock/structs"
+	"packagelock/versions"
+)
+
+var (
+	debianMain = structs.Package_Repo{
+		Type: "deb", URL: "http://deb.debian.org/debian", Suite: "bookworm", Components: []string{"main", "contrib"}, Enabled: true,
+	}
+	debianSecurity = structs.Package_Repo{
+		Type: "deb", URL: "http://security.debian.org/debian-security", Suite: "bookworm-security",
+		Components: []string{"main"}, Enabled: true,
+	}
+)
+
+// testIndex builds an index from the entries offered by each mirror key.
+func testIndex(mirrors map[string][]IndexEntry) *Index {
+	index := &Index{repos: map[string]*RepoIndex{}}
+	for key, entries := range mirrors {
+		repoIndex := &RepoIndex{Mirror: Mirror{Key: key}, Packages: map[string][]IndexEntry{}}
+		for _, entry := range entries {
+			repoIndex.Packages[entry.Name] = append(repoIndex.Packages[entry.Name], entry)
+		}
+		index.repos[key] = repoIndex
+	}
+	return index
+}
+
+// debKey is the mirror key of an amd64 apt component.
+func debKey(repo structs.Package_Repo, component string) string {
+	return MirrorKey(repo, component, "amd64")
+}
+
+func TestRepoArch(t *testing.T) {
+	cases := []struct{ repoType, hostArch, want string }{
+		{"deb", "x86_64", "amd64"},
+		{"deb", "AARCH64", "arm64"},
+		{"deb", "i686", "i386"},
+		{"deb", "amd64", "amd64"},
+		{"rpm", "amd64", "x86_64"},
+		{"rpm", "x86_64", "x86_64"},
+		{"apk", "arm64", "aarch64"},
+		{"pacman", "x86_64", "x86_64"},
+	}
+	for _, tc := range cases {
+		if got := RepoArch(tc.repoType, tc.hostArch); got != tc.want {
+			t.Errorf("RepoArch(%q, %q) = %q, want %q", tc.repoType, tc.hostArch, got, tc.want)
+		}
+	}
+}
+
+func TestMirrors(t *testing.T) {
+	mirrors := Mirrors(debianMain, "x86_64")
+	if len(mirrors) != 2 || mirrors[0].Component != "main" || mirrors[1].Component != "contrib" || mirrors[0].Arch != "amd64" {
+		t.Errorf("Mirrors(deb) = %+v, want main and contrib for amd64", mirrors)
+	}
+	if mirrors[0].Key != MirrorKey(debianMain, "main", "amd64") || mirrors[0].Key == mirrors[1].Key {
+		t.Errorf("Mirrors(deb) keys = %q, %q", mirrors[0].Key, mirrors[1].Key)
+	}
+
+	flat := structs.Package_Repo{Type: "deb", URL: "http://mirror.internal/debian", Suite: "./", Enabled: true}
+	if mirrors := Mirrors(flat, "x86_64"); len(mirrors) != 1 || mirrors[0].Component != "" {
+		t.Errorf("Mirrors(flat deb) = %+v, want one without component", mirrors)
+	}
+
+	disabled := debianMain
+	disabled.Enabled = false
+	for _, repo := range []structs.Package_Repo{
+		disabled,
+		{Type: "deb-src", URL: "http://deb.debian.org/debian", Suite: "bookworm", Enabled: true},
+		{Type: "pacman", URL: "https://geo.mirror.pkgbuild.com/core/os/$arch", Suite: "core", Enabled: true},
+		{Type: "rpm", Enabled: true},
+	} {
+		if mirrors := Mirrors(repo, "x86_64"); len(mirrors) != 0 {
+			t.Errorf("Mirrors(%+v) = %+v, want none", repo, mirrors)
+		}
+	}
+}
+
+func TestArchMatches(t *testing.T) {
+	cases := []struct {
+		entryArch, pkgArch string
+		want               bool
+	}{
+		{"amd64", "amd64", true},
+		{"arm64", "amd64", false},
+		{"all", "amd64", true},
+		{"noarch", "x86_64", true},
+		{"x86_64", "noarch", false},
+		{"", "amd64", true},
+		{"i386", "", true},
+	}
+	for _, tc := range cases {
+		if got := archMatches(tc.entryArch, tc.pkgArch); got != tc.want {
+			t.Errorf("archMatches(%q, %q) = %t, want %t", tc.entryArch, tc.pkgArch, got, tc.want)
+		}
+	}
+}
+
+func TestCandidate(t *testing.T) {
+	index := testIndex(map[string][]IndexEntry{
+		debKey(debianMain, "main"): {
+			{Name: "openssl", Version: "3.0.11-1~deb12u2", Arch: "amd64"},
+			{Name: "openssl", Version: "3.0.15-1~deb12u1", Arch: "arm64"},
+			{Name: "ca-certificates", Version: "20230311", Arch: "all"},
+		},
+		debKey(debianSecurity, "main"): {
+			{Name: "openssl", Version: "3.0.13-1~deb12u1", Arch: "amd64"},
+		},
+		// Mirrored for another host, not configured on this one
+		debKey(structs.Package_Repo{Type: "deb", URL: "http://deb.debian.org/debian", Suite: "trixie", Enabled: true}, "main"): {
+			{Name: "openssl", Version: "3.3.2-1", Arch: "amd64"},
+		},
+	})
+	hostRepos := []structs.Package_Repo{debianMain, debianSecurity}
+
+	cases := []struct {
+		name, arch string
+		want       string
+		found      bool
+	}{
+		{"openssl", "amd64", "3.0.13-1~deb12u1", true}, // newest over all repos of the host, not of arm64
+		{"openssl", "arm64", "3.0.15-1~deb12u1", true},
+		{"ca-certificates", "amd64", "20230311", true}, // 'all' serves every architecture
+		{"libssl3", "amd64", "", false},
+	}
+	for _, tc := range cases {
+		got, found := index.Candidate(versions.Dpkg, hostRepos, "x86_64", tc.name, tc.arch)
+		if got != tc.want || found != tc.found {
+			t.Errorf("Candidate(%q, %q) = %q, %t, want %q, %t", tc.name, tc.arch, got, found, tc.want, tc.found)
+		}
+	}
+
+	// Only the amd64 indexes are mirrored, an arm64 host has no candidates
+	if got, found := index.Candidate(versions.Dpkg, hostRepos, "aarch64", "openssl", "arm64"); found {
+		t.Errorf("Candidate on an arm64 host = %q, want none", got)
+	}
+}
+
+func TestCandidateNoarch(t *testing.T) {
+	baseos := structs.Package_Repo{Type: "rpm", Name: "baseos", URL: "http://dl.rockylinux.org/9/BaseOS/x86_64/os/", Enabled: true}
+	index := testIndex(map[string][]IndexEntry{
+		MirrorKey(baseos, "", "x86_64"): {
+			{Name: "tzdata", Version: "2024a-1.el9", Arch: "noarch"},
+			{Name: "tzdata", Version: "2024b-2.el9", Arch: "noarch"},
+			{Name: "glibc", Version: "2.34-100.el9", Arch: "x86_64"},
+			{Name: "glibc", Version: "2.34-125.el9", Arch: "i686"},
+		},
+	})
+
+	repos := []structs.Package_Repo{baseos}
+	if got, _ := index.Candidate(versions.RPM, repos, "amd64", "tzdata", "noarch"); got != "2024b-2.el9" {
+		t.Errorf("Candidate(tzdata) = %q, want 2024b-2.el9", got)
+	}
+	if got, _ := index.Candidate(versions.RPM, repos, "amd64", "glibc", "x86_64"); got != "2.34-100.el9" {
+		t.Errorf("Candidate(glibc) = %q, want 2.34-100.el9", got)
+	}
+}
+
+func TestUpdatePackages(t *testing.T) {
+	index := testIndex(map[string][]IndexEntry{
+		debKey(debianMain, "main"): {
+			{Name: "openssl", Version: "3.0.13-1~deb12u1", Arch: "amd64"},
+			{Name: "bash", Version: "5.2.15-2+b7", Arch: "amd64"},
+		},
+	})
+	host := structs.Host{
+		Arch:           "x86_64",
+		PackageManager: structs.Package_Manager{PackageRepos: []structs.Package_Repo{debianMain}},
+	}
+	packages := []structs.Package{
+		{PackageName: "openssl", PackageVersion: "3.0.11-1~deb12u2", Arch: "amd64"},
+		{PackageName: "bash", PackageVersion: "5.2.15-2+b7", Arch: "amd64"},
+		{PackageName: "local-tool", PackageVersion: "1.0", Arch: "amd64", CandidateVersion: "2.0", Updatable: true},
+	}
+
+	index.UpdatePackages(host, packages)
+	want := []struct {
+		candidate string
+		updatable bool
+	}{
+		{"3.0.13-1~deb12u1", true},
+		{"5.2.15-2+b7", false},
+		{"", false},
+	}
+	for idx, pkg := range packages {
+		if pkg.CandidateVersion != want[idx].candidate || pkg.Updatable != want[idx].updatable {
+			t.Errorf("%s: candidate %q, updatable %t, want %q, %t",
+				pkg.PackageName, pkg.CandidateVersion, pkg.Updatable, want[idx].candidate, want[idx].updatable)
+		}
+	}
+}
+
+func TestLoadIndex(t *testing.T) {
+	dir := t.TempDir()
+	mirror := Mirrors(debianMain, "x86_64")[0]
+	writeMirror(t, dir, mirror, "Packages", fixture(t, "Packages"))
+
+	broken := Mirror{Key: "broken", Repo: structs.Package_Repo{Type: "pacman"}}
+	writeMirror(t, dir, broken, "", nil)
+
+	index, err := LoadIndex(dir)
+	if err == nil {
+		t.Errorf("LoadIndex with an unsupported mirror succeeded, want error")
+	}
+	if index.Len() != 1 {
+		t.Fatalf("LoadIndex loaded %d mirrors, want 1", index.Len())
+	}
+	if got, _ := index.Candidate(versions.Dpkg, []structs.Package_Repo{debianMain}, "x86_64", "libssl3", "amd64"); got != "3.0.13-1~deb12u1" {
+		t.Errorf("Candidate(libssl3) = %q, want 3.0.13-1~deb12u1", got)
+	}
+
+	missing, err := LoadIndex(filepath.Join(dir, "missing"))
+	if err != nil || missing.Len() != 0 {
+		t.Errorf("LoadIndex of a missing dir = %d mirrors, %v, want an empty index", missing.Len(), err)
+	}
+}
+
+// writeMirror stores a mirror with an index file the way the sync does.
+func writeMirror(t *testing.T, dir string, mirror Mirror, indexName string, content []byte) {
+	t.Helper()
+	mirrorDir := filepath.Join(dir, mirror.Key)
+	if err := os.MkdirAll(mirrorDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	meta, err := json.Marshal(mirror)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(mirrorDir, metaFileName), meta, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if indexName != "" {
+		if err := os.WriteFile(filepath.Join(mirrorDir, indexName), content, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
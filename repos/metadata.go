@@ -0,0 +1,271 @@
+package repos
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ParseDebianPackages parses a Debian 'Packages' index.
+func ParseDebianPackages(r io.Reader) ([]IndexEntry, error) {
+	content, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	stanzas, err := parseDeb822(content)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []IndexEntry
+	for _, stanza := range stanzas {
+		if stanza["package"] == "" || stanza["version"] == "" {
+			continue
+		}
+		entries = append(entries, IndexEntry{
+			Name:    stanza["package"],
+			Version: stanza["version"],
+			Arch:    stanza["architecture"],
+		})
+	}
+	return entries, nil
+}
+
+// DebianRelease is the part of a Debian 'Release' file needed to verify the indexes.
+type DebianRelease struct {
+	Suite    string
+	Codename string
+	SHA256   map[string]string // path relative to the Release file -> checksum
+}
+
+// ParseDebianRelease parses a Debian 'Release' or 'InRelease' file.
+func ParseDebianRelease(r io.Reader) (*DebianRelease, error) {
+	content, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	// InRelease files are clearsigned, only the signed part is of interest
+	text := string(content)
+	if strings.HasPrefix(text, "-----BEGIN PGP SIGNED MESSAGE-----") {
+		if _, after, found := strings.Cut(text, "\n\n"); found {
+			text = after
+		}
+		if before, _, found := strings.Cut(text, "-----BEGIN PGP SIGNATURE-----"); found {
+			text = before
+		}
+	}
+
+	stanzas, err := parseDeb822([]byte(text))
+	if err != nil {
+		return nil, err
+	}
+	if len(stanzas) == 0 {
+		return nil, errors.New("empty Release file")
+	}
+
+	release := &DebianRelease{
+		Suite:    stanzas[0]["suite"],
+		Codename: stanzas[0]["codename"],
+		SHA256:   map[string]string{},
+	}
+
+	// Continuation lines are joined, so the field is a flat list of 'checksum size path'
+	fields := strings.Fields(stanzas[0]["sha256"])
+	for i := 0; i+2 < len(fields); i += 3 {
+		release.SHA256[fields[i+2]] = fields[i]
+	}
+	return release, nil
+}
+
+// Repomd is the part of a 'repodata/repomd.xml' file pointing at the primary metadata.
+type Repomd struct {
+	Data []struct {
+		Type     string `xml:"type,attr"`
+		Checksum struct {
+			Type  string `xml:"type,attr"`
+			Value string `xml:",chardata"`
+		} `xml:"checksum"`
+		Location struct {
+			Href string `xml:"href,attr"`
+		} `xml:"location"`
+	} `xml:"data"`
+}
+
+// Primary returns the location and sha256 checksum of the primary metadata.
+func (r *Repomd) Primary() (href, checksum string, err error) {
+	for _, data := range r.Data {
+		if data.Type != "primary" {
+			continue
+		}
+		if data.Checksum.Type == "sha256" {
+			checksum = strings.TrimSpace(data.Checksum.Value)
+		}
+		return data.Location.Href, checksum, nil
+	}
+	return "", "", errors.New("repomd.xml has no primary metadata")
+}
+
+// ParseRepomd parses an RPM 'repomd.xml' file.
+func ParseRepomd(r io.Reader) (*Repomd, error) {
+	var repomd Repomd
+	if err := xml.NewDecoder(r).Decode(&repomd); err != nil {
+		return nil, err
+	}
+	return &repomd, nil
+}
+
+// ParsePrimaryXML parses the RPM 'primary.xml' metadata.
+// Versions are returned as '[epoch:]version-release'.
+func ParsePrimaryXML(r io.Reader) ([]IndexEntry, error) {
+	type rpmPackage struct {
+		Name    string `xml:"name"`
+		Arch    string `xml:"arch"`
+		Version struct {
+			Epoch string `xml:"epoch,attr"`
+			Ver   string `xml:"ver,attr"`
+			Rel   string `xml:"rel,attr"`
+		} `xml:"version"`
+	}
+
+	var entries []IndexEntry
+	decoder := xml.NewDecoder(r)
+	for {
+		token, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		start, ok := token.(xml.StartElement)
+		if !ok || start.Name.Local != "package" {
+			continue
+		}
+
+		// Decoding package by package keeps memory usage low for large repositories
+		var pkg rpmPackage
+		if err := decoder.DecodeElement(&pkg, &start); err != nil {
+			return nil, err
+		}
+		if pkg.Arch == "src" {
+			continue
+		}
+
+		version := pkg.Version.Ver
+		if pkg.Version.Rel != "" {
+			version += "-" + pkg.Version.Rel
+		}
+		if pkg.Version.Epoch != "" && pkg.Version.Epoch != "0" {
+			version = pkg.Version.Epoch + ":" + version
+		}
+
+		entries = append(entries, IndexEntry{Name: pkg.Name, Version: version, Arch: pkg.Arch})
+	}
+	return entries, nil
+}
+
+// ParseAPKIndexArchive parses an Alpine 'APKINDEX.tar.gz'.
+// The archive is made of concatenated gzip streams (signature and index),
+// which gzip.Reader handles transparently.
+func ParseAPKIndexArchive(r io.Reader) ([]IndexEntry, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+
+	archive := tar.NewReader(gz)
+	for {
+		header, err := archive.Next()
+		if errors.Is(err, io.EOF) {
+			return nil, errors.New("archive does not contain an APKINDEX")
+		}
+		if err != nil {
+			return nil, err
+		}
+		if header.Name == "APKINDEX" {
+			return ParseAPKIndex(archive)
+		}
+	}
+}
+
+// ParseAPKIndex parses the uncompressed 'APKINDEX' file.
+func ParseAPKIndex(r io.Reader) ([]IndexEntry, error) {
+	var entries []IndexEntry
+	var current IndexEntry
+
+	flush := func() {
+		if current.Name != "" && current.Version != "" {
+			entries = append(entries, current)
+		}
+		current = IndexEntry{}
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			flush()
+			continue
+		}
+		key, value, found := strings.Cut(line, ":")
+		if !found {
+			continue
+		}
+		switch key {
+		case "P":
+			current.Name = value
+		case "V":
+			current.Version = value
+		case "A":
+			current.Arch = value
+		}
+	}
+	flush()
+
+	return entries, scanner.Err()
+}
+
+// readIndexFile parses the first of the given files which exists in dir.
+// Plain '.gz' files are decompressed before they are handed to the parser.
+func readIndexFile(dir string, parse func(io.Reader) ([]IndexEntry, error), names ...string) ([]IndexEntry, error) {
+	for _, name := range names {
+		file, err := os.Open(filepath.Join(dir, name))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+
+		var reader io.Reader = file
+		if strings.HasSuffix(name, ".gz") && !strings.HasSuffix(name, ".tar.gz") {
+			gz, err := gzip.NewReader(file)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", name, err)
+			}
+			defer gz.Close()
+			reader = gz
+		}
+
+		entries, err := parse(reader)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		return entries, nil
+	}
+	return nil, fmt.Errorf("none of %v found", names)
+}
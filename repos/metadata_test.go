@@ -0,0 +1,151 @@
+package repos
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"reflect"
+	"testing"
+)
+
+func TestParseDebianPackages(t *testing.T) {
+	entries, err := ParseDebianPackages(bytes.NewReader(fixture(t, "Packages")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []IndexEntry{
+		{Name: "openssl", Version: "3.0.13-1~deb12u1", Arch: "amd64"},
+		{Name: "libssl3", Version: "3.0.13-1~deb12u1", Arch: "amd64"},
+		{Name: "ca-certificates", Version: "20230311", Arch: "all"},
+	}
+	if !reflect.DeepEqual(entries, want) {
+		t.Errorf("ParseDebianPackages = %+v, want %+v", entries, want)
+	}
+}
+
+func TestParseDebianRelease(t *testing.T) {
+	release, err := ParseDebianRelease(bytes.NewReader(fixture(t, "InRelease")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &DebianRelease{
+		Suite:    "stable",
+		Codename: "bookworm",
+		SHA256: map[string]string{
+			"main/binary-amd64/Packages":    "7cd9b1d3a2a3a8b9c0e1f2a3b4c5d6e7f8091a2b3c4d5e6f708192a3b4c5d6e7",
+			"main/binary-amd64/Packages.gz": "0f1e2d3c4b5a69788796a5b4c3d2e1f00f1e2d3c4b5a69788796a5b4c3d2e1f0",
+		},
+	}
+	if !reflect.DeepEqual(release, want) {
+		t.Errorf("ParseDebianRelease = %+v, want %+v", release, want)
+	}
+
+	if _, err := ParseDebianRelease(bytes.NewReader([]byte("# nothing\n\n"))); err == nil {
+		t.Errorf("empty Release file succeeded, want error")
+	}
+}
+
+func TestParseRepomd(t *testing.T) {
+	repomd, err := ParseRepomd(bytes.NewReader(fixture(t, "repomd.xml")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	href, checksum, err := repomd.Primary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if href != "repodata/2222-primary.xml.gz" || checksum != "2222222222222222222222222222222222222222222222222222222222222222" {
+		t.Errorf("Primary() = %q, %q", href, checksum)
+	}
+
+	if _, _, err := (&Repomd{}).Primary(); err == nil {
+		t.Errorf("Primary() without primary data succeeded, want error")
+	}
+}
+
+func TestParsePrimaryXML(t *testing.T) {
+	entries, err := ParsePrimaryXML(bytes.NewReader(fixture(t, "primary.xml")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []IndexEntry{
+		{Name: "openssl", Version: "1:3.0.7-27.el9", Arch: "x86_64"},
+		{Name: "tzdata", Version: "2024a-1.el9", Arch: "noarch"},
+		{Name: "bash", Version: "5.1.8", Arch: "x86_64"},
+	}
+	if !reflect.DeepEqual(entries, want) {
+		t.Errorf("ParsePrimaryXML = %+v, want %+v", entries, want)
+	}
+
+	if _, err := ParsePrimaryXML(bytes.NewReader([]byte("<metadata><package><name>x</name>"))); err == nil {
+		t.Errorf("truncated primary.xml succeeded, want error")
+	}
+}
+
+var apkIndexEntries = []IndexEntry{
+	{Name: "musl", Version: "1.2.5-r0", Arch: "x86_64"},
+	{Name: "alpine-baselayout-data", Version: "3.6.5-r0", Arch: "noarch"},
+}
+
+func TestParseAPKIndex(t *testing.T) {
+	entries, err := ParseAPKIndex(bytes.NewReader(fixture(t, "APKINDEX")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(entries, apkIndexEntries) {
+		t.Errorf("ParseAPKIndex = %+v, want %+v", entries, apkIndexEntries)
+	}
+}
+
+func TestParseAPKIndexArchive(t *testing.T) {
+	// APKINDEX.tar.gz is the signature followed by the index as separate gzip streams,
+	// the signature archive is cut before its end-of-archive marker
+	var archive bytes.Buffer
+	writeTarGz(t, &archive, true, tarFile{".SIGN.RSA.alpine-devel.rsa.pub", []byte("signature")})
+	writeTarGz(t, &archive, false, tarFile{"DESCRIPTION", []byte("v3.20")}, tarFile{"APKINDEX", fixture(t, "APKINDEX")})
+
+	entries, err := ParseAPKIndexArchive(&archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(entries, apkIndexEntries) {
+		t.Errorf("ParseAPKIndexArchive = %+v, want %+v", entries, apkIndexEntries)
+	}
+
+	var empty bytes.Buffer
+	writeTarGz(t, &empty, false, tarFile{"DESCRIPTION", []byte("v3.20")})
+	if _, err := ParseAPKIndexArchive(&empty); err == nil {
+		t.Errorf("archive without APKINDEX succeeded, want error")
+	}
+}
+
+type tarFile struct {
+	name    string
+	content []byte
+}
+
+// writeTarGz appends a gzip compressed tar to buf. A cut archive lacks the end-of-archive marker.
+func writeTarGz(t *testing.T, buf *bytes.Buffer, cut bool, files ...tarFile) {
+	t.Helper()
+	gz := gzip.NewWriter(buf)
+	archive := tar.NewWriter(gz)
+	for _, file := range files {
+		header := &tar.Header{Name: file.name, Mode: 0o644, Size: int64(len(file.content))}
+		if err := archive.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := archive.Write(file.content); err != nil {
+			t.Fatal(err)
+		}
+	}
+	finish := archive.Close
+	if cut {
+		finish = archive.Flush
+	}
+	if err := finish(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
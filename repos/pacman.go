@@ -0,0 +1,134 @@
+package repos
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"packagelock/structs"
+)
+
+var (
+	pacmanDisabledSection = regexp.MustCompile(`^#\s*\[([^\]]+)\]\s*$`)
+	pacmanDisabledKey     = regexp.MustCompile(`^#\s*(Server|Include|SigLevel)\s*=`)
+)
+
+// ParsePacmanConf parses pacman.conf. Every section except [options] is one repository.
+// Servers pulled in via 'Include' are resolved through includes, which may be nil.
+// Sections that are commented out (as shipped for the testing repos) are returned as disabled.
+func ParsePacmanConf(content []byte, source string, includes map[string][]byte) ([]structs.Package_Repo, error) {
+	uncommented, disabled := uncommentPacmanSections(content)
+
+	sections, err := parseINI(uncommented)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", source, err)
+	}
+
+	// The global SigLevel applies to every repo which doesn't set its own
+	globalSigLevel := ""
+	for _, section := range sections {
+		if section.name == "options" {
+			globalSigLevel = section.get("siglevel")
+		}
+	}
+
+	var result []structs.Package_Repo
+	for _, section := range sections {
+		if section.name == "options" {
+			continue
+		}
+
+		sigLevel := section.get("siglevel")
+		if sigLevel == "" {
+			sigLevel = globalSigLevel
+		}
+
+		servers := section.values["server"]
+		for _, include := range section.values["include"] {
+			servers = append(servers, pacmanMirrorlistServers(includes[include])...)
+		}
+
+		repo := structs.Package_Repo{
+			Type:     "pacman",
+			Name:     section.name,
+			Suite:    section.name,
+			Enabled:  !disabled[section.name],
+			GPGCheck: !strings.Contains(sigLevel, "Never"),
+			Source:   source,
+		}
+		if len(servers) > 0 {
+			repo.URL = strings.ReplaceAll(servers[0], "$repo", section.name)
+		}
+
+		result = append(result, repo)
+	}
+
+	return result, nil
+}
+
+// uncommentPacmanSections turns commented out repository sections into normal ones,
+// so they can be reported as disabled repositories.
+func uncommentPacmanSections(content []byte) ([]byte, map[string]bool) {
+	disabled := map[string]bool{}
+	var out bytes.Buffer
+	inDisabled := false
+
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		if match := pacmanDisabledSection.FindStringSubmatch(line); match != nil && match[1] != "options" {
+			disabled[match[1]] = true
+			inDisabled = true
+			out.WriteString("[" + match[1] + "]\n")
+			continue
+		}
+		if strings.HasPrefix(line, "[") {
+			inDisabled = false
+		}
+		if inDisabled && pacmanDisabledKey.MatchString(line) {
+			line = strings.TrimSpace(strings.TrimLeft(line, "#"))
+		}
+
+		out.WriteString(line + "\n")
+	}
+
+	return out.Bytes(), disabled
+}
+
+// pacmanIncludes returns all files included from pacman.conf.
+func pacmanIncludes(content []byte) []string {
+	uncommented, _ := uncommentPacmanSections(content)
+	sections, err := parseINI(uncommented)
+	if err != nil {
+		return nil
+	}
+
+	seen := map[string]bool{}
+	var result []string
+	for _, section := range sections {
+		for _, include := range section.values["include"] {
+			if !seen[include] {
+				seen[include] = true
+				result = append(result, include)
+			}
+		}
+	}
+	return result
+}
+
+// pacmanMirrorlistServers returns the active 'Server' entries of a mirrorlist.
+func pacmanMirrorlistServers(content []byte) []string {
+	var servers []string
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		key, value, found := strings.Cut(line, "=")
+		if found && strings.TrimSpace(key) == "Server" {
+			servers = append(servers, strings.TrimSpace(value))
+		}
+	}
+	return servers
+}
@@ -0,0 +1,53 @@
+package repos
+
+import (
+	"reflect"
+	"testing"
+
+	"packagelock/structs"
+)
+
+func TestParsePacmanConf(t *testing.T) {
+	const source = PacmanConf
+	includes := map[string][]byte{"/etc/pacman.d/mirrorlist": fixture(t, "mirrorlist")}
+	repos, err := ParsePacmanConf(fixture(t, "pacman.conf"), source, includes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkRepos(t, repos, []structs.Package_Repo{
+		{
+			Type: "pacman", Name: "core-testing", URL: "https://geo.mirror.pkgbuild.com/core-testing/os/$arch",
+			Suite: "core-testing", Enabled: false, GPGCheck: true, Source: source,
+		},
+		{
+			Type: "pacman", Name: "core", URL: "https://geo.mirror.pkgbuild.com/core/os/$arch",
+			Suite: "core", Enabled: true, GPGCheck: true, Source: source,
+		},
+		{
+			Type: "pacman", Name: "extra", URL: "https://geo.mirror.pkgbuild.com/extra/os/$arch",
+			Suite: "extra", Enabled: true, GPGCheck: true, Source: source,
+		},
+		{
+			Type: "pacman", Name: "custom", URL: "https://repo.internal/custom/os/$arch",
+			Suite: "custom", Enabled: true, GPGCheck: false, Source: source,
+		},
+	})
+}
+
+func TestParsePacmanConfMissingInclude(t *testing.T) {
+	repos, err := ParsePacmanConf(fixture(t, "pacman.conf"), PacmanConf, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if repos[1].Name != "core" || repos[1].URL != "" {
+		t.Errorf("core without mirrorlist = %+v, want no URL", repos[1])
+	}
+}
+
+func TestPacmanIncludes(t *testing.T) {
+	got := pacmanIncludes(fixture(t, "pacman.conf"))
+	if want := []string{"/etc/pacman.d/mirrorlist"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("pacmanIncludes = %v, want %v", got, want)
+	}
+}
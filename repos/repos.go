@@ -0,0 +1,160 @@
+// Repos
+//
+// The Repos Package discovers the package repositories configured on a host.
+// It understands apt (one-line and deb822), yum/dnf, apk and pacman
+// configuration and normalizes all of them into structs.Package_Repo records.
+package repos
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"packagelock/structs"
+)
+
+// Well known locations of repository configuration files.
+const (
+	AptSourcesList  = "/etc/apt/sources.list"
+	AptSourcesDir   = "/etc/apt/sources.list.d"
+	YumReposDir     = "/etc/yum.repos.d"
+	ApkRepositories = "/etc/apk/repositories"
+	PacmanConf      = "/etc/pacman.conf"
+)
+
+// ErrUnknownFormat is returned when a file does not match any supported repository format.
+var ErrUnknownFormat = errors.New("unknown repository file format")
+
+// ParseFiles parses a set of repository configuration files keyed by their absolute path.
+// Files referenced by an 'Include' directive (pacman) are looked up in the same map.
+// Unknown files are skipped, so callers may pass in more than they need to.
+func ParseFiles(files map[string][]byte) ([]structs.Package_Repo, error) {
+	// Parse in a stable order so the resulting records don't shuffle between reports
+	paths := make([]string, 0, len(files))
+	for p := range files {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	var result []structs.Package_Repo
+	var errs []error
+	for _, p := range paths {
+		parsed, err := ParseFile(p, files[p], files)
+		if errors.Is(err, ErrUnknownFormat) {
+			continue
+		}
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		result = append(result, parsed...)
+	}
+
+	return result, errors.Join(errs...)
+}
+
+// ParseFile parses a single repository configuration file, choosing the parser by path.
+// includes is used to resolve files referenced from within the file and may be nil.
+func ParseFile(filePath string, content []byte, includes map[string][]byte) ([]structs.Package_Repo, error) {
+	dir, name := path.Split(filepath.ToSlash(filePath))
+	dir = strings.TrimSuffix(dir, "/")
+
+	switch {
+	case filePath == AptSourcesList || (dir == AptSourcesDir && strings.HasSuffix(name, ".list")):
+		return ParseAptSources(content, filePath)
+	case dir == AptSourcesDir && strings.HasSuffix(name, ".sources"):
+		return ParseDeb822Sources(content, filePath)
+	case dir == YumReposDir && strings.HasSuffix(name, ".repo"):
+		return ParseYumRepo(content, filePath)
+	case filePath == ApkRepositories:
+		return ParseApkRepositories(content, filePath)
+	case filePath == PacmanConf:
+		return ParsePacmanConf(content, filePath, includes)
+	default:
+		return nil, ErrUnknownFormat
+	}
+}
+
+// Discover reads all known repository configuration files below root
+// (usually "/") and returns the normalized repositories.
+func Discover(root string) ([]structs.Package_Repo, error) {
+	files, err := CollectFiles(root)
+	if err != nil {
+		return nil, err
+	}
+	return ParseFiles(files)
+}
+
+// CollectFiles reads all known repository configuration files below root.
+// The returned map is keyed by the absolute path on the host, not the path below root,
+// so it can be sent to the server as-is.
+func CollectFiles(root string) (map[string][]byte, error) {
+	files := make(map[string][]byte)
+
+	readFile := func(hostPath string) error {
+		content, err := os.ReadFile(filepath.Join(root, hostPath))
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		files[hostPath] = content
+		return nil
+	}
+
+	readDir := func(hostDir string, suffixes ...string) error {
+		entries, err := os.ReadDir(filepath.Join(root, hostDir))
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			if entry.IsDir() {
+				continue
+			}
+			for _, suffix := range suffixes {
+				if strings.HasSuffix(entry.Name(), suffix) {
+					if err := readFile(path.Join(hostDir, entry.Name())); err != nil {
+						return err
+					}
+					break
+				}
+			}
+		}
+		return nil
+	}
+
+	if err := readFile(AptSourcesList); err != nil {
+		return nil, err
+	}
+	if err := readDir(AptSourcesDir, ".list", ".sources"); err != nil {
+		return nil, err
+	}
+	if err := readDir(YumReposDir, ".repo"); err != nil {
+		return nil, err
+	}
+	if err := readFile(ApkRepositories); err != nil {
+		return nil, err
+	}
+	if err := readFile(PacmanConf); err != nil {
+		return nil, err
+	}
+
+	// pacman.conf usually pulls its servers from a mirrorlist
+	if conf, ok := files[PacmanConf]; ok {
+		for _, include := range pacmanIncludes(conf) {
+			if err := readFile(include); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return files, nil
+}
@@ -0,0 +1,84 @@
+package repos
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"packagelock/structs"
+)
+
+// fixture reads a file of testdata.
+func fixture(t *testing.T, name string) []byte {
+	t.Helper()
+	content, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return content
+}
+
+// checkRepos compares parsed repositories record by record, so a failure points at the record.
+func checkRepos(t *testing.T, got, want []structs.Package_Repo) {
+	t.Helper()
+	for idx := 0; idx < len(got) || idx < len(want); idx++ {
+		switch {
+		case idx >= len(got):
+			t.Errorf("repo %d missing, want %+v", idx, want[idx])
+		case idx >= len(want):
+			t.Errorf("repo %d = %+v, want none", idx, got[idx])
+		case !reflect.DeepEqual(got[idx], want[idx]):
+			t.Errorf("repo %d = %+v\nwant %+v", idx, got[idx], want[idx])
+		}
+	}
+}
+
+func TestParseFiles(t *testing.T) {
+	files := map[string][]byte{
+		AptSourcesList:                    fixture(t, "sources.list"),
+		AptSourcesDir + "/ubuntu.sources": fixture(t, "ubuntu.sources"),
+		YumReposDir + "/rocky.repo":       fixture(t, "rocky.repo"),
+		ApkRepositories:                   fixture(t, "repositories"),
+		PacmanConf:                        fixture(t, "pacman.conf"),
+		"/etc/pacman.d/mirrorlist":        fixture(t, "mirrorlist"),
+		"/etc/apt/sources.list.d/old.bak": []byte("not a repository"),
+	}
+
+	repos, err := ParseFiles(files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	count := map[string]int{}
+	for _, repo := range repos {
+		count[repo.Source]++
+	}
+	want := map[string]int{
+		AptSourcesList:                    5,
+		AptSourcesDir + "/ubuntu.sources": 5,
+		YumReposDir + "/rocky.repo":       3,
+		ApkRepositories:                   5,
+		PacmanConf:                        4,
+	}
+	if !reflect.DeepEqual(count, want) {
+		t.Errorf("repos per file = %v, want %v", count, want)
+	}
+
+	// A broken file doesn't hide the others
+	files[AptSourcesList] = []byte("deb http://deb.debian.org/debian\n")
+	repos, err = ParseFiles(files)
+	if err == nil {
+		t.Errorf("ParseFiles with a broken file succeeded, want error")
+	}
+	if len(repos) != 17 {
+		t.Errorf("ParseFiles with a broken file returned %d repos, want 17", len(repos))
+	}
+}
+
+func TestParseFileUnknownFormat(t *testing.T) {
+	for _, path := range []string{"/etc/apt/sources.list.d/old.bak", "/etc/yum.repos.d/sub/x.repo", "/etc/hosts"} {
+		if _, err := ParseFile(path, nil, nil); err != ErrUnknownFormat {
+			t.Errorf("ParseFile(%q) error = %v, want ErrUnknownFormat", path, err)
+		}
+	}
+}
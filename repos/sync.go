@@ -0,0 +1,283 @@
+package repos
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Syncer downloads repository indexes into the mirror directory.
+type Syncer struct {
+	Dir    string
+	Client *http.Client
+	Logger *zap.Logger
+}
+
+// NewSyncer creates a Syncer for the given mirror directory.
+func NewSyncer(dir string, timeout time.Duration, logger *zap.Logger) *Syncer {
+	return &Syncer{
+		Dir:    dir,
+		Client: &http.Client{Timeout: timeout},
+		Logger: logger,
+	}
+}
+
+// Sync downloads the indexes of all given mirrors. Mirrors which fail are logged
+// and reported in the returned error, the remaining ones are still synced.
+// Afterwards the stamp file is touched, so running servers reload the index.
+func (s *Syncer) Sync(ctx context.Context, mirrors []Mirror) error {
+	if err := os.MkdirAll(s.Dir, 0o755); err != nil {
+		return err
+	}
+
+	var errs []error
+	synced := 0
+	for _, mirror := range mirrors {
+		if err := s.syncMirror(ctx, mirror); err != nil {
+			s.Logger.Warn("Failed to sync repository",
+				zap.String("url", mirror.Repo.URL),
+				zap.String("suite", mirror.Repo.Suite),
+				zap.String("component", mirror.Component),
+				zap.Error(err),
+			)
+			errs = append(errs, fmt.Errorf("%s %s %s: %w", mirror.Repo.URL, mirror.Repo.Suite, mirror.Component, err))
+			continue
+		}
+		synced++
+		s.Logger.Info("Synced repository",
+			zap.String("url", mirror.Repo.URL),
+			zap.String("suite", mirror.Repo.Suite),
+			zap.String("component", mirror.Component),
+		)
+	}
+
+	if synced > 0 {
+		stamp := filepath.Join(s.Dir, stampFileName)
+		if err := os.WriteFile(stamp, []byte(time.Now().Format(time.RFC3339)), 0o644); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (s *Syncer) syncMirror(ctx context.Context, mirror Mirror) error {
+	dir := filepath.Join(s.Dir, mirror.Key)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+
+	var err error
+	switch mirror.Repo.Type {
+	case "deb":
+		err = s.syncDebian(ctx, mirror, dir)
+	case "rpm":
+		err = s.syncRPM(ctx, mirror, dir)
+	case "apk":
+		err = s.syncAPK(ctx, mirror, dir)
+	default:
+		err = fmt.Errorf("unsupported repository type %q", mirror.Repo.Type)
+	}
+	if err != nil {
+		return err
+	}
+
+	mirror.SyncTime = time.Now()
+	meta, err := json.MarshalIndent(mirror, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(dir, metaFileName), meta)
+}
+
+func (s *Syncer) syncDebian(ctx context.Context, mirror Mirror, dir string) error {
+	base := strings.TrimSuffix(mirror.Repo.URL, "/")
+
+	// Flat repositories ('deb http://host/path ./') keep their index next to the suite
+	if strings.HasSuffix(mirror.Repo.Suite, "/") {
+		flat := base + "/" + strings.TrimPrefix(mirror.Repo.Suite, "./")
+		data, err := s.fetch(ctx, flat+"Packages.gz")
+		if err != nil {
+			return err
+		}
+		return writeFileAtomic(filepath.Join(dir, "Packages.gz"), data)
+	}
+
+	distBase := base + "/dists/" + mirror.Repo.Suite
+	releaseData, err := s.fetch(ctx, distBase+"/Release")
+	if err != nil {
+		return err
+	}
+	release, err := ParseDebianRelease(bytes.NewReader(releaseData))
+	if err != nil {
+		return fmt.Errorf("Release: %w", err)
+	}
+
+	indexPath := path.Join(mirror.Component, "binary-"+mirror.Arch, "Packages.gz")
+	data, err := s.fetch(ctx, distBase+"/"+indexPath)
+	if err != nil {
+		return err
+	}
+	if err := verifySHA256(data, release.SHA256[indexPath]); err != nil {
+		return fmt.Errorf("%s: %w", indexPath, err)
+	}
+
+	if err := writeFileAtomic(filepath.Join(dir, "Release"), releaseData); err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(dir, "Packages.gz"), data)
+}
+
+func (s *Syncer) syncRPM(ctx context.Context, mirror Mirror, dir string) error {
+	base, err := s.resolveRPMBaseURL(ctx, mirror)
+	if err != nil {
+		return err
+	}
+
+	repomdData, err := s.fetch(ctx, base+"/repodata/repomd.xml")
+	if err != nil {
+		return err
+	}
+	repomd, err := ParseRepomd(bytes.NewReader(repomdData))
+	if err != nil {
+		return fmt.Errorf("repomd.xml: %w", err)
+	}
+	href, checksum, err := repomd.Primary()
+	if err != nil {
+		return err
+	}
+
+	data, err := s.fetch(ctx, base+"/"+href)
+	if err != nil {
+		return err
+	}
+	if err := verifySHA256(data, checksum); err != nil {
+		return fmt.Errorf("%s: %w", href, err)
+	}
+
+	name := "primary.xml"
+	if strings.HasSuffix(href, ".gz") {
+		name += ".gz"
+	} else if !strings.HasSuffix(href, ".xml") {
+		return fmt.Errorf("unsupported primary metadata compression: %s", href)
+	}
+
+	if err := writeFileAtomic(filepath.Join(dir, "repomd.xml"), repomdData); err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(dir, name), data)
+}
+
+// resolveRPMBaseURL returns the base url of an rpm repository,
+// following mirrorlists and metalinks if the repository has no baseurl.
+func (s *Syncer) resolveRPMBaseURL(ctx context.Context, mirror Mirror) (string, error) {
+	url := strings.ReplaceAll(mirror.Repo.URL, "$basearch", mirror.Arch)
+	url = strings.ReplaceAll(url, "$arch", mirror.Arch)
+	if strings.Contains(url, "$") {
+		return "", fmt.Errorf("repository url contains unresolved variables: %s", url)
+	}
+
+	if !strings.Contains(url, "mirrorlist") && !strings.Contains(url, "metalink") {
+		// A plain baseurl, which is used as-is
+		return strings.TrimSuffix(url, "/"), nil
+	}
+
+	data, err := s.fetch(ctx, url)
+	if err != nil {
+		return "", err
+	}
+
+	if bytes.Contains(data, []byte("<metalink")) {
+		var metalink struct {
+			URLs []string `xml:"files>file>resources>url"`
+		}
+		if err := xml.Unmarshal(data, &metalink); err != nil {
+			return "", fmt.Errorf("metalink: %w", err)
+		}
+		for _, candidate := range metalink.URLs {
+			candidate = strings.TrimSpace(candidate)
+			if strings.HasPrefix(candidate, "http") && strings.HasSuffix(candidate, "/repodata/repomd.xml") {
+				return strings.TrimSuffix(candidate, "/repodata/repomd.xml"), nil
+			}
+		}
+		return "", errors.New("metalink contains no usable mirror")
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "http") {
+			return strings.TrimSuffix(line, "/"), nil
+		}
+	}
+	return "", errors.New("mirrorlist contains no usable mirror")
+}
+
+func (s *Syncer) syncAPK(ctx context.Context, mirror Mirror, dir string) error {
+	url := strings.Join([]string{
+		strings.TrimSuffix(mirror.Repo.URL, "/"),
+		mirror.Repo.Suite,
+		mirror.Component,
+		mirror.Arch,
+		"APKINDEX.tar.gz",
+	}, "/")
+
+	data, err := s.fetch(ctx, url)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(dir, "APKINDEX.tar.gz"), data)
+}
+
+func (s *Syncer) fetch(ctx context.Context, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// verifySHA256 checks data against an expected checksum. An empty checksum is not verified.
+func verifySHA256(data []byte, expected string) error {
+	if expected == "" {
+		return nil
+	}
+	sum := sha256.Sum256(data)
+	if actual := hex.EncodeToString(sum[:]); !strings.EqualFold(actual, expected) {
+		return fmt.Errorf("checksum mismatch: expected %s, got %s", expected, actual)
+	}
+	return nil
+}
+
+func writeFileAtomic(name string, data []byte) error {
+	tmp := name + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, name)
+}
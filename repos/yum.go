@@ -0,0 +1,118 @@
+package repos
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strings"
+
+	"packagelock/structs"
+)
+
+// ParseYumRepo parses a yum/dnf .repo file. Every section is one repository.
+func ParseYumRepo(content []byte, source string) ([]structs.Package_Repo, error) {
+	sections, err := parseINI(content)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", source, err)
+	}
+
+	var result []structs.Package_Repo
+	for _, section := range sections {
+		if section.name == "main" {
+			continue
+		}
+
+		repo := structs.Package_Repo{
+			Type:     "rpm",
+			Name:     section.name,
+			Enabled:  yumBool(section.get("enabled"), true),
+			GPGCheck: yumBool(section.get("gpgcheck"), false),
+			Source:   source,
+		}
+
+		// baseurl wins over the mirror lists, as that is what dnf uses as well
+		switch {
+		case section.get("baseurl") != "":
+			repo.URL = strings.Fields(section.get("baseurl"))[0]
+		case section.get("mirrorlist") != "":
+			repo.URL = section.get("mirrorlist")
+		case section.get("metalink") != "":
+			repo.URL = section.get("metalink")
+		}
+
+		result = append(result, repo)
+	}
+
+	return result, nil
+}
+
+func yumBool(value string, fallback bool) bool {
+	switch strings.ToLower(value) {
+	case "1", "yes", "true", "on":
+		return true
+	case "0", "no", "false", "off":
+		return false
+	default:
+		return fallback
+	}
+}
+
+type iniSection struct {
+	name     string
+	disabled bool // the section header was commented out
+	keys     []string
+	values   map[string][]string
+}
+
+func (s *iniSection) get(key string) string {
+	values := s.values[key]
+	if len(values) == 0 {
+		return ""
+	}
+	return strings.Join(values, " ")
+}
+
+func (s *iniSection) add(key, value string) {
+	if _, ok := s.values[key]; !ok {
+		s.keys = append(s.keys, key)
+	}
+	s.values[key] = append(s.values[key], value)
+}
+
+// parseINI parses the INI dialect shared by yum and pacman.
+// Repeated keys and indented continuation lines are kept as multiple values.
+func parseINI(content []byte) ([]*iniSection, error) {
+	var sections []*iniSection
+	var current *iniSection
+	lastKey := ""
+
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		raw := scanner.Text()
+		line := strings.TrimSpace(raw)
+
+		switch {
+		case line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";"):
+			continue
+		case strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]"):
+			current = &iniSection{
+				name:   strings.TrimSpace(line[1 : len(line)-1]),
+				values: map[string][]string{},
+			}
+			sections = append(sections, current)
+			lastKey = ""
+		case current == nil:
+			return nil, fmt.Errorf("line %d: key outside of a section", lineNumber)
+		case (raw[0] == ' ' || raw[0] == '\t') && lastKey != "":
+			current.add(lastKey, line)
+		default:
+			key, value, _ := strings.Cut(line, "=")
+			lastKey = strings.ToLower(strings.TrimSpace(key))
+			current.add(lastKey, strings.TrimSpace(value))
+		}
+	}
+
+	return sections, scanner.Err()
+}
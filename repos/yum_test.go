@@ -0,0 +1,37 @@
+package repos
+
+import (
+	"testing"
+
+	"packagelock/structs"
+)
+
+func TestParseYumRepo(t *testing.T) {
+	const source = YumReposDir + "/rocky.repo"
+	repos, err := ParseYumRepo(fixture(t, "rocky.repo"), source)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkRepos(t, repos, []structs.Package_Repo{
+		{
+			Type: "rpm", Name: "baseos", URL: "https://mirrors.rockylinux.org/mirrorlist?arch=$basearch&repo=BaseOS-$releasever",
+			Enabled: true, GPGCheck: true, Source: source,
+		},
+		{
+			Type: "rpm", Name: "appstream", URL: "http://dl.rockylinux.org/$contentdir/$releasever/AppStream/$basearch/os/",
+			Enabled: true, GPGCheck: true, Source: source,
+		},
+		{
+			Type: "rpm", Name: "epel-testing", URL: "https://mirrors.fedoraproject.org/metalink?repo=testing-epel9&arch=$basearch",
+			Enabled: false, GPGCheck: false, Source: source,
+		},
+	})
+}
+
+func TestParseYumRepoKeyOutsideSection(t *testing.T) {
+	_, err := ParseYumRepo([]byte("# comment\nenabled=1\n[base]\n"), "x.repo")
+	if err == nil || err.Error() != "x.repo: line 2: key outside of a section" {
+		t.Errorf("error = %v", err)
+	}
+}
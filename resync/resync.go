@@ -0,0 +1,215 @@
+// Resync
+//
+// The Resync Package forces agents to refresh and report their inventory now,
+// instead of waiting for their next regular report. Every agent gets a
+// refresh-inventory job, the progress of the sync is derived from those jobs.
+package resync
+
+import (
+	"errors"
+	"packagelock/db"
+	"packagelock/jobs"
+	"packagelock/structs"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/surrealdb/surrealdb.go"
+)
+
+// Status is a sync with the current state of all of its agents.
+type Status struct {
+	structs.Sync_Request
+	Summary Summary
+	Done    bool // all jobs finished or the deadline passed
+}
+
+type Summary struct {
+	Total     int
+	Pending   int // queued, claimed or running
+	Succeeded int
+	Failed    int
+	TimedOut  int
+	Reported  int // agents which uploaded their inventory since the sync started
+}
+
+// Matches reports whether an agent and its host are selected by a filter.
+func Matches(filter structs.Sync_Filter, agent structs.Agent, host *structs.Host) bool {
+	if agent.ArchiveTime != nil || (host != nil && host.ArchiveTime != nil) {
+		return false
+	}
+	if len(filter.AgentIDs) > 0 && !containsID(filter.AgentIDs, agent.AgentID) {
+		return false
+	}
+	if len(filter.HostIDs) > 0 && !containsID(filter.HostIDs, agent.HostID) {
+		return false
+	}
+	if filter.Distro != "" && (host == nil || !strings.EqualFold(host.Distro, filter.Distro)) {
+		return false
+	}
+	if filter.StaleBefore != nil && host != nil && !host.PackageManager.UpdateTime.Before(*filter.StaleBefore) {
+		return false
+	}
+	return true
+}
+
+func containsID(ids []uuid.UUID, id uuid.UUID) bool {
+	for _, candidate := range ids {
+		if candidate == id {
+			return true
+		}
+	}
+	return false
+}
+
+// Start queues a refresh-inventory job for every agent matching the filter and stores the sync.
+// If the sync can't be started completely, the jobs queued so far are cancelled.
+func Start(database *db.Database, queue *jobs.Queue, filter structs.Sync_Filter, timeout time.Duration) (*structs.Sync_Request, error) {
+	agents, err := surrealdb.SmartUnmarshal[[]structs.Agent](database.DB.Select("agents"))
+	if err != nil {
+		return nil, err
+	}
+	hosts, err := surrealdb.SmartUnmarshal[[]structs.Host](database.DB.Select("hosts"))
+	if err != nil {
+		return nil, err
+	}
+
+	hostsByID := make(map[uuid.UUID]*structs.Host, len(hosts))
+	for idx := range hosts {
+		hostsByID[hosts[idx].HostID] = &hosts[idx]
+	}
+
+	now := time.Now()
+	request := structs.Sync_Request{
+		SyncID:       uuid.New(),
+		Filter:       filter,
+		Agents:       []structs.Sync_Agent{},
+		Deadline:     now.Add(timeout),
+		CreationTime: now,
+	}
+
+	for _, agent := range agents {
+		host := hostsByID[agent.HostID]
+		if !Matches(filter, agent, host) {
+			continue
+		}
+
+		// Agents which come back after the deadline don't run a stale refresh anymore
+		job, err := queue.Enqueue(agent, structs.Job{
+			Type:           jobs.TypeRefreshInventory,
+			TimeoutSeconds: int(timeout.Seconds()),
+			NotAfter:       &request.Deadline,
+		})
+		if err != nil {
+			return nil, cancel(queue, request, err)
+		}
+
+		entry := structs.Sync_Agent{
+			AgentID: agent.AgentID,
+			HostID:  agent.HostID,
+			JobID:   job.JobID,
+			State:   job.State,
+		}
+		if host != nil {
+			entry.Hostname = host.Hostname
+		}
+		request.Agents = append(request.Agents, entry)
+	}
+
+	if _, err := database.DB.Query("INSERT INTO syncs $sync", map[string]interface{}{"sync": request}); err != nil {
+		return nil, cancel(queue, request, err)
+	}
+	return &request, nil
+}
+
+// cancel fails the jobs of a sync which could not be started, so agents don't run
+// jobs no sync record refers to.
+func cancel(queue *jobs.Queue, request structs.Sync_Request, cause error) error {
+	errs := []error{cause}
+	now := time.Now()
+	for _, agent := range request.Agents {
+		if err := queue.Cancel(agent.JobID, "sync could not be started", now); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Find returns a sync by its SyncID or nil if there is none.
+func Find(database *db.Database, syncID uuid.UUID) (*structs.Sync_Request, error) {
+	found, err := surrealdb.SmartUnmarshal[[]structs.Sync_Request](database.DB.Query(
+		"SELECT * FROM syncs WHERE SyncID = $syncID LIMIT 1",
+		map[string]interface{}{"syncID": syncID.String()},
+	))
+	if err != nil || len(found) == 0 {
+		return nil, err
+	}
+	return &found[0], nil
+}
+
+// Progress looks up the current job states and inventory reports of a sync.
+func Progress(database *db.Database, queue *jobs.Queue, request structs.Sync_Request, now time.Time) (Status, error) {
+	status := Status{Sync_Request: request}
+	status.Agents = make([]structs.Sync_Agent, len(request.Agents))
+	copy(status.Agents, request.Agents)
+
+	hostIDs := make([]string, 0, len(request.Agents))
+	for _, agent := range request.Agents {
+		hostIDs = append(hostIDs, agent.HostID.String())
+	}
+	hosts, err := surrealdb.SmartUnmarshal[[]structs.Host](database.DB.Query(
+		"SELECT * FROM hosts WHERE HostID IN $hostIDs",
+		map[string]interface{}{"hostIDs": hostIDs},
+	))
+	if err != nil {
+		return status, err
+	}
+	reported := map[uuid.UUID]time.Time{}
+	for _, host := range hosts {
+		if host.PackageManager.UpdateTime.After(request.CreationTime) {
+			reported[host.HostID] = host.PackageManager.UpdateTime
+		}
+	}
+
+	for idx := range status.Agents {
+		agent := &status.Agents[idx]
+
+		job, err := queue.Find(agent.JobID)
+		if err != nil {
+			return status, err
+		}
+		if job != nil {
+			agent.State = job.State
+		}
+		if reportTime, ok := reported[agent.HostID]; ok {
+			agent.ReportTime = &reportTime
+			status.Summary.Reported++
+		}
+
+		status.Summary.Total++
+		switch agent.State {
+		case jobs.StateSucceeded:
+			status.Summary.Succeeded++
+		case jobs.StateFailed:
+			status.Summary.Failed++
+		case jobs.StateTimedOut:
+			status.Summary.TimedOut++
+		default:
+			status.Summary.Pending++
+		}
+	}
+
+	status.Done = status.Summary.Pending == 0 || now.After(request.Deadline)
+	return status, nil
+}
+
+// Missing returns the agents which did not report their inventory.
+func (s Status) Missing() []structs.Sync_Agent {
+	var missing []structs.Sync_Agent
+	for _, agent := range s.Agents {
+		if agent.ReportTime == nil {
+			missing = append(missing, agent)
+		}
+	}
+	return missing
+}
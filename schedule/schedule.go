@@ -0,0 +1,103 @@
+// Schedule
+//
+// The Schedule Package evaluates maintenance windows: cron expressions
+// for the start of every occurrence, a duration and a time zone.
+package schedule
+
+import (
+	"fmt"
+	"time"
+	_ "time/tzdata" // time zones must work in minimal containers as well
+
+	"packagelock/structs"
+
+	"github.com/robfig/cron/v3"
+)
+
+// cronParser accepts standard five field expressions and descriptors like "@weekly".
+var cronParser = cron.NewParser(cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+
+// Occurrence is a single opening of a maintenance window.
+type Occurrence struct {
+	Start time.Time
+	End   time.Time
+}
+
+// Window is a compiled maintenance window.
+type Window struct {
+	schedule cron.Schedule
+	duration time.Duration
+	location *time.Location
+}
+
+// Compile parses the cron expression and time zone of a maintenance window.
+func Compile(window structs.Maintenance_Window) (*Window, error) {
+	if window.DurationMinutes <= 0 {
+		return nil, fmt.Errorf("window duration must be positive")
+	}
+
+	location := time.UTC
+	if window.TimeZone != "" {
+		var err error
+		location, err = time.LoadLocation(window.TimeZone)
+		if err != nil {
+			return nil, fmt.Errorf("invalid time zone %q: %w", window.TimeZone, err)
+		}
+	}
+
+	schedule, err := cronParser.Parse(window.Cron)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cron expression %q: %w", window.Cron, err)
+	}
+
+	return &Window{
+		schedule: schedule,
+		duration: time.Duration(window.DurationMinutes) * time.Minute,
+		location: location,
+	}, nil
+}
+
+// Validate checks the name, cron expression, duration and time zone of a maintenance window.
+func Validate(window structs.Maintenance_Window) error {
+	if window.Name == "" {
+		return fmt.Errorf("window needs a name")
+	}
+	_, err := Compile(window)
+	return err
+}
+
+// Next returns the next n occurrences starting after the given time.
+func (w *Window) Next(after time.Time, n int) []Occurrence {
+	occurrences := make([]Occurrence, 0, n)
+	t := after.In(w.location)
+	for len(occurrences) < n {
+		start := w.schedule.Next(t)
+		if start.IsZero() {
+			// The expression never matches, e.g. "0 0 30 2 *"
+			break
+		}
+		occurrences = append(occurrences, Occurrence{Start: start, End: start.Add(w.duration)})
+		t = start
+	}
+	return occurrences
+}
+
+// Active returns the occurrence open at the given time, if any.
+func (w *Window) Active(now time.Time) (Occurrence, bool) {
+	// Only occurrences starting within one duration before now can still be open
+	var latest time.Time
+	t := now.Add(-w.duration).In(w.location)
+	for {
+		start := w.schedule.Next(t)
+		if start.IsZero() || start.After(now) {
+			break
+		}
+		latest = start
+		t = start
+	}
+
+	if latest.IsZero() || !now.Before(latest.Add(w.duration)) {
+		return Occurrence{}, false
+	}
+	return Occurrence{Start: latest, End: latest.Add(w.duration)}, true
+}
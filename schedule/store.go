@@ -0,0 +1,21 @@
+package schedule
+
+import (
+	"packagelock/db"
+	"packagelock/structs"
+
+	"github.com/google/uuid"
+	"github.com/surrealdb/surrealdb.go"
+)
+
+// FindWindow returns the maintenance window with the given WindowID or nil if there is none.
+func FindWindow(database *db.Database, windowID uuid.UUID) (*structs.Maintenance_Window, error) {
+	found, err := surrealdb.SmartUnmarshal[[]structs.Maintenance_Window](database.DB.Query(
+		"SELECT * FROM maintenance_windows WHERE WindowID = $windowID LIMIT 1",
+		map[string]interface{}{"windowID": windowID.String()},
+	))
+	if err != nil || len(found) == 0 {
+		return nil, err
+	}
+	return &found[0], nil
+}
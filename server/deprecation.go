@@ -0,0 +1,28 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// The base64 query routes were replaced by resource paths like /v1/agents/{AgentID}.
+var (
+	legacyDeprecated = time.Date(2026, time.October, 19, 0, 0, 0, 0, time.UTC)
+	legacySunset     = time.Date(2027, time.April, 30, 0, 0, 0, 0, time.UTC)
+)
+
+// deprecated marks the responses of a route as deprecated (RFC 9745) and announces
+// when it is removed (RFC 8594). successor is the route to use instead, it is only logged
+// because it needs the decoded AgentID.
+func deprecated(params ServerParams, successor string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		c.Set("Deprecation", fmt.Sprintf("@%d", legacyDeprecated.Unix()))
+		c.Set("Sunset", legacySunset.Format(http.TimeFormat))
+
+		params.Logger.Debug("Deprecated route called, use " + successor + " instead")
+		return c.Next()
+	}
+}
@@ -0,0 +1,145 @@
+package server
+
+import (
+	"packagelock/handler"
+	"packagelock/jobs"
+	"packagelock/openapi"
+	"packagelock/resync"
+	"packagelock/schedule"
+	"packagelock/stream"
+	"packagelock/structs"
+	"sync"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/spf13/viper"
+)
+
+// Query parameters shared by the host and agent lists.
+var listQuery = map[string]string{
+	"limit":    "page size, 1 to 1000, defaults to 100",
+	"cursor":   "value of 'X-Next-Cursor' of the previous page",
+	"sort":     "sort key, prefixed with '-' for descending order",
+	"distro":   "only hosts with this distribution",
+	"arch":     "only hosts with this architecture",
+	"status":   "online or offline",
+	"archived": "false, true or all, defaults to false",
+}
+
+// operations documents the routes registered in addRoutes for the OpenAPI document.
+// Routes missing here are still listed, just without summary and body types.
+var operations = map[string]openapi.Operation{
+	"POST /auth/login": {Summary: "Log in and receive a JWT", Request: handler.LoginRequest{}, Response: structs.ApiKey{}},
+
+	"GET /v1/agents/":                {Summary: "Get an agent by its base64 AgentID", Response: structs.Agent{}, Query: map[string]string{"AgentID": "base64url encoded AgentID"}, Deprecated: true},
+	"POST /v1/agents/register":       {Summary: "Register an agent", Request: structs.Agent{}, Response: structs.Agent{}, Status: fiber.StatusCreated},
+	"GET /v1/agents/stream":          {Summary: "Open the WebSocket stream of an agent", Status: fiber.StatusSwitchingProtocols},
+	"GET /v1/agents/:id":             {Summary: "Get an agent", Response: structs.Agent{}},
+	"GET /v1/agents/:id/host":        {Summary: "Get the host of an agent", Response: structs.Host{}},
+	"GET /v1/agents/:id/jobs":        {Summary: "List the jobs of an agent", Response: []structs.Job{}, Query: map[string]string{"state": "only jobs in this state"}},
+	"POST /v1/agents/:id/jobs":       {Summary: "Queue a job for an agent", Request: structs.Job{}, Response: structs.Job{}, Status: fiber.StatusCreated},
+	"GET /v1/agents/:id/jobs/next":   {Summary: "Claim the next job of an agent", Response: structs.Job{}, Query: map[string]string{"wait": "long-poll duration, e.g. 30s"}},
+	"GET /v1/agents/:id/jobs/:jobId": {Summary: "Get a job of an agent", Response: structs.Job{}},
+	"PUT /v1/agents/:id/jobs/:jobId": {Summary: "Report the progress or result of a job", Request: jobs.Report{}, Response: structs.Job{}},
+
+	"GET /v1/general/hosts":           {Summary: "List hosts", Response: []structs.Host{}, Query: listQuery},
+	"GET /v1/general/agents":          {Summary: "List agents", Response: []structs.Agent{}, Query: listQuery},
+	"GET /v1/general/connections":     {Summary: "List the agents connected to the stream", Response: []stream.ConnectionInfo{}},
+	"POST /v1/general/sync":           {Summary: "Sync the inventory of all or the filtered agents", Request: handler.SyncRequest{}, Response: resync.Status{}, Status: fiber.StatusAccepted},
+	"GET /v1/general/sync/:id":        {Summary: "Get the progress of a sync", Response: resync.Status{}},
+	"GET /v1/general/vulnerabilities": {Summary: "List the vulnerabilities of all hosts", Response: []structs.Vulnerability_Finding{}},
+
+	"GET /v1/hosts/":                    {Summary: "Get the host of an agent by its base64 AgentID", Response: structs.Host{}, Query: map[string]string{"AgentID": "base64url encoded AgentID"}, Deprecated: true},
+	"POST /v1/hosts/register":           {Summary: "Register a host", Request: structs.Host{}, Response: structs.Host{}, Status: fiber.StatusCreated},
+	"GET /v1/hosts/:id":                 {Summary: "Get a host", Response: structs.Host{}},
+	"GET /v1/hosts/:id/agents":          {Summary: "List the agents of a host", Response: []structs.Agent{}, Query: map[string]string{"archived": listQuery["archived"]}},
+	"GET /v1/hosts/:id/repos":           {Summary: "List the repositories of a host", Response: []structs.Package_Repo{}},
+	"PUT /v1/hosts/:id/repos":           {Summary: "Report the repositories of a host", Request: handler.ReposReport{}, Response: []structs.Package_Repo{}},
+	"GET /v1/hosts/:id/packages":        {Summary: "List the packages of a host", Response: []structs.Package{}},
+	"PUT /v1/hosts/:id/packages":        {Summary: "Report the package inventory of a host", Request: handler.InventoryReport{}, Response: []structs.Package{}},
+	"GET /v1/hosts/:id/vulnerabilities": {Summary: "List the vulnerabilities of a host", Response: []structs.Vulnerability_Finding{}},
+	"GET /v1/hosts/:id/violations":      {Summary: "List the lock violations of a host", Response: []structs.Lock_Violation{}},
+	"GET /v1/hosts/:id/drift":           {Summary: "List the drift of a host from its baseline", Response: []structs.Drift_Event{}, Query: map[string]string{"all": "include resolved drift"}},
+	"GET /v1/hosts/:id/baseline":        {Summary: "Get the baseline of a host", Response: structs.Baseline{}},
+	"PUT /v1/hosts/:id/baseline":        {Summary: "Assign a system definition, sent as raw body, as baseline", Response: []structs.Drift_Event{}},
+	"DELETE /v1/hosts/:id/baseline":     {Summary: "Delete the baseline of a host", Status: fiber.StatusNoContent},
+	"PUT /v1/hosts/:id/tags":            {Summary: "Replace the tags of a host", Request: map[string]string{}, Response: map[string]string{}},
+	"PATCH /v1/hosts/:id":               {Summary: "Update, archive or restore a host", Request: handler.HostPatch{}, Response: structs.Host{}},
+	"DELETE /v1/hosts/:id":              {Summary: "Archive or purge a host", Status: fiber.StatusNoContent, Query: map[string]string{"purge": "remove the host and its data right away"}},
+
+	"GET /v1/locks/":               {Summary: "List locks", Response: []structs.Lock{}},
+	"POST /v1/locks/":              {Summary: "Create a lock", Request: structs.Lock{}, Response: structs.Lock{}, Status: fiber.StatusCreated},
+	"GET /v1/locks/:id":            {Summary: "Get a lock", Response: structs.Lock{}},
+	"PUT /v1/locks/:id":            {Summary: "Update a lock", Request: structs.Lock{}, Response: structs.Lock{}},
+	"DELETE /v1/locks/:id":         {Summary: "Delete a lock", Status: fiber.StatusNoContent},
+	"GET /v1/locks/:id/violations": {Summary: "List the violations of a lock", Response: []structs.Lock_Violation{}},
+
+	"GET /v1/groups/":          {Summary: "List host groups", Response: []structs.Host_Group{}},
+	"POST /v1/groups/":         {Summary: "Create a host group", Request: structs.Host_Group{}, Response: structs.Host_Group{}, Status: fiber.StatusCreated},
+	"POST /v1/groups/preview":  {Summary: "List the hosts a rule matches", Request: struct{ Rule string }{}, Response: []structs.Host{}},
+	"GET /v1/groups/:id":       {Summary: "Get a host group", Response: structs.Host_Group{}},
+	"PUT /v1/groups/:id":       {Summary: "Update a host group", Request: structs.Host_Group{}, Response: structs.Host_Group{}},
+	"DELETE /v1/groups/:id":    {Summary: "Delete a host group", Status: fiber.StatusNoContent},
+	"GET /v1/groups/:id/hosts": {Summary: "List the members of a host group", Response: []structs.Host{}},
+
+	"GET /v1/windows/":       {Summary: "List maintenance windows", Response: []structs.Maintenance_Window{}},
+	"POST /v1/windows/":      {Summary: "Create a maintenance window", Request: structs.Maintenance_Window{}, Response: structs.Maintenance_Window{}, Status: fiber.StatusCreated},
+	"GET /v1/windows/:id":    {Summary: "Get a maintenance window", Response: structs.Maintenance_Window{}},
+	"PUT /v1/windows/:id":    {Summary: "Update a maintenance window", Request: structs.Maintenance_Window{}, Response: structs.Maintenance_Window{}},
+	"DELETE /v1/windows/:id": {Summary: "Delete a maintenance window", Status: fiber.StatusNoContent},
+	"GET /v1/windows/:id/preview": {Summary: "List the next occurrences of a maintenance window", Response: struct {
+		WindowID    uuid.UUID
+		TimeZone    string
+		Occurrences []schedule.Occurrence
+	}{}, Query: map[string]string{"n": "number of occurrences, defaults to 5", "from": "RFC 3339 start time, defaults to now"}},
+
+	"GET /v1/campaigns/":            {Summary: "List campaigns", Response: []structs.Campaign{}},
+	"POST /v1/campaigns/":           {Summary: "Create a campaign", Request: structs.Campaign{}, Response: structs.Campaign{}, Status: fiber.StatusCreated},
+	"GET /v1/campaigns/:id":         {Summary: "Get a campaign", Response: structs.Campaign{}},
+	"POST /v1/campaigns/:id/pause":  {Summary: "Pause a campaign", Response: structs.Campaign{}},
+	"POST /v1/campaigns/:id/resume": {Summary: "Resume a campaign", Response: structs.Campaign{}},
+	"POST /v1/campaigns/:id/cancel": {Summary: "Cancel a campaign", Response: structs.Campaign{}},
+
+	"GET /v1/approvals/":             {Summary: "List approval requests", Response: []structs.Approval_Request{}, Query: map[string]string{"state": "only requests in this state"}},
+	"GET /v1/approvals/:id":          {Summary: "Get an approval request", Response: structs.Approval_Request{}},
+	"POST /v1/approvals/:id/approve": {Summary: "Approve a request", Request: struct{ Comment string }{}, Response: structs.Approval_Request{}},
+	"POST /v1/approvals/:id/reject":  {Summary: "Reject a request", Request: struct{ Comment string }{}, Response: structs.Approval_Request{}},
+
+	"GET /v1/ca/bundle": {Summary: "Get the PEM certificates of the internal CA"},
+	"GET /v1/ca/crl":    {Summary: "Get the PEM revocation list of the internal CA"},
+}
+
+// NewOpenAPIDocument describes the routes of the app as OpenAPI document.
+func NewOpenAPIDocument(app *fiber.App, config *viper.Viper) map[string]interface{} {
+	return openapi.Build(app.GetRoutes(true), openapi.Info{
+		Title:   "PackageLock API",
+		Version: config.GetString("general.app-version"),
+		Secured: config.GetBool("general.production"),
+	}, operations)
+}
+
+// addDocs serves the OpenAPI document at '/openapi.json' and the Swagger UI at '/docs'.
+// Production doesn't expose its API description, 'print-routes --format openapi' prints it.
+// The document is built on the first request, when all routes are registered.
+func addDocs(app *fiber.App, params ServerParams) {
+	if params.Config.GetBool("general.production") {
+		return
+	}
+
+	var once sync.Once
+	var document map[string]interface{}
+
+	app.Get("/openapi.json", func(c *fiber.Ctx) error {
+		once.Do(func() {
+			document = NewOpenAPIDocument(app, params.Config)
+		})
+		return c.JSON(document)
+	})
+
+	app.Get("/docs", func(c *fiber.Ctx) error {
+		return c.Render("swagger", fiber.Map{
+			"AppVersion": params.Config.GetString("general.app-version"),
+		})
+	})
+	params.Logger.Debug("Added OpenAPI Handlers.")
+}
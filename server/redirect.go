@@ -0,0 +1,77 @@
+package server
+
+import (
+	"context"
+	"net"
+	"packagelock/certs"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+// newRedirectApp creates the plain-HTTP app. It answers ACME HTTP-01 challenges
+// and permanently redirects every other request to the same path on the HTTPS server.
+func newRedirectApp(params ServerParams) *fiber.App {
+	app := fiber.New(fiber.Config{
+		DisableStartupMessage: true,
+	})
+
+	app.Get(certs.HTTPChallengePath+":token", func(c *fiber.Ctx) error {
+		keyAuth, ok := params.Challenges.Get(c.Params("token"))
+		if !ok {
+			return c.SendStatus(fiber.StatusNotFound)
+		}
+		return c.SendString(keyAuth)
+	})
+
+	httpsPort := params.Config.GetString("network.port")
+	app.Use(func(c *fiber.Ctx) error {
+		host := c.Hostname()
+		if hostname, _, err := net.SplitHostPort(host); err == nil {
+			host = hostname
+		}
+		host = strings.Trim(host, "[]")
+		if host == "" {
+			host = params.Config.GetString("network.fqdn")
+		}
+
+		authority := net.JoinHostPort(host, httpsPort)
+		if httpsPort == "443" {
+			authority = strings.TrimSuffix(authority, ":443")
+		}
+		return c.Redirect("https://"+authority+string(c.Request().URI().RequestURI()), fiber.StatusMovedPermanently)
+	})
+
+	return app
+}
+
+// startRedirectServer runs the plain-HTTP listener on 'network.ssl-config.redirectport'
+// next to the HTTPS server. It is only started with 'network.ssl' and 'network.ssl-config.redirecthttp'.
+func startRedirectServer(params ServerParams) {
+	if !params.Config.GetBool("network.ssl") || !params.Config.GetBool("network.ssl-config.redirecthttp") {
+		return
+	}
+
+	app := newRedirectApp(params)
+	redirectAddr := params.Config.GetString("network.fqdn") + ":" + params.Config.GetString("network.ssl-config.redirectport")
+
+	params.Lifecycle.Append(fx.Hook{
+		OnStart: func(ctx context.Context) error {
+			go func() {
+				params.Logger.Info("Starting HTTP redirect server", zap.String("address", redirectAddr))
+
+				// The API keeps running over HTTPS if the port is taken or needs privileges
+				if err := app.Listen(redirectAddr); err != nil {
+					params.Logger.Error("Failed to start HTTP redirect server", zap.Error(err))
+				}
+			}()
+			return nil
+		},
+		OnStop: func(ctx context.Context) error {
+			params.Logger.Info("Shutting down HTTP redirect server")
+			return app.Shutdown()
+		},
+	})
+}
@@ -2,7 +2,10 @@ package server
 
 import (
 	"context"
+	"crypto/tls"
+	"fmt"
 	"os"
+	"packagelock/certs"
 	"packagelock/handler"
 	"strconv"
 
@@ -15,7 +18,6 @@ import (
 	"github.com/gofiber/fiber/v2/middleware/monitor"
 	"github.com/gofiber/fiber/v2/middleware/recover"
 	"github.com/gofiber/template/html/v2"
-	"github.com/golang-jwt/jwt/v5"
 	"github.com/spf13/viper"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/trace"
@@ -26,11 +28,15 @@ import (
 type ServerParams struct {
 	fx.In
 
-	Lifecycle fx.Lifecycle
-	Logger    *zap.Logger
-	Config    *viper.Viper
-	Handlers  *handler.Handlers // The injected Handlers struct
-	Tracer    trace.Tracer      // Injected Tracer
+	Lifecycle    fx.Lifecycle
+	Logger       *zap.Logger
+	Config       *viper.Viper
+	Handlers     *handler.Handlers     // The injected Handlers struct
+	Tracer       trace.Tracer          // Injected Tracer
+	Challenges   *certs.HTTPChallenges // ACME HTTP-01 challenges, served by the redirect server
+	Certificates *certs.Store          // Certificates of the HTTPS server, reloaded on change
+	ACME         *certs.ACME           // Renews the certificate with 'acme.enabled'
+	Expiry       *certs.ExpiryMonitor  // Warns about expiring certificates
 }
 
 func NewServer(params ServerParams) *fiber.App {
@@ -73,15 +79,12 @@ func NewServer(params ServerParams) *fiber.App {
 		prometheus.RegisterAt(app, "/metrics")
 
 		// following path's will be ignored.
-		// As prometheus exports how often a path got called,
-		// we ignore everything authentication related (even misstypes)
-		// to cancel out possible sidechannel attack's
-		prometheus.SetSkipPaths([]string{"/auth/login", "/v1/auth/login", "/auth", "/login"})
+		prometheus.SetSkipPaths(metricsSkipPaths)
 
 		app.Use(prometheus.Middleware)
 		params.Logger.Info("Added Monitoring Middleware.")
 	}
-  
+
 	// Middleware for healthcheck
 	app.Use(healthcheck.New(healthcheck.Config{
 		LivenessProbe: func(c *fiber.Ctx) bool {
@@ -100,6 +103,9 @@ func NewServer(params ServerParams) *fiber.App {
 	addRoutes(app, params)
 	params.Logger.Info("Added routes.")
 
+	// Add OpenAPI document and Swagger UI
+	addDocs(app, params)
+
 	appVersion := params.Config.GetString("general.app-version")
 
 	// Add 404 handler
@@ -113,6 +119,7 @@ func NewServer(params ServerParams) *fiber.App {
 	// Start the server using lifecycle hooks
 	params.Logger.Info("Finished API-Server Initialization.")
 	startServer(app, params)
+	startRedirectServer(params)
 
 	return app
 }
@@ -125,19 +132,22 @@ func addRoutes(app *fiber.App, params ServerParams) {
 	if params.Config.GetBool("general.production") {
 		params.Logger.Info("Enabled Production! Adding JWT!")
 
-		// Read the private key for JWT
-		keyData, err := os.ReadFile(params.Config.GetString("network.ssl-config.privatekeypath"))
-		if err != nil {
-			params.Logger.Fatal("Failed to read private key for JWT", zap.Error(err))
-		}
-		privateKey, err := jwt.ParseRSAPrivateKeyFromPEM(keyData)
-		if err != nil {
-			params.Logger.Fatal("Failed to parse private key for JWT", zap.Error(err))
-		}
+		// JWTs are signed with the private key of the server and verified with its public key,
+		// which is reloaded when a renewal replaced the key
+		jwtKey := certs.NewJWTKeyFile(params.Config.GetString("network.ssl-config.privatekeypath"))
+		// Checked on start instead of here, so the routes can be built without the key, e.g. by print-routes
+		params.Lifecycle.Append(fx.Hook{
+			OnStart: func(context.Context) error {
+				if _, err := jwtKey.Key(); err != nil {
+					return fmt.Errorf("load private key for JWT: %w", err)
+				}
+				return nil
+			},
+		})
 
 		// JWT Middleware to protect specific routes
 		jwtMiddleware := jwtware.New(jwtware.Config{
-			SigningKey: jwtware.SigningKey{Key: privateKey},
+			KeyFunc: jwtKey.Keyfunc,
 		})
 
 		// Apply JWT protection to all routes in the "/v1" group
@@ -147,6 +157,12 @@ func addRoutes(app *fiber.App, params ServerParams) {
 		addGeneralHandler(v1, params)
 		addAgentHandler(v1, params)
 		addHostHandler(v1, params)
+		addLockHandler(v1, params)
+		addGroupHandler(v1, params)
+		addWindowHandler(v1, params)
+		addCampaignHandler(v1, params)
+		addApprovalHandler(v1, params)
+		addCAHandler(v1, params)
 	} else {
 		params.Logger.Info("Non-Production Setup! Disabled JWT!")
 
@@ -157,6 +173,12 @@ func addRoutes(app *fiber.App, params ServerParams) {
 		addGeneralHandler(v1, params)
 		addAgentHandler(v1, params)
 		addHostHandler(v1, params)
+		addLockHandler(v1, params)
+		addGroupHandler(v1, params)
+		addWindowHandler(v1, params)
+		addCampaignHandler(v1, params)
+		addApprovalHandler(v1, params)
+		addCAHandler(v1, params)
 	}
 }
 
@@ -178,10 +200,17 @@ func startServer(app *fiber.App, params ServerParams) {
 				if params.Config.GetBool("network.ssl") {
 					params.Logger.Info("Starting HTTPS server", zap.String("address", serverAddr))
 
-					certFile := params.Config.GetString("network.ssl-config.certificatepath")
-					keyFile := params.Config.GetString("network.ssl-config.privatekeypath")
+					// Certificates are served by the store, so renewed ones apply without a restart
+					tlsConfig, err := params.Certificates.TLSConfig()
+					if err != nil {
+						params.Logger.Fatal("Invalid TLS configuration", zap.Error(err))
+					}
+					listener, err := tls.Listen("tcp", serverAddr, tlsConfig)
+					if err != nil {
+						params.Logger.Fatal("Failed to start HTTPS server", zap.Error(err))
+					}
 
-					if err := app.ListenTLS(serverAddr, certFile, keyFile); err != nil {
+					if err := app.Listener(listener); err != nil {
 						params.Logger.Fatal("Failed to start HTTPS server", zap.Error(err))
 					}
 				} else {
@@ -205,8 +234,16 @@ func startServer(app *fiber.App, params ServerParams) {
 func addAgentHandler(group fiber.Router, params ServerParams) {
 	agentGroup := group.Group("/agents")
 
-	agentGroup.Get("/", params.Handlers.GetAgentByID)
+	agentGroup.Get("/", deprecated(params, "/v1/agents/{AgentID}"), params.Handlers.GetAgentByID)
 	agentGroup.Post("/register", params.Handlers.RegisterAgent)
+	agentGroup.Get("/stream", params.Handlers.AgentStream)
+	agentGroup.Get("/:id", params.Handlers.GetAgent)
+	agentGroup.Get("/:id/host", params.Handlers.GetAgentHost)
+	agentGroup.Get("/:id/jobs", params.Handlers.GetAgentJobs)
+	agentGroup.Post("/:id/jobs", params.Handlers.CreateAgentJob)
+	agentGroup.Get("/:id/jobs/next", params.Handlers.GetNextAgentJob)
+	agentGroup.Get("/:id/jobs/:jobId", params.Handlers.GetAgentJob)
+	agentGroup.Put("/:id/jobs/:jobId", params.Handlers.ReportAgentJob)
 	params.Logger.Debug("Added Agent Handlers.")
 }
 
@@ -215,17 +252,103 @@ func addGeneralHandler(group fiber.Router, params ServerParams) {
 
 	generalGroup.Get("/hosts", params.Handlers.GetHosts)
 	generalGroup.Get("/agents", params.Handlers.GetAgents)
+	generalGroup.Get("/connections", params.Handlers.GetConnections)
+	generalGroup.Post("/sync", params.Handlers.StartSync)
+	generalGroup.Get("/sync/:id", params.Handlers.GetSync)
+	generalGroup.Get("/vulnerabilities", params.Handlers.GetVulnerabilities)
 	params.Logger.Debug("Added General Handlers.")
 }
 
 func addHostHandler(group fiber.Router, params ServerParams) {
 	hostGroup := group.Group("/hosts")
 
-	hostGroup.Get("/", params.Handlers.GetHostByAgentID)
+	hostGroup.Get("/", deprecated(params, "/v1/agents/{AgentID}/host"), params.Handlers.GetHostByAgentID)
 	hostGroup.Post("/register", params.Handlers.RegisterHost)
+	hostGroup.Get("/:id", params.Handlers.GetHost)
+	hostGroup.Get("/:id/agents", params.Handlers.GetHostAgents)
+	hostGroup.Get("/:id/repos", params.Handlers.GetHostRepos)
+	hostGroup.Put("/:id/repos", params.Handlers.ReportHostRepos)
+	hostGroup.Get("/:id/packages", params.Handlers.GetHostPackages)
+	hostGroup.Put("/:id/packages", params.Handlers.ReportHostPackages)
+	hostGroup.Get("/:id/vulnerabilities", params.Handlers.GetHostVulns)
+	hostGroup.Get("/:id/violations", params.Handlers.GetHostViolations)
+	hostGroup.Get("/:id/drift", params.Handlers.GetHostDrift)
+	hostGroup.Get("/:id/baseline", params.Handlers.GetHostBaseline)
+	hostGroup.Put("/:id/baseline", params.Handlers.PutHostBaseline)
+	hostGroup.Delete("/:id/baseline", params.Handlers.DeleteHostBaseline)
+	hostGroup.Put("/:id/tags", params.Handlers.PutHostTags)
+	hostGroup.Patch("/:id", params.Handlers.UpdateHost)
+	hostGroup.Delete("/:id", params.Handlers.DeleteHost)
 	params.Logger.Debug("Added Host Handlers.")
 }
 
+func addLockHandler(group fiber.Router, params ServerParams) {
+	lockGroup := group.Group("/locks")
+
+	lockGroup.Get("/", params.Handlers.GetLocks)
+	lockGroup.Post("/", params.Handlers.CreateLock)
+	lockGroup.Get("/:id", params.Handlers.GetLock)
+	lockGroup.Put("/:id", params.Handlers.UpdateLock)
+	lockGroup.Delete("/:id", params.Handlers.DeleteLock)
+	lockGroup.Get("/:id/violations", params.Handlers.GetLockViolations)
+	params.Logger.Debug("Added Lock Handlers.")
+}
+
+func addGroupHandler(group fiber.Router, params ServerParams) {
+	groupGroup := group.Group("/groups")
+
+	groupGroup.Get("/", params.Handlers.GetGroups)
+	groupGroup.Post("/", params.Handlers.CreateGroup)
+	groupGroup.Post("/preview", params.Handlers.PreviewGroup)
+	groupGroup.Get("/:id", params.Handlers.GetGroup)
+	groupGroup.Put("/:id", params.Handlers.UpdateGroup)
+	groupGroup.Delete("/:id", params.Handlers.DeleteGroup)
+	groupGroup.Get("/:id/hosts", params.Handlers.GetGroupHosts)
+	params.Logger.Debug("Added Group Handlers.")
+}
+
+func addWindowHandler(group fiber.Router, params ServerParams) {
+	windowGroup := group.Group("/windows")
+
+	windowGroup.Get("/", params.Handlers.GetWindows)
+	windowGroup.Post("/", params.Handlers.CreateWindow)
+	windowGroup.Get("/:id", params.Handlers.GetWindow)
+	windowGroup.Put("/:id", params.Handlers.UpdateWindow)
+	windowGroup.Delete("/:id", params.Handlers.DeleteWindow)
+	windowGroup.Get("/:id/preview", params.Handlers.GetWindowPreview)
+	params.Logger.Debug("Added Window Handlers.")
+}
+
+func addCampaignHandler(group fiber.Router, params ServerParams) {
+	campaignGroup := group.Group("/campaigns")
+
+	campaignGroup.Get("/", params.Handlers.GetCampaigns)
+	campaignGroup.Post("/", params.Handlers.CreateCampaign)
+	campaignGroup.Get("/:id", params.Handlers.GetCampaign)
+	campaignGroup.Post("/:id/pause", params.Handlers.PauseCampaign)
+	campaignGroup.Post("/:id/resume", params.Handlers.ResumeCampaign)
+	campaignGroup.Post("/:id/cancel", params.Handlers.CancelCampaign)
+	params.Logger.Debug("Added Campaign Handlers.")
+}
+
+func addApprovalHandler(group fiber.Router, params ServerParams) {
+	approvalGroup := group.Group("/approvals")
+
+	approvalGroup.Get("/", params.Handlers.GetApprovals)
+	approvalGroup.Get("/:id", params.Handlers.GetApproval)
+	approvalGroup.Post("/:id/approve", params.Handlers.ApproveApproval)
+	approvalGroup.Post("/:id/reject", params.Handlers.RejectApproval)
+	params.Logger.Debug("Added Approval Handlers.")
+}
+
+func addCAHandler(group fiber.Router, params ServerParams) {
+	caGroup := group.Group("/ca")
+
+	caGroup.Get("/bundle", params.Handlers.GetCABundle)
+	caGroup.Get("/crl", params.Handlers.GetCACRL)
+	params.Logger.Debug("Added CA Handlers.")
+}
+
 func addLoginHandler(group fiber.Router, params ServerParams) {
 	loginGroup := group.Group("/auth")
 
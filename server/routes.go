@@ -0,0 +1,145 @@
+package server
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// metricsSkipPaths are not counted by the Prometheus middleware.
+// As prometheus exports how often a path got called,
+// we ignore everything authentication related (even misstypes)
+// to cancel out possible sidechannel attack's
+var metricsSkipPaths = []string{"/auth/login", "/v1/auth/login", "/auth", "/login"}
+
+// Route describes a registered route and the middleware running before its handler.
+type Route struct {
+	Method     string
+	Path       string
+	Handler    string
+	Auth       string   // "jwt" or "none"
+	Middleware []string // in the order they run, skipped ones are suffixed with " (skipped)"
+}
+
+// Routes lists the routes of the app. Middleware registered with Use is matched
+// to the routes below its prefix, HEAD routes added by fiber for GET routes are left out.
+// Routes are sorted by path.
+func Routes(app *fiber.App) []Route {
+	type key struct {
+		method, path string
+		handler      uintptr
+	}
+	registered := map[key]bool{}
+	for _, route := range app.GetRoutes(true) {
+		registered[key{route.Method, route.Path, handlerPointer(route)}] = true
+	}
+
+	var routes []Route
+	for _, stack := range app.Stack() {
+		var middleware []*fiber.Route
+		for _, route := range stack {
+			if len(route.Handlers) == 0 {
+				continue
+			}
+			if !registered[key{route.Method, route.Path, handlerPointer(*route)}] {
+				middleware = append(middleware, route)
+				continue
+			}
+			if route.Method == fiber.MethodHead {
+				continue
+			}
+			routes = append(routes, describe(route, middleware))
+		}
+	}
+
+	// The stack is grouped by method, the routes of a path belong together
+	sort.SliceStable(routes, func(i, j int) bool {
+		return routes[i].Path < routes[j].Path
+	})
+	return routes
+}
+
+func describe(route *fiber.Route, middleware []*fiber.Route) Route {
+	described := Route{
+		Method:     route.Method,
+		Path:       route.Path,
+		Handler:    funcName(route.Handlers[len(route.Handlers)-1]),
+		Auth:       "none",
+		Middleware: []string{},
+	}
+
+	var handlers []fiber.Handler
+	for _, use := range middleware {
+		if covers(use.Path, route.Path) {
+			handlers = append(handlers, use.Handlers...)
+		}
+	}
+	handlers = append(handlers, route.Handlers[:len(route.Handlers)-1]...)
+
+	for _, handler := range handlers {
+		name := middlewareName(handler)
+		switch {
+		case name == "jwt":
+			described.Auth = "jwt"
+		case name == "fiberprometheus" && metricsSkipped(route.Path):
+			name += " (skipped)"
+		}
+		described.Middleware = append(described.Middleware, name)
+	}
+	return described
+}
+
+// covers reports whether middleware used at prefix runs for path.
+func covers(prefix, path string) bool {
+	return prefix == "/" || path == prefix || strings.HasPrefix(path, prefix+"/")
+}
+
+func metricsSkipped(path string) bool {
+	for _, skipped := range metricsSkipPaths {
+		if path == skipped {
+			return true
+		}
+	}
+	return false
+}
+
+func handlerPointer(route fiber.Route) uintptr {
+	if len(route.Handlers) == 0 {
+		return 0
+	}
+	return reflect.ValueOf(route.Handlers[len(route.Handlers)-1]).Pointer()
+}
+
+var (
+	closureSuffix = regexp.MustCompile(`(\.func\d+)+$`)
+	majorVersion  = regexp.MustCompile(`/v\d+\.`)
+	receiver      = regexp.MustCompile(`\(\*?\w+\)\.`)
+)
+
+// funcName returns the short name of the function a handler was created by,
+// e.g. 'handler.NewGetHostHandler' for the closure it returns.
+func funcName(handler fiber.Handler) string {
+	fn := runtime.FuncForPC(reflect.ValueOf(handler).Pointer())
+	if fn == nil {
+		return fmt.Sprintf("%p", handler)
+	}
+	name := strings.TrimSuffix(fn.Name(), "-fm")
+	name = closureSuffix.ReplaceAllString(name, "")
+	name = majorVersion.ReplaceAllString(name, ".")
+	name = name[strings.LastIndex(name, "/")+1:]
+	return receiver.ReplaceAllString(name, "")
+}
+
+// middlewareName shortens the constructor of a middleware to its package, e.g. 'jwt' for 'jwt.New'.
+func middlewareName(handler fiber.Handler) string {
+	name := funcName(handler)
+	for _, suffix := range []string{".New", ".Middleware"} {
+		name = strings.TrimSuffix(name, suffix)
+	}
+	return strings.TrimPrefix(name, "server.")
+}
@@ -0,0 +1,518 @@
+package stream
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"packagelock/config"
+	"packagelock/db"
+	"packagelock/jobs"
+	"packagelock/structs"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gofiber/contrib/websocket"
+	"github.com/google/uuid"
+	"github.com/spf13/viper"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+// HubParams holds the dependencies of the Hub.
+type HubParams struct {
+	fx.In
+
+	Lifecycle fx.Lifecycle
+	Logger    *zap.Logger
+	Config    *viper.Viper
+	Watcher   *config.Watcher
+	DB        *db.Database
+	Jobs      *jobs.Queue
+}
+
+// Hub is the registry of connected agents. Every agent has at most one connection,
+// a new connection replaces the old one.
+type Hub struct {
+	logger       *zap.Logger
+	config       *viper.Viper
+	db           *db.Database
+	jobs         *jobs.Queue
+	sendBuffer   int
+	writeTimeout time.Duration
+	pingInterval time.Duration
+	readTimeout  time.Duration
+	maxMessage   int64
+
+	mu         sync.Mutex
+	conns      map[uuid.UUID]*connection
+	lastConfig string // 'agents.config' as last pushed to all agents
+}
+
+// ConnectionInfo describes a connected agent.
+type ConnectionInfo struct {
+	AgentID        uuid.UUID
+	HostID         uuid.UUID
+	RemoteAddr     string
+	ConnectedSince time.Time
+	LastSeen       time.Time
+	Pending        int // messages waiting in the send buffer
+}
+
+type connection struct {
+	agent       structs.Agent
+	socket      *websocket.Conn
+	send        chan Message
+	acked       chan struct{} // signals the writer that a pushed job was acknowledged
+	done        chan struct{}
+	closeOnce   sync.Once
+	connectedAt time.Time
+
+	mu       sync.Mutex
+	lastSeen time.Time
+	pushed   map[uuid.UUID]struct{} // jobs sent but not yet reported on by the agent
+}
+
+// NewHub creates the connection registry. All connections are closed when the app stops.
+// Changes of 'agents.config' in the config file are pushed to all connected agents.
+func NewHub(params HubParams) *Hub {
+	hub := &Hub{
+		logger:       params.Logger,
+		config:       params.Config,
+		db:           params.DB,
+		jobs:         params.Jobs,
+		sendBuffer:   params.Config.GetInt("stream.send-buffer"),
+		writeTimeout: params.Config.GetDuration("stream.write-timeout"),
+		pingInterval: params.Config.GetDuration("stream.ping-interval"),
+		readTimeout:  params.Config.GetDuration("stream.read-timeout"),
+		maxMessage:   params.Config.GetInt64("stream.max-message"),
+		conns:        map[uuid.UUID]*connection{},
+	}
+	if msg, err := hub.configMessage(); err == nil {
+		hub.lastConfig = string(msg.Payload)
+	}
+	params.Watcher.OnChange(hub.broadcastConfig)
+
+	params.Lifecycle.Append(fx.Hook{
+		OnStop: func(context.Context) error {
+			hub.mu.Lock()
+			defer hub.mu.Unlock()
+			for _, conn := range hub.conns {
+				conn.close()
+			}
+			return nil
+		},
+	})
+
+	return hub
+}
+
+func (c *connection) close() {
+	c.closeOnce.Do(func() { close(c.done) })
+}
+
+func (c *connection) seen() {
+	c.mu.Lock()
+	c.lastSeen = time.Now()
+	c.mu.Unlock()
+}
+
+func (c *connection) trackPushed(jobID uuid.UUID) {
+	c.mu.Lock()
+	c.pushed[jobID] = struct{}{}
+	c.mu.Unlock()
+}
+
+// forget stops tracking a job which never reached the agent.
+func (c *connection) forget(jobID uuid.UUID) {
+	c.mu.Lock()
+	delete(c.pushed, jobID)
+	c.mu.Unlock()
+}
+
+func (c *connection) acknowledge(jobID uuid.UUID) {
+	c.mu.Lock()
+	_, pushed := c.pushed[jobID]
+	delete(c.pushed, jobID)
+	c.mu.Unlock()
+
+	if pushed {
+		select {
+		case c.acked <- struct{}{}:
+		default: // the writer has a wake-up pending already
+		}
+	}
+}
+
+// awaiting reports whether a pushed job wasn't acknowledged yet.
+func (c *connection) awaiting() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.pushed) > 0
+}
+
+// unacknowledged returns the pushed jobs the agent never reported on.
+func (c *connection) unacknowledged() []uuid.UUID {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	jobIDs := make([]uuid.UUID, 0, len(c.pushed))
+	for jobID := range c.pushed {
+		jobIDs = append(jobIDs, jobID)
+	}
+	return jobIDs
+}
+
+// Serve runs the stream of an agent until the connection closes.
+// The caller has to authenticate the agent before upgrading the connection.
+func (h *Hub) Serve(socket *websocket.Conn, agent structs.Agent) {
+	conn := &connection{
+		agent:       agent,
+		socket:      socket,
+		send:        make(chan Message, h.sendBuffer),
+		acked:       make(chan struct{}, 1),
+		done:        make(chan struct{}),
+		connectedAt: time.Now(),
+		lastSeen:    time.Now(),
+		pushed:      map[uuid.UUID]struct{}{},
+	}
+
+	h.register(conn)
+	defer h.unregister(conn)
+
+	// The agent gets its config before anything else
+	if len(h.config.GetStringMap("agents.config")) > 0 {
+		msg, err := h.configMessage()
+		if err == nil {
+			err = h.enqueue(conn, msg)
+		}
+		if err != nil {
+			h.logger.Warn("Failed to push agent config", zap.String("AgentID", agent.AgentID.String()), zap.Error(err))
+		}
+	}
+
+	readDone := make(chan struct{})
+	go func() {
+		h.readLoop(conn)
+		close(readDone)
+	}()
+	h.writeLoop(conn)
+
+	// The socket must not be used anymore once Serve returns, so wait for the reader
+	_ = socket.Close()
+	<-readDone
+}
+
+func (h *Hub) register(conn *connection) {
+	h.mu.Lock()
+	previous := h.conns[conn.agent.AgentID]
+	h.conns[conn.agent.AgentID] = conn
+	h.mu.Unlock()
+
+	if previous != nil {
+		h.logger.Info("Agent reconnected, closing previous stream", zap.String("AgentID", conn.agent.AgentID.String()))
+		previous.close()
+	}
+	if err := TouchAgent(h.db, conn.agent.AgentID); err != nil {
+		h.logger.Warn("Failed to update agent LastSeen", zap.Error(err))
+	}
+	h.logger.Info("Agent stream connected", zap.String("AgentID", conn.agent.AgentID.String()))
+}
+
+func (h *Hub) unregister(conn *connection) {
+	conn.close()
+
+	h.mu.Lock()
+	if h.conns[conn.agent.AgentID] == conn {
+		delete(h.conns, conn.agent.AgentID)
+	}
+	h.mu.Unlock()
+
+	// The agent may have lost jobs written just before the connection dropped.
+	// Only jobs which are still claimed are put back, see jobs.Queue.Release.
+	for _, jobID := range conn.unacknowledged() {
+		if err := h.jobs.Release(jobID); err != nil {
+			h.logger.Warn("Failed to release job", zap.String("JobID", jobID.String()), zap.Error(err))
+		}
+	}
+
+	h.logger.Info("Agent stream disconnected", zap.String("AgentID", conn.agent.AgentID.String()))
+}
+
+// writeLoop is the only writer of the socket. It pushes queued jobs one at a time:
+// the next job is only pushed once the agent acknowledged the previous one,
+// so a slow agent isn't flooded with jobs it can't take yet.
+func (h *Hub) writeLoop(conn *connection) {
+	notified, unsubscribe := h.jobs.Subscribe(conn.agent.AgentID)
+	defer unsubscribe()
+
+	ping := time.NewTicker(h.pingInterval)
+	defer ping.Stop()
+
+	// Jobs queued while the agent was offline
+	if err := h.pushJob(conn); err != nil {
+		h.logger.Debug("Failed to push jobs to agent", zap.Error(err))
+		return
+	}
+
+	for {
+		select {
+		case <-conn.done:
+			_ = conn.socket.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseGoingAway, ""),
+				time.Now().Add(h.writeTimeout),
+			)
+			return
+		case msg := <-conn.send:
+			if err := h.write(conn, msg); err != nil {
+				h.logger.Debug("Failed to write to agent stream", zap.Error(err))
+				return
+			}
+		case <-notified:
+			if err := h.pushJob(conn); err != nil {
+				h.logger.Debug("Failed to push jobs to agent", zap.Error(err))
+				return
+			}
+		case <-conn.acked:
+			if err := h.pushJob(conn); err != nil {
+				h.logger.Debug("Failed to push jobs to agent", zap.Error(err))
+				return
+			}
+		case <-ping.C:
+			if err := conn.socket.WriteControl(websocket.PingMessage, nil, time.Now().Add(h.writeTimeout)); err != nil {
+				h.logger.Debug("Failed to ping agent", zap.Error(err))
+				return
+			}
+		}
+	}
+}
+
+func (h *Hub) write(conn *connection, msg Message) error {
+	if err := conn.socket.SetWriteDeadline(time.Now().Add(h.writeTimeout)); err != nil {
+		return err
+	}
+	return conn.socket.WriteJSON(msg)
+}
+
+// pushJob claims and sends the next queued job of the agent, unless the agent didn't
+// acknowledge the previously pushed job yet. A job which can't be written is put back
+// into the queue for polling, as are jobs the agent didn't acknowledge before the
+// connection closed.
+func (h *Hub) pushJob(conn *connection) error {
+	if conn.awaiting() {
+		return nil
+	}
+
+	job, err := h.jobs.Claim(conn.agent.AgentID)
+	if err != nil {
+		h.logger.Warn("Failed to claim job for agent stream", zap.Error(err))
+		return nil
+	}
+	if job == nil {
+		return nil
+	}
+
+	// Tracked before the write, as the agent may acknowledge the job before it returns
+	conn.trackPushed(job.JobID)
+	msg, err := NewMessage(TypeJob, job)
+	if err == nil {
+		msg.JobID = &job.JobID
+		err = h.write(conn, msg)
+	}
+	if err != nil {
+		conn.forget(job.JobID)
+		if releaseErr := h.jobs.Release(job.JobID); releaseErr != nil {
+			h.logger.Warn("Failed to release job", zap.String("JobID", job.JobID.String()), zap.Error(releaseErr))
+		}
+		return err
+	}
+
+	h.logger.Info("Pushed Job to agent",
+		zap.String("JobID", job.JobID.String()),
+		zap.String("AgentID", conn.agent.AgentID.String()),
+	)
+	return nil
+}
+
+func (h *Hub) readLoop(conn *connection) {
+	defer conn.close()
+
+	conn.socket.SetReadLimit(h.maxMessage)
+	extend := func() {
+		_ = conn.socket.SetReadDeadline(time.Now().Add(h.readTimeout))
+	}
+	extend()
+	conn.socket.SetPongHandler(func(string) error {
+		extend()
+		return nil
+	})
+
+	for {
+		var msg Message
+		if err := conn.socket.ReadJSON(&msg); err != nil {
+			if !websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				h.logger.Debug("Failed to read from agent stream", zap.Error(err))
+			}
+			return
+		}
+		extend()
+		conn.seen()
+
+		if err := h.handle(conn, msg); err != nil {
+			h.logger.Debug("Invalid message from agent",
+				zap.String("AgentID", conn.agent.AgentID.String()),
+				zap.String("type", msg.Type),
+				zap.Error(err),
+			)
+			reply, _ := NewMessage(TypeError, map[string]string{"error": err.Error()})
+			reply.JobID = msg.JobID
+			if sendErr := h.enqueue(conn, reply); sendErr != nil {
+				return
+			}
+		}
+	}
+}
+
+func (h *Hub) handle(conn *connection, msg Message) error {
+	switch msg.Type {
+	case TypeHeartbeat:
+		return TouchAgent(h.db, conn.agent.AgentID)
+
+	case TypeJobState:
+		var report jobs.Report
+		if err := h.decodeJobMessage(conn, msg, &report); err != nil {
+			return err
+		}
+		_, err := h.jobs.Update(*msg.JobID, report)
+		if err == nil {
+			conn.acknowledge(*msg.JobID)
+		}
+		return err
+
+	case TypeJobOutput:
+		var chunk OutputChunk
+		if err := h.decodeJobMessage(conn, msg, &chunk); err != nil {
+			return err
+		}
+		_, err := h.jobs.AppendOutput(*msg.JobID, chunk.Stdout, chunk.Stderr)
+		if err == nil {
+			conn.acknowledge(*msg.JobID)
+		}
+		return err
+	}
+
+	return errors.New("unknown message type " + msg.Type)
+}
+
+// decodeJobMessage checks that a message refers to a job of the agent and decodes its payload.
+func (h *Hub) decodeJobMessage(conn *connection, msg Message, payload interface{}) error {
+	if msg.JobID == nil {
+		return errors.New("message needs a JobID")
+	}
+
+	job, err := h.jobs.Find(*msg.JobID)
+	if err != nil {
+		return err
+	}
+	if job == nil || job.AgentID != conn.agent.AgentID {
+		return errors.New("job not found")
+	}
+
+	return json.Unmarshal(msg.Payload, payload)
+}
+
+func (h *Hub) enqueue(conn *connection, msg Message) error {
+	select {
+	case <-conn.done:
+		return ErrNotConnected
+	case conn.send <- msg:
+		return nil
+	default:
+		return ErrBackpressure
+	}
+}
+
+// configMessage encodes 'agents.config' for the agents.
+func (h *Hub) configMessage() (Message, error) {
+	return NewMessage(TypeConfig, h.config.GetStringMap("agents.config"))
+}
+
+// broadcastConfig pushes 'agents.config' to all connected agents if it changed.
+func (h *Hub) broadcastConfig() {
+	msg, err := h.configMessage()
+	if err != nil {
+		h.logger.Warn("Failed to encode agent config", zap.Error(err))
+		return
+	}
+
+	h.mu.Lock()
+	changed := string(msg.Payload) != h.lastConfig
+	h.lastConfig = string(msg.Payload)
+	h.mu.Unlock()
+	if !changed {
+		return
+	}
+
+	sent := h.Broadcast(msg)
+	h.logger.Info("Pushed changed agent config", zap.Int("agents", sent))
+}
+
+// Broadcast sends a message to all connected agents and returns how many it reached.
+func (h *Hub) Broadcast(msg Message) int {
+	h.mu.Lock()
+	conns := make([]*connection, 0, len(h.conns))
+	for _, conn := range h.conns {
+		conns = append(conns, conn)
+	}
+	h.mu.Unlock()
+
+	sent := 0
+	for _, conn := range conns {
+		if err := h.enqueue(conn, msg); err != nil {
+			h.logger.Debug("Failed to broadcast to agent", zap.String("AgentID", conn.agent.AgentID.String()), zap.Error(err))
+			continue
+		}
+		sent++
+	}
+	return sent
+}
+
+// Connected reports whether an agent has an open stream.
+func (h *Hub) Connected(agentID uuid.UUID) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, ok := h.conns[agentID]
+	return ok
+}
+
+// Connections lists all connected agents.
+func (h *Hub) Connections() []ConnectionInfo {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	infos := make([]ConnectionInfo, 0, len(h.conns))
+	for _, conn := range h.conns {
+		conn.mu.Lock()
+		lastSeen := conn.lastSeen
+		conn.mu.Unlock()
+
+		infos = append(infos, ConnectionInfo{
+			AgentID:        conn.agent.AgentID,
+			HostID:         conn.agent.HostID,
+			RemoteAddr:     conn.socket.RemoteAddr().String(),
+			ConnectedSince: conn.connectedAt,
+			LastSeen:       lastSeen,
+			Pending:        len(conn.send),
+		})
+	}
+
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].ConnectedSince.Before(infos[j].ConnectedSince)
+	})
+	return infos
+}
+
+// Module exports the stream module.
+var Module = fx.Options(
+	fx.Provide(NewHub),
+)
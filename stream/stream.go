@@ -0,0 +1,75 @@
+// Stream
+//
+// The Stream Package keeps a WebSocket connection to every agent which supports it.
+// The server pushes jobs and the values of 'agents.config' over it, agents send back
+// heartbeats and job output. Everything pushed as a job stays in the job queue,
+// so agents without a connection simply fall back to polling. Forced syncs are
+// refresh-inventory jobs and reach the agent like any other job.
+package stream
+
+import (
+	"encoding/json"
+	"errors"
+	"packagelock/db"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Message types sent by the server.
+const (
+	TypeJob    = "job"    // Payload: structs.Job, already claimed for the agent
+	TypeConfig = "config" // Payload: the values of 'agents.config' the agent should apply
+	TypeError  = "error"  // Payload: {"error": "..."} answer to an invalid agent message
+)
+
+// Message types sent by the agent.
+const (
+	TypeHeartbeat = "heartbeat"  // Payload: none
+	TypeJobState  = "job-state"  // Payload: jobs.Report
+	TypeJobOutput = "job-output" // Payload: OutputChunk
+)
+
+// Message is the envelope of everything sent over the stream.
+type Message struct {
+	Type    string
+	JobID   *uuid.UUID      `json:",omitempty"`
+	Payload json.RawMessage `json:",omitempty"`
+}
+
+// OutputChunk is a piece of job output streamed while the job runs.
+type OutputChunk struct {
+	Stdout string
+	Stderr string
+}
+
+var (
+	// ErrNotConnected is returned when sending to an agent without a stream.
+	ErrNotConnected = errors.New("agent is not connected")
+	// ErrBackpressure is returned when the agent doesn't keep up with the messages sent to it.
+	ErrBackpressure = errors.New("agent send buffer is full")
+)
+
+// NewMessage builds a message with a JSON encoded payload.
+func NewMessage(messageType string, payload interface{}) (Message, error) {
+	msg := Message{Type: messageType}
+	if payload == nil {
+		return msg, nil
+	}
+
+	encoded, err := json.Marshal(payload)
+	if err != nil {
+		return msg, err
+	}
+	msg.Payload = encoded
+	return msg, nil
+}
+
+// TouchAgent records that an agent has been seen just now.
+func TouchAgent(database *db.Database, agentID uuid.UUID) error {
+	_, err := database.DB.Query("UPDATE agents SET LastSeen = $now WHERE AgentID = $agentID", map[string]interface{}{
+		"agentID": agentID.String(),
+		"now":     time.Now(),
+	})
+	return err
+}
@@ -11,13 +11,17 @@ import (
 )
 
 type Package struct {
-	ID             string `json:"id,omitempty"`
-	PackageID      uuid.UUID
-	PackageName    string
-	PackageVersion string
-	Updatable      bool
-	CreationTime   time.Time
-	UpdateTime     time.Time
+	ID               string `json:"id,omitempty"`
+	PackageID        uuid.UUID
+	HostID           uuid.UUID
+	PackageName      string
+	PackageVersion   string
+	Arch             string
+	SourceName       string // source package the binary was built from, dpkg's 'Source:' field
+	CandidateVersion string // newest version available from the host's repositories
+	Updatable        bool
+	CreationTime     time.Time
+	UpdateTime       time.Time
 }
 
 type Network_Info struct {
@@ -37,11 +41,23 @@ type Interface struct {
 type Package_Manager struct {
 	ID                 string `json:"id,omitempty"`
 	PackageManagerName string
-	PackageRepos       []string // A Slice containing all Repository Links.
+	PackageRepos       []Package_Repo // A Slice containing all configured Repositories.
 	CreationTime       time.Time
 	UpdateTime         time.Time
 }
 
+// Package_Repo is a normalized repository, independent of the package manager it was read from.
+type Package_Repo struct {
+	Type       string   // deb, deb-src, rpm, apk or pacman
+	Name       string   // repo id, apk tag or pacman section. Generated for apt.
+	URL        string   // base url, mirrorlist or metalink
+	Suite      string   // apt suite, apk branch or pacman repo name
+	Components []string // apt components or apk repository
+	Enabled    bool
+	GPGCheck   bool
+	Source     string // file the repo was read from
+}
+
 type Host struct {
 	ID             string `json:"id,omitempty"`
 	Hostname       string // FQDN
@@ -52,16 +68,42 @@ type Host struct {
 	Arch           string
 	PackageManager Package_Manager
 	Packages       []uuid.UUID
+	Services       []Service
+	Tags           map[string]string // free-form, e.g. env=prod
+	ArchiveTime    *time.Time        // set when the host was decommissioned, purged after 'hosts.retention'
 	CreationTime   time.Time
 	UpdateTime     time.Time
 }
 
+// Host_Group groups hosts for policies. Static groups list their hosts,
+// dynamic groups have a rule over host fields, e.g. 'Distro == "debian" && Arch == "amd64"'.
+type Host_Group struct {
+	ID           string `json:"id,omitempty"`
+	GroupID      uuid.UUID
+	Name         string
+	Description  string
+	Rule         string      // dynamic groups only
+	HostIDs      []uuid.UUID // static groups only
+	Members      []uuid.UUID // evaluated members, kept up to date by the server
+	CreationTime time.Time
+	UpdateTime   time.Time
+}
+
+// Service is a system service as reported by the agent, e.g. a systemd unit.
+type Service struct {
+	Name    string
+	Enabled bool // started on boot
+	Active  bool // currently running
+}
+
 type Agent struct {
 	ID           string `json:"id,omitempty"`
 	AgentName    string
 	AgentSecret  string // a secret for encryption
 	HostID       uuid.UUID
 	AgentID      uuid.UUID
+	LastSeen     time.Time  // last heartbeat or poll
+	ArchiveTime  *time.Time // archived together with its host
 	CreationTime time.Time
 	UpdateTime   time.Time
 }
@@ -86,3 +128,262 @@ type User struct {
 	UpdateTime   time.Time
 	ApiKeys      []ApiKey
 }
+
+// Vulnerability is an advisory imported from an OSV database dump.
+type Vulnerability struct {
+	ID               string `json:"id,omitempty"`
+	OSVID            string // e.g. DSA-5678-1 or ALPINE-CVE-2024-1234
+	Aliases          []string
+	Summary          string
+	Details          string
+	Severity         []string // CVSS vectors as published
+	Affected         []Vulnerability_Affected
+	AffectedPackages []string // names of all affected packages, used for lookups
+	References       []string
+	Published        time.Time
+	Modified         time.Time
+	ImportTime       time.Time
+}
+
+type Vulnerability_Affected struct {
+	Ecosystem string // e.g. Debian:12, Alpine:v3.20 or Rocky Linux:9
+	Name      string
+	Ranges    []Vulnerability_Range
+	Versions  []string // explicitly listed affected versions
+}
+
+type Vulnerability_Range struct {
+	Type   string // only ECOSYSTEM ranges are evaluated
+	Events []Vulnerability_Event
+}
+
+type Vulnerability_Event struct {
+	Introduced   string
+	Fixed        string
+	LastAffected string
+	Limit        string
+}
+
+// Vulnerability_Finding is a host package affected by a vulnerability.
+type Vulnerability_Finding struct {
+	HostID          uuid.UUID
+	Hostname        string
+	PackageName     string
+	PackageVersion  string
+	SourceName      string // set if the vulnerability was published for the source package
+	VulnerabilityID string
+	Aliases         []string
+	Summary         string
+	Severity        []string
+	Ecosystem       string
+	FixedVersion    string // empty if no fix is known
+}
+
+// Lock pins the allowed package versions of a set of hosts.
+type Lock struct {
+	ID           string `json:"id,omitempty"`
+	LockID       uuid.UUID
+	Name         string
+	Description  string
+	HostIDs      []uuid.UUID
+	HostGroups   []uuid.UUID
+	Packages     []Lock_Package
+	CreationTime time.Time
+	UpdateTime   time.Time
+}
+
+type Lock_Package struct {
+	PackageName string
+	Version     string // exact version, shorthand for the constraint "= Version"
+	Constraint  string // e.g. ">= 1.2, < 2.0"; used if Version is empty
+}
+
+// Lock_Violation is a host package which does not satisfy an applicable lock.
+type Lock_Violation struct {
+	ID               string `json:"id,omitempty"`
+	LockID           uuid.UUID
+	LockName         string
+	HostID           uuid.UUID
+	PackageName      string
+	InstalledVersion string // empty if the package is missing
+	Expected         string // the violated constraint
+	Reason           string // "missing" or "version"
+	DetectionTime    time.Time
+}
+
+// Baseline is the system definition (packagelock.sys.yaml) a host is expected to match.
+type Baseline struct {
+	ID           string `json:"id,omitempty"`
+	HostID       uuid.UUID
+	Definition   string // YAML as uploaded
+	CreationTime time.Time
+	UpdateTime   time.Time
+}
+
+// Drift_Event is a difference between the declared and the observed state of a host.
+// It stays open until the difference disappears and is then marked as resolved.
+type Drift_Event struct {
+	ID         string `json:"id,omitempty"`
+	DriftID    uuid.UUID
+	HostID     uuid.UUID
+	Source     string // baseline or lock:<LockID>
+	Kind       string // package, repo, service or package-manager
+	Type       string // missing, unexpected or changed
+	Name       string
+	Expected   string
+	Observed   string
+	FirstSeen  time.Time
+	LastSeen   time.Time
+	ResolvedAt *time.Time
+}
+
+// Job is an operation the server asks an agent to run, e.g. updating a package.
+type Job struct {
+	ID             string `json:"id,omitempty"`
+	JobID          uuid.UUID
+	AgentID        uuid.UUID
+	HostID         uuid.UUID
+	Type           string // install, update, remove, upgrade-all or refresh-inventory
+	Spec           Job_Spec
+	State          string     // queued, claimed, running, succeeded, failed or timed_out
+	TimeoutSeconds int        // counted from the claim
+	NotAfter       *time.Time // jobs not claimed until then time out, e.g. at the end of a maintenance window
+	Stdout         string
+	Stderr         string
+	ExitCode       *int
+	Error          string
+	CreationTime   time.Time
+	ClaimTime      *time.Time
+	StartTime      *time.Time
+	FinishTime     *time.Time
+	UpdateTime     time.Time
+}
+
+type Job_Spec struct {
+	Packages []Job_Package // packages to install, update or remove
+}
+
+type Job_Package struct {
+	PackageName string
+	Version     string // optional, e.g. the version pinned by a lock
+}
+
+// Sync_Request is a forced inventory refresh of a set of agents.
+type Sync_Request struct {
+	ID           string `json:"id,omitempty"`
+	SyncID       uuid.UUID
+	Filter       Sync_Filter
+	Agents       []Sync_Agent
+	Deadline     time.Time
+	CreationTime time.Time
+}
+
+// Sync_Filter selects the agents of a sync. Empty fields match everything.
+type Sync_Filter struct {
+	AgentIDs    []uuid.UUID
+	HostIDs     []uuid.UUID
+	HostGroups  []uuid.UUID // resolved into HostIDs when the sync starts
+	Distro      string
+	StaleBefore *time.Time // only hosts whose inventory is older
+}
+
+// Sync_Agent is the progress of a single agent in a sync.
+type Sync_Agent struct {
+	AgentID    uuid.UUID
+	HostID     uuid.UUID
+	Hostname   string
+	JobID      uuid.UUID
+	State      string     // state of the refresh-inventory job
+	ReportTime *time.Time // first inventory upload after the sync started
+}
+
+// Maintenance_Window is a recurring period in which hosts may be patched.
+type Maintenance_Window struct {
+	ID              string `json:"id,omitempty"`
+	WindowID        uuid.UUID
+	Name            string
+	Cron            string // start of every occurrence, e.g. "0 2 * * SAT"
+	DurationMinutes int
+	TimeZone        string // IANA name, e.g. Europe/Berlin. Defaults to UTC.
+	HostIDs         []uuid.UUID
+	HostGroups      []uuid.UUID
+	Enabled         bool
+	CreationTime    time.Time
+	UpdateTime      time.Time
+}
+
+// Campaign rolls out a job to a set of hosts, only inside a maintenance window.
+type Campaign struct {
+	ID                      string `json:"id,omitempty"`
+	CampaignID              uuid.UUID
+	Name                    string
+	WindowID                uuid.UUID
+	HostIDs                 []uuid.UUID
+	HostGroups              []uuid.UUID // resolved into HostIDs when the campaign is created
+	JobType                 string
+	Spec                    Job_Spec
+	ExpectedDurationMinutes int    // a job is only dispatched if the window stays open this long
+	State                   string // pending-approval, rejected, scheduled, running, paused, completed, aborted or cancelled
+	Waves                   []Campaign_Wave
+	CurrentWave             int     // index of the wave being rolled out
+	FailureThreshold        float64 // percentage of failed hosts in a wave which halts the campaign
+	HaltAction              string  // pause or abort
+	HealthGraceMinutes      int     // how long agents have to check in after their job finished
+	HaltReason              string
+	ApprovalID              *uuid.UUID // approval request the campaign waits for, if approvals are enabled
+	Targets                 []Campaign_Target
+	CreationTime            time.Time
+	UpdateTime              time.Time
+}
+
+// Campaign_Wave is a stage of a campaign. A wave either lists its hosts, e.g. canaries,
+// takes a percentage of all campaign hosts, or, with neither, all remaining hosts.
+type Campaign_Wave struct {
+	Name       string
+	Percent    int
+	HostIDs    []uuid.UUID
+	State      string // pending, running, verifying, passed, failed or overridden
+	Succeeded  int
+	Failed     int
+	StartTime  *time.Time
+	FinishTime *time.Time
+}
+
+type Campaign_Target struct {
+	HostID       uuid.UUID
+	AgentID      uuid.UUID
+	Wave         int
+	JobID        *uuid.UUID // set once dispatched
+	State        string     // pending until dispatched, then the job state, or skipped without an agent
+	DispatchTime *time.Time
+	FinishTime   *time.Time
+	Healthy      *bool // set once the agent checked in after its job, or failed to in time
+}
+
+// Approval_Request asks a second person to approve a change before it is applied.
+type Approval_Request struct {
+	ID                string `json:"id,omitempty"`
+	RequestID         uuid.UUID
+	Kind              string    // campaign, lock-create, lock-update or lock-delete
+	SubjectID         uuid.UUID // CampaignID or LockID, unset for new locks
+	Summary           string
+	Lock              *Lock // proposed lock of lock changes
+	RequesterID       uuid.UUID
+	Requester         string
+	RequiredGroups    []string // approvers need to be member of one of them
+	RequiredApprovals int
+	State             string // pending, approved, rejected or expired
+	Decisions         []Approval_Decision
+	ExpiresAt         time.Time
+	ApplyError        string // set if the approved change could not be applied
+	CreationTime      time.Time
+	UpdateTime        time.Time
+}
+
+type Approval_Decision struct {
+	UserID   uuid.UUID
+	Username string
+	Decision string // approve, reject or expire
+	Comment  string
+	Time     time.Time
+}
@@ -0,0 +1,309 @@
+package sysdef
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"packagelock/repos"
+	"packagelock/structs"
+	"packagelock/versions"
+)
+
+// Change actions.
+const (
+	ActionAdd    = "add"
+	ActionChange = "change"
+	ActionRemove = "remove"
+)
+
+// Change kinds.
+const (
+	KindPackageManager = "package-manager"
+	KindRepo           = "repo"
+	KindPackage        = "package"
+	KindService        = "service"
+)
+
+// Change is a single step needed to converge a host to its definition.
+type Change struct {
+	Kind    string
+	Action  string
+	Name    string
+	Current string `json:",omitempty"`
+	Desired string `json:",omitempty"`
+	Detail  string `json:",omitempty"` // e.g. upgrade or downgrade
+}
+
+// String renders the change in a plan-like notation.
+func (c Change) String() string {
+	symbol := map[string]string{ActionAdd: "+", ActionChange: "~", ActionRemove: "-"}[c.Action]
+	line := fmt.Sprintf("%s %s %s", symbol, c.Kind, c.Name)
+	switch {
+	case c.Current != "" && c.Desired != "":
+		line += fmt.Sprintf(": %s -> %s", c.Current, c.Desired)
+	case c.Desired != "":
+		line += fmt.Sprintf(": %s", c.Desired)
+	case c.Current != "":
+		line += fmt.Sprintf(": %s", c.Current)
+	}
+	if c.Detail != "" {
+		line += " (" + c.Detail + ")"
+	}
+	return line
+}
+
+// Plan returns the changes needed to bring a host with the given packages to the definition.
+// Undeclared packages and repos are only removed if the definition sets 'prune'.
+func Plan(def Definition, host structs.Host, packages []structs.Package) ([]Change, error) {
+	var changes []Change
+
+	if !strings.EqualFold(def.PackageManager, host.PackageManager.PackageManagerName) {
+		changes = append(changes, Change{
+			Kind:    KindPackageManager,
+			Action:  ActionChange,
+			Name:    def.PackageManager,
+			Current: host.PackageManager.PackageManagerName,
+			Desired: def.PackageManager,
+			Detail:  "cannot be converged automatically",
+		})
+	}
+
+	changes = append(changes, planRepos(def, host)...)
+
+	packageChanges, err := planPackages(def, packages, versions.ForPackageManagerName(def.PackageManager))
+	if err != nil {
+		return nil, err
+	}
+	changes = append(changes, packageChanges...)
+
+	changes = append(changes, planServices(def, host)...)
+	return changes, nil
+}
+
+// Summary counts the changes per action.
+func Summary(changes []Change) (add, change, remove int) {
+	for _, c := range changes {
+		switch c.Action {
+		case ActionAdd:
+			add++
+		case ActionChange:
+			change++
+		case ActionRemove:
+			remove++
+		}
+	}
+	return add, change, remove
+}
+
+func repoKey(repoType, url, suite string) string {
+	return repoType + "\x00" + strings.TrimSuffix(url, "/") + "\x00" + suite
+}
+
+func repoName(repoType, url, suite string) string {
+	name := repoType + " " + url
+	if suite != "" {
+		name += " " + suite
+	}
+	return name
+}
+
+func planRepos(def Definition, host structs.Host) []Change {
+	var changes []Change
+
+	current := map[string]structs.Package_Repo{}
+	for _, repo := range host.PackageManager.PackageRepos {
+		current[repoKey(repo.Type, repo.URL, repo.Suite)] = repo
+	}
+
+	declared := map[string]bool{}
+	for _, repo := range def.Repos {
+		key := repoKey(repo.Type, repo.URL, repo.Suite)
+		declared[key] = true
+		name := repoName(repo.Type, repo.URL, repo.Suite)
+
+		existing, ok := current[key]
+		if !ok {
+			if repo.IsEnabled() {
+				changes = append(changes, Change{Kind: KindRepo, Action: ActionAdd, Name: name})
+			}
+			continue
+		}
+
+		if existing.Enabled != repo.IsEnabled() {
+			changes = append(changes, Change{
+				Kind:    KindRepo,
+				Action:  ActionChange,
+				Name:    name,
+				Current: enabledString(existing.Enabled),
+				Desired: enabledString(repo.IsEnabled()),
+			})
+		}
+		if len(repo.Components) > 0 && !sameSet(existing.Components, repo.Components) {
+			changes = append(changes, Change{
+				Kind:    KindRepo,
+				Action:  ActionChange,
+				Name:    name,
+				Current: strings.Join(existing.Components, " "),
+				Desired: strings.Join(repo.Components, " "),
+				Detail:  "components",
+			})
+		}
+	}
+
+	if def.Prune {
+		for _, repo := range host.PackageManager.PackageRepos {
+			if !declared[repoKey(repo.Type, repo.URL, repo.Suite)] && repo.Enabled {
+				changes = append(changes, Change{Kind: KindRepo, Action: ActionRemove, Name: repoName(repo.Type, repo.URL, repo.Suite)})
+			}
+		}
+	}
+
+	return changes
+}
+
+func planPackages(def Definition, packages []structs.Package, cmp versions.Comparator) ([]Change, error) {
+	var changes []Change
+
+	installed := map[string][]structs.Package{}
+	for _, pkg := range packages {
+		installed[pkg.PackageName] = append(installed[pkg.PackageName], pkg)
+	}
+
+	repoType := repos.PackageManagerType(def.PackageManager)
+	declared := map[string]bool{}
+	for _, pkg := range def.Packages {
+		declared[pkg.Name] = true
+
+		var constraint *versions.Constraint
+		desired := pkg.Version
+		switch {
+		case pkg.Version != "":
+			parsed, err := versions.ParseConstraint("= " + pkg.Version)
+			if err != nil {
+				return nil, fmt.Errorf("package %q: %w", pkg.Name, err)
+			}
+			constraint = &parsed
+		case pkg.Constraint != "":
+			parsed, err := versions.ParseConstraint(pkg.Constraint)
+			if err != nil {
+				return nil, fmt.Errorf("package %q: %w", pkg.Name, err)
+			}
+			constraint = &parsed
+			desired = pkg.Constraint
+		}
+
+		// Declared arches may be written like the host's, e.g. x86_64 for amd64
+		arch := repos.RepoArch(repoType, pkg.Arch)
+		var candidates []structs.Package
+		for _, candidate := range installed[pkg.Name] {
+			if arch == "" || candidate.Arch == arch {
+				candidates = append(candidates, candidate)
+			}
+		}
+
+		name := pkg.Name
+		if pkg.Arch != "" {
+			name += ":" + pkg.Arch
+		}
+
+		if len(candidates) == 0 {
+			changes = append(changes, Change{Kind: KindPackage, Action: ActionAdd, Name: name, Desired: desired})
+			continue
+		}
+		if constraint == nil {
+			continue
+		}
+
+		for _, candidate := range candidates {
+			if constraint.Check(cmp, candidate.PackageVersion) {
+				continue
+			}
+			change := Change{
+				Kind:    KindPackage,
+				Action:  ActionChange,
+				Name:    name,
+				Current: candidate.PackageVersion,
+				Desired: desired,
+			}
+			if pkg.Version != "" {
+				if cmp.Compare(candidate.PackageVersion, pkg.Version) < 0 {
+					change.Detail = "upgrade"
+				} else {
+					change.Detail = "downgrade"
+				}
+			}
+			changes = append(changes, change)
+		}
+	}
+
+	if def.Prune {
+		for _, pkg := range packages {
+			if !declared[pkg.PackageName] {
+				changes = append(changes, Change{Kind: KindPackage, Action: ActionRemove, Name: pkg.PackageName, Current: pkg.PackageVersion})
+			}
+		}
+	}
+
+	sort.SliceStable(changes, func(i, j int) bool {
+		return changes[i].Name < changes[j].Name
+	})
+	return changes, nil
+}
+
+func planServices(def Definition, host structs.Host) []Change {
+	var changes []Change
+
+	current := map[string]structs.Service{}
+	for _, service := range host.Services {
+		current[service.Name] = service
+	}
+
+	for _, service := range def.Services {
+		existing, ok := current[service.Name]
+		switch {
+		case !ok && service.IsEnabled():
+			changes = append(changes, Change{
+				Kind:    KindService,
+				Action:  ActionAdd,
+				Name:    service.Name,
+				Desired: enabledString(true),
+				Detail:  "not installed",
+			})
+		case ok && existing.Enabled != service.IsEnabled():
+			changes = append(changes, Change{
+				Kind:    KindService,
+				Action:  ActionChange,
+				Name:    service.Name,
+				Current: enabledString(existing.Enabled),
+				Desired: enabledString(service.IsEnabled()),
+			})
+		}
+	}
+
+	return changes
+}
+
+func enabledString(enabled bool) string {
+	if enabled {
+		return "enabled"
+	}
+	return "disabled"
+}
+
+func sameSet(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	counts := map[string]int{}
+	for _, v := range a {
+		counts[v]++
+	}
+	for _, v := range b {
+		counts[v]--
+		if counts[v] < 0 {
+			return false
+		}
+	}
+	return true
+}
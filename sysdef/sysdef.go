@@ -0,0 +1,207 @@
+// Sysdef
+//
+// The Sysdef Package reads and writes system definition files (packagelock.sys.yaml).
+// A system definition declares the package manager, repositories, pinned packages
+// and services of a host, so a host can be rebuilt or cloned from it.
+package sysdef
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"packagelock/repos"
+	"packagelock/structs"
+
+	"gopkg.in/yaml.v3"
+)
+
+// FileName is the conventional name of a system definition file.
+const FileName = "packagelock.sys.yaml"
+
+// CurrentVersion is the format version written by Marshal.
+// Files with a newer version are rejected instead of being misread.
+const CurrentVersion = 1
+
+type Definition struct {
+	Version        int       `yaml:"version"`
+	Hostname       string    `yaml:"hostname,omitempty"`
+	Distro         string    `yaml:"distro,omitempty"`
+	Arch           string    `yaml:"arch,omitempty"`
+	PackageManager string    `yaml:"packageManager"`
+	Prune          bool      `yaml:"prune,omitempty"` // remove packages and repos which are not declared
+	Repos          []Repo    `yaml:"repos,omitempty"`
+	Packages       []Package `yaml:"packages,omitempty"`
+	Services       []Service `yaml:"services,omitempty"`
+}
+
+type Repo struct {
+	Type       string   `yaml:"type"`
+	Name       string   `yaml:"name,omitempty"`
+	URL        string   `yaml:"url"`
+	Suite      string   `yaml:"suite,omitempty"`
+	Components []string `yaml:"components,omitempty"`
+	Enabled    *bool    `yaml:"enabled,omitempty"` // defaults to true
+	GPGCheck   bool     `yaml:"gpgcheck,omitempty"`
+}
+
+// Package pins a package either to an exact version or to a constraint like ">= 1.2".
+// Without both, any installed version is accepted.
+type Package struct {
+	Name       string `yaml:"name"`
+	Version    string `yaml:"version,omitempty"`
+	Constraint string `yaml:"constraint,omitempty"`
+	Arch       string `yaml:"arch,omitempty"`
+}
+
+// Service declares that a service has to be enabled (or disabled) on boot.
+type Service struct {
+	Name    string `yaml:"name"`
+	Enabled *bool  `yaml:"enabled,omitempty"` // defaults to true
+}
+
+// IsEnabled reports whether the repo should be enabled.
+func (r Repo) IsEnabled() bool {
+	return r.Enabled == nil || *r.Enabled
+}
+
+// IsEnabled reports whether the service should be enabled.
+func (s Service) IsEnabled() bool {
+	return s.Enabled == nil || *s.Enabled
+}
+
+// Load reads and validates a system definition file.
+func Load(path string) (*Definition, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	def, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return def, nil
+}
+
+// Parse decodes and validates a system definition. Unknown keys are rejected
+// so that typos don't silently drop parts of the definition.
+func Parse(data []byte) (*Definition, error) {
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+
+	var def Definition
+	if err := decoder.Decode(&def); err != nil {
+		return nil, err
+	}
+	if err := Validate(def); err != nil {
+		return nil, err
+	}
+	return &def, nil
+}
+
+// Validate checks the version and required fields of a definition.
+func Validate(def Definition) error {
+	if def.Version < 1 || def.Version > CurrentVersion {
+		return fmt.Errorf("unsupported definition version %d, expected 1 to %d", def.Version, CurrentVersion)
+	}
+	if def.PackageManager == "" {
+		return fmt.Errorf("packageManager is required")
+	}
+
+	for _, repo := range def.Repos {
+		if repo.Type == "" || repo.URL == "" {
+			return fmt.Errorf("repo %q needs a type and a url", repo.Name)
+		}
+	}
+
+	seen := map[string]bool{}
+	for _, pkg := range def.Packages {
+		if pkg.Name == "" {
+			return fmt.Errorf("package needs a name")
+		}
+		if pkg.Version != "" && pkg.Constraint != "" {
+			return fmt.Errorf("package %q has both a version and a constraint", pkg.Name)
+		}
+		key := pkg.Name + "\x00" + pkg.Arch
+		if seen[key] {
+			return fmt.Errorf("package %q is declared twice", pkg.Name)
+		}
+		seen[key] = true
+	}
+
+	for _, service := range def.Services {
+		if service.Name == "" {
+			return fmt.Errorf("service needs a name")
+		}
+	}
+	return nil
+}
+
+// Marshal encodes a definition as YAML.
+func Marshal(def Definition) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(def); err != nil {
+		return nil, err
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// FromHost builds a definition pinning the live inventory of a host.
+// Only enabled services are declared, as the agent reports every unit it knows of.
+func FromHost(host structs.Host, packages []structs.Package) Definition {
+	def := Definition{
+		Version:        CurrentVersion,
+		Hostname:       host.Hostname,
+		Distro:         host.Distro,
+		Arch:           host.Arch,
+		PackageManager: host.PackageManager.PackageManagerName,
+	}
+
+	for _, repo := range host.PackageManager.PackageRepos {
+		enabled := repo.Enabled
+		def.Repos = append(def.Repos, Repo{
+			Type:       repo.Type,
+			Name:       repo.Name,
+			URL:        repo.URL,
+			Suite:      repo.Suite,
+			Components: repo.Components,
+			Enabled:    &enabled,
+			GPGCheck:   repo.GPGCheck,
+		})
+	}
+
+	// Packages name the arch like their package manager, e.g. amd64 instead of x86_64
+	nativeArch := repos.HostPackageArch(host)
+	for _, pkg := range packages {
+		declared := Package{Name: pkg.PackageName, Version: pkg.PackageVersion}
+		// The arch is only needed to tell multiarch installs apart
+		if pkg.Arch != "" && pkg.Arch != nativeArch && !strings.EqualFold(pkg.Arch, "all") && pkg.Arch != "noarch" {
+			declared.Arch = pkg.Arch
+		}
+		def.Packages = append(def.Packages, declared)
+	}
+	sort.Slice(def.Packages, func(i, j int) bool {
+		if def.Packages[i].Name != def.Packages[j].Name {
+			return def.Packages[i].Name < def.Packages[j].Name
+		}
+		return def.Packages[i].Arch < def.Packages[j].Arch
+	})
+
+	for _, service := range host.Services {
+		if service.Enabled {
+			def.Services = append(def.Services, Service{Name: service.Name})
+		}
+	}
+	sort.Slice(def.Services, func(i, j int) bool {
+		return def.Services[i].Name < def.Services[j].Name
+	})
+
+	return def
+}
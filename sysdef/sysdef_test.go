@@ -0,0 +1,75 @@
+package sysdef
+
+import (
+	"testing"
+
+	"packagelock/structs"
+)
+
+func TestFromHostArch(t *testing.T) {
+	host := structs.Host{
+		Arch:           "x86_64",
+		PackageManager: structs.Package_Manager{PackageManagerName: "apt"},
+	}
+	packages := []structs.Package{
+		{PackageName: "bash", PackageVersion: "5.2.15-2+b7", Arch: "amd64"},
+		{PackageName: "tzdata", PackageVersion: "2024a-0+deb12u1", Arch: "all"},
+		{PackageName: "libc6", PackageVersion: "2.36-9+deb12u7", Arch: "i386"},
+	}
+
+	def := FromHost(host, packages)
+	if def.Arch != "x86_64" {
+		t.Errorf("Arch = %q, want the host's x86_64", def.Arch)
+	}
+	want := map[string]string{"bash": "", "tzdata": "", "libc6": "i386"}
+	for _, pkg := range def.Packages {
+		if pkg.Arch != want[pkg.Name] {
+			t.Errorf("package %s: arch %q, want %q", pkg.Name, pkg.Arch, want[pkg.Name])
+		}
+	}
+
+	// Without a package manager the arch naming follows the repositories
+	host.PackageManager = structs.Package_Manager{PackageRepos: []structs.Package_Repo{{Type: "rpm"}}}
+	def = FromHost(host, []structs.Package{{PackageName: "bash", Arch: "x86_64"}})
+	if def.Packages[0].Arch != "" {
+		t.Errorf("rpm package of the host arch: arch %q, want none", def.Packages[0].Arch)
+	}
+}
+
+func TestPlanPackageArch(t *testing.T) {
+	host := structs.Host{
+		Arch:           "x86_64",
+		PackageManager: structs.Package_Manager{PackageManagerName: "apt"},
+	}
+	packages := []structs.Package{
+		{PackageName: "libc6", PackageVersion: "2.36-9+deb12u7", Arch: "amd64"},
+	}
+
+	for _, arch := range []string{"", "amd64", "x86_64"} {
+		def := Definition{
+			Version:        CurrentVersion,
+			PackageManager: "apt",
+			Packages:       []Package{{Name: "libc6", Version: "2.36-9+deb12u7", Arch: arch}},
+		}
+		changes, err := Plan(def, host, packages)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(changes) != 0 {
+			t.Errorf("libc6 declared for arch %q: changes %v, want none", arch, changes)
+		}
+	}
+
+	def := Definition{
+		Version:        CurrentVersion,
+		PackageManager: "apt",
+		Packages:       []Package{{Name: "libc6", Arch: "i386"}},
+	}
+	changes, err := Plan(def, host, packages)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 1 || changes[0].Action != ActionAdd || changes[0].Name != "libc6:i386" {
+		t.Errorf("libc6:i386 changes = %v, want it added", changes)
+	}
+}
@@ -0,0 +1,189 @@
+package versions
+
+import "strings"
+
+type apkComparator struct{}
+
+func (apkComparator) Name() string { return "apk" }
+
+// Token types of an apk version, in the order apk-tools prefers them.
+type apkToken int
+
+const (
+	apkTokenInvalid apkToken = iota - 1
+	apkTokenDigitOrZero
+	apkTokenDigit
+	apkTokenLetter
+	apkTokenSuffix
+	apkTokenSuffixNo
+	apkTokenRevisionNo
+	apkTokenEnd
+)
+
+var (
+	apkPreSuffixes  = []string{"alpha", "beta", "pre", "rc"}
+	apkPostSuffixes = []string{"cvs", "svn", "git", "hg", "p"}
+)
+
+// Compare is a port of apk_version_compare (apk-tools src/version.c).
+// Versions look like 1.2.3a_rc1_p2-r4: pre-release suffixes (_alpha, _beta, _pre, _rc)
+// sort before the plain version, all other suffixes and -rN revisions after it.
+func (apkComparator) Compare(a, b string) int {
+	at, bt := apkTokenDigit, apkTokenDigit
+	av, bv := 0, 0
+
+	for at == bt && at != apkTokenEnd && at != apkTokenInvalid && av == bv {
+		av = apkGetToken(&at, &a)
+		bv = apkGetToken(&bt, &b)
+	}
+
+	// The value of this token differs
+	if av < bv {
+		return -1
+	}
+	if av > bv {
+		return 1
+	}
+
+	// Both are at their end or invalid
+	if at == bt {
+		return 0
+	}
+
+	// The longer version is newer, unless it continues with a pre-release suffix
+	if at == apkTokenSuffix && apkGetToken(&at, &a) < 0 {
+		return -1
+	}
+	if bt == apkTokenSuffix && apkGetToken(&bt, &b) < 0 {
+		return 1
+	}
+
+	// Prefer the version continuing with the smaller token type
+	if at > bt {
+		return -1
+	}
+	if bt > at {
+		return 1
+	}
+	return 0
+}
+
+// apkGetToken returns the value of the current token of s and
+// advances s and t to the next token.
+func apkGetToken(t *apkToken, s *string) int {
+	str := *s
+	if str == "" {
+		*t = apkTokenEnd
+		return 0
+	}
+
+	value, i := 0, 0
+	next := apkTokenInvalid
+
+	switch *t {
+	case apkTokenDigitOrZero:
+		// Leading zeros are compared like decimal fractions: 1.01 < 1.1
+		if str[0] == '0' {
+			for i < len(str) && str[i] == '0' {
+				i++
+			}
+			if i < len(str) && isDigit(str[i]) {
+				next = apkTokenDigit
+			} else {
+				// A plain zero component, whatever follows is detected as usual
+				*t = apkTokenDigit
+			}
+			value = -i
+			break
+		}
+		fallthrough
+	case apkTokenDigit, apkTokenSuffixNo, apkTokenRevisionNo:
+		for i < len(str) && isDigit(str[i]) && i < 18 {
+			value = value*10 + int(str[i]-'0')
+			i++
+		}
+		// Absurdly long numbers are cut off instead of overflowing
+		for i < len(str) && isDigit(str[i]) {
+			i++
+		}
+	case apkTokenLetter:
+		value = int(str[0])
+		i++
+	case apkTokenSuffix:
+		found := false
+		for idx, suffix := range apkPreSuffixes {
+			if strings.HasPrefix(str, suffix) {
+				value, i, found = idx-len(apkPreSuffixes), len(suffix), true
+				break
+			}
+		}
+		if !found {
+			for idx, suffix := range apkPostSuffixes {
+				if strings.HasPrefix(str, suffix) {
+					value, i, found = idx, len(suffix), true
+					break
+				}
+			}
+		}
+		if !found {
+			*t = apkTokenInvalid
+			return -1
+		}
+	default:
+		*t = apkTokenInvalid
+		return -1
+	}
+
+	*s = str[i:]
+	switch {
+	case *s == "":
+		*t = apkTokenEnd
+	case next != apkTokenInvalid:
+		*t = next
+	default:
+		apkNextToken(t, s)
+	}
+	return value
+}
+
+// apkNextToken determines the type of the token at the start of s.
+func apkNextToken(t *apkToken, s *string) {
+	str := *s
+	next := apkTokenInvalid
+
+	switch {
+	case str == "":
+		next = apkTokenEnd
+	case (*t == apkTokenDigit || *t == apkTokenDigitOrZero) && str[0] >= 'a' && str[0] <= 'z':
+		next = apkTokenLetter
+	case *t == apkTokenLetter && isDigit(str[0]):
+		next = apkTokenDigit
+	case *t == apkTokenSuffix && isDigit(str[0]):
+		next = apkTokenSuffixNo
+	default:
+		switch str[0] {
+		case '.':
+			next = apkTokenDigitOrZero
+		case '_':
+			next = apkTokenSuffix
+		case '-':
+			if len(str) > 1 && str[1] == 'r' {
+				next = apkTokenRevisionNo
+				str = str[1:]
+			}
+		}
+		str = str[1:]
+	}
+
+	// Tokens may only go back to an earlier type in a few places
+	if next < *t {
+		if !((next == apkTokenDigitOrZero && *t == apkTokenDigit) ||
+			(next == apkTokenSuffix && *t == apkTokenSuffixNo) ||
+			(next == apkTokenDigit && *t == apkTokenLetter)) {
+			next = apkTokenInvalid
+		}
+	}
+
+	*s = str
+	*t = next
+}
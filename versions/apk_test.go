@@ -0,0 +1,60 @@
+package versions
+
+import "testing"
+
+func TestAPKCompare(t *testing.T) {
+	checkCompare(t, APK, []versionCase{
+		// apk-tools test/version.data
+		{"2.34", "0.1.0_alpha", 1},
+		{"23_foo", "4_beta", 1},
+		{"1.0", "1.0bc", -1},
+		{"0.1.0_alpha", "0.1.0_alpha", 0},
+		{"0.1.0_alpha", "0.1.3_alpha", -1},
+		{"0.1.0_alpha2", "0.1.0_alpha", 1},
+		{"0.1.0_alpha", "0.1.0_beta", -1},
+		{"0.1.0_beta", "0.1.0_pre", -1},
+		{"0.1.0_pre", "0.1.0_rc", -1},
+		{"0.1.0_rc", "0.1.0", -1},
+		{"0.1.0_beta3", "0.1.0_beta2", 1},
+		{"0.1.0_rc1", "0.1.0_rc10", -1},
+		{"0.1.0", "0.1.0_p1", -1},
+		{"0.1.0_cvs1", "0.1.0_svn1", -1},
+		{"0.1.0_svn", "0.1.0_git", -1},
+		{"0.1.0_git", "0.1.0_hg", -1},
+		{"0.1.0_hg", "0.1.0_p", -1},
+		{"0.1.0_p1", "0.1.0_p2", -1},
+		{"1.0_alpha_p1", "1.0_alpha", 1},
+		{"1.0_alpha_p1", "1.0_beta", -1},
+
+		// Numbers
+		{"1.0", "1.0", 0},
+		{"1.0.1", "1.0.2", -1},
+		{"2.6.9", "2.6.18", -1},
+		{"1.0", "1.0.0", -1},
+		{"1.9", "1.10", -1},
+		{"1.01", "1.1", -1}, // leading zeros compare like fractions
+		{"1.001", "1.01", -1},
+		{"1.0.0", "1.0.0.1", -1},
+		{"20240101", "20240102", -1},
+		{"999999999999999999999", "999999999999999999999", 0},
+
+		// Letters
+		{"1.0a", "1.0a", 0},
+		{"1.0a", "1.0b", -1},
+		{"1.0", "1.0a", -1},
+		{"1.0z", "1.1", -1},
+		{"1.2a3", "1.2a10", -1},
+
+		// Revisions
+		{"1.0-r0", "1.0-r0", 0},
+		{"1.0", "1.0-r0", -1}, // any revision is newer than none
+		{"1.0", "1.0-r1", -1},
+		{"1.0-r1", "1.0-r2", -1},
+		{"1.4.3-r2", "1.4.3-r10", -1},
+		{"1.0_rc1-r5", "1.0-r0", -1},
+		{"1.0_p1-r0", "1.0-r5", 1},
+		{"3.1.4_p20240101-r1", "3.1.4_p20231231-r3", 1},
+		{"2.40.1-r0", "2.40.1-r1", -1},
+		{"3.3.0-r0", "3.1.4-r5", 1},
+	})
+}
@@ -0,0 +1,106 @@
+package versions
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Constraint is a set of version requirements like ">= 1.2, < 2.0 || = 2.1-3".
+// Comma separated clauses must all match, '||' separated groups are alternatives.
+type Constraint struct {
+	raw    string
+	groups [][]clause
+}
+
+type clause struct {
+	op      string
+	version string
+}
+
+var constraintOps = []string{">=", "<=", "!=", "==", ">", "<", "="}
+
+// ParseConstraint parses a constraint. A bare version means "= version", "*" matches everything.
+func ParseConstraint(raw string) (Constraint, error) {
+	constraint := Constraint{raw: strings.TrimSpace(raw)}
+	if constraint.raw == "" {
+		return constraint, fmt.Errorf("empty version constraint")
+	}
+
+	for _, group := range strings.Split(constraint.raw, "||") {
+		var clauses []clause
+		for _, part := range strings.Split(group, ",") {
+			part = strings.TrimSpace(part)
+			if part == "" {
+				return constraint, fmt.Errorf("empty clause in version constraint %q", raw)
+			}
+			if part == "*" {
+				clauses = append(clauses, clause{op: "*"})
+				continue
+			}
+
+			op := "="
+			for _, candidate := range constraintOps {
+				if strings.HasPrefix(part, candidate) {
+					op = candidate
+					part = strings.TrimSpace(part[len(candidate):])
+					break
+				}
+			}
+			if op == "==" {
+				op = "="
+			}
+			if part == "" || strings.ContainsAny(part, " \t") {
+				return constraint, fmt.Errorf("invalid clause in version constraint %q", raw)
+			}
+			clauses = append(clauses, clause{op: op, version: part})
+		}
+		constraint.groups = append(constraint.groups, clauses)
+	}
+
+	return constraint, nil
+}
+
+// Check reports whether version satisfies the constraint.
+func (c Constraint) Check(cmp Comparator, version string) bool {
+	for _, group := range c.groups {
+		matches := true
+		for _, cl := range group {
+			if !cl.check(cmp, version) {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			return true
+		}
+	}
+	return false
+}
+
+// String returns the constraint as it was written.
+func (c Constraint) String() string {
+	return c.raw
+}
+
+func (cl clause) check(cmp Comparator, version string) bool {
+	if cl.op == "*" {
+		return true
+	}
+
+	result := cmp.Compare(version, cl.version)
+	switch cl.op {
+	case "=":
+		return result == 0
+	case "!=":
+		return result != 0
+	case ">":
+		return result > 0
+	case ">=":
+		return result >= 0
+	case "<":
+		return result < 0
+	case "<=":
+		return result <= 0
+	}
+	return false
+}
@@ -0,0 +1,75 @@
+package versions
+
+import "testing"
+
+func TestParseConstraint(t *testing.T) {
+	valid := []string{"1.0", "= 1.0", "==1.0", ">= 1.2, < 2.0", "< 1.0 || > 2.0", "*", " != 1:1.0-1 "}
+	for _, raw := range valid {
+		if _, err := ParseConstraint(raw); err != nil {
+			t.Errorf("ParseConstraint(%q) returned error: %v", raw, err)
+		}
+	}
+
+	invalid := []string{"", "   ", ">=", ">= 1.0,", "|| 1.0", "1.0 2.0", ">= 1.0,, < 2.0"}
+	for _, raw := range invalid {
+		if _, err := ParseConstraint(raw); err == nil {
+			t.Errorf("ParseConstraint(%q) succeeded, want error", raw)
+		}
+	}
+}
+
+func TestConstraintCheck(t *testing.T) {
+	cases := []struct {
+		cmp        Comparator
+		constraint string
+		version    string
+		want       bool
+	}{
+		{Dpkg, "*", "1.0", true},
+		{Dpkg, "1.0-1", "1.0-1", true},
+		{Dpkg, "1.0-1", "1.0-2", false},
+		{Dpkg, "== 1.0-1", "0:1.0-1", true},
+		{Dpkg, "!= 1.0-1", "1.0-2", true},
+		{Dpkg, "!= 1.0-1", "1.0-1", false},
+		{Dpkg, "> 1.0", "1.0", false},
+		{Dpkg, "> 1.0", "1.0+b1", true},
+		{Dpkg, ">= 1.0", "1.0", true},
+		{Dpkg, ">= 1.0", "1.0~rc1", false},
+		{Dpkg, "< 2.0", "2.0~beta1", true},
+		{Dpkg, "<= 2.0", "2.0", true},
+		{Dpkg, "<= 2.0", "1:1.0", false},
+		{Dpkg, ">= 1.2, < 2.0", "1.10", true},
+		{Dpkg, ">= 1.2, < 2.0", "2.0", false},
+		{Dpkg, ">= 1.2, < 2.0", "1.1", false},
+		{Dpkg, "< 1.0 || >= 2.0", "0.9", true},
+		{Dpkg, "< 1.0 || >= 2.0", "2.1", true},
+		{Dpkg, "< 1.0 || >= 2.0", "1.5", false},
+		{Dpkg, ">= 1.0, < 2.0 || = 3.0-1", "3.0-1", true},
+		{RPM, ">= 1.0-2.el9", "1.0-10.el9", true},
+		{RPM, "< 1.0", "1.0~rc1", true},
+		{RPM, "= 1.0", "1.0-5.fc40", true},
+		{APK, "< 1.0", "1.0_rc1", true},
+		{APK, "> 1.0-r0", "1.0_p1-r0", true},
+		{Generic, ">= 1.9", "1.10", true},
+	}
+
+	for _, tc := range cases {
+		constraint, err := ParseConstraint(tc.constraint)
+		if err != nil {
+			t.Fatalf("ParseConstraint(%q): %v", tc.constraint, err)
+		}
+		if got := constraint.Check(tc.cmp, tc.version); got != tc.want {
+			t.Errorf("%q.Check(%s, %q) = %t, want %t", tc.constraint, tc.cmp.Name(), tc.version, got, tc.want)
+		}
+	}
+}
+
+func TestConstraintString(t *testing.T) {
+	constraint, err := ParseConstraint("  >= 1.0, < 2.0 ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := constraint.String(); got != ">= 1.0, < 2.0" {
+		t.Errorf("String() = %q, want %q", got, ">= 1.0, < 2.0")
+	}
+}
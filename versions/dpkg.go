@@ -0,0 +1,111 @@
+package versions
+
+import "strings"
+
+type dpkgComparator struct{}
+
+func (dpkgComparator) Name() string { return "dpkg" }
+
+// DpkgVersion is a Debian version split into [epoch:]upstream_version[-debian_revision].
+type DpkgVersion struct {
+	Epoch    string
+	Upstream string
+	Revision string
+}
+
+// ParseDpkg splits a Debian version into its parts.
+// The revision is everything after the last hyphen, the epoch everything before the first colon.
+func ParseDpkg(version string) DpkgVersion {
+	var parsed DpkgVersion
+	version = strings.TrimSpace(version)
+
+	if epoch, rest, found := strings.Cut(version, ":"); found {
+		parsed.Epoch = epoch
+		version = rest
+	}
+	if idx := strings.LastIndex(version, "-"); idx >= 0 {
+		parsed.Revision = version[idx+1:]
+		version = version[:idx]
+	}
+	parsed.Upstream = version
+	return parsed
+}
+
+// Compare implements dpkg's version comparison (lib/dpkg/version.c).
+func (dpkgComparator) Compare(a, b string) int {
+	va, vb := ParseDpkg(a), ParseDpkg(b)
+
+	if c := compareNumeric(va.Epoch, vb.Epoch); c != 0 {
+		return c
+	}
+	if c := dpkgVerRevCmp(va.Upstream, vb.Upstream); c != 0 {
+		return c
+	}
+	return dpkgVerRevCmp(va.Revision, vb.Revision)
+}
+
+// dpkgOrder gives the sort weight of a character in the non-digit part of a version.
+// Tildes sort before everything, even the end of the string, letters before other characters.
+func dpkgOrder(c byte) int {
+	switch {
+	case isDigit(c):
+		return 0
+	case isAlpha(c):
+		return int(c)
+	case c == '~':
+		return -1
+	case c != 0:
+		return int(c) + 256
+	}
+	return 0
+}
+
+func dpkgVerRevCmp(a, b string) int {
+	at := func(s string, i int) byte {
+		if i < len(s) {
+			return s[i]
+		}
+		return 0
+	}
+
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		firstDiff := 0
+
+		for (i < len(a) && !isDigit(a[i])) || (j < len(b) && !isDigit(b[j])) {
+			ac := dpkgOrder(at(a, i))
+			bc := dpkgOrder(at(b, j))
+			if ac != bc {
+				return sign(ac - bc)
+			}
+			i++
+			j++
+		}
+
+		for at(a, i) == '0' {
+			i++
+		}
+		for at(b, j) == '0' {
+			j++
+		}
+
+		for isDigit(at(a, i)) && isDigit(at(b, j)) {
+			if firstDiff == 0 {
+				firstDiff = int(a[i]) - int(b[j])
+			}
+			i++
+			j++
+		}
+
+		if isDigit(at(a, i)) {
+			return 1
+		}
+		if isDigit(at(b, j)) {
+			return -1
+		}
+		if firstDiff != 0 {
+			return sign(firstDiff)
+		}
+	}
+	return 0
+}
@@ -0,0 +1,100 @@
+package versions
+
+import "testing"
+
+// versionCase is a comparison of two versions, want is the result of Compare(a, b).
+type versionCase struct {
+	a, b string
+	want int
+}
+
+// checkCompare runs the cases in both directions, Compare has to be antisymmetric.
+func checkCompare(t *testing.T, cmp Comparator, cases []versionCase) {
+	t.Helper()
+	for _, tc := range cases {
+		if got := cmp.Compare(tc.a, tc.b); got != tc.want {
+			t.Errorf("%s.Compare(%q, %q) = %d, want %d", cmp.Name(), tc.a, tc.b, got, tc.want)
+		}
+		if got := cmp.Compare(tc.b, tc.a); got != -tc.want {
+			t.Errorf("%s.Compare(%q, %q) = %d, want %d", cmp.Name(), tc.b, tc.a, got, -tc.want)
+		}
+	}
+}
+
+func TestDpkgCompare(t *testing.T) {
+	checkCompare(t, Dpkg, []versionCase{
+		// lib/dpkg/t/t-version.c
+		{"0:0-0", "0:0-0", 0},
+		{"0:0-00", "0:00-0", 0},
+		{"1:2-3", "1:2-3", 0},
+		{"0:0-0", "1:0-0", -1},
+		{"0:a-0", "0:b-0", -1},
+		{"0:0-a", "0:0-b", -1},
+		{"0:1-1", "0:2-1", -1},
+		{"0:1-1", "0:1-2", -1},
+
+		// Epochs
+		{"1.0", "0:1.0", 0},
+		{"2.0", "1:1.0", -1},
+		{"1:1.0", "2:0.1", -1},
+		{"10:1.0", "9:2.0", 1},
+
+		// Upstream versions
+		{"1.0", "1.0", 0},
+		{"001", "1", 0},
+		{"1.0", "1.1", -1},
+		{"1.9", "1.10", -1},
+		{"1.0", "1.0.1", -1},
+		{"1.0", "1.0a", -1},
+		{"1.0a", "1.0b", -1},
+		{"1.0a", "1.0+", -1}, // letters sort before other characters
+		{"18446744073709551616", "18446744073709551615", 1},
+		{"0:18446744073709551616", "1:0", -1},
+
+		// Revisions, the revision is everything after the last hyphen
+		{"1.0", "1.0-0", 0},
+		{"1.0", "1.0-1", -1},
+		{"1.0-1", "1.0-2", -1},
+		{"1.0-1", "1.0-1.1", -1},
+		{"1.0-1", "1.0-1ubuntu1", -1},
+		{"1.0-1", "1.0+dfsg-1", -1},
+		{"1.2.3-a.b-c", "1.2.3-a.b-c", 0},
+		{"1.2.3-a.b-c", "1.2.3-a.b-d", -1},
+
+		// Tildes sort before everything, Debian Policy 5.6.12
+		{"1.0~~", "1.0~~a", -1},
+		{"1.0~~a", "1.0~", -1},
+		{"1.0~", "1.0", -1},
+		{"1.0~rc1", "1.0", -1},
+		{"1.0~rc1", "1.0~rc2", -1},
+		{"1.0~rc1-1", "1.0-1", -1},
+		{"1.0~beta1~git20240101", "1.0~beta1", -1},
+
+		// Stable updates and backports
+		{"1.2.3-1~bpo12+1", "1.2.3-1", -1},
+		{"1.2.3-1", "1.2.3-1+deb12u1", -1},
+		{"2.36-9+deb12u4", "2.36-9+deb12u7", -1},
+		{"1:9.18.19-1~deb12u1", "1:9.18.24-1", -1},
+		{"7.88.1-10", "7.88.1-10+deb12u5", -1},
+		{"3.0.11-1~deb12u2", "3.0.13-1~deb12u1", -1},
+	})
+}
+
+func TestParseDpkg(t *testing.T) {
+	cases := []struct {
+		version string
+		want    DpkgVersion
+	}{
+		{"1.0", DpkgVersion{Upstream: "1.0"}},
+		{"1:1.0-2", DpkgVersion{Epoch: "1", Upstream: "1.0", Revision: "2"}},
+		{"1.2.3-a.b-c", DpkgVersion{Upstream: "1.2.3-a.b", Revision: "c"}},
+		{"2:1.0:beta-1", DpkgVersion{Epoch: "2", Upstream: "1.0:beta", Revision: "1"}},
+		{" 1.0-1 ", DpkgVersion{Upstream: "1.0", Revision: "1"}},
+	}
+
+	for _, tc := range cases {
+		if got := ParseDpkg(tc.version); got != tc.want {
+			t.Errorf("ParseDpkg(%q) = %+v, want %+v", tc.version, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package versions
+
+import "strings"
+
+type genericComparator struct{}
+
+func (genericComparator) Name() string { return "generic" }
+
+// Compare orders two version strings by comparing their numeric and
+// alphabetic segments from left to right. It is used for package managers
+// without a dedicated comparator.
+func (genericComparator) Compare(a, b string) int {
+	for a != "" || b != "" {
+		segA, restA := nextSegment(a)
+		segB, restB := nextSegment(b)
+		a, b = restA, restB
+
+		numA := segA != "" && isDigit(segA[0])
+		numB := segB != "" && isDigit(segB[0])
+		switch {
+		case numA && numB:
+			if c := compareNumeric(segA, segB); c != 0 {
+				return c
+			}
+			continue
+		case numA != numB:
+			// numbers are newer than letters, any segment is newer than none
+			if segA == "" {
+				return -1
+			}
+			if segB == "" {
+				return 1
+			}
+			if numA {
+				return 1
+			}
+			return -1
+		}
+		if c := strings.Compare(segA, segB); c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+// nextSegment splits off the next run of digits or letters, skipping separators.
+func nextSegment(s string) (string, string) {
+	s = strings.TrimLeftFunc(s, func(r rune) bool {
+		return r > 0x7f || (!isDigit(byte(r)) && !isAlpha(byte(r)))
+	})
+	if s == "" {
+		return "", ""
+	}
+	digit := isDigit(s[0])
+	end := strings.IndexFunc(s, func(r rune) bool {
+		return r > 0x7f || isDigit(byte(r)) != digit || (!isDigit(byte(r)) && !isAlpha(byte(r)))
+	})
+	if end < 0 {
+		return s, ""
+	}
+	return s[:end], s[end:]
+}
@@ -0,0 +1,156 @@
+package versions
+
+import "strings"
+
+type rpmComparator struct{}
+
+func (rpmComparator) Name() string { return "rpm" }
+
+// RPMVersion is an RPM version split into [epoch:]version[-release].
+type RPMVersion struct {
+	Epoch   string
+	Version string
+	Release string
+}
+
+// ParseRPM splits an EVR string into its parts.
+func ParseRPM(evr string) RPMVersion {
+	var parsed RPMVersion
+	evr = strings.TrimSpace(evr)
+
+	if idx := strings.Index(evr, ":"); idx >= 0 && strings.Trim(evr[:idx], "0123456789") == "" {
+		parsed.Epoch = evr[:idx]
+		evr = evr[idx+1:]
+	}
+	if idx := strings.LastIndex(evr, "-"); idx >= 0 {
+		parsed.Release = evr[idx+1:]
+		evr = evr[:idx]
+	}
+	parsed.Version = evr
+	return parsed
+}
+
+// Compare compares two EVR strings like rpm does (rpmVersionCompare).
+// A missing epoch counts as 0, a missing release matches any release.
+func (rpmComparator) Compare(a, b string) int {
+	va, vb := ParseRPM(a), ParseRPM(b)
+
+	if c := compareNumeric(va.Epoch, vb.Epoch); c != 0 {
+		return c
+	}
+	if c := RPMVerCmp(va.Version, vb.Version); c != 0 {
+		return c
+	}
+	if va.Release == "" || vb.Release == "" {
+		return 0
+	}
+	return RPMVerCmp(va.Release, vb.Release)
+}
+
+// RPMVerCmp is a port of rpmvercmp (rpmio/rpmvercmp.c) including '~' and '^' handling.
+func RPMVerCmp(a, b string) int {
+	if a == b {
+		return 0
+	}
+
+	at := func(s string, i int) byte {
+		if i < len(s) {
+			return s[i]
+		}
+		return 0
+	}
+	isAlnum := func(c byte) bool { return isDigit(c) || isAlpha(c) }
+
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		for i < len(a) && !isAlnum(a[i]) && a[i] != '~' && a[i] != '^' {
+			i++
+		}
+		for j < len(b) && !isAlnum(b[j]) && b[j] != '~' && b[j] != '^' {
+			j++
+		}
+
+		// Tilde sorts before everything else
+		if at(a, i) == '~' || at(b, j) == '~' {
+			if at(a, i) != '~' {
+				return 1
+			}
+			if at(b, j) != '~' {
+				return -1
+			}
+			i++
+			j++
+			continue
+		}
+
+		// Caret sorts after the end of the string, but before everything else
+		if at(a, i) == '^' || at(b, j) == '^' {
+			if i >= len(a) {
+				return -1
+			}
+			if j >= len(b) {
+				return 1
+			}
+			if a[i] != '^' {
+				return 1
+			}
+			if b[j] != '^' {
+				return -1
+			}
+			i++
+			j++
+			continue
+		}
+
+		if i >= len(a) || j >= len(b) {
+			break
+		}
+
+		// Grab the next segment of the same type from both strings
+		startA, startB := i, j
+		isNum := isDigit(a[i])
+		if isNum {
+			for i < len(a) && isDigit(a[i]) {
+				i++
+			}
+			for j < len(b) && isDigit(b[j]) {
+				j++
+			}
+		} else {
+			for i < len(a) && isAlpha(a[i]) {
+				i++
+			}
+			for j < len(b) && isAlpha(b[j]) {
+				j++
+			}
+		}
+
+		// Segments of different types: numeric is newer than alpha
+		if startB == j {
+			if isNum {
+				return 1
+			}
+			return -1
+		}
+
+		segA, segB := a[startA:i], b[startB:j]
+		var c int
+		if isNum {
+			c = compareNumeric(segA, segB)
+		} else {
+			c = sign(strings.Compare(segA, segB))
+		}
+		if c != 0 {
+			return c
+		}
+	}
+
+	if i >= len(a) && j >= len(b) {
+		return 0
+	}
+	// Whichever version still has characters left is newer
+	if i < len(a) {
+		return 1
+	}
+	return -1
+}
@@ -0,0 +1,133 @@
+package versions
+
+import "testing"
+
+// rpmVerCmpCases are the cases of rpm's tests/rpmvercmp.at.
+var rpmVerCmpCases = []versionCase{
+	{"1.0", "1.0", 0},
+	{"1.0", "2.0", -1},
+	{"2.0.1", "2.0.1", 0},
+	{"2.0", "2.0.1", -1},
+	{"2.0.1a", "2.0.1a", 0},
+	{"2.0.1a", "2.0.1", 1},
+	{"5.5p1", "5.5p1", 0},
+	{"5.5p1", "5.5p2", -1},
+	{"5.5p10", "5.5p10", 0},
+	{"5.5p1", "5.5p10", -1},
+	{"10xyz", "10.1xyz", -1},
+	{"xyz10", "xyz10", 0},
+	{"xyz10", "xyz10.1", -1},
+	{"xyz.4", "xyz.4", 0},
+	{"xyz.4", "8", -1},
+	{"xyz.4", "2", -1},
+	{"5.5p2", "5.6p1", -1},
+	{"5.6p1", "6.5p1", -1},
+	{"6.0.rc1", "6.0", 1},
+	{"10b2", "10a1", 1},
+	{"10a2", "10b2", -1},
+	{"1.0aa", "1.0aa", 0},
+	{"1.0a", "1.0aa", -1},
+	{"10.0001", "10.0001", 0},
+	{"10.0001", "10.1", 0},
+	{"10.0001", "10.0039", -1},
+	{"4.999.9", "5.0", -1},
+	{"20101121", "20101121", 0},
+	{"20101121", "20101122", -1},
+	{"2_0", "2_0", 0},
+	{"2.0", "2_0", 0},
+
+	// RhBug:178798, separators are all equal
+	{"a", "a", 0},
+	{"a+", "a+", 0},
+	{"a+", "a_", 0},
+	{"+a", "+a", 0},
+	{"+a", "_a", 0},
+	{"+_", "+_", 0},
+	{"_+", "+_", 0},
+	{"_+", "_", 0},
+	{"+", "_", 0},
+
+	// Tilde sorting
+	{"1.0~rc1", "1.0~rc1", 0},
+	{"1.0~rc1", "1.0", -1},
+	{"1.0~rc1", "1.0~rc2", -1},
+	{"1.0~rc1~git123", "1.0~rc1~git123", 0},
+	{"1.0~rc1~git123", "1.0~rc1", -1},
+
+	// Caret sorting
+	{"1.0^", "1.0^", 0},
+	{"1.0^", "1.0", 1},
+	{"1.0^git1", "1.0^git1", 0},
+	{"1.0^git1", "1.0", 1},
+	{"1.0^git1", "1.0^git2", -1},
+	{"1.0^git1", "1.01", -1},
+	{"1.0^20160101", "1.0^20160101", 0},
+	{"1.0^20160101", "1.0.1", -1},
+	{"1.0^20160101^git1", "1.0^20160101^git1", 0},
+	{"1.0^20160102", "1.0^20160101^git1", 1},
+
+	// Tilde and caret sorting
+	{"1.0~rc1^git1", "1.0~rc1^git1", 0},
+	{"1.0~rc1^git1", "1.0~rc1", 1},
+	{"1.0^git1~pre", "1.0^git1~pre", 0},
+	{"1.0^git1", "1.0^git1~pre", 1},
+
+	// Oddities documented by rpm, RhBug:811992
+	{"1b.fc17", "1b.fc17", 0},
+	{"1b.fc17", "1.fc17", -1},
+	{"1g.fc17", "1g.fc17", 0},
+	{"1g.fc17", "1.fc17", 1},
+
+	// Non-ASCII characters are separators, so these are all equal
+	{"1.1.α", "1.1.α", 0},
+	{"1.1.α", "1.1.β", 0},
+	{"1.1.αα", "1.1.α", 0},
+	{"1.1.ββ", "1.1.αα", 0},
+}
+
+func TestRPMVerCmp(t *testing.T) {
+	for _, tc := range rpmVerCmpCases {
+		if got := RPMVerCmp(tc.a, tc.b); got != tc.want {
+			t.Errorf("RPMVerCmp(%q, %q) = %d, want %d", tc.a, tc.b, got, tc.want)
+		}
+		if got := RPMVerCmp(tc.b, tc.a); got != -tc.want {
+			t.Errorf("RPMVerCmp(%q, %q) = %d, want %d", tc.b, tc.a, got, -tc.want)
+		}
+	}
+}
+
+func TestRPMCompare(t *testing.T) {
+	checkCompare(t, RPM, []versionCase{
+		{"1.0-1", "1.0-1", 0},
+		{"0:1.0-1", "1.0-1", 0},
+		{"1:1.0-1", "2.0-1", 1},
+		{"1.0-1.el9", "1.0-2.el9", -1},
+		{"1.0-1.el9", "1.0-1.el9_3", -1},
+		{"5.14.0-362.8.1.el9_3", "5.14.0-362.13.1.el9_3", -1},
+		{"3.0.7-24.el9", "3.0.7-25.el9", -1},
+		{"1.0~rc1-1", "1.0-1", -1},
+		{"1.0-1", "1.0^git1-1", -1},
+
+		// A missing release matches every release
+		{"1.0", "1.0-5.fc40", 0},
+		{"1.0", "1.1-1", -1},
+	})
+}
+
+func TestParseRPM(t *testing.T) {
+	cases := []struct {
+		evr  string
+		want RPMVersion
+	}{
+		{"1.0", RPMVersion{Version: "1.0"}},
+		{"1.0-1.el9", RPMVersion{Version: "1.0", Release: "1.el9"}},
+		{"2:1.0-1", RPMVersion{Epoch: "2", Version: "1.0", Release: "1"}},
+		{"a:1.0", RPMVersion{Version: "a:1.0"}},
+	}
+
+	for _, tc := range cases {
+		if got := ParseRPM(tc.evr); got != tc.want {
+			t.Errorf("ParseRPM(%q) = %+v, want %+v", tc.evr, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+// Versions
+//
+// The Versions Package orders package versions the way the
+// respective package manager does. Comparing version strings in
+// any other way gets epochs, tildes and pre-release suffixes wrong.
+package versions
+
+import (
+	"strings"
+
+	"packagelock/structs"
+)
+
+// Comparator orders the version strings of one packaging ecosystem.
+type Comparator interface {
+	// Compare returns -1 if a is older than b, 1 if a is newer than b and 0 if they are equal.
+	Compare(a, b string) int
+	// Name returns the name of the versioning scheme, e.g. "dpkg".
+	Name() string
+}
+
+// Comparators for the supported ecosystems.
+var (
+	Dpkg    Comparator = dpkgComparator{}
+	RPM     Comparator = rpmComparator{}
+	APK     Comparator = apkComparator{}
+	Generic Comparator = genericComparator{}
+)
+
+// ForPackageManager returns the comparator used by a package manager.
+// Unknown package managers get the Generic comparator.
+func ForPackageManager(packageManager structs.Package_Manager) Comparator {
+	return ForPackageManagerName(packageManager.PackageManagerName)
+}
+
+// ForPackageManagerName returns the comparator for a package manager by its name, e.g. "apt" or "dnf".
+func ForPackageManagerName(name string) Comparator {
+	switch strings.ToLower(name) {
+	case "apt", "apt-get", "aptitude", "dpkg":
+		return Dpkg
+	case "dnf", "yum", "rpm", "zypper", "tdnf", "microdnf":
+		return RPM
+	case "pacman":
+		// libalpm's vercmp is rpmvercmp on [epoch:]version[-release]
+		return RPM
+	case "apk":
+		return APK
+	default:
+		return Generic
+	}
+}
+
+// ForRepoType returns the comparator for a structs.Package_Repo type.
+func ForRepoType(repoType string) Comparator {
+	switch repoType {
+	case "deb", "deb-src":
+		return Dpkg
+	case "rpm", "pacman":
+		return RPM
+	case "apk":
+		return APK
+	default:
+		return Generic
+	}
+}
+
+// ForDistro returns the comparator for a distribution name as found in structs.Host.Distro.
+func ForDistro(distro string) Comparator {
+	switch d := strings.ToLower(distro); {
+	case strings.Contains(d, "debian"), strings.Contains(d, "ubuntu"), strings.Contains(d, "mint"):
+		return Dpkg
+	case strings.Contains(d, "alpine"):
+		return APK
+	case strings.Contains(d, "rocky"), strings.Contains(d, "alma"), strings.Contains(d, "centos"),
+		strings.Contains(d, "rhel"), strings.Contains(d, "red hat"), strings.Contains(d, "fedora"),
+		strings.Contains(d, "suse"), strings.Contains(d, "arch"):
+		return RPM
+	default:
+		return Generic
+	}
+}
+
+// ForHost returns the comparator for a host, preferring its package manager over its distro.
+func ForHost(host structs.Host) Comparator {
+	if cmp := ForPackageManager(host.PackageManager); cmp != Generic {
+		return cmp
+	}
+	return ForDistro(host.Distro)
+}
+
+// Newest returns the newest of the given versions, or "" if there are none.
+func Newest(cmp Comparator, versions ...string) string {
+	newest := ""
+	for _, version := range versions {
+		if newest == "" || cmp.Compare(version, newest) > 0 {
+			newest = version
+		}
+	}
+	return newest
+}
+
+func sign(i int) int {
+	switch {
+	case i < 0:
+		return -1
+	case i > 0:
+		return 1
+	}
+	return 0
+}
+
+// compareNumeric compares two strings of digits by their numeric value, without overflowing.
+func compareNumeric(a, b string) int {
+	a = strings.TrimLeft(a, "0")
+	b = strings.TrimLeft(b, "0")
+	if len(a) != len(b) {
+		return sign(len(a) - len(b))
+	}
+	return strings.Compare(a, b)
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isAlpha(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}